@@ -3,9 +3,13 @@ package main
 import (
 	"better-uptime/cmd/redis"
 	"better-uptime/common/kafka"
+	"better-uptime/common/stripe"
+	"better-uptime/common/waitingroom"
 	"better-uptime/config"
 	"better-uptime/internal/api"
+	"better-uptime/internal/api/booking"
 	db "better-uptime/internal/db/sqlc"
+	"better-uptime/internal/worker"
 	"context"
 	"fmt"
 	"log"
@@ -20,20 +24,31 @@ func main() {
 	if cfg.POSTGRES_CONNECTION == "" {
 		log.Fatal("POSTGRES_CONNECTION is empty! Check your .env")
 	}
+	if err := waitingroom.CheckSecret(cfg.WAITING_ROOM_SECRET); err != nil {
+		log.Fatal(err)
+	}
 	fmt.Println("Connecting to DB:", cfg.POSTGRES_CONNECTION)
 
 	rdb := redis.RedisConnect(cfg.REDIS_DB_URL, cfg.REDIS_PASSWORD)
 
 	defer rdb.Close()
 
-	kafkaProducer, err := kafka.NewSaramaProducer(
-		[]string{"localhost:9092"},
-	)
+	transport, err := kafka.NewTransport(cfg.KAFKA_DRIVER, cfg.KAFKA_BROKERS)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	kafkaProducer, err := transport.Producer()
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer kafkaProducer.Close()
 
+	payments, err := stripe.NewPaymentGateway(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	// Connect to DB
 	pool, err := pgxpool.New(context.Background(), cfg.POSTGRES_CONNECTION)
 	if err != nil {
@@ -44,35 +59,23 @@ func main() {
 	// Create store
 	store := db.NewStore(pool)
 
-	// consumerHandler := &booking.ConsumerHandler{
-	// 	store: store,
-	// }
-
-	// brokers := []string{"localhost:9092"}
-
-	// // ✅ Tatkal consumer
-	// tatkalConsumer, _ := kafka.NewSaramaConsumer(
-	// 	"tatkal-consumer",
-	// 	brokers,
-	// 	"booking-group",
-	// 	"tatkal_booking",
-	// 	consumerHandler,
-	// )
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-	// //  Seat upgradation consumer
-	// seatConsumer, _ := kafka.NewSaramaConsumer(
-	// 	"seat-consumer",
-	// 	brokers,
-	// 	"booking-group",
-	// 	"seat_upgradation",
-	// 	consumerHandler,
-	// )
-
-	// go tatkalConsumer.Start(ctx)
-	// go seatConsumer.Start(ctx)
+	// tatkal_booking and seat_upgradation are consumed by cmd/worker, unless
+	// the broker only lives in this process
+	if transport.InProcess() {
+		consumers, err := worker.NewBookingConsumers(cfg, transport, booking.NewHandler(cfg, store, *rdb, kafkaProducer, payments))
+		if err != nil {
+			log.Fatal(err)
+		}
+		go worker.Run(ctx, consumers)
+	}
 
 	// Start server
-	server := api.NewServer(store, cfg, *rdb, kafkaProducer)
+	server := api.NewServer(store, cfg, *rdb, kafkaProducer, payments)
+	server.StartBackgroundJobs(ctx)
+
 	fmt.Printf("Server running on port %s\n", cfg.PORT)
 	if err := server.Start(); err != nil {
 		log.Fatalf("Server failed: %v", err)
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"better-uptime/cmd/redis"
+	"better-uptime/common/kafka"
+	"better-uptime/common/logger"
+	"better-uptime/common/stripe"
+	"better-uptime/config"
+	"better-uptime/internal/api/booking"
+	db "better-uptime/internal/db/sqlc"
+	"better-uptime/internal/worker"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// The worker runs the Kafka consumers of the booking flow, separately from the
+// API so a consumer backlog does not slow down HTTP requests.
+func main() {
+	cfg := config.LoadConfig()
+
+	if cfg.POSTGRES_CONNECTION == "" {
+		log.Fatal("POSTGRES_CONNECTION is empty! Check your .env")
+	}
+
+	transport, err := kafka.NewTransport(cfg.KAFKA_DRIVER, cfg.KAFKA_BROKERS)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if transport.InProcess() {
+		log.Fatalf("KAFKA_DRIVER=%s runs the consumers inside cmd/api, the worker is not needed", cfg.KAFKA_DRIVER)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	rdb := redis.RedisConnect(cfg.REDIS_DB_URL, cfg.REDIS_PASSWORD)
+	if rdb == nil {
+		log.Fatal("Cannot connect to Redis")
+	}
+	defer rdb.Close()
+
+	kafkaProducer, err := transport.Producer()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer kafkaProducer.Close()
+
+	payments, err := stripe.NewPaymentGateway(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	pool, err := pgxpool.New(ctx, cfg.POSTGRES_CONNECTION)
+	if err != nil {
+		log.Fatalf("Cannot connect to DB: %v", err)
+	}
+	defer pool.Close()
+
+	store := db.NewStore(pool)
+	bookingHandler := booking.NewHandler(cfg, store, *rdb, kafkaProducer, payments)
+
+	consumers, err := worker.NewBookingConsumers(cfg, transport, bookingHandler)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	healthServer := &http.Server{
+		Addr:    fmt.Sprintf(":%s", cfg.WORKER_PORT),
+		Handler: worker.HealthRoutes(consumers),
+	}
+	go func() {
+		fmt.Println("Worker health running on", healthServer.Addr)
+		if err := healthServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("health server failed: %v", err)
+		}
+	}()
+
+	worker.Run(ctx, consumers)
+	logger.Info("worker stopped")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	healthServer.Shutdown(shutdownCtx)
+}
@@ -5,4 +5,5 @@ import "context"
 type Consumer interface {
 	Start(ctx context.Context) error
 	Close() error
+	Health() ConsumerHealth
 }
@@ -0,0 +1,34 @@
+package kafka
+
+import "time"
+
+// DeadLetter wraps a message a consumer gave up on. The original payload is
+// kept untouched so the message can be replayed onto its topic later.
+type DeadLetter struct {
+	Topic     string    `json:"topic"`
+	Partition int32     `json:"partition"`
+	Offset    int64     `json:"offset"`
+	Key       string    `json:"key,omitempty"`
+	Payload   string    `json:"payload"`
+	Error     string    `json:"error"`
+	Retryable bool      `json:"retryable"`
+	Attempts  int       `json:"attempts"`
+	FailedAt  time.Time `json:"failed_at"`
+}
+
+// RetryPolicy is an exponential backoff bounded both in attempts and in the
+// longest single wait.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// Backoff returns how long to wait after the given (1 based) failed attempt.
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	delay := p.BaseDelay << (attempt - 1)
+	if delay <= 0 || delay > p.MaxDelay {
+		return p.MaxDelay
+	}
+	return delay
+}
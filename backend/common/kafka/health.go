@@ -0,0 +1,79 @@
+package kafka
+
+import (
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// ConsumerHealth is a point-in-time view of a consumer, reported by the
+// worker's health endpoint.
+type ConsumerHealth struct {
+	Name      string    `json:"name"`
+	Topic     string    `json:"topic"`
+	Status    string    `json:"status"`
+	LastError string    `json:"last_error,omitempty"`
+	Since     time.Time `json:"since"`
+}
+
+const (
+	StatusStarting    = "STARTING"
+	StatusConsuming   = "CONSUMING"
+	StatusRebalancing = "REBALANCING"
+	StatusFailing     = "FAILING"
+	StatusStopped     = "STOPPED"
+)
+
+type healthTracker struct {
+	mu     sync.Mutex
+	health ConsumerHealth
+}
+
+func newHealthTracker(name, topic string) healthTracker {
+	return healthTracker{
+		health: ConsumerHealth{
+			Name:   name,
+			Topic:  topic,
+			Status: StatusStarting,
+			Since:  time.Now(),
+		},
+	}
+}
+
+// Health reports whether the consumer currently holds a group session.
+func (t *healthTracker) Health() ConsumerHealth {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.health
+}
+
+func (t *healthTracker) setStatus(status string, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.health.Status != status {
+		t.health.Since = time.Now()
+	}
+	t.health.Status = status
+	if err != nil {
+		t.health.LastError = err.Error()
+	}
+}
+
+// trackedHandler records session setup and teardown so a consumer stuck
+// outside a session shows up in its health.
+type trackedHandler struct {
+	sarama.ConsumerGroupHandler
+	tracker *healthTracker
+}
+
+func (t *trackedHandler) Setup(session sarama.ConsumerGroupSession) error {
+	t.tracker.setStatus(StatusConsuming, nil)
+	return t.ConsumerGroupHandler.Setup(session)
+}
+
+func (t *trackedHandler) Cleanup(session sarama.ConsumerGroupSession) error {
+	t.tracker.setStatus(StatusRebalancing, nil)
+	return t.ConsumerGroupHandler.Cleanup(session)
+}
@@ -0,0 +1,423 @@
+package kafka
+
+import (
+	"better-uptime/common/logger"
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// MemoryBroker is an in-process stand-in for a Kafka cluster, for local
+// development and tests. It keeps Kafka's guarantees the booking flow relies
+// on: messages with the same key land on the same partition in order, each
+// consumer group splits a topic's partitions between its members and tracks
+// its own offsets, and anything not marked before a session ends is delivered
+// again. Messages live as long as the process, so a new group starts from the
+// oldest message rather than the newest.
+type MemoryBroker struct {
+	partitions int
+
+	mu         sync.Mutex
+	topics     map[string][][]*sarama.ConsumerMessage
+	offsets    map[string][]int64 // "group/topic" -> next offset per partition
+	groups     map[string]*memoryGroup
+	published  chan struct{} // closed and replaced on every publish
+	roundRobin int
+	nextMember int
+}
+
+type memoryGroup struct {
+	members    []string
+	generation int32
+	changed    chan struct{} // closed and replaced when members join or leave
+}
+
+func NewMemoryBroker(partitions int) *MemoryBroker {
+	if partitions < 1 {
+		partitions = 1
+	}
+
+	return &MemoryBroker{
+		partitions: partitions,
+		topics:     map[string][][]*sarama.ConsumerMessage{},
+		offsets:    map[string][]int64{},
+		groups:     map[string]*memoryGroup{},
+		published:  make(chan struct{}),
+	}
+}
+
+func (b *MemoryBroker) Producer() *MemoryProducer {
+	return &MemoryProducer{broker: b}
+}
+
+func (b *MemoryBroker) NewConsumer(name string, groupId string, topic string, handler sarama.ConsumerGroupHandler) *MemoryConsumer {
+	c := &MemoryConsumer{
+		healthTracker: newHealthTracker(name, topic),
+		name:          name,
+		group:         groupId,
+		topic:         topic,
+		broker:        b,
+		closed:        make(chan struct{}),
+	}
+	c.handler = &trackedHandler{ConsumerGroupHandler: handler, tracker: &c.healthTracker}
+
+	return c
+}
+
+// topicLocked returns the partition logs of a topic, creating it on first use
+// like a broker with auto-create enabled. b.mu must be held.
+func (b *MemoryBroker) topicLocked(topic string) [][]*sarama.ConsumerMessage {
+	logs, ok := b.topics[topic]
+	if !ok {
+		logs = make([][]*sarama.ConsumerMessage, b.partitions)
+		b.topics[topic] = logs
+	}
+	return logs
+}
+
+func (b *MemoryBroker) groupLocked(groupId, topic string) *memoryGroup {
+	key := groupId + "/" + topic
+	g, ok := b.groups[key]
+	if !ok {
+		g = &memoryGroup{changed: make(chan struct{})}
+		b.groups[key] = g
+	}
+	return g
+}
+
+func (b *MemoryBroker) offsetsLocked(groupId, topic string) []int64 {
+	key := groupId + "/" + topic
+	offsets, ok := b.offsets[key]
+	if !ok {
+		offsets = make([]int64, b.partitions)
+		b.offsets[key] = offsets
+	}
+	return offsets
+}
+
+// partitionFor hashes the key like sarama's default partitioner, so all events
+// of one journey and coach stay in order. Keyless messages are spread evenly.
+func (b *MemoryBroker) partitionFor(key string) int32 {
+	if key == "" {
+		b.roundRobin++
+		return int32(b.roundRobin % b.partitions)
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int32(h.Sum32() % uint32(b.partitions))
+}
+
+func (b *MemoryBroker) publish(topic, key string, value []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	logs := b.topicLocked(topic)
+	partition := b.partitionFor(key)
+
+	msg := &sarama.ConsumerMessage{
+		Topic:     topic,
+		Partition: partition,
+		Offset:    int64(len(logs[partition])),
+		Value:     append([]byte(nil), value...),
+		Timestamp: time.Now(),
+	}
+	if key != "" {
+		msg.Key = []byte(key)
+	}
+	logs[partition] = append(logs[partition], msg)
+
+	close(b.published)
+	b.published = make(chan struct{})
+}
+
+// wait blocks until the message at offset exists or ctx is done.
+func (b *MemoryBroker) wait(ctx context.Context, topic string, partition int32, offset int64) (*sarama.ConsumerMessage, bool) {
+	for {
+		b.mu.Lock()
+		entries := b.topicLocked(topic)[partition]
+		if offset < int64(len(entries)) {
+			msg := *entries[offset]
+			b.mu.Unlock()
+			return &msg, true
+		}
+		published := b.published
+		b.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, false
+		case <-published:
+		}
+	}
+}
+
+func (b *MemoryBroker) highWaterMark(topic string, partition int32) int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return int64(len(b.topicLocked(topic)[partition]))
+}
+
+func (b *MemoryBroker) join(groupId, topic string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextMember++
+	member := fmt.Sprintf("%s-%d", groupId, b.nextMember)
+
+	g := b.groupLocked(groupId, topic)
+	g.members = append(g.members, member)
+	g.rebalance()
+
+	return member
+}
+
+func (b *MemoryBroker) leave(groupId, topic, member string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	g := b.groupLocked(groupId, topic)
+	for i, m := range g.members {
+		if m == member {
+			g.members = append(g.members[:i], g.members[i+1:]...)
+			break
+		}
+	}
+	g.rebalance()
+}
+
+func (g *memoryGroup) rebalance() {
+	g.generation++
+	close(g.changed)
+	g.changed = make(chan struct{})
+}
+
+// assignment splits the partitions round robin between the members in the
+// order they joined, and returns a channel closed on the next rebalance.
+func (b *MemoryBroker) assignment(groupId, topic, member string) (int32, []int32, <-chan struct{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	g := b.groupLocked(groupId, topic)
+
+	var partitions []int32
+	for i, m := range g.members {
+		if m != member {
+			continue
+		}
+		for p := i; p < b.partitions; p += len(g.members) {
+			partitions = append(partitions, int32(p))
+		}
+	}
+
+	return g.generation, partitions, g.changed
+}
+
+func (b *MemoryBroker) committed(groupId, topic string, partition int32) int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.offsetsLocked(groupId, topic)[partition]
+}
+
+// commit stores the next offset to read. Like Kafka, commits from a session
+// that was rebalanced away are rejected, and marking never moves backwards
+// unless it is a reset.
+func (b *MemoryBroker) commit(groupId, topic string, generation int32, partition int32, offset int64, reset bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.groupLocked(groupId, topic).generation != generation {
+		return
+	}
+
+	offsets := b.offsetsLocked(groupId, topic)
+	if reset || offset > offsets[partition] {
+		offsets[partition] = offset
+	}
+}
+
+type MemoryProducer struct {
+	broker *MemoryBroker
+}
+
+func (p *MemoryProducer) Publish(ctx context.Context, topic string, key string, value []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	p.broker.publish(topic, key, value)
+	return nil
+}
+
+func (p *MemoryProducer) Close() error {
+	return nil
+}
+
+type MemoryConsumer struct {
+	healthTracker
+
+	name    string
+	group   string
+	topic   string
+	broker  *MemoryBroker
+	handler sarama.ConsumerGroupHandler
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func (c *MemoryConsumer) Start(ctx context.Context) error {
+	logger.Info("starting consumer: %s", c.name)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-c.closed:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	member := c.broker.join(c.group, c.topic)
+	defer c.broker.leave(c.group, c.topic, member)
+
+	for {
+		if err := c.consume(ctx, member); err != nil {
+			logger.Error("consumer error: %s: %v", c.name, err)
+			c.setStatus(StatusFailing, err)
+		}
+		if ctx.Err() != nil {
+			logger.Info("stopping consumer: %s", c.name)
+			c.setStatus(StatusStopped, nil)
+			return ctx.Err()
+		}
+	}
+}
+
+// consume runs one group session. Like sarama's, it lasts until the group
+// rebalances, ctx is done or one of the claims returns.
+func (c *MemoryConsumer) consume(ctx context.Context, member string) error {
+	generation, partitions, changed := c.broker.assignment(c.group, c.topic, member)
+
+	sessionCtx, endSession := context.WithCancel(ctx)
+	defer endSession()
+
+	session := &memorySession{
+		ctx:        sessionCtx,
+		broker:     c.broker,
+		group:      c.group,
+		member:     member,
+		generation: generation,
+		claims:     map[string][]int32{c.topic: partitions},
+	}
+
+	if err := c.handler.Setup(session); err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	for _, partition := range partitions {
+		claim := &memoryClaim{
+			broker:    c.broker,
+			topic:     c.topic,
+			partition: partition,
+			initial:   c.broker.committed(c.group, c.topic, partition),
+			messages:  make(chan *sarama.ConsumerMessage),
+		}
+
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			claim.feed(sessionCtx)
+		}()
+		go func() {
+			defer wg.Done()
+			defer endSession()
+			if err := c.handler.ConsumeClaim(session, claim); err != nil {
+				logger.Error("consumer error: %s: %v", c.name, err)
+			}
+		}()
+	}
+
+	select {
+	case <-sessionCtx.Done():
+	case <-changed:
+	}
+	endSession()
+	wg.Wait()
+
+	return c.handler.Cleanup(session)
+}
+
+func (c *MemoryConsumer) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	return nil
+}
+
+type memorySession struct {
+	ctx        context.Context
+	broker     *MemoryBroker
+	group      string
+	member     string
+	generation int32
+	claims     map[string][]int32
+}
+
+func (s *memorySession) Claims() map[string][]int32 { return s.claims }
+func (s *memorySession) MemberID() string           { return s.member }
+func (s *memorySession) GenerationID() int32        { return s.generation }
+func (s *memorySession) Context() context.Context   { return s.ctx }
+
+// Commit is a no-op, marked offsets are committed right away.
+func (s *memorySession) Commit() {}
+
+func (s *memorySession) MarkOffset(topic string, partition int32, offset int64, metadata string) {
+	s.broker.commit(s.group, topic, s.generation, partition, offset, false)
+}
+
+func (s *memorySession) ResetOffset(topic string, partition int32, offset int64, metadata string) {
+	s.broker.commit(s.group, topic, s.generation, partition, offset, true)
+}
+
+func (s *memorySession) MarkMessage(msg *sarama.ConsumerMessage, metadata string) {
+	s.MarkOffset(msg.Topic, msg.Partition, msg.Offset+1, metadata)
+}
+
+type memoryClaim struct {
+	broker    *MemoryBroker
+	topic     string
+	partition int32
+	initial   int64
+	messages  chan *sarama.ConsumerMessage
+}
+
+func (c *memoryClaim) Topic() string        { return c.topic }
+func (c *memoryClaim) Partition() int32     { return c.partition }
+func (c *memoryClaim) InitialOffset() int64 { return c.initial }
+func (c *memoryClaim) HighWaterMarkOffset() int64 {
+	return c.broker.highWaterMark(c.topic, c.partition)
+}
+func (c *memoryClaim) Messages() <-chan *sarama.ConsumerMessage { return c.messages }
+
+// feed hands the partition to the claim from the committed offset on, and
+// closes Messages when the session ends.
+func (c *memoryClaim) feed(ctx context.Context) {
+	defer close(c.messages)
+
+	for offset := c.initial; ; offset++ {
+		msg, ok := c.broker.wait(ctx, c.topic, c.partition, offset)
+		if !ok {
+			return
+		}
+
+		select {
+		case c.messages <- msg:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
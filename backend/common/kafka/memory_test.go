@@ -0,0 +1,302 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+const testWait = 2 * time.Second
+
+// recordingHandler passes every message it is given to got and marks it,
+// unless fail says the message should fail the session instead.
+type recordingHandler struct {
+	got        chan *sarama.ConsumerMessage
+	fail       func(msg *sarama.ConsumerMessage) bool
+	mu         sync.Mutex
+	generation int32
+}
+
+func newRecordingHandler() *recordingHandler {
+	return &recordingHandler{got: make(chan *sarama.ConsumerMessage, 100)}
+}
+
+func (h *recordingHandler) Setup(session sarama.ConsumerGroupSession) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.generation = session.GenerationID()
+	return nil
+}
+
+func (h *recordingHandler) Cleanup(sarama.ConsumerGroupSession) error { return nil }
+
+func (h *recordingHandler) sessionGeneration() int32 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.generation
+}
+
+func (h *recordingHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for msg := range claim.Messages() {
+		if h.fail != nil && h.fail(msg) {
+			h.got <- msg
+			return errors.New("failed " + string(msg.Value))
+		}
+
+		h.got <- msg
+		session.MarkMessage(msg, "")
+	}
+	return nil
+}
+
+// receive waits for n messages.
+func (h *recordingHandler) receive(t *testing.T, n int) []*sarama.ConsumerMessage {
+	t.Helper()
+
+	var msgs []*sarama.ConsumerMessage
+	timeout := time.After(testWait)
+	for len(msgs) < n {
+		select {
+		case msg := <-h.got:
+			msgs = append(msgs, msg)
+		case <-timeout:
+			t.Fatalf("received %d of %d messages", len(msgs), n)
+		}
+	}
+	return msgs
+}
+
+// quiet fails the test when any more messages come in.
+func (h *recordingHandler) quiet(t *testing.T) {
+	t.Helper()
+
+	select {
+	case msg := <-h.got:
+		t.Fatalf("unexpected message %s", msg.Value)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// start runs a consumer until the test ends, the returned func stops it and
+// waits for it to leave its group.
+func start(t *testing.T, c *MemoryConsumer) func() {
+	t.Helper()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.Start(context.Background())
+	}()
+
+	stop := func() {
+		c.Close()
+		select {
+		case <-done:
+		case <-time.After(testWait):
+			t.Fatal("consumer did not stop")
+		}
+	}
+	t.Cleanup(func() {
+		c.Close()
+		<-done
+	})
+
+	return stop
+}
+
+func publish(t *testing.T, p *MemoryProducer, topic, key string, values ...string) {
+	t.Helper()
+
+	for _, v := range values {
+		if err := p.Publish(context.Background(), topic, key, []byte(v)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func values(msgs []*sarama.ConsumerMessage) []string {
+	out := make([]string, 0, len(msgs))
+	for _, msg := range msgs {
+		out = append(out, string(msg.Value))
+	}
+	return out
+}
+
+func TestMemoryBrokerKeepsOrderPerKey(t *testing.T) {
+	broker := NewMemoryBroker(3)
+	producer := broker.Producer()
+
+	keys := []string{"journey-1", "journey-2", "journey-3", "journey-4"}
+	for i := 0; i < 40; i++ {
+		key := keys[i%len(keys)]
+		publish(t, producer, "seats", key, fmt.Sprintf("%s/%02d", key, i))
+	}
+
+	h := newRecordingHandler()
+	start(t, broker.NewConsumer("test", "group", "seats", h))
+
+	partitions := map[string]int32{}
+	last := map[string]string{}
+	for _, msg := range h.receive(t, 40) {
+		key := string(msg.Key)
+		if !strings.HasPrefix(string(msg.Value), key+"/") {
+			t.Fatalf("message %s came with key %s", msg.Value, key)
+		}
+
+		if p, ok := partitions[key]; ok && p != msg.Partition {
+			t.Errorf("key %s on partitions %d and %d", key, p, msg.Partition)
+		}
+		partitions[key] = msg.Partition
+
+		if string(msg.Value) <= last[key] {
+			t.Errorf("key %s: %s came after %s", key, msg.Value, last[key])
+		}
+		last[key] = string(msg.Value)
+	}
+	h.quiet(t)
+}
+
+func TestMemoryConsumerGroupResumesFromCommittedOffsets(t *testing.T) {
+	broker := NewMemoryBroker(2)
+	producer := broker.Producer()
+
+	publish(t, producer, "bookings", "", "1", "2", "3", "4", "5")
+
+	first := newRecordingHandler()
+	stop := start(t, broker.NewConsumer("first", "workers", "bookings", first))
+	if got := len(first.receive(t, 5)); got != 5 {
+		t.Fatalf("got %d messages", got)
+	}
+	stop()
+
+	publish(t, producer, "bookings", "", "6", "7", "8")
+
+	// the same group carries on where it stopped
+	second := newRecordingHandler()
+	start(t, broker.NewConsumer("second", "workers", "bookings", second))
+	got := values(second.receive(t, 3))
+	for _, v := range got {
+		if v != "6" && v != "7" && v != "8" {
+			t.Errorf("group read %s again, got %v", v, got)
+		}
+	}
+	second.quiet(t)
+
+	// a new group has offsets of its own and starts from the oldest message
+	other := newRecordingHandler()
+	start(t, broker.NewConsumer("other", "auditors", "bookings", other))
+	if got := len(other.receive(t, 8)); got != 8 {
+		t.Fatalf("new group got %d messages", got)
+	}
+	other.quiet(t)
+}
+
+func TestMemoryConsumerGroupSplitsPartitions(t *testing.T) {
+	broker := NewMemoryBroker(4)
+	producer := broker.Producer()
+
+	a := newRecordingHandler()
+	b := newRecordingHandler()
+	b.got = a.got
+	start(t, broker.NewConsumer("a", "workers", "bookings", a))
+	start(t, broker.NewConsumer("b", "workers", "bookings", b))
+
+	// published once both run a session of the same generation, so nothing
+	// is delivered to a session about to be rebalanced away
+	deadline := time.Now().Add(testWait)
+	for {
+		broker.mu.Lock()
+		g := broker.groupLocked("workers", "bookings")
+		members, generation := len(g.members), g.generation
+		broker.mu.Unlock()
+
+		if members == 2 && a.sessionGeneration() == generation && b.sessionGeneration() == generation {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("consumers did not settle in the group")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	for i := 0; i < 20; i++ {
+		publish(t, producer, "bookings", fmt.Sprintf("key-%d", i), fmt.Sprint(i))
+	}
+
+	seen := map[string]int{}
+	partitions := map[int32]bool{}
+	for _, msg := range a.receive(t, 20) {
+		partitions[msg.Partition] = true
+		seen[string(msg.Value)]++
+	}
+	if len(partitions) < 2 {
+		t.Errorf("messages only came from partitions %v", partitions)
+	}
+	for i := 0; i < 20; i++ {
+		if n := seen[fmt.Sprint(i)]; n != 1 {
+			t.Errorf("message %d delivered %d times", i, n)
+		}
+	}
+	a.quiet(t)
+}
+
+func TestMemoryConsumerRedeliversUnmarkedMessages(t *testing.T) {
+	broker := NewMemoryBroker(1)
+	producer := broker.Producer()
+
+	var mu sync.Mutex
+	failed := false
+
+	h := newRecordingHandler()
+	h.fail = func(msg *sarama.ConsumerMessage) bool {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if string(msg.Value) == "boom" && !failed {
+			failed = true
+			return true
+		}
+		return false
+	}
+
+	publish(t, producer, "bookings", "pnr", "before", "boom", "after")
+	start(t, broker.NewConsumer("test", "workers", "bookings", h))
+
+	got := values(h.receive(t, 4))
+	want := []string{"before", "boom", "boom", "after"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	h.quiet(t)
+}
+
+func TestMemoryCommitFromStaleGenerationIsIgnored(t *testing.T) {
+	broker := NewMemoryBroker(1)
+
+	member := broker.join("workers", "bookings")
+	generation, _, _ := broker.assignment("workers", "bookings", member)
+	broker.join("workers", "bookings")
+
+	broker.commit("workers", "bookings", generation, 0, 5, false)
+	if got := broker.committed("workers", "bookings", 0); got != 0 {
+		t.Fatalf("stale commit moved the offset to %d", got)
+	}
+
+	generation, _, _ = broker.assignment("workers", "bookings", member)
+	broker.commit("workers", "bookings", generation, 0, 5, false)
+	broker.commit("workers", "bookings", generation, 0, 3, false)
+	if got := broker.committed("workers", "bookings", 0); got != 5 {
+		t.Fatalf("offset moved back to %d", got)
+	}
+
+	broker.commit("workers", "bookings", generation, 0, 3, true)
+	if got := broker.committed("workers", "bookings", 0); got != 3 {
+		t.Fatalf("reset left the offset at %d", got)
+	}
+}
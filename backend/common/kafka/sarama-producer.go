@@ -16,6 +16,11 @@ func NewSaramaProducer(brokerURL []string) (*SaramaProducer, error) {
 	config.Producer.Return.Successes = true
 	config.Producer.RequiredAcks = sarama.WaitForAll
 	config.Producer.Retry.Max = 5
+	// the broker drops duplicates from our own retries, so a retried send
+	// cannot publish an outbox event twice
+	config.Version = sarama.V2_1_0_0
+	config.Producer.Idempotent = true
+	config.Net.MaxOpenRequests = 1
 
 	p, err := sarama.NewSyncProducer(brokerURL, config)
 	if err != nil {
@@ -1,13 +1,15 @@
 package kafka
 
 import (
+	"better-uptime/common/logger"
 	"context"
-	"log"
 
 	"github.com/IBM/sarama"
 )
 
 type SaramaConsumer struct {
+	healthTracker
+
 	name    string
 	group   sarama.ConsumerGroup
 	topic   string
@@ -24,22 +26,27 @@ func NewSaramaConsumer(name string, brokerUrl []string, groupId string, topic st
 		return nil, err
 	}
 
-	return &SaramaConsumer{
-		name:    name,
-		group:   group,
-		topic:   topic,
-		handler: handler,
-	}, nil
+	c := &SaramaConsumer{
+		healthTracker: newHealthTracker(name, topic),
+		name:          name,
+		group:         group,
+		topic:         topic,
+	}
+	c.handler = &trackedHandler{ConsumerGroupHandler: handler, tracker: &c.healthTracker}
+
+	return c, nil
 }
 
 func (c *SaramaConsumer) Start(ctx context.Context) error {
-	log.Println("starting consumer:", c.name)
+	logger.Info("starting consumer: %s", c.name)
 	for {
 		if err := c.group.Consume(ctx, []string{c.topic}, c.handler); err != nil {
-			log.Println("consumer error:", c.name, err)
+			logger.Error("consumer error: %s: %v", c.name, err)
+			c.setStatus(StatusFailing, err)
 		}
 		if ctx.Err() != nil {
-			log.Println("stopping consumer:", c.name)
+			logger.Info("stopping consumer: %s", c.name)
+			c.setStatus(StatusStopped, nil)
 			return ctx.Err()
 		}
 	}
@@ -0,0 +1,54 @@
+package kafka
+
+import (
+	"fmt"
+
+	"github.com/IBM/sarama"
+)
+
+const (
+	DriverSarama = "sarama"
+	DriverMemory = "memory"
+)
+
+// partitions of every topic on the in-memory broker
+const memoryPartitions = 3
+
+// Transport hands out producers and consumers for the configured driver, so
+// the binaries do not care whether a Kafka cluster is behind them.
+type Transport struct {
+	driver  string
+	brokers []string
+	memory  *MemoryBroker
+}
+
+func NewTransport(driver string, brokers []string) (*Transport, error) {
+	switch driver {
+	case DriverSarama:
+		return &Transport{driver: driver, brokers: brokers}, nil
+	case DriverMemory:
+		return &Transport{driver: driver, memory: NewMemoryBroker(memoryPartitions)}, nil
+	default:
+		return nil, fmt.Errorf("unknown kafka driver %q", driver)
+	}
+}
+
+// InProcess reports whether messages only exist inside this process, in which
+// case producers and consumers have to run in the same binary.
+func (t *Transport) InProcess() bool {
+	return t.memory != nil
+}
+
+func (t *Transport) Producer() (Producer, error) {
+	if t.memory != nil {
+		return t.memory.Producer(), nil
+	}
+	return NewSaramaProducer(t.brokers)
+}
+
+func (t *Transport) Consumer(name string, groupId string, topic string, handler sarama.ConsumerGroupHandler) (Consumer, error) {
+	if t.memory != nil {
+		return t.memory.NewConsumer(name, groupId, topic, handler), nil
+	}
+	return NewSaramaConsumer(name, t.brokers, groupId, topic, handler)
+}
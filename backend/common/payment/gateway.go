@@ -0,0 +1,103 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// ErrRefundRejected wraps refund errors that will not go away by retrying, like
+// a payment that was already refunded.
+var ErrRefundRejected = errors.New("refund rejected")
+
+// PaymentGateway is everything the booking flow needs from a payment
+// provider. Amounts are in rupees; adapters convert to the provider's unit.
+type PaymentGateway interface {
+	// CreateCheckoutSession starts a hosted payment page for a booking. It is
+	// idempotent per booking and hold token, a booking promoted off the
+	// waitlist gets a new page for its new hold.
+	CreateCheckoutSession(ctx context.Context, req CheckoutRequest) (*CheckoutSession, error)
+	// Refund returns money for a completed payment, identified by the payment
+	// ID reported when the checkout completed.
+	Refund(ctx context.Context, req RefundRequest) (*Refund, error)
+	// FetchStatus looks a checkout session up at the provider, for when a
+	// webhook went missing.
+	FetchStatus(ctx context.Context, sessionId string) (Status, error)
+	// ExpireSession closes a checkout session that is still open, so it can
+	// no longer be paid. A session already paid or expired is left alone.
+	ExpireSession(ctx context.Context, sessionId string) error
+	// VerifyWebhook checks the signature of a webhook call and decodes it.
+	VerifyWebhook(payload []byte, header http.Header) (*Event, error)
+}
+
+type CheckoutRequest struct {
+	BookingID   int32
+	UserID      string
+	HoldToken   string
+	Amount      float64
+	Description string
+	ExpiresAt   time.Time
+}
+
+type CheckoutSession struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type RefundRequest struct {
+	PaymentID string
+	Amount    float64
+	// IdempotencyKey makes a retried refund return the first one instead of
+	// paying out twice
+	IdempotencyKey string
+}
+
+type Refund struct {
+	ID     string       `json:"id"`
+	Status RefundStatus `json:"status"`
+}
+
+// RefundStatus is where a refund is at the gateway. A PENDING refund is
+// settled later by a refund webhook.
+type RefundStatus string
+
+const (
+	RefundPending   RefundStatus = "PENDING"
+	RefundSucceeded RefundStatus = "SUCCEEDED"
+	RefundFailed    RefundStatus = "FAILED"
+)
+
+type Status string
+
+const (
+	StatusOpen    Status = "OPEN"
+	StatusPaid    Status = "PAID"
+	StatusFailed  Status = "FAILED"
+	StatusExpired Status = "EXPIRED"
+)
+
+type EventType string
+
+const (
+	EventCheckoutCompleted EventType = "checkout.session.completed"
+	EventCheckoutExpired   EventType = "checkout.session.expired"
+	EventPaymentFailed     EventType = "payment_intent.payment_failed"
+	EventRefundUpdated     EventType = "refund.updated"
+	EventRefundFailed      EventType = "refund.failed"
+)
+
+// Event is a webhook call reduced to what the booking flow acts on. BookingID
+// and HoldToken come from the metadata set when the session was created;
+// refund events carry RefundID and RefundStatus instead.
+type Event struct {
+	ID           string
+	Type         EventType
+	SessionID    string
+	PaymentID    string
+	BookingID    string
+	HoldToken    string
+	RefundID     string
+	RefundStatus RefundStatus
+}
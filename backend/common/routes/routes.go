@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	"better-uptime/common/util"
+	"better-uptime/common/waitingroom"
 
 	"net/http"
 
@@ -27,7 +28,7 @@ func DefaultRouter(middlewares ...func(http.Handler) http.Handler) *chi.Mux {
 		cors.Handler(cors.Options{
 			AllowedOrigins:   []string{"https://*", "http://*"},
 			AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-			AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", util.VIN_HEADER},
+			AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", util.VIN_HEADER, waitingroom.TokenHeader},
 			ExposedHeaders:   []string{"Link"},
 			AllowCredentials: true,
 			MaxAge:           300,
@@ -56,7 +57,7 @@ func loggerMiddleware(h http.Handler) http.Handler {
 				r.Method, scheme, r.Host, r.RequestURI, r.Proto,
 				ww.Status(), ww.BytesWritten(), time.Since(t1),
 			)
-			logger.Info(message)
+			logger.Info("%s", message)
 		}()
 
 		h.ServeHTTP(ww, r)
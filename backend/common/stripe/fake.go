@@ -0,0 +1,434 @@
+package stripe
+
+import (
+	"better-uptime/common/logger"
+	"better-uptime/common/payment"
+	"better-uptime/common/util"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stripe/stripe-go/v84/webhook"
+)
+
+// fakeWebhookSecret signs the fake gateway's webhooks when no
+// STRIPE_WEBHOOK_SECRET is configured.
+const fakeWebhookSecret = "whsec_fake_local"
+
+// Refunds that nobody settles by hand succeed after fakeRefundDelay. A refund
+// webhook is retried like Stripe does, since it can arrive before the refund
+// is recorded.
+const (
+	fakeRefundDelay       = 5 * time.Second
+	fakeWebhookAttempts   = 5
+	fakeWebhookRetryDelay = 2 * time.Second
+)
+
+// FakeGateway stands in for Stripe during local development. Sessions live in
+// memory and are settled from a local checkout page, which sends the same
+// signed webhooks Stripe would, so the whole booking flow runs offline.
+type FakeGateway struct {
+	baseURL       string
+	webhookURL    string
+	webhookSecret string
+	httpClient    *http.Client
+
+	mu       sync.Mutex
+	sessions map[string]*fakeSession
+	holds    map[string]string      // hold token -> session id
+	refunds  map[string]*fakeRefund // refund id -> refund
+	keys     map[string]string      // idempotency key -> refund id
+	seq      atomic.Int64
+}
+
+type fakeSession struct {
+	payment.CheckoutSession
+	BookingID int32
+	HoldToken string
+	Amount    float64
+	Status    payment.Status
+	PaymentID string
+}
+
+type fakeRefund struct {
+	payment.Refund
+	PaymentID string
+	Amount    float64
+}
+
+func NewFakeGateway(baseURL, webhookURL, webhookSecret string) *FakeGateway {
+	if webhookSecret == "" {
+		webhookSecret = fakeWebhookSecret
+	}
+
+	return &FakeGateway{
+		baseURL:       baseURL,
+		webhookURL:    webhookURL,
+		webhookSecret: webhookSecret,
+		httpClient:    &http.Client{Timeout: 10 * time.Second},
+		sessions:      map[string]*fakeSession{},
+		holds:         map[string]string{},
+		refunds:       map[string]*fakeRefund{},
+		keys:          map[string]string{},
+	}
+}
+
+func (g *FakeGateway) nextID(prefix string) string {
+	return fmt.Sprintf("%s_fake_%d_%d", prefix, time.Now().UnixNano(), g.seq.Add(1))
+}
+
+func (g *FakeGateway) CreateCheckoutSession(ctx context.Context, req payment.CheckoutRequest) (*payment.CheckoutSession, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if id, ok := g.holds[req.HoldToken]; ok {
+		s := g.sessions[id].CheckoutSession
+		return &s, nil
+	}
+
+	id := g.nextID("cs")
+	s := &fakeSession{
+		CheckoutSession: payment.CheckoutSession{
+			ID:        id,
+			URL:       fmt.Sprintf("%s/v1/fake-payment/checkout/%s", g.baseURL, id),
+			ExpiresAt: req.ExpiresAt,
+		},
+		BookingID: req.BookingID,
+		HoldToken: req.HoldToken,
+		Amount:    req.Amount,
+		Status:    payment.StatusOpen,
+	}
+	g.sessions[id] = s
+	g.holds[req.HoldToken] = id
+
+	// Stripe expires an unpaid session on its own, so does the fake
+	if !req.ExpiresAt.IsZero() {
+		time.AfterFunc(time.Until(req.ExpiresAt), func() {
+			if _, err := g.settle(context.Background(), id, payment.StatusExpired); err != nil {
+				logger.Error("fake payment expiry: %s: %v", id, err)
+			}
+		})
+	}
+
+	result := s.CheckoutSession
+	return &result, nil
+}
+
+func (g *FakeGateway) Refund(ctx context.Context, req payment.RefundRequest) (*payment.Refund, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if req.IdempotencyKey != "" {
+		if id, ok := g.keys[req.IdempotencyKey]; ok {
+			r := g.refunds[id].Refund
+			return &r, nil
+		}
+	}
+
+	id := g.nextID("re")
+	g.refunds[id] = &fakeRefund{
+		Refund:    payment.Refund{ID: id, Status: payment.RefundPending},
+		PaymentID: req.PaymentID,
+		Amount:    req.Amount,
+	}
+	if req.IdempotencyKey != "" {
+		g.keys[req.IdempotencyKey] = id
+	}
+
+	// like Stripe, the refund settles later and says so through a webhook
+	time.AfterFunc(fakeRefundDelay, func() {
+		if _, err := g.settleRefund(context.Background(), id, payment.RefundSucceeded); err != nil {
+			logger.Error("fake refund settlement: %s: %v", id, err)
+		}
+	})
+
+	return &payment.Refund{ID: id, Status: payment.RefundPending}, nil
+}
+
+func (g *FakeGateway) FetchStatus(ctx context.Context, sessionId string) (payment.Status, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	s, ok := g.sessions[sessionId]
+	if !ok {
+		return "", fmt.Errorf("session %s not found", sessionId)
+	}
+	return s.Status, nil
+}
+
+// ExpireSession expires an open session the way its checkout page does. The
+// webhook is sent in the background, as Stripe does, so a caller can expire
+// a session from inside the request that the webhook will reach.
+func (g *FakeGateway) ExpireSession(ctx context.Context, sessionId string) error {
+	g.mu.Lock()
+	_, ok := g.sessions[sessionId]
+	g.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("session %s not found", sessionId)
+	}
+
+	go func() {
+		if _, err := g.settle(context.Background(), sessionId, payment.StatusExpired); err != nil {
+			logger.Error("fake payment expiry: %s: %v", sessionId, err)
+		}
+	}()
+	return nil
+}
+
+func (g *FakeGateway) VerifyWebhook(payload []byte, header http.Header) (*payment.Event, error) {
+	return parseWebhook(payload, header, g.webhookSecret)
+}
+
+// settle moves an open session to its outcome and sends the matching webhook.
+// Settling a session that is no longer open does nothing.
+func (g *FakeGateway) settle(ctx context.Context, id string, outcome payment.Status) (*fakeSession, error) {
+	g.mu.Lock()
+	s, ok := g.sessions[id]
+	if !ok {
+		g.mu.Unlock()
+		return nil, fmt.Errorf("session %s not found", id)
+	}
+	if s.Status != payment.StatusOpen {
+		result := *s
+		g.mu.Unlock()
+		return &result, nil
+	}
+	s.Status = outcome
+	if outcome != payment.StatusExpired {
+		s.PaymentID = g.nextID("pi")
+	}
+	result := *s
+	g.mu.Unlock()
+
+	if err := g.sendWebhook(ctx, &result); err != nil {
+		return &result, err
+	}
+	return &result, nil
+}
+
+func (g *FakeGateway) sendWebhook(ctx context.Context, s *fakeSession) error {
+	metadata := map[string]string{
+		"booking_id": strconv.Itoa(int(s.BookingID)),
+		"hold_token": s.HoldToken,
+	}
+
+	var eventType payment.EventType
+	var object map[string]interface{}
+	switch s.Status {
+	case payment.StatusPaid, payment.StatusExpired:
+		eventType = payment.EventCheckoutCompleted
+		status, paymentStatus := "complete", "paid"
+		if s.Status == payment.StatusExpired {
+			eventType = payment.EventCheckoutExpired
+			status, paymentStatus = "expired", "unpaid"
+		}
+		object = map[string]interface{}{
+			"id":             s.ID,
+			"object":         "checkout.session",
+			"status":         status,
+			"payment_status": paymentStatus,
+			"amount_total":   int64(s.Amount * 100),
+			"metadata":       metadata,
+		}
+		if s.PaymentID != "" {
+			object["payment_intent"] = s.PaymentID
+		}
+	case payment.StatusFailed:
+		eventType = payment.EventPaymentFailed
+		object = map[string]interface{}{
+			"id":       s.PaymentID,
+			"object":   "payment_intent",
+			"status":   "requires_payment_method",
+			"metadata": metadata,
+		}
+	default:
+		return fmt.Errorf("no webhook for status %s", s.Status)
+	}
+
+	return g.deliver(ctx, eventType, object)
+}
+
+// settleRefund moves a pending refund to its outcome and sends the refund
+// webhook. Settling a refund that is no longer pending does nothing.
+func (g *FakeGateway) settleRefund(ctx context.Context, id string, outcome payment.RefundStatus) (*fakeRefund, error) {
+	g.mu.Lock()
+	r, ok := g.refunds[id]
+	if !ok {
+		g.mu.Unlock()
+		return nil, fmt.Errorf("refund %s not found", id)
+	}
+	if r.Status != payment.RefundPending {
+		result := *r
+		g.mu.Unlock()
+		return &result, nil
+	}
+	r.Status = outcome
+	result := *r
+	g.mu.Unlock()
+
+	eventType, status := payment.EventRefundUpdated, "succeeded"
+	if outcome == payment.RefundFailed {
+		eventType, status = payment.EventRefundFailed, "failed"
+	}
+	object := map[string]interface{}{
+		"id":             result.ID,
+		"object":         "refund",
+		"status":         status,
+		"amount":         int64(result.Amount * 100),
+		"payment_intent": result.PaymentID,
+	}
+
+	var err error
+	for attempt := 1; attempt <= fakeWebhookAttempts; attempt++ {
+		if err = g.deliver(ctx, eventType, object); err == nil {
+			return &result, nil
+		}
+		if attempt < fakeWebhookAttempts {
+			time.Sleep(fakeWebhookRetryDelay)
+		}
+	}
+	return &result, err
+}
+
+// deliver signs an event the way Stripe does and posts it to the webhook URL.
+func (g *FakeGateway) deliver(ctx context.Context, eventType payment.EventType, object map[string]interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"id":      g.nextID("evt"),
+		"object":  "event",
+		"type":    string(eventType),
+		"created": time.Now().Unix(),
+		"data":    map[string]interface{}{"object": object},
+	})
+	if err != nil {
+		return err
+	}
+
+	signed := webhook.GenerateTestSignedPayload(&webhook.UnsignedPayload{
+		Payload:   body,
+		Secret:    g.webhookSecret,
+		Timestamp: time.Now(),
+	})
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Stripe-Signature", signed.Header)
+
+	resp, err := g.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to deliver webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+var checkoutPage = template.Must(template.New("checkout").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Fake checkout</title></head>
+<body>
+<h1>Fake checkout</h1>
+<p>Booking {{.BookingID}}, amount INR {{printf "%.2f" .Amount}}, status {{.Status}}</p>
+{{if eq .Status "OPEN"}}
+<form method="post" action="{{.ID}}/succeed"><button>Pay</button></form>
+<form method="post" action="{{.ID}}/fail"><button>Fail payment</button></form>
+<form method="post" action="{{.ID}}/expire"><button>Let it expire</button></form>
+{{end}}
+</body>
+</html>
+`))
+
+// Routes serves the checkout page the session URL points to. Mounted under
+// /v1/fake-payment only when PAYMENT_GATEWAY=fake.
+func (g *FakeGateway) Routes() http.Handler {
+	r := chi.NewRouter()
+
+	r.Get("/checkout/{id}", func(w http.ResponseWriter, r *http.Request) {
+		g.mu.Lock()
+		s, ok := g.sessions[chi.URLParam(r, "id")]
+		var session fakeSession
+		if ok {
+			session = *s
+		}
+		g.mu.Unlock()
+
+		if !ok {
+			util.ErrorJson(w, fmt.Errorf("session not found"))
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		checkoutPage.Execute(w, session)
+	})
+
+	r.Post("/checkout/{id}/{outcome}", func(w http.ResponseWriter, r *http.Request) {
+		outcomes := map[string]payment.Status{
+			"succeed": payment.StatusPaid,
+			"fail":    payment.StatusFailed,
+			"expire":  payment.StatusExpired,
+		}
+		outcome, ok := outcomes[chi.URLParam(r, "outcome")]
+		if !ok {
+			util.ErrorJson(w, fmt.Errorf("outcome must be succeed, fail or expire"))
+			return
+		}
+
+		s, err := g.settle(r.Context(), chi.URLParam(r, "id"), outcome)
+		if err != nil {
+			util.ErrorJson(w, err)
+			return
+		}
+
+		util.WriteJson(w, http.StatusOK, map[string]interface{}{
+			"message": "payment settled",
+			"data": map[string]interface{}{
+				"session_id": s.ID,
+				"booking_id": s.BookingID,
+				"status":     s.Status,
+				"payment_id": s.PaymentID,
+			},
+		})
+	})
+
+	r.Post("/refunds/{id}/{outcome}", func(w http.ResponseWriter, r *http.Request) {
+		outcomes := map[string]payment.RefundStatus{
+			"succeed": payment.RefundSucceeded,
+			"fail":    payment.RefundFailed,
+		}
+		outcome, ok := outcomes[chi.URLParam(r, "outcome")]
+		if !ok {
+			util.ErrorJson(w, fmt.Errorf("outcome must be succeed or fail"))
+			return
+		}
+
+		refund, err := g.settleRefund(r.Context(), chi.URLParam(r, "id"), outcome)
+		if err != nil {
+			util.ErrorJson(w, err)
+			return
+		}
+
+		util.WriteJson(w, http.StatusOK, map[string]interface{}{
+			"message": "refund settled",
+			"data": map[string]interface{}{
+				"refund_id":  refund.ID,
+				"payment_id": refund.PaymentID,
+				"status":     refund.Status,
+			},
+		})
+	})
+
+	return r
+}
@@ -0,0 +1,265 @@
+package stripe
+
+import (
+	"better-uptime/common/payment"
+	"better-uptime/config"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stripe/stripe-go/v84"
+	"github.com/stripe/stripe-go/v84/webhook"
+)
+
+const (
+	DriverStripe = "stripe"
+	DriverFake   = "fake"
+)
+
+// Stripe refuses checkout sessions that expire sooner than this.
+const minSessionLifetime = 30 * time.Minute
+
+// NewPaymentGateway returns the gateway selected by PAYMENT_GATEWAY.
+func NewPaymentGateway(cfg *config.Config) (payment.PaymentGateway, error) {
+	switch cfg.PAYMENT_GATEWAY {
+	case DriverStripe:
+		return NewGateway(cfg.STRIPE_SECRET_KEY, cfg.STRIPE_WEBHOOK_SECRET, cfg.PAYMENT_SUCCESS_URL, cfg.PAYMENT_CANCEL_URL), nil
+	case DriverFake:
+		return NewFakeGateway(cfg.FAKE_PAYMENT_BASE_URL, cfg.FAKE_PAYMENT_WEBHOOK_URL, cfg.STRIPE_WEBHOOK_SECRET), nil
+	default:
+		return nil, fmt.Errorf("unknown payment gateway %q", cfg.PAYMENT_GATEWAY)
+	}
+}
+
+// Gateway is the Stripe adapter. It holds its own client instead of setting
+// the package wide stripe.Key, so nothing leaks between callers.
+type Gateway struct {
+	client        *stripe.Client
+	webhookSecret string
+	successURL    string
+	cancelURL     string
+}
+
+func NewGateway(secretKey, webhookSecret, successURL, cancelURL string) *Gateway {
+	return &Gateway{
+		client:        stripe.NewClient(secretKey),
+		webhookSecret: webhookSecret,
+		successURL:    successURL,
+		cancelURL:     cancelURL,
+	}
+}
+
+func ConvertTheAmount(price string, currency string) (int64, error) {
+	var amount float64
+
+	_, err := fmt.Sscanf(price, "%f", &amount)
+	if err != nil {
+		return 0, fmt.Errorf("invalid price format")
+	}
+
+	// fares carry paise, so round instead of truncating 12.29*100 to 1228
+	return int64(math.Round(amount * 100)), nil
+
+}
+
+func (g *Gateway) CreateCheckoutSession(ctx context.Context, req payment.CheckoutRequest) (*payment.CheckoutSession, error) {
+	amount, err := ConvertTheAmount(fmt.Sprintf("%.2f", req.Amount), "inr")
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert the amount %w", err)
+	}
+
+	// the hold sweeper expires the booking on time even when Stripe keeps
+	// the page open longer, and closes the page with ExpireSession
+	expiresAt := req.ExpiresAt
+	if min := time.Now().Add(minSessionLifetime); expiresAt.Before(min) {
+		expiresAt = min
+	}
+
+	// copied onto the payment intent as well, so payment_intent events can
+	// be traced back to the booking
+	metadata := map[string]string{
+		"booking_id": strconv.Itoa(int(req.BookingID)),
+		"hold_token": req.HoldToken,
+	}
+
+	params := &stripe.CheckoutSessionCreateParams{
+		Mode: stripe.String(string(stripe.CheckoutSessionModePayment)),
+		LineItems: []*stripe.CheckoutSessionCreateLineItemParams{{
+			PriceData: &stripe.CheckoutSessionCreateLineItemPriceDataParams{
+				Currency: stripe.String("inr"),
+				ProductData: &stripe.CheckoutSessionCreateLineItemPriceDataProductDataParams{
+					Name: stripe.String(req.Description),
+				},
+				UnitAmount: stripe.Int64(amount),
+			},
+			Quantity: stripe.Int64(1),
+		}},
+		AllowPromotionCodes: stripe.Bool(true),
+		SuccessURL:          stripe.String(g.successURL),
+		CancelURL:           stripe.String(g.cancelURL),
+		ExpiresAt:           stripe.Int64(expiresAt.Unix()),
+		Metadata:            metadata,
+		PaymentIntentData: &stripe.CheckoutSessionCreatePaymentIntentDataParams{
+			Metadata: metadata,
+		},
+	}
+	params.AddMetadata("api_version", "2024-05-01")
+	params.SetIdempotencyKey(fmt.Sprintf("booking_%d_%s", req.BookingID, req.HoldToken))
+
+	s, err := g.client.V1CheckoutSessions.Create(ctx, params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the session: %w", err)
+	}
+
+	return &payment.CheckoutSession{
+		ID:        s.ID,
+		URL:       s.URL,
+		ExpiresAt: time.Unix(s.ExpiresAt, 0),
+	}, nil
+}
+
+func (g *Gateway) Refund(ctx context.Context, req payment.RefundRequest) (*payment.Refund, error) {
+	amount, err := ConvertTheAmount(fmt.Sprintf("%.2f", req.Amount), "inr")
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert the amount %w", err)
+	}
+
+	params := &stripe.RefundCreateParams{
+		Amount: stripe.Int64(amount),
+	}
+	if strings.HasPrefix(req.PaymentID, "pi_") {
+		params.PaymentIntent = stripe.String(req.PaymentID)
+	} else {
+		params.Charge = stripe.String(req.PaymentID)
+	}
+	if req.IdempotencyKey != "" {
+		params.SetIdempotencyKey(req.IdempotencyKey)
+	}
+
+	result, err := g.client.V1Refunds.Create(ctx, params)
+	if err != nil {
+		// Start checking specific Stripe Error types
+		var stripeErr *stripe.Error
+		if errors.As(err, &stripeErr) {
+			switch stripeErr.Code {
+			case stripe.ErrorCodeChargeAlreadyRefunded:
+				return nil, fmt.Errorf("%w: this payment has already been refunded", payment.ErrRefundRejected)
+			case stripe.ErrorCodeAmountTooLarge:
+				return nil, fmt.Errorf("%w: refund amount exceeds the original payment", payment.ErrRefundRejected)
+			case stripe.ErrorCodeBalanceInsufficient:
+				return nil, fmt.Errorf("your Stripe balance is too low to process this refund")
+			}
+		}
+		return nil, fmt.Errorf("stripe error: %v", err.Error())
+	}
+
+	return &payment.Refund{
+		ID:     result.ID,
+		Status: refundStatus(result.Status),
+	}, nil
+}
+
+func refundStatus(status stripe.RefundStatus) payment.RefundStatus {
+	switch status {
+	case stripe.RefundStatusSucceeded:
+		return payment.RefundSucceeded
+	case stripe.RefundStatusFailed, stripe.RefundStatusCanceled:
+		return payment.RefundFailed
+	default:
+		return payment.RefundPending
+	}
+}
+
+func (g *Gateway) FetchStatus(ctx context.Context, sessionId string) (payment.Status, error) {
+	s, err := g.client.V1CheckoutSessions.Retrieve(ctx, sessionId, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch the session: %w", err)
+	}
+
+	switch {
+	case s.Status == stripe.CheckoutSessionStatusComplete && s.PaymentStatus == stripe.CheckoutSessionPaymentStatusPaid:
+		return payment.StatusPaid, nil
+	case s.Status == stripe.CheckoutSessionStatusExpired:
+		return payment.StatusExpired, nil
+	default:
+		return payment.StatusOpen, nil
+	}
+}
+
+func (g *Gateway) ExpireSession(ctx context.Context, sessionId string) error {
+	status, err := g.FetchStatus(ctx, sessionId)
+	if err != nil {
+		return err
+	}
+	if status != payment.StatusOpen {
+		return nil
+	}
+
+	if _, err := g.client.V1CheckoutSessions.Expire(ctx, sessionId, nil); err != nil {
+		return fmt.Errorf("failed to expire the session: %w", err)
+	}
+	return nil
+}
+
+func (g *Gateway) VerifyWebhook(payload []byte, header http.Header) (*payment.Event, error) {
+	return parseWebhook(payload, header, g.webhookSecret)
+}
+
+// parseWebhook checks a Stripe-Signature header and reduces the event to the
+// fields the booking flow needs. The fake gateway signs the same way.
+func parseWebhook(payload []byte, header http.Header, secret string) (*payment.Event, error) {
+	event, err := webhook.ConstructEventWithOptions(payload, header.Get("Stripe-Signature"), secret,
+		webhook.ConstructEventOptions{
+			IgnoreAPIVersionMismatch: true,
+		})
+	if err != nil {
+		return nil, fmt.Errorf("not able to create event: %w", err)
+	}
+
+	result := &payment.Event{
+		ID:   event.ID,
+		Type: payment.EventType(event.Type),
+	}
+
+	switch result.Type {
+	case payment.EventCheckoutCompleted, payment.EventCheckoutExpired:
+		var session stripe.CheckoutSession
+		if err := json.Unmarshal(event.Data.Raw, &session); err != nil {
+			return nil, fmt.Errorf("failed to parse checkout session: %w", err)
+		}
+		result.SessionID = session.ID
+		if session.PaymentIntent != nil {
+			result.PaymentID = session.PaymentIntent.ID
+		}
+		result.BookingID = session.Metadata["booking_id"]
+		result.HoldToken = session.Metadata["hold_token"]
+
+	case payment.EventPaymentFailed:
+		var intent stripe.PaymentIntent
+		if err := json.Unmarshal(event.Data.Raw, &intent); err != nil {
+			return nil, fmt.Errorf("failed to parse payment intent: %w", err)
+		}
+		result.PaymentID = intent.ID
+		result.BookingID = intent.Metadata["booking_id"]
+		result.HoldToken = intent.Metadata["hold_token"]
+
+	case payment.EventRefundUpdated, payment.EventRefundFailed:
+		var refund stripe.Refund
+		if err := json.Unmarshal(event.Data.Raw, &refund); err != nil {
+			return nil, fmt.Errorf("failed to parse refund: %w", err)
+		}
+		result.RefundID = refund.ID
+		result.RefundStatus = refundStatus(refund.Status)
+		if refund.PaymentIntent != nil {
+			result.PaymentID = refund.PaymentIntent.ID
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,23 @@
+package util
+
+import (
+	"crypto/rand"
+	"math/big"
+	"strconv"
+)
+
+const (
+	pnrLowerBound = 1_000_000_000
+	pnrRange      = 9_000_000_000
+)
+
+// GeneratePNR returns a random 10 digit PNR. It is drawn from crypto/rand so
+// PNRs can not be guessed from each other, and the first digit is never zero.
+func GeneratePNR() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(pnrRange))
+	if err != nil {
+		return "", err
+	}
+
+	return strconv.FormatInt(n.Int64()+pnrLowerBound, 10), nil
+}
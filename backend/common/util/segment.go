@@ -0,0 +1,15 @@
+package util
+
+// FullJourney is the leg mask of a booking that covers the whole route. It is
+// also the only mask a train without a route can be sold with.
+const FullJourney int64 = -1
+
+// LegMask sets one bit per leg travelled between two route stops. Leg n is the
+// one that leaves stop n, so it is stored in bit n-1.
+func LegMask(fromSequence, toSequence int32) int64 {
+	var mask int64
+	for leg := fromSequence; leg < toSequence; leg++ {
+		mask |= 1 << (leg - 1)
+	}
+	return mask
+}
@@ -0,0 +1,50 @@
+package util
+
+import "testing"
+
+func TestLegMask(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to int32
+		want     int64
+	}{
+		{"first leg", 1, 2, 0b1},
+		{"origin to third stop", 1, 3, 0b11},
+		{"middle legs", 2, 5, 0b1110},
+		{"last of five legs", 5, 6, 0b10000},
+		{"same stop", 3, 3, 0},
+		{"backwards", 4, 2, 0},
+		{"63 legs", 1, 64, 1<<63 - 1},
+		{"leg 64 is the sign bit", 64, 65, -1 << 63},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := LegMask(tt.from, tt.to); got != tt.want {
+				t.Errorf("LegMask(%d, %d) = %b, want %b", tt.from, tt.to, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLegMasksOverlapOnlyWhenSegmentsShareALeg(t *testing.T) {
+	tests := []struct {
+		a, b    [2]int32
+		overlap bool
+	}{
+		{[2]int32{1, 3}, [2]int32{3, 5}, false},
+		{[2]int32{1, 4}, [2]int32{3, 5}, true},
+		{[2]int32{2, 3}, [2]int32{1, 6}, true},
+		{[2]int32{1, 2}, [2]int32{4, 6}, false},
+	}
+
+	for _, tt := range tests {
+		got := LegMask(tt.a[0], tt.a[1])&LegMask(tt.b[0], tt.b[1]) != 0
+		if got != tt.overlap {
+			t.Errorf("%v and %v overlap: %v, want %v", tt.a, tt.b, got, tt.overlap)
+		}
+	}
+	if LegMask(1, 4)&FullJourney == 0 {
+		t.Error("a segment does not overlap the full journey")
+	}
+}
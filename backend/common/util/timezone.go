@@ -49,4 +49,12 @@ func ParseISTTime(layout, value string) (time.Time, error) {
 
 func ParseISOTime(value string) (time.Time, error) {
 	return time.Parse(time.RFC3339, value)
-} 
\ No newline at end of file
+}
+
+// AtISTClock places the IST wall-clock time of clock on the IST calendar day of
+// date. Train schedules only carry a time of day, so this is how a schedule is
+// turned into an actual departure for a journey date.
+func AtISTClock(date time.Time, clock time.Time) time.Time {
+	c := ConvertUTCToIST(clock)
+	return time.Date(date.Year(), date.Month(), date.Day(), c.Hour(), c.Minute(), c.Second(), 0, IST)
+}
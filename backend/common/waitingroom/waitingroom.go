@@ -0,0 +1,325 @@
+package waitingroom
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid queue token")
+	ErrExpiredToken = errors.New("queue token expired, join the queue again")
+	ErrNotAdmitted  = errors.New("not admitted from the waiting room yet")
+	ErrTokenUsed    = errors.New("queue token already used")
+)
+
+// TokenHeader carries the queue token of a tatkal booking request.
+const TokenHeader = "X-Queue-Token"
+
+// queues are forgotten a day after they were last touched
+const queueTTL = 24 * time.Hour
+
+// MinSecretLength is the shortest secret tokens may be signed with, the size
+// of the HMAC key.
+const MinSecretLength = sha256.Size
+
+// Ticket is what a queue token carries: the place a user was given in the
+// queue of a journey and class.
+type Ticket struct {
+	JourneyID int32  `json:"j"`
+	CoachType string `json:"c"`
+	UserID    string `json:"u"`
+	Number    int64  `json:"n"`
+	IssuedAt  int64  `json:"iat"`
+}
+
+// Status is where a ticket stands in its queue.
+type Status struct {
+	Token                string `json:"token,omitempty"`
+	Position             int64  `json:"position"`
+	Admitted             bool   `json:"admitted"`
+	EstimatedWaitSeconds int64  `json:"estimated_wait_seconds"`
+}
+
+// Room is a virtual waiting room in front of the tatkal booking path. Every
+// journey and class has its own queue in redis; users join it for a signed
+// token carrying their place, and places are admitted in order at a steady
+// rate per queue. Admission is worked out whenever a queue is read rather
+// than by a background job, so any number of replicas share one rate.
+type Room struct {
+	Redis    *redis.Client
+	secret   []byte
+	rate     int
+	tokenTTL time.Duration
+}
+
+func NewRoom(redisClient *redis.Client, secret string, admitPerSecond int, tokenTTL time.Duration) *Room {
+	return &Room{
+		Redis:    redisClient,
+		secret:   []byte(secret),
+		rate:     admitPerSecond,
+		tokenTTL: tokenTTL,
+	}
+}
+
+// CheckSecret refuses a signing secret anyone could guess. Tokens signed with
+// an empty one can be forged to skip the queue.
+func CheckSecret(secret string) error {
+	if len(secret) < MinSecretLength {
+		return fmt.Errorf("WAITING_ROOM_SECRET must be at least %d bytes, got %d", MinSecretLength, len(secret))
+	}
+	return nil
+}
+
+// advanceLua admits the places that have come due since the queue was last
+// read and, when ARGV[3] is set, gives the user a place unless they already
+// have one. Places accrue at the queue's own rate, or ARGV[2], but not while
+// everyone in the queue is already admitted, so an idle queue does not build
+// up a burst.
+//
+// KEYS[1] = queue hash (seq, admitted, at, rate)
+// KEYS[2] = the user's place in the queue
+// ARGV[1] = now in ms, ARGV[2] = default rate per second, ARGV[3] = join,
+// ARGV[4] = ttl in seconds
+// returns {place or 0, seq, admitted, rate}
+var advanceLua = `
+local now = tonumber(ARGV[1])
+local seq = tonumber(redis.call('HGET', KEYS[1], 'seq') or '0')
+local admitted = tonumber(redis.call('HGET', KEYS[1], 'admitted') or '0')
+local at = tonumber(redis.call('HGET', KEYS[1], 'at') or ARGV[1])
+local rate = tonumber(redis.call('HGET', KEYS[1], 'rate') or ARGV[2])
+
+if rate > 0 then
+  local due = math.floor((now - at) * rate / 1000)
+  if due > 0 then
+    admitted = admitted + due
+    at = at + math.floor(due * 1000 / rate)
+  end
+end
+if admitted >= seq then
+  admitted = seq
+  at = now
+end
+
+local place = tonumber(redis.call('GET', KEYS[2]) or '0')
+if ARGV[3] == '1' and place == 0 then
+  seq = seq + 1
+  place = seq
+  redis.call('SET', KEYS[2], place, 'EX', ARGV[4])
+end
+
+redis.call('HSET', KEYS[1], 'seq', seq, 'admitted', admitted, 'at', at)
+redis.call('EXPIRE', KEYS[1], ARGV[4])
+return {place, seq, admitted, rate}
+`
+
+func queueKey(journeyID int32, coachType string) string {
+	return fmt.Sprintf("waitroom:%d:%s", journeyID, coachType)
+}
+
+func placeKey(journeyID int32, coachType, userID string) string {
+	return fmt.Sprintf("waitroom:%d:%s:user:%s", journeyID, coachType, userID)
+}
+
+func usedKey(t Ticket) string {
+	return fmt.Sprintf("waitroom:%d:%s:used:%d", t.JourneyID, t.CoachType, t.Number)
+}
+
+// advance runs advanceLua and returns the user's place, if any, and how far
+// the queue has been admitted.
+func (r *Room) advance(ctx context.Context, journeyID int32, coachType, userID string, join bool) (int64, int64, int64, error) {
+	joinArg := "0"
+	if join {
+		joinArg = "1"
+	}
+
+	res, err := r.Redis.Eval(ctx, advanceLua,
+		[]string{queueKey(journeyID, coachType), placeKey(journeyID, coachType, userID)},
+		time.Now().UnixMilli(), r.rate, joinArg, int64(queueTTL.Seconds()),
+	).Int64Slice()
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	return res[0], res[2], res[3], nil
+}
+
+// Join puts a user in the queue of a journey and class and returns a token
+// for their place. A user already in the queue keeps their place and gets a
+// fresh token for it.
+func (r *Room) Join(ctx context.Context, journeyID int32, coachType, userID string) (Status, error) {
+	place, admitted, rate, err := r.advance(ctx, journeyID, coachType, userID, true)
+	if err != nil {
+		return Status{}, err
+	}
+
+	token, err := r.sign(Ticket{
+		JourneyID: journeyID,
+		CoachType: coachType,
+		UserID:    userID,
+		Number:    place,
+		IssuedAt:  time.Now().Unix(),
+	})
+	if err != nil {
+		return Status{}, err
+	}
+
+	status := status(place, admitted, rate)
+	status.Token = token
+	return status, nil
+}
+
+// Status reads where the place of a token stands.
+func (r *Room) Status(ctx context.Context, token string) (Ticket, Status, error) {
+	ticket, err := r.parse(token)
+	if err != nil {
+		return Ticket{}, Status{}, err
+	}
+
+	_, admitted, rate, err := r.advance(ctx, ticket.JourneyID, ticket.CoachType, ticket.UserID, false)
+	if err != nil {
+		return Ticket{}, Status{}, err
+	}
+
+	return ticket, status(ticket.Number, admitted, rate), nil
+}
+
+// Verify checks that a token was issued to the user for the journey and class
+// and that its place has been admitted.
+func (r *Room) Verify(ctx context.Context, token, userID string, journeyID int32, coachType string) (Ticket, error) {
+	ticket, status, err := r.Status(ctx, token)
+	if err != nil {
+		return Ticket{}, err
+	}
+
+	if ticket.UserID != userID || ticket.JourneyID != journeyID || ticket.CoachType != coachType {
+		return Ticket{}, ErrInvalidToken
+	}
+
+	if !status.Admitted {
+		return Ticket{}, ErrNotAdmitted
+	}
+
+	used, err := r.Redis.Exists(ctx, usedKey(ticket)).Result()
+	if err != nil {
+		return Ticket{}, err
+	}
+	if used > 0 {
+		return Ticket{}, ErrTokenUsed
+	}
+
+	return ticket, nil
+}
+
+// Consume uses up an admitted ticket, a place lets one booking through.
+// Release gives it back when the booking could not be made. Joining again
+// hands out a fresh token for the same place, so the place stays used for
+// as long as it is kept rather than as long as a token lasts.
+func (r *Room) Consume(ctx context.Context, ticket Ticket) error {
+	ok, err := r.Redis.SetNX(ctx, usedKey(ticket), ticket.UserID, queueTTL).Result()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrTokenUsed
+	}
+
+	return nil
+}
+
+// Release lets a consumed ticket be used again.
+func (r *Room) Release(ctx context.Context, ticket Ticket) error {
+	return r.Redis.Del(ctx, usedKey(ticket)).Err()
+}
+
+// SetRate changes how many places per second the queue of a journey and class
+// admits. 0 goes back to the default rate.
+func (r *Room) SetRate(ctx context.Context, journeyID int32, coachType string, admitPerSecond int) error {
+	key := queueKey(journeyID, coachType)
+
+	// places due at the old rate are admitted before it changes
+	if _, _, _, err := r.advance(ctx, journeyID, coachType, "", false); err != nil {
+		return err
+	}
+
+	if admitPerSecond == 0 {
+		return r.Redis.HDel(ctx, key, "rate").Err()
+	}
+
+	pipe := r.Redis.TxPipeline()
+	pipe.HSet(ctx, key, "rate", admitPerSecond)
+	pipe.Expire(ctx, key, queueTTL)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Rejected reports whether err is a token being turned away, rather than
+// redis failing.
+func Rejected(err error) bool {
+	return errors.Is(err, ErrInvalidToken) || errors.Is(err, ErrExpiredToken) ||
+		errors.Is(err, ErrNotAdmitted) || errors.Is(err, ErrTokenUsed)
+}
+
+func status(place, admitted, rate int64) Status {
+	s := Status{Admitted: place <= admitted}
+	if !s.Admitted {
+		s.Position = place - admitted
+		if rate > 0 {
+			s.EstimatedWaitSeconds = (s.Position + rate - 1) / rate
+		}
+	}
+	return s
+}
+
+// a token is the ticket as base64 JSON and its HMAC, joined by a dot
+func (r *Room) sign(t Ticket) (string, error) {
+	payload, err := json.Marshal(t)
+	if err != nil {
+		return "", err
+	}
+
+	body := base64.RawURLEncoding.EncodeToString(payload)
+	return body + "." + base64.RawURLEncoding.EncodeToString(r.mac(body)), nil
+}
+
+func (r *Room) parse(token string) (Ticket, error) {
+	body, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return Ticket{}, ErrInvalidToken
+	}
+
+	got, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(got, r.mac(body)) {
+		return Ticket{}, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(body)
+	if err != nil {
+		return Ticket{}, ErrInvalidToken
+	}
+
+	var t Ticket
+	if err := json.Unmarshal(payload, &t); err != nil {
+		return Ticket{}, ErrInvalidToken
+	}
+
+	if time.Since(time.Unix(t.IssuedAt, 0)) > r.tokenTTL {
+		return Ticket{}, ErrExpiredToken
+	}
+
+	return t, nil
+}
+
+func (r *Room) mac(body string) []byte {
+	m := hmac.New(sha256.New, r.secret)
+	m.Write([]byte(body))
+	return m.Sum(nil)
+}
@@ -0,0 +1,179 @@
+package waitingroom
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+func testRoom() *Room {
+	return &Room{secret: []byte(testSecret), tokenTTL: 10 * time.Minute}
+}
+
+func testTicket() Ticket {
+	return Ticket{JourneyID: 3, CoachType: "3A", UserID: "u1", Number: 42, IssuedAt: time.Now().Unix()}
+}
+
+func TestSignedTokenParsesBack(t *testing.T) {
+	r := testRoom()
+	want := testTicket()
+
+	token, err := r.sign(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := r.parse(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("parse() = %+v, want %+v", got, want)
+	}
+}
+
+// signedBody signs a token body as sign does, whatever it holds.
+func signedBody(r *Room, body string) string {
+	return body + "." + base64.RawURLEncoding.EncodeToString(r.mac(body))
+}
+
+func TestParseRejectsTokens(t *testing.T) {
+	r := testRoom()
+
+	token, err := r.sign(testTicket())
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, sig, _ := strings.Cut(token, ".")
+
+	// the same ticket with a better place, under the original signature
+	better := testTicket()
+	better.Number = 1
+	forged, err := r.sign(better)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forgedBody, _, _ := strings.Cut(forged, ".")
+
+	other := &Room{secret: []byte(strings.Repeat("x", MinSecretLength)), tokenTTL: time.Minute}
+	otherToken, err := other.sign(testTicket())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old := testTicket()
+	old.IssuedAt = time.Now().Add(-time.Hour).Unix()
+	expired, err := r.sign(old)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"empty", "", ErrInvalidToken},
+		{"no signature", body, ErrInvalidToken},
+		{"signature not base64", body + ".!!", ErrInvalidToken},
+		{"body changed", forgedBody + "." + sig, ErrInvalidToken},
+		{"signed with another secret", otherToken, ErrInvalidToken},
+		{"body not json", signedBody(r, "bm90IGpzb24"), ErrInvalidToken},
+		{"expired", expired, ErrExpiredToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := r.parse(tt.token)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("parse() error = %v, want %v", err, tt.want)
+			}
+			if !Rejected(err) {
+				t.Errorf("%v is not a rejection", err)
+			}
+		})
+	}
+}
+
+func TestStatus(t *testing.T) {
+	tests := []struct {
+		name                    string
+		place, admitted, rate   int64
+		admittedWant            bool
+		position, estimatedWait int64
+	}{
+		{"admitted", 5, 10, 2, true, 0, 0},
+		{"last admitted", 10, 10, 2, true, 0, 0},
+		{"next in line", 11, 10, 2, false, 1, 1},
+		{"further back", 25, 10, 2, false, 15, 8},
+		{"queue paused", 25, 10, 0, false, 15, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := status(tt.place, tt.admitted, tt.rate)
+			if s.Admitted != tt.admittedWant || s.Position != tt.position || s.EstimatedWaitSeconds != tt.estimatedWait {
+				t.Errorf("status() = %+v", s)
+			}
+		})
+	}
+}
+
+func TestCheckSecret(t *testing.T) {
+	tests := []struct {
+		secret string
+		ok     bool
+	}{
+		{"", false},
+		{"secret", false},
+		{strings.Repeat("s", MinSecretLength-1), false},
+		{strings.Repeat("s", MinSecretLength), true},
+		{strings.Repeat("s", 64), true},
+	}
+
+	for _, tt := range tests {
+		if err := CheckSecret(tt.secret); (err == nil) != tt.ok {
+			t.Errorf("CheckSecret(%d bytes) = %v", len(tt.secret), err)
+		}
+	}
+}
+
+func TestPlaceBooksOnceWhateverTokenItIsUsedWith(t *testing.T) {
+	mr := miniredis.RunT(t)
+	r := NewRoom(redis.NewClient(&redis.Options{Addr: mr.Addr()}), testSecret, 1000, 10*time.Minute)
+	ctx := context.Background()
+
+	// admitVerified joins the queue and returns the ticket once it is let in
+	admitVerified := func() (Ticket, error) {
+		joined, err := r.Join(ctx, 3, "3A", "u1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(5 * time.Millisecond)
+		return r.Verify(ctx, joined.Token, "u1", 3, "3A")
+	}
+
+	ticket, err := admitVerified()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Consume(ctx, ticket); err != nil {
+		t.Fatal(err)
+	}
+
+	// the first token has run out, joining again gives a new one for the
+	// same place
+	mr.FastForward(11 * time.Minute)
+
+	if _, err := admitVerified(); !errors.Is(err, ErrTokenUsed) {
+		t.Fatalf("Verify() = %v, want %v", err, ErrTokenUsed)
+	}
+}
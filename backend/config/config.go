@@ -3,6 +3,8 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
@@ -14,6 +16,86 @@ type Config struct {
 	REDIS_PASSWORD        string
 	STRIPE_SECRET_KEY     string
 	STRIPE_WEBHOOK_SECRET string
+
+	// PAYMENT_GATEWAY is "stripe" or "fake". The fake gateway serves its own
+	// checkout page under FAKE_PAYMENT_BASE_URL and posts signed webhooks to
+	// FAKE_PAYMENT_WEBHOOK_URL, so bookings can be paid without Stripe
+	PAYMENT_GATEWAY          string
+	PAYMENT_SUCCESS_URL      string
+	PAYMENT_CANCEL_URL       string
+	FAKE_PAYMENT_BASE_URL    string
+	FAKE_PAYMENT_WEBHOOK_URL string
+
+	// unpaid bookings are expired after HOLD_TTL_SECONDS, checked every
+	// HOLD_SWEEP_INTERVAL_SECONDS
+	HOLD_TTL_SECONDS            int
+	HOLD_SWEEP_INTERVAL_SECONDS int
+
+	// KAFKA_DRIVER is "sarama" for a real cluster or "memory" to run the whole
+	// flow in one process without one. KAFKA_BROKERS is a comma separated
+	// list of host:port
+	KAFKA_DRIVER       string
+	KAFKA_BROKERS      []string
+	KAFKA_TATKAL_TOPIC string
+	KAFKA_TATKAL_GROUP string
+	KAFKA_SEAT_TOPIC   string
+	KAFKA_SEAT_GROUP   string
+	KAFKA_DLQ_TOPIC    string
+	KAFKA_DLQ_GROUP    string
+
+	// a failed message is retried up to CONSUMER_MAX_ATTEMPTS times, waiting
+	// from CONSUMER_RETRY_BASE_MS doubling up to CONSUMER_RETRY_MAX_MS, before
+	// it goes to the dead-letter topic
+	CONSUMER_MAX_ATTEMPTS  int
+	CONSUMER_RETRY_BASE_MS int
+	CONSUMER_RETRY_MAX_MS  int
+
+	// the outbox relay publishes up to OUTBOX_BATCH_SIZE events per
+	// transaction every OUTBOX_POLL_INTERVAL_MS and keeps published events
+	// for OUTBOX_RETENTION_HOURS
+	OUTBOX_POLL_INTERVAL_MS int
+	OUTBOX_BATCH_SIZE       int
+	OUTBOX_RETENTION_HOURS  int
+
+	// refunds are sent to the gateway in batches of REFUND_BATCH_SIZE every
+	// REFUND_POLL_INTERVAL_MS. A failed call is retried up to
+	// REFUND_MAX_ATTEMPTS times, waiting from REFUND_RETRY_BASE_SECONDS
+	// doubling up to REFUND_RETRY_MAX_SECONDS
+	REFUND_POLL_INTERVAL_MS   int
+	REFUND_BATCH_SIZE         int
+	REFUND_MAX_ATTEMPTS       int
+	REFUND_RETRY_BASE_SECONDS int
+	REFUND_RETRY_MAX_SECONDS  int
+
+	// the cancellation statistics behind waitlist predictions are rebuilt
+	// every PREDICTION_REFRESH_INTERVAL_MINUTES
+	PREDICTION_REFRESH_INTERVAL_MINUTES int
+
+	// the chart of a journey is prepared CHART_PREPARATION_HOURS before its
+	// train leaves the origin, checked every CHART_SWEEP_INTERVAL_SECONDS
+	CHART_PREPARATION_HOURS      int
+	CHART_SWEEP_INTERVAL_SECONDS int
+
+	// TATKAL_QUOTA_PERCENT of the seats of each class with tatkal configured
+	// are set aside for tatkal when a journey is created. the redis counters
+	// of free tatkal seats are loaded TATKAL_WARMUP_LEAD_MINUTES before the
+	// window opens and reconciled with the database every
+	// TATKAL_WARMUP_INTERVAL_SECONDS until it closes
+	TATKAL_QUOTA_PERCENT           int
+	TATKAL_WARMUP_LEAD_MINUTES     int
+	TATKAL_WARMUP_INTERVAL_SECONDS int
+
+	// tatkal bookings go through a waiting room that lets in
+	// WAITING_ROOM_ADMIT_PER_SECOND users per journey and class. Queue tokens
+	// are signed with WAITING_ROOM_SECRET and last
+	// WAITING_ROOM_TOKEN_TTL_MINUTES. The API does not start without a secret
+	// of at least 32 bytes
+	WAITING_ROOM_SECRET            string
+	WAITING_ROOM_ADMIT_PER_SECOND  int
+	WAITING_ROOM_TOKEN_TTL_MINUTES int
+
+	// port of the worker's health endpoint
+	WORKER_PORT string
 }
 
 func LoadConfig() *Config {
@@ -28,6 +110,53 @@ func LoadConfig() *Config {
 		REDIS_PASSWORD:        getEnv("REDIS_PASSWORD", ""),
 		STRIPE_SECRET_KEY:     getEnv("STRIPE_SECRET_KEY", ""),
 		STRIPE_WEBHOOK_SECRET: getEnv("STRIPE_WEBHOOK_SECRET", ""),
+
+		PAYMENT_GATEWAY:          getEnv("PAYMENT_GATEWAY", "stripe"),
+		PAYMENT_SUCCESS_URL:      getEnv("PAYMENT_SUCCESS_URL", "http://127.0.0.1:5500/Stripe-Payment-Go/payment-success.html"),
+		PAYMENT_CANCEL_URL:       getEnv("PAYMENT_CANCEL_URL", "http://127.0.0.1:5500/Stripe-Payment-Go/payment-failed.html"),
+		FAKE_PAYMENT_BASE_URL:    getEnv("FAKE_PAYMENT_BASE_URL", "http://localhost:8080"),
+		FAKE_PAYMENT_WEBHOOK_URL: getEnv("FAKE_PAYMENT_WEBHOOK_URL", "http://localhost:8080/v1/booking/webhook/stripe"),
+
+		HOLD_TTL_SECONDS:            getEnvInt("HOLD_TTL_SECONDS", 600),
+		HOLD_SWEEP_INTERVAL_SECONDS: getEnvInt("HOLD_SWEEP_INTERVAL_SECONDS", 30),
+
+		KAFKA_DRIVER:       getEnv("KAFKA_DRIVER", "sarama"),
+		KAFKA_BROKERS:      getEnvList("KAFKA_BROKERS", []string{"localhost:9092"}),
+		KAFKA_TATKAL_TOPIC: getEnv("KAFKA_TATKAL_TOPIC", "tatkal_booking"),
+		KAFKA_TATKAL_GROUP: getEnv("KAFKA_TATKAL_GROUP", "tatkal-booking-group"),
+		KAFKA_SEAT_TOPIC:   getEnv("KAFKA_SEAT_TOPIC", "seat_upgradation"),
+		KAFKA_SEAT_GROUP:   getEnv("KAFKA_SEAT_GROUP", "seat-upgradation-group"),
+		KAFKA_DLQ_TOPIC:    getEnv("KAFKA_DLQ_TOPIC", "booking_dlq"),
+		KAFKA_DLQ_GROUP:    getEnv("KAFKA_DLQ_GROUP", "booking-dlq-group"),
+
+		CONSUMER_MAX_ATTEMPTS:  getEnvInt("CONSUMER_MAX_ATTEMPTS", 5),
+		CONSUMER_RETRY_BASE_MS: getEnvInt("CONSUMER_RETRY_BASE_MS", 200),
+		CONSUMER_RETRY_MAX_MS:  getEnvInt("CONSUMER_RETRY_MAX_MS", 5000),
+
+		OUTBOX_POLL_INTERVAL_MS: getEnvInt("OUTBOX_POLL_INTERVAL_MS", 500),
+		OUTBOX_BATCH_SIZE:       getEnvInt("OUTBOX_BATCH_SIZE", 100),
+		OUTBOX_RETENTION_HOURS:  getEnvInt("OUTBOX_RETENTION_HOURS", 72),
+
+		REFUND_POLL_INTERVAL_MS:   getEnvInt("REFUND_POLL_INTERVAL_MS", 1000),
+		REFUND_BATCH_SIZE:         getEnvInt("REFUND_BATCH_SIZE", 20),
+		REFUND_MAX_ATTEMPTS:       getEnvInt("REFUND_MAX_ATTEMPTS", 8),
+		REFUND_RETRY_BASE_SECONDS: getEnvInt("REFUND_RETRY_BASE_SECONDS", 30),
+		REFUND_RETRY_MAX_SECONDS:  getEnvInt("REFUND_RETRY_MAX_SECONDS", 3600),
+
+		PREDICTION_REFRESH_INTERVAL_MINUTES: getEnvInt("PREDICTION_REFRESH_INTERVAL_MINUTES", 360),
+
+		CHART_PREPARATION_HOURS:      getEnvInt("CHART_PREPARATION_HOURS", 4),
+		CHART_SWEEP_INTERVAL_SECONDS: getEnvInt("CHART_SWEEP_INTERVAL_SECONDS", 60),
+
+		TATKAL_QUOTA_PERCENT:           getEnvInt("TATKAL_QUOTA_PERCENT", 10),
+		TATKAL_WARMUP_LEAD_MINUTES:     getEnvInt("TATKAL_WARMUP_LEAD_MINUTES", 5),
+		TATKAL_WARMUP_INTERVAL_SECONDS: getEnvInt("TATKAL_WARMUP_INTERVAL_SECONDS", 30),
+
+		WAITING_ROOM_SECRET:            getEnv("WAITING_ROOM_SECRET", ""),
+		WAITING_ROOM_ADMIT_PER_SECOND:  getEnvInt("WAITING_ROOM_ADMIT_PER_SECOND", 20),
+		WAITING_ROOM_TOKEN_TTL_MINUTES: getEnvInt("WAITING_ROOM_TOKEN_TTL_MINUTES", 30),
+
+		WORKER_PORT: getEnv("WORKER_PORT", "8081"),
 	}
 }
 
@@ -37,3 +166,35 @@ func getEnv(key, fallback string) string {
 	}
 	return fallback
 }
+
+func getEnvInt(key string, fallback int) int {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("invalid value %q for %s, using %d", value, key, fallback)
+		return fallback
+	}
+	return parsed
+}
+
+func getEnvList(key string, fallback []string) []string {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	if len(list) == 0 {
+		return fallback
+	}
+	return list
+}
@@ -0,0 +1,325 @@
+package booking
+
+import (
+	db "better-uptime/internal/db/sqlc"
+	"context"
+	"fmt"
+	"slices"
+)
+
+// Costs of a seating plan, the cheapest plan around any seat wins. Splitting
+// a booking across coaches is worse than any number of missed preferences.
+const (
+	extraCoachCost     = 100
+	missedBerthCost    = 10
+	sideLowerBerthCost = 3
+	untouchedSeatCost  = 1
+)
+
+const (
+	// seat numbers of a bay of SL or 3A, a berth someone wants is looked
+	// for this many seat numbers either side
+	bayLength       = 8
+	preferenceReach = bayLength
+	// rounds of choosing and locking before settling for any free seats
+	allocationRounds = 3
+	// ages from which passengers are senior citizens
+	seniorAgeMale   = 60
+	seniorAgeFemale = 58
+	// seat numbers of two coaches are never this close
+	coachSeatNumbersGap = 1000
+)
+
+// seatNeed is the berth a passenger should get. Lower is set for senior
+// citizens and women travelling alone who asked for nothing, they are given
+// a lower berth (a side lower one at worst) before anyone else is seated.
+type seatNeed struct {
+	Want  db.BerthType
+	Lower bool
+}
+
+func needOf(age int, gender string, preference db.BerthType, alone bool) seatNeed {
+	if preference != "" {
+		return seatNeed{Want: preference}
+	}
+
+	senior := age >= seniorAgeMale || (gender == "F" && age >= seniorAgeFemale)
+	if senior || (alone && gender == "F") {
+		return seatNeed{Want: db.BerthTypeDOWN, Lower: true}
+	}
+
+	return seatNeed{}
+}
+
+// passengerNeeds is what each passenger of a new booking needs of a berth.
+func passengerNeeds(passengers []PassengerRequest) []seatNeed {
+	needs := make([]seatNeed, 0, len(passengers))
+	for _, p := range passengers {
+		needs = append(needs, needOf(p.Age, p.Gender, db.BerthType(p.BerthPreference), len(passengers) == 1))
+	}
+	return needs
+}
+
+// storedNeeds is passengerNeeds for the stored passengers of a booking still
+// travelling.
+func storedNeeds(passengers []db.GetPassengersByBookingRow) []seatNeed {
+	passengers = travelling(passengers)
+	needs := make([]seatNeed, 0, len(passengers))
+	for _, p := range passengers {
+		needs = append(needs, needOf(int(p.Age), p.Gender, p.BerthPreference.BerthType, len(passengers) == 1))
+	}
+	return needs
+}
+
+// allocateSeats locks seats of a class for the passengers of a booking and
+// returns them in passenger order, fewer of them when the class has not
+// enough seats free. The seats are chosen by chooseSeats from an unlocked
+// list and only the chosen ones are locked, so other bookings are not kept
+// off seats this one does not take. When some were taken in between it
+// chooses again without them, and after a few rounds it settles for any
+// free seats rather than keep losing them.
+func allocateSeats(ctx context.Context, q *db.Queries, journeyId int32, coachType db.CoachType, quota db.SeatQuota, legMask int64, needs []seatNeed) ([]int32, error) {
+	lost := make(map[int32]bool)
+
+	for round := 0; round < allocationRounds; round++ {
+		rows, err := q.ListFreeSeats(ctx, db.ListFreeSeatsParams{
+			JourneyID: journeyId,
+			CoachType: coachType,
+			Quota:     quota,
+			LegMask:   legMask,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("not able to list free seats: %w", err)
+		}
+
+		free := make([]db.ListFreeSeatsRow, 0, len(rows))
+		for _, row := range rows {
+			if !lost[row.SeatID] {
+				free = append(free, row)
+			}
+		}
+
+		plan := chooseSeats(free, needs)
+		if plan == nil {
+			return nil, nil
+		}
+
+		locked, err := q.LockFreeSeats(ctx, db.LockFreeSeatsParams{
+			JourneyID: journeyId,
+			SeatIds:   plan,
+			Quota:     quota,
+			LegMask:   legMask,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("not able to lock seats: %w", err)
+		}
+		if len(locked) == len(plan) {
+			return plan, nil
+		}
+
+		// seats locked so far stay locked by this transaction and may be
+		// chosen again
+		for _, seatID := range plan {
+			if !slices.Contains(locked, seatID) {
+				lost[seatID] = true
+			}
+		}
+	}
+
+	seatIDs, err := q.LockAvailableSeats(ctx, db.LockAvailableSeatsParams{
+		JourneyID: journeyId,
+		CoachType: coachType,
+		Quota:     quota,
+		LegMask:   legMask,
+		SeatLimit: int32(len(needs)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("not able to lock seats: %w", err)
+	}
+
+	return seatIDs, nil
+}
+
+// chooseSeats plans a seat for each passenger from the free seats of a class,
+// given in coach and seat number order. Around the first free seat of every
+// bay it seats the passengers as close as it can, those who need a lower
+// berth first and then those with a preference, each on the nearest berth
+// they want within a bay or else the nearest seat left. The cheapest plan is
+// kept: one coach, close seat numbers and preferences met, with seats already
+// sold for other legs before untouched ones. It returns the seats in
+// passenger order, or nil when there are not enough.
+func chooseSeats(free []db.ListFreeSeatsRow, needs []seatNeed) []int32 {
+	if len(needs) == 0 || len(free) < len(needs) {
+		return nil
+	}
+
+	order := make([]int, len(needs))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		return needRank(needs[a]) - needRank(needs[b])
+	})
+
+	var best []int
+	bestCost := 0
+	for anchor := range free {
+		if anchor > 0 && sameBay(free[anchor-1], free[anchor]) {
+			continue
+		}
+		plan, cost := planAround(free, needs, order, anchor)
+		if best == nil || cost < bestCost {
+			best, bestCost = plan, cost
+		}
+	}
+
+	seatIDs := make([]int32, len(best))
+	for i, seat := range best {
+		seatIDs[i] = free[seat].SeatID
+	}
+	return seatIDs
+}
+
+// sameBay reports whether two seats are in the same bay of a coach.
+func sameBay(a, b db.ListFreeSeatsRow) bool {
+	return a.CoachNumber == b.CoachNumber && (a.SeatNo-1)/bayLength == (b.SeatNo-1)/bayLength
+}
+
+func needRank(need seatNeed) int {
+	switch {
+	case need.Lower:
+		return 0
+	case need.Want != "":
+		return 1
+	}
+	return 2
+}
+
+// planAround seats the passengers around one free seat, returning the index
+// of the seat of each passenger and what the plan costs.
+func planAround(free []db.ListFreeSeatsRow, needs []seatNeed, order []int, anchor int) ([]int, int) {
+	plan := make([]int, len(needs))
+	for i := range plan {
+		plan[i] = -1
+	}
+
+	chosen := make(map[int]bool, len(needs))
+	// of two seats as near, the one in the anchor's bay
+	nearer := func(a, b int) bool {
+		distA, distB := seatDistance(free[anchor], free[a]), seatDistance(free[anchor], free[b])
+		return distA < distB || (distA == distB && (sameBay(free[anchor], free[a]) || !sameBay(free[anchor], free[b])))
+	}
+	nearest := func(reach int, ok func(seat db.ListFreeSeatsRow) bool) int {
+		left, right := anchor, anchor+1
+		for left >= 0 || right < len(free) {
+			var seat int
+			if right >= len(free) || (left >= 0 && nearer(left, right)) {
+				seat = left
+				left--
+			} else {
+				seat = right
+				right++
+			}
+
+			if reach >= 0 && seatDistance(free[anchor], free[seat]) > reach {
+				return -1
+			}
+			if !chosen[seat] && ok(free[seat]) {
+				return seat
+			}
+		}
+		return -1
+	}
+
+	cost := 0
+	for _, p := range order {
+		want := needs[p].Want
+		if want == "" {
+			continue
+		}
+		plan[p] = nearest(preferenceReach, func(seat db.ListFreeSeatsRow) bool {
+			return seat.Berth == want
+		})
+		chosen[plan[p]] = true
+	}
+
+	for _, p := range order {
+		if plan[p] >= 0 || needs[p].Want != db.BerthTypeDOWN {
+			continue
+		}
+		plan[p] = nearest(preferenceReach, func(seat db.ListFreeSeatsRow) bool {
+			return seat.Berth == db.BerthTypeSIDEDOWN
+		})
+		chosen[plan[p]] = true
+		if plan[p] >= 0 {
+			cost += sideLowerBerthCost
+		}
+	}
+
+	for _, p := range order {
+		if plan[p] >= 0 {
+			continue
+		}
+		plan[p] = nearest(-1, func(db.ListFreeSeatsRow) bool {
+			return true
+		})
+		chosen[plan[p]] = true
+		if needs[p].Want != "" {
+			cost += missedBerthCost
+		}
+	}
+
+	// how far apart the seats are in each coach, beyond sitting side by side
+	type span struct{ low, high, seats int32 }
+	spans := make(map[int32]*span)
+	for _, seat := range plan {
+		row := free[seat]
+		s, ok := spans[row.CoachNumber]
+		if !ok {
+			spans[row.CoachNumber] = &span{low: row.SeatNo, high: row.SeatNo, seats: 1}
+		} else {
+			s.low = min(s.low, row.SeatNo)
+			s.high = max(s.high, row.SeatNo)
+			s.seats++
+		}
+
+		if row.Untouched {
+			cost += untouchedSeatCost
+		}
+	}
+
+	cost += (len(spans) - 1) * extraCoachCost
+	for _, s := range spans {
+		cost += int(s.high - s.low - (s.seats - 1))
+	}
+
+	return plan, cost
+}
+
+// seatDistance is how far apart two seats are, seats in different coaches
+// being further apart than any two in the same one.
+func seatDistance(a, b db.ListFreeSeatsRow) int {
+	position := func(seat db.ListFreeSeatsRow) int {
+		return int(seat.CoachNumber)*coachSeatNumbersGap + int(seat.SeatNo)
+	}
+
+	distance := position(a) - position(b)
+	if distance < 0 {
+		return -distance
+	}
+	return distance
+}
+
+// holdSeat holds the legs of a seat for a booking. The seat was locked free
+// for them, a hold that touches no row means another booking got there first
+// and the booking must not go on without it.
+func holdSeat(ctx context.Context, q *db.Queries, arg db.HoldSeatParams) error {
+	held, err := q.HoldSeat(ctx, arg)
+	if err != nil {
+		return fmt.Errorf("failed to hold seat %d: %w", arg.SeatID, err)
+	}
+	if held == 0 {
+		return fmt.Errorf("seat %d is no longer free", arg.SeatID)
+	}
+	return nil
+}
@@ -0,0 +1,222 @@
+package booking
+
+import (
+	db "better-uptime/internal/db/sqlc"
+	"slices"
+	"testing"
+)
+
+var bayBerths = []db.BerthType{
+	db.BerthTypeDOWN, db.BerthTypeMID, db.BerthTypeUP,
+	db.BerthTypeDOWN, db.BerthTypeMID, db.BerthTypeUP,
+	db.BerthTypeSIDEDOWN, db.BerthTypeSIDEUP,
+}
+
+// seat is a free seat of an SL or 3A coach, its id the coach number times
+// 100 plus the seat number.
+func seat(coach, seatNo int32) db.ListFreeSeatsRow {
+	return db.ListFreeSeatsRow{
+		SeatID:      coach*100 + seatNo,
+		CoachNumber: coach,
+		SeatNo:      seatNo,
+		Berth:       bayBerths[(seatNo-1)%bayLength],
+		Untouched:   true,
+	}
+}
+
+func seats(coach int32, seatNos ...int32) []db.ListFreeSeatsRow {
+	rows := make([]db.ListFreeSeatsRow, 0, len(seatNos))
+	for _, seatNo := range seatNos {
+		rows = append(rows, seat(coach, seatNo))
+	}
+	return rows
+}
+
+func seatRange(coach, from, to int32) []db.ListFreeSeatsRow {
+	var rows []db.ListFreeSeatsRow
+	for seatNo := from; seatNo <= to; seatNo++ {
+		rows = append(rows, seat(coach, seatNo))
+	}
+	return rows
+}
+
+func sold(rows []db.ListFreeSeatsRow) []db.ListFreeSeatsRow {
+	for i := range rows {
+		rows[i].Untouched = false
+	}
+	return rows
+}
+
+// fullTrain is every seat of a train of 24 coaches of 72 seats free.
+func fullTrain() []db.ListFreeSeatsRow {
+	var rows []db.ListFreeSeatsRow
+	for coach := int32(1); coach <= 24; coach++ {
+		rows = append(rows, seatRange(coach, 1, 72)...)
+	}
+	return rows
+}
+
+var (
+	anyBerth = seatNeed{}
+	senior   = seatNeed{Want: db.BerthTypeDOWN, Lower: true}
+	upper    = seatNeed{Want: db.BerthTypeUP}
+)
+
+func TestChooseSeats(t *testing.T) {
+	tests := []struct {
+		name  string
+		free  []db.ListFreeSeatsRow
+		needs []seatNeed
+		want  []int32
+	}{
+		{
+			name:  "not enough seats",
+			free:  seats(1, 1),
+			needs: []seatNeed{anyBerth, anyBerth},
+			want:  nil,
+		},
+		{
+			name:  "no passengers",
+			free:  seats(1, 1),
+			needs: nil,
+			want:  nil,
+		},
+		{
+			name:  "keeps a party together",
+			free:  seats(1, 1, 40, 41, 42),
+			needs: []seatNeed{anyBerth, anyBerth, anyBerth},
+			want:  []int32{140, 141, 142},
+		},
+		{
+			name:  "seats a senior on a lower berth",
+			free:  seats(1, 2, 3, 4),
+			needs: []seatNeed{anyBerth, senior},
+			want:  []int32{102, 104},
+		},
+		{
+			name:  "gives a senior a side lower berth when no lower one is left",
+			free:  seats(1, 2, 3, 7),
+			needs: []seatNeed{senior, anyBerth},
+			want:  []int32{107, 102},
+		},
+		{
+			name:  "keeps a party in one coach over their preferences",
+			free:  append(seats(1, 7, 8), seats(2, 3)...),
+			needs: []seatNeed{upper, upper},
+			want:  []int32{107, 108},
+		},
+		{
+			name:  "prefers seats sold for other legs",
+			free:  append(seatRange(1, 1, 8), sold(seatRange(1, 9, 16))...),
+			needs: []seatNeed{anyBerth, anyBerth},
+			want:  []int32{109, 110},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := chooseSeats(tt.free, tt.needs)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("chooseSeats() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlanAround(t *testing.T) {
+	tests := []struct {
+		name     string
+		free     []db.ListFreeSeatsRow
+		needs    []seatNeed
+		anchor   int
+		wantPlan []int
+		wantCost int
+	}{
+		{
+			name:     "nearest berth wanted",
+			free:     sold(seatRange(1, 1, 8)),
+			needs:    []seatNeed{upper},
+			anchor:   0,
+			wantPlan: []int{2},
+			wantCost: 0,
+		},
+		{
+			name:     "side lower berth costs a little",
+			free:     sold(seats(1, 2, 3, 7)),
+			needs:    []seatNeed{senior},
+			anchor:   0,
+			wantPlan: []int{2},
+			wantCost: sideLowerBerthCost,
+		},
+		{
+			name:     "missed berth",
+			free:     sold(seats(1, 1, 2)),
+			needs:    []seatNeed{upper},
+			anchor:   1,
+			wantPlan: []int{1},
+			wantCost: missedBerthCost,
+		},
+		{
+			name:     "seats apart and untouched",
+			free:     seats(1, 1, 5),
+			needs:    []seatNeed{anyBerth, anyBerth},
+			anchor:   0,
+			wantPlan: []int{0, 1},
+			wantCost: 3 + 2*untouchedSeatCost,
+		},
+		{
+			name:     "split across coaches",
+			free:     sold(append(seats(1, 72), seats(2, 1)...)),
+			needs:    []seatNeed{anyBerth, anyBerth},
+			anchor:   0,
+			wantPlan: []int{0, 1},
+			wantCost: extraCoachCost,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := make([]int, len(tt.needs))
+			for i := range order {
+				order[i] = i
+			}
+
+			plan, cost := planAround(tt.free, tt.needs, order, tt.anchor)
+			if !slices.Equal(plan, tt.wantPlan) || cost != tt.wantCost {
+				t.Errorf("planAround() = %v, %d, want %v, %d", plan, cost, tt.wantPlan, tt.wantCost)
+			}
+		})
+	}
+}
+
+func TestChooseSeatsOnFullTrain(t *testing.T) {
+	free := fullTrain()
+	needs := []seatNeed{senior, upper, anyBerth, anyBerth, anyBerth, anyBerth}
+
+	got := chooseSeats(free, needs)
+	if len(got) != len(needs) {
+		t.Fatalf("chose %v", got)
+	}
+
+	byID := make(map[int32]db.ListFreeSeatsRow, len(free))
+	for _, row := range free {
+		byID[row.SeatID] = row
+	}
+	for _, id := range got {
+		if !sameBay(byID[got[0]], byID[id]) {
+			t.Fatalf("party split over bays: %v", got)
+		}
+	}
+	if byID[got[0]].Berth != db.BerthTypeDOWN || byID[got[1]].Berth != db.BerthTypeUP {
+		t.Errorf("preferences missed: %v", got)
+	}
+}
+
+func BenchmarkChooseSeatsFullTrain(b *testing.B) {
+	free := fullTrain()
+	needs := []seatNeed{senior, upper, anyBerth, anyBerth, anyBerth, anyBerth}
+
+	for b.Loop() {
+		chooseSeats(free, needs)
+	}
+}
@@ -1,73 +1,159 @@
 package booking
 
 import (
-	db "better-uptime/internal/db/sqlc"
+	"better-uptime/common/kafka"
+	"better-uptime/common/logger"
+	"context"
 	"encoding/json"
-	"log"
+	"time"
 
 	"github.com/IBM/sarama"
 )
 
-type ConsumerHandler struct {
-	store db.Store
+// messageHandler adapts a per-message function to sarama's consumer group
+// interface. Each topic gets its own consumer group, so no topic switch is
+// needed here.
+type messageHandler struct {
+	h       *Handler
+	process func(ctx context.Context, msg *sarama.ConsumerMessage) error
+	// the dead-letter consumer keeps retrying until a message is stored
+	// instead of dead-lettering it again
+	keepRetrying bool
 }
 
-func (h *ConsumerHandler) Setup(sarama.ConsumerGroupSession) error {
+func (c messageHandler) Setup(sarama.ConsumerGroupSession) error {
 	return nil
 }
 
-func (h *ConsumerHandler) Cleanup(sarama.ConsumerGroupSession) error {
+func (c messageHandler) Cleanup(sarama.ConsumerGroupSession) error {
 	return nil
 }
 
-func (h *ConsumerHandler) ConsumeClaim(
+func (c messageHandler) ConsumeClaim(
 	session sarama.ConsumerGroupSession,
 	claim sarama.ConsumerGroupClaim,
 ) error {
 
 	for msg := range claim.Messages() {
-
-		switch msg.Topic {
-
-		case "tatkal_booking":
-			h.handleTatkal(session, msg)
-
-		case "seat_upgradation":
-			h.handleSeat(session, msg)
+		if !c.handle(session, msg) {
+			// the session is ending, the unmarked message is redelivered to
+			// whoever owns the partition next
+			return nil
 		}
 	}
 
 	return nil
 }
 
-type TatkalJob struct {
-	BookingID string         `json:"booking_id"`
-	UserID    string         `json:"user_id"`
-	Data      BookingRequest `json:"data"`
-}
+// handle retries transient failures with backoff and dead-letters the message
+// once it is out of attempts or cannot succeed at all. It only returns false
+// when the session ended before the message was settled.
+func (c messageHandler) handle(session sarama.ConsumerGroupSession, msg *sarama.ConsumerMessage) bool {
+	policy := c.h.retryPolicy()
+
+	var err error
+	attempt := 0
+	for {
+		attempt++
+		// in-flight work is not tied to the session so a shutdown lets the
+		// current booking finish
+		err = c.process(context.Background(), msg)
+		if err == nil {
+			session.MarkMessage(msg, "")
+			return true
+		}
+
+		if !isRetryable(err) || (!c.keepRetrying && attempt >= policy.MaxAttempts) {
+			break
+		}
 
-func (h *ConsumerHandler) handleTatkal(session sarama.ConsumerGroupSession, msg *sarama.ConsumerMessage) {
-	var job TatkalJob
+		logger.Error("%s[%d]@%d attempt %d failed, retrying: %v", msg.Topic, msg.Partition, msg.Offset, attempt, err)
+		if !sleep(session.Context(), policy.Backoff(attempt)) {
+			return false
+		}
+	}
 
-	if err := json.Unmarshal(msg.Value, &job); err != nil {
-		log.Println("invalid tatkal message:", err)
+	if c.keepRetrying {
+		logger.Error("%s[%d]@%d dropped: %v", msg.Topic, msg.Partition, msg.Offset, err)
 		session.MarkMessage(msg, "")
-		return
+		return true
 	}
 
-	// call DB or service
+	if !c.h.deadLetter(session.Context(), msg, err, attempt) {
+		return false
+	}
 	session.MarkMessage(msg, "")
+	return true
 }
 
-func (h *ConsumerHandler) handleSeat(session sarama.ConsumerGroupSession, msg *sarama.ConsumerMessage) {
-	var data SeatReleasedEvent
+// deadLetter publishes the failed message to the dead-letter topic. Dropping
+// it is never an option, so it keeps trying until Kafka takes it or the
+// session ends.
+func (h *Handler) deadLetter(ctx context.Context, msg *sarama.ConsumerMessage, cause error, attempts int) bool {
+	value, err := json.Marshal(kafka.DeadLetter{
+		Topic:     msg.Topic,
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+		Key:       string(msg.Key),
+		Payload:   string(msg.Value),
+		Error:     cause.Error(),
+		Retryable: isRetryable(cause),
+		Attempts:  attempts,
+		FailedAt:  time.Now(),
+	})
+	if err != nil {
+		logger.Error("failed to encode dead letter for %s[%d]@%d: %v", msg.Topic, msg.Partition, msg.Offset, err)
+		return false
+	}
 
-	if err := json.Unmarshal(msg.Value, &data); err != nil {
-		log.Println("invalid seat message:", err)
-		session.MarkMessage(msg, "")
-		return
+	policy := h.retryPolicy()
+	for attempt := 1; ; attempt++ {
+		err := h.Kafka.Publish(ctx, h.config.KAFKA_DLQ_TOPIC, string(msg.Key), value)
+		if err == nil {
+			logger.Error("%s[%d]@%d dead-lettered after %d attempts: %v", msg.Topic, msg.Partition, msg.Offset, attempts, cause)
+			return true
+		}
+
+		logger.Error("failed to publish dead letter for %s[%d]@%d: %v", msg.Topic, msg.Partition, msg.Offset, err)
+		if !sleep(ctx, policy.Backoff(attempt)) {
+			return false
+		}
 	}
+}
 
-	// call DB logic
-	session.MarkMessage(msg, "")
+func (h *Handler) retryPolicy() kafka.RetryPolicy {
+	return kafka.RetryPolicy{
+		MaxAttempts: h.config.CONSUMER_MAX_ATTEMPTS,
+		BaseDelay:   time.Duration(h.config.CONSUMER_RETRY_BASE_MS) * time.Millisecond,
+		MaxDelay:    time.Duration(h.config.CONSUMER_RETRY_MAX_MS) * time.Millisecond,
+	}
+}
+
+// sleep waits for d and reports false if ctx ended first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// TatkalConsumer processes tatkal jobs published by CreateBooking.
+func (h *Handler) TatkalConsumer() sarama.ConsumerGroupHandler {
+	return messageHandler{h: h, process: h.handleTatkal}
+}
+
+// SeatConsumer promotes waitlisted bookings when seats are released.
+func (h *Handler) SeatConsumer() sarama.ConsumerGroupHandler {
+	return messageHandler{h: h, process: h.handleSeatUpgradation}
+}
+
+// DeadLetterConsumer stores dead-lettered messages so admins can list and
+// replay them.
+func (h *Handler) DeadLetterConsumer() sarama.ConsumerGroupHandler {
+	return messageHandler{h: h, process: h.handleDeadLetter, keepRetrying: true}
 }
@@ -0,0 +1,267 @@
+package booking
+
+import (
+	"better-uptime/common/logger"
+	"better-uptime/common/middleware"
+	"better-uptime/common/util"
+	db "better-uptime/internal/db/sqlc"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+// Stages a booking goes through, a tatkal one from QUEUED on
+const (
+	StageQueued       = "QUEUED"
+	StageSeatsHeld    = "SEATS_HELD"
+	StagePaymentReady = "PAYMENT_READY"
+	StageWaitlist     = "WAITLIST"
+	StageConfirmed    = "CONFIRMED"
+	StageFailed       = "FAILED"
+)
+
+// a stream re-reads the booking this often in case an update was missed,
+// pub/sub delivers nothing to a subscriber that is not connected
+const statusRecheckInterval = 10 * time.Second
+
+// BookingProgress is where a booking stands, as returned by the status
+// endpoint and pushed on its stream.
+type BookingProgress struct {
+	BookingID  int32            `json:"booking_id"`
+	Pnr        string           `json:"pnr"`
+	Stage      string           `json:"stage"`
+	Status     db.BookingStatus `json:"status"`
+	PaymentURL string           `json:"payment_url,omitempty"`
+	ExpiresAt  *time.Time       `json:"expires_at,omitempty"`
+	Reason     string           `json:"reason,omitempty"`
+}
+
+// Done reports whether the booking will not move on any more.
+func (p BookingProgress) Done() bool {
+	return p.Stage == StageConfirmed || p.Stage == StageFailed
+}
+
+func progressChannel(bookingId int32) string {
+	return fmt.Sprintf("booking:progress:%d", bookingId)
+}
+
+// bookingProgress works out the stage of a booking from its status and
+// latest payment.
+func (h *Handler) bookingProgress(ctx context.Context, booking db.Booking) (BookingProgress, error) {
+	progress := BookingProgress{
+		BookingID: booking.ID,
+		Pnr:       booking.Pnr.String,
+		Status:    booking.Status,
+	}
+
+	switch booking.Status {
+	case db.BookingStatusQUEUED:
+		progress.Stage = StageQueued
+	case db.BookingStatusPENDING:
+		paid, err := h.store.GetLatestPaymentByBooking(ctx, util.ToPgInt4(booking.ID))
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return BookingProgress{}, err
+		}
+
+		progress.Stage = StageSeatsHeld
+		if paid.SessionUrl.Valid {
+			progress.Stage = StagePaymentReady
+			progress.PaymentURL = paid.SessionUrl.String
+
+			start := booking.Createdat.Time
+			if booking.HoldStartedAt.Valid {
+				start = booking.HoldStartedAt.Time
+			}
+			expiresAt := start.Add(time.Duration(h.config.HOLD_TTL_SECONDS) * time.Second)
+			progress.ExpiresAt = &expiresAt
+		}
+	case db.BookingStatusWAITLIST:
+		progress.Stage = StageWaitlist
+
+		// a waitlisted booking is paid for up front, the page stays open
+		// until then
+		paid, err := h.store.GetLatestPaymentByBooking(ctx, util.ToPgInt4(booking.ID))
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return BookingProgress{}, err
+		}
+		if paid.SessionUrl.Valid && (!paid.Status.Valid || paid.Status.PaymentStatus == db.PaymentStatusPENDING) {
+			progress.PaymentURL = paid.SessionUrl.String
+		}
+	case db.BookingStatusCONFIRMED, db.BookingStatusRAC:
+		progress.Stage = StageConfirmed
+	case db.BookingStatusFAILED:
+		progress.Stage = StageFailed
+		progress.Reason = booking.FailureReason.String
+	case db.BookingStatusEXPIRED:
+		progress.Stage = StageFailed
+		progress.Reason = "not paid for in time"
+	case db.BookingStatusCANCELLED:
+		progress.Stage = StageFailed
+		progress.Reason = "cancelled"
+	}
+
+	return progress, nil
+}
+
+// publishProgress pushes the current stage of a booking to everyone
+// streaming it. It only logs failures, the stream re-reads the booking anyway.
+func (h *Handler) publishProgress(ctx context.Context, bookingId int32) {
+	booking, err := h.store.GetBookingById(ctx, bookingId)
+	if err != nil {
+		logger.Error("failed to read booking %d for its progress: %v", bookingId, err)
+		return
+	}
+
+	progress, err := h.bookingProgress(ctx, booking)
+	if err != nil {
+		logger.Error("failed to work out progress of booking %d: %v", bookingId, err)
+		return
+	}
+
+	data, err := json.Marshal(progress)
+	if err != nil {
+		return
+	}
+
+	if err := h.Redis.Publish(ctx, progressChannel(bookingId), data).Err(); err != nil {
+		logger.Error("failed to publish progress of booking %d: %v", bookingId, err)
+	}
+}
+
+// ownBooking reads the booking of the {id} URL param, which must belong to
+// the user making the request.
+func (h *Handler) ownBooking(r *http.Request) (db.Booking, error) {
+	ctx := r.Context()
+
+	payload, err := middleware.GetFirebasePayloadFromContext(ctx)
+	if err != nil {
+		return db.Booking{}, util.ErrUnauthorized
+	}
+
+	bookingId, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		return db.Booking{}, util.ErrNotValidRequest
+	}
+
+	booking, err := h.store.GetBookingById(ctx, int32(bookingId))
+	if err != nil {
+		return db.Booking{}, errors.New("booking not found")
+	}
+
+	if booking.Userid.Bytes != payload.UserId {
+		return db.Booking{}, util.ErrUnauthorized
+	}
+
+	return booking, nil
+}
+
+// GetBookingStatus returns the stage of a booking, for a tatkal booking
+// QUEUED → SEATS_HELD → PAYMENT_READY → CONFIRMED or FAILED.
+func (h *Handler) GetBookingStatus(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	booking, err := h.ownBooking(r)
+	if err != nil {
+		util.ErrorJson(w, err)
+		return
+	}
+
+	progress, err := h.bookingProgress(ctx, booking)
+	if err != nil {
+		util.ErrorJson(w, util.ErrInternal)
+		return
+	}
+
+	util.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "Booking status",
+		"data":    progress,
+	})
+}
+
+// StreamBookingStatus sends the stage of a booking as server-sent events,
+// first as it is and then on every change, until the booking is confirmed or
+// failed or the client goes away.
+func (h *Handler) StreamBookingStatus(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		util.ErrorJson(w, errors.New("streaming is not supported"))
+		return
+	}
+
+	booking, err := h.ownBooking(r)
+	if err != nil {
+		util.ErrorJson(w, err)
+		return
+	}
+
+	// subscribed before the first read, so no change falls in between
+	sub := h.Redis.Subscribe(ctx, progressChannel(booking.ID))
+	defer sub.Close()
+
+	if _, err := sub.Receive(ctx); err != nil {
+		util.ErrorJson(w, util.ErrInternal)
+		return
+	}
+
+	progress, err := h.bookingProgress(ctx, booking)
+	if err != nil {
+		util.ErrorJson(w, util.ErrInternal)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	messages := sub.Channel()
+	ticker := time.NewTicker(statusRecheckInterval)
+	defer ticker.Stop()
+
+	last := ""
+	for {
+		data, err := json.Marshal(progress)
+		if err != nil {
+			return
+		}
+
+		if string(data) != last {
+			fmt.Fprintf(w, "event: status\ndata: %s\n\n", data)
+			flusher.Flush()
+			last = string(data)
+		}
+
+		if progress.Done() {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			if err := json.Unmarshal([]byte(msg.Payload), &progress); err != nil {
+				logger.Error("invalid progress of booking %d: %v", booking.ID, err)
+			}
+		case <-ticker.C:
+			current, err := h.store.GetBookingById(ctx, booking.ID)
+			if err != nil {
+				continue
+			}
+			if progress, err = h.bookingProgress(ctx, current); err != nil {
+				return
+			}
+		}
+	}
+}
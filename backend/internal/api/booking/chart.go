@@ -0,0 +1,454 @@
+package booking
+
+import (
+	"better-uptime/common/logger"
+	"better-uptime/common/util"
+	"better-uptime/internal/api/cancellation"
+	db "better-uptime/internal/db/sqlc"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// ChartEntry is a line of a reservation chart: a passenger on a berth, with
+// "CNF" or their RAC number as the status.
+type ChartEntry struct {
+	SeatNo int32        `json:"seat_no"`
+	Berth  db.BerthType `json:"berth"`
+	Pnr    string       `json:"pnr"`
+	Name   string       `json:"name"`
+	Age    int32        `json:"age"`
+	Gender string       `json:"gender"`
+	From   string       `json:"from,omitempty"`
+	To     string       `json:"to,omitempty"`
+	Status string       `json:"status"`
+}
+
+// CoachChart is the reservation chart of one coach.
+type CoachChart struct {
+	JourneyID   int32        `json:"journey_id"`
+	CoachNumber int32        `json:"coach_number"`
+	CoachType   db.CoachType `json:"coach_type"`
+	Passengers  []ChartEntry `json:"passengers"`
+}
+
+// ChartCsvHeader is the first line of every coach's CSV chart.
+var ChartCsvHeader = []string{"coach_type", "coach_number", "seat_no", "berth", "pnr", "name", "age", "gender", "from", "to", "status"}
+
+// RunChartPreparation charts the journeys that are due every interval until
+// ctx is done.
+func (h *Handler) RunChartPreparation(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			charted, err := h.PrepareDueCharts(ctx)
+			if err != nil {
+				logger.Error("chart preparation failed: %v", err)
+				continue
+			}
+			if charted > 0 {
+				logger.Info("chart preparation charted %d journeys", charted)
+			}
+		}
+	}
+}
+
+// PrepareDueCharts charts every open journey whose train leaves its origin
+// within CHART_PREPARATION_HOURS. A journey that fails is logged and tried
+// again on the next run.
+func (h *Handler) PrepareDueCharts(ctx context.Context) (int, error) {
+	due := time.Now().Add(time.Duration(h.config.CHART_PREPARATION_HOURS) * time.Hour).In(util.IST)
+
+	journeys, err := h.store.ListJourneysToChart(ctx, pgtype.Date{Time: due, Valid: true})
+	if err != nil {
+		return 0, err
+	}
+
+	charted := 0
+	for _, j := range journeys {
+		if util.AtISTClock(j.JourneyDate.Time, j.OriginDeparture).After(due) {
+			continue
+		}
+
+		if err := h.PrepareChart(ctx, j.ID); err != nil {
+			logger.Error("failed to chart journey %d: %v", j.ID, err)
+			continue
+		}
+		charted++
+	}
+
+	return charted, nil
+}
+
+// PrepareChart closes a journey for reservations:
+//
+//  1. unpaid holds are expired and unpaid waitlisted bookings dropped, as
+//     there is no time left to pay for them
+//  2. RAC and waitlisted passengers are promoted into every seat left free,
+//     and the tatkal waitlist into the tatkal seats left free
+//  3. bookings still on the waitlist are cancelled with the whole fare
+//     refunded, and on the tatkal waitlist less the clerkage
+//  4. the seats still free move to the CURRENT quota
+//  5. the reservation chart of each coach is saved and the journey is CHARTED
+//
+// Steps 3 to 5 run in one transaction that locks the journey, so a journey
+// charted by another replica in the meantime is left alone. The journey stays
+// open for booking until then, so step 1 is run again in it for the holds
+// made since, before their seats are frozen.
+func (h *Handler) PrepareChart(ctx context.Context, journeyId int32) error {
+	err := h.store.ExecTx(ctx, func(q *db.Queries) error {
+		return h.dropUnpaid(ctx, q, journeyId)
+	})
+	if err != nil {
+		return fmt.Errorf("not able to drop unpaid bookings: %w", err)
+	}
+
+	coachTypes, err := h.store.GetCoachTypesByJourney(ctx, journeyId)
+	if err != nil {
+		return err
+	}
+
+	for _, coachType := range coachTypes {
+		if err := h.PromoteRac(ctx, journeyId, coachType); err != nil {
+			return fmt.Errorf("not able to promote rac of %s: %w", coachType, err)
+		}
+		if err := h.PromoteWaitlist(ctx, journeyId, coachType); err != nil {
+			return fmt.Errorf("not able to promote waitlist of %s: %w", coachType, err)
+		}
+		if err := h.PromoteTatkalWaitlist(ctx, journeyId, coachType); err != nil {
+			return fmt.Errorf("not able to promote tatkal waitlist of %s: %w", coachType, err)
+		}
+	}
+
+	return h.store.ExecTx(ctx, func(q *db.Queries) error {
+		status, err := q.LockJourneyForCharting(ctx, journeyId)
+		if err != nil {
+			return err
+		}
+		if !status.Valid || status.JourneyStatus != db.JourneyStatusOPEN {
+			return nil
+		}
+
+		if err := h.dropUnpaid(ctx, q, journeyId); err != nil {
+			return fmt.Errorf("not able to drop unpaid bookings: %w", err)
+		}
+
+		if err := cancelUncleared(ctx, q, journeyId); err != nil {
+			return err
+		}
+
+		if _, err := q.FreezeSeatInventory(ctx, journeyId); err != nil {
+			return fmt.Errorf("not able to freeze seats: %w", err)
+		}
+
+		if err := saveCharts(ctx, q, journeyId); err != nil {
+			return err
+		}
+
+		return q.MarkJourneyCharted(ctx, journeyId)
+	})
+}
+
+// dropUnpaid expires the held bookings of a journey and the RAC bookings that
+// were never paid for, and takes unpaid waitlisted bookings off the waitlist,
+// so that promotion only confirms paid bookings and never opens a hold.
+func (h *Handler) dropUnpaid(ctx context.Context, q *db.Queries, journeyId int32) error {
+	pending, err := q.GetPendingBookingsByJourney(ctx, util.ToPgInt4(journeyId))
+	if err != nil {
+		return err
+	}
+
+	// RAC bookings left unpaid, moved there off the waitlist before moving
+	// to RAC needed a payment
+	unpaidRac, err := q.GetUnpaidRacBookingsByJourney(ctx, util.ToPgInt4(journeyId))
+	if err != nil {
+		return err
+	}
+	for _, bookingId := range unpaidRac {
+		if err := q.CancelWaitlist(ctx, util.ToPgInt4(bookingId)); err != nil {
+			return err
+		}
+	}
+	pending = append(pending, unpaidRac...)
+
+	for _, bookingId := range pending {
+		err := q.UpdateBookingStatus(ctx, db.UpdateBookingStatusParams{
+			ID:     bookingId,
+			Status: db.BookingStatusEXPIRED,
+		})
+		if err != nil {
+			return err
+		}
+
+		if err := h.expireBooking(ctx, q, bookingId, journeyId); err != nil {
+			return fmt.Errorf("failed to expire booking %d: %w", bookingId, err)
+		}
+	}
+
+	waiting, err := waitingBookings(ctx, q, journeyId)
+	if err != nil {
+		return err
+	}
+
+	for _, wl := range waiting {
+		if wl.PaymentStatus.Valid && wl.PaymentStatus.PaymentStatus == db.PaymentStatusSUCCESS {
+			continue
+		}
+
+		if err := wl.leaveWaitlist(ctx, q); err != nil {
+			return err
+		}
+
+		err = q.UpdateBookingStatus(ctx, db.UpdateBookingStatusParams{
+			ID:     wl.ID,
+			Status: db.BookingStatusEXPIRED,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// waitingBooking is a booking on the general or the tatkal waitlist of a
+// journey, with the last payment made for it.
+type waitingBooking struct {
+	ID               int32
+	Userid           pgtype.UUID
+	BookingType      db.BookingType
+	CoachType        db.CoachType
+	Amount           pgtype.Float8
+	PaymentStatus    db.NullPaymentStatus
+	GatewayPaymentID pgtype.Text
+	Tatkal           bool
+}
+
+// waitingBookings locks and returns the bookings on both waitlists of a
+// journey.
+func waitingBookings(ctx context.Context, q *db.Queries, journeyId int32) ([]waitingBooking, error) {
+	general, err := q.GetWaitingBookingsByJourney(ctx, util.ToPgInt4(journeyId))
+	if err != nil {
+		return nil, err
+	}
+
+	tatkal, err := q.GetTatkalWaitingBookingsByJourney(ctx, util.ToPgInt4(journeyId))
+	if err != nil {
+		return nil, err
+	}
+
+	waiting := make([]waitingBooking, 0, len(general)+len(tatkal))
+	for _, wl := range general {
+		waiting = append(waiting, waitingBooking{
+			ID:               wl.ID,
+			Userid:           wl.Userid,
+			BookingType:      wl.BookingType,
+			CoachType:        wl.CoachType.CoachType,
+			Amount:           wl.Amount,
+			PaymentStatus:    wl.PaymentStatus,
+			GatewayPaymentID: wl.GatewayPaymentID,
+		})
+	}
+	for _, wl := range tatkal {
+		waiting = append(waiting, waitingBooking{
+			ID:               wl.ID,
+			Userid:           wl.Userid,
+			BookingType:      wl.BookingType,
+			CoachType:        wl.CoachType,
+			Amount:           wl.Amount,
+			PaymentStatus:    wl.PaymentStatus,
+			GatewayPaymentID: wl.GatewayPaymentID,
+			Tatkal:           true,
+		})
+	}
+
+	return waiting, nil
+}
+
+// leaveWaitlist takes the booking's place off the waitlist it is on.
+func (wl waitingBooking) leaveWaitlist(ctx context.Context, q *db.Queries) error {
+	if wl.Tatkal {
+		_, err := q.CancelTatkalWaitlist(ctx, util.ToPgInt4(wl.ID))
+		return err
+	}
+	return q.CancelWaitlist(ctx, util.ToPgInt4(wl.ID))
+}
+
+// cancelUncleared cancels the bookings still on a waitlist of a journey and
+// queues a refund for each: everything paid for the general waitlist, less
+// the clerkage for the tatkal one.
+func cancelUncleared(ctx context.Context, q *db.Queries, journeyId int32) error {
+	waiting, err := waitingBookings(ctx, q, journeyId)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	for _, wl := range waiting {
+		passengers, err := q.CountPassengersByBooking(ctx, util.ToPgInt4(wl.ID))
+		if err != nil {
+			return err
+		}
+
+		var deduction cancellation.Deduction
+		if wl.Tatkal {
+			deduction, err = cancellation.EvaluateTatkalWaitlist(ctx, q, wl.ID, wl.CoachType, int(passengers), wl.Amount.Float64, now)
+			if err != nil {
+				return err
+			}
+		} else {
+			departure, _, err := cancellation.BookingDeparture(ctx, q, wl.ID)
+			if err != nil {
+				return err
+			}
+
+			deduction = cancellation.NotCleared(wl.CoachType, wl.BookingType, int(passengers), wl.Amount.Float64, departure, now)
+		}
+
+		breakdown, err := json.Marshal(deduction)
+		if err != nil {
+			return err
+		}
+
+		_, err = q.CreateRefund(ctx, db.CreateRefundParams{
+			Userid:             wl.Userid,
+			Bookingid:          util.ToPgInt4(wl.ID),
+			Amount:             int32(math.Round(deduction.Refund)),
+			Status:             db.RefundStatusPENDING,
+			DeductionBreakdown: breakdown,
+			PaymentID:          wl.GatewayPaymentID,
+			IdempotencyKey:     pgtype.Text{String: fmt.Sprintf("refund_%d_not_cleared", wl.ID), Valid: true},
+		})
+		if err != nil {
+			return fmt.Errorf("not able to create the refund: %w", err)
+		}
+
+		if err := wl.leaveWaitlist(ctx, q); err != nil {
+			return err
+		}
+
+		err = q.UpdateBookingStatus(ctx, db.UpdateBookingStatusParams{
+			ID:     wl.ID,
+			Status: db.BookingStatusCANCELLED,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// saveCharts builds the reservation chart of every coach of the journey's
+// train, empty coaches included, and stores it as JSON and CSV.
+func saveCharts(ctx context.Context, q *db.Queries, journeyId int32) error {
+	journey, err := q.GetTrainJourneyById(ctx, journeyId)
+	if err != nil {
+		return err
+	}
+
+	coaches, err := q.GetCoachesByTrain(ctx, journey.TrainID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := q.GetChartPassengers(ctx, journeyId)
+	if err != nil {
+		return fmt.Errorf("not able to get the passengers: %w", err)
+	}
+
+	byCoach := make(map[int32][]ChartEntry)
+	for _, row := range rows {
+		byCoach[row.CoachID.Int32] = append(byCoach[row.CoachID.Int32], ChartEntry{
+			SeatNo: row.SeatNo,
+			Berth:  row.Berth,
+			Pnr:    row.Pnr.String,
+			Name:   row.Name,
+			Age:    row.Age,
+			Gender: row.Gender,
+			From:   row.FromCode,
+			To:     row.ToCode,
+			Status: row.ChartStatus,
+		})
+	}
+
+	for _, coach := range coaches {
+		chart := CoachChart{
+			JourneyID:   journeyId,
+			CoachNumber: coach.Coachnumber,
+			CoachType:   coach.Coachtype,
+			Passengers:  byCoach[coach.ID],
+		}
+		if chart.Passengers == nil {
+			chart.Passengers = []ChartEntry{}
+		}
+
+		data, err := json.Marshal(chart)
+		if err != nil {
+			return err
+		}
+
+		csvData, err := chartCsv(chart)
+		if err != nil {
+			return err
+		}
+
+		err = q.SaveReservationChart(ctx, db.SaveReservationChartParams{
+			JourneyID:   journeyId,
+			CoachID:     coach.ID,
+			CoachNumber: coach.Coachnumber,
+			CoachType:   coach.Coachtype,
+			Chart:       data,
+			ChartCsv:    csvData,
+		})
+		if err != nil {
+			return fmt.Errorf("not able to save the chart of coach %d: %w", coach.Coachnumber, err)
+		}
+	}
+
+	return nil
+}
+
+func chartCsv(chart CoachChart) (string, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+
+	if err := writer.Write(ChartCsvHeader); err != nil {
+		return "", err
+	}
+
+	for _, p := range chart.Passengers {
+		err := writer.Write([]string{
+			string(chart.CoachType),
+			strconv.Itoa(int(chart.CoachNumber)),
+			strconv.Itoa(int(p.SeatNo)),
+			string(p.Berth),
+			p.Pnr,
+			p.Name,
+			strconv.Itoa(int(p.Age)),
+			p.Gender,
+			p.From,
+			p.To,
+			p.Status,
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+
+	writer.Flush()
+	return buf.String(), writer.Error()
+}
@@ -0,0 +1,83 @@
+package booking
+
+import (
+	"better-uptime/config"
+	"better-uptime/internal/db/dbtest"
+	db "better-uptime/internal/db/sqlc"
+	"context"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestDropUnpaidExpiresUnpaidRacBookings(t *testing.T) {
+	data := dbtest.New()
+	data.Return("GetUnpaidRacBookingsByJourney", int32(9))
+	data.Return("GetRacSummaryByBooking", db.GetRacSummaryByBookingRow{CoachType: db.CoachTypeSL, Seats: 2})
+	data.Return("GetBookingById", db.Booking{ID: 9, BookingType: db.BookingTypeNORMAL, Status: db.BookingStatusEXPIRED})
+
+	h := &Handler{config: &config.Config{KAFKA_SEAT_TOPIC: "seats"}, store: data.Store()}
+	if err := h.dropUnpaid(context.Background(), db.New(data), 3); err != nil {
+		t.Fatal(err)
+	}
+
+	statuses := data.Calls("UpdateBookingStatus")
+	if len(statuses) != 1 || statuses[0].Args[0] != int32(9) || statuses[0].Args[1] != db.BookingStatusEXPIRED {
+		t.Fatalf("booking statuses %v", statuses)
+	}
+	if calls := data.Calls("CancelWaitlist"); len(calls) != 1 || calls[0].Args[0] != (pgtype.Int4{Int32: 9, Valid: true}) {
+		t.Errorf("waitlist entry left behind: %v", calls)
+	}
+	if calls := data.Calls("ReleaseRacByBooking"); len(calls) != 1 || calls[0].Args[0] != int32(9) {
+		t.Errorf("RAC berths kept: %v", calls)
+	}
+	// the berths go to the next paid booking
+	if calls := data.Calls("CreateOutboxEvent"); len(calls) != 1 {
+		t.Errorf("%d seat_released events queued", len(calls))
+	}
+}
+
+func TestRacNextWaitlistOnlyTakesPaidBookings(t *testing.T) {
+	data := dbtest.New()
+	// an unpaid booking heads the waitlist, the paid-only query skips it
+	data.Return("GetNextWaitlistByCoach", db.Waitlist{ID: 1, Bookingid: pgtype.Int4{Int32: 4, Valid: true}})
+
+	moved, err := racNextWaitlist(context.Background(), db.New(data), 3, db.CoachTypeSL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moved {
+		t.Fatal("an unpaid booking was moved to RAC")
+	}
+	if calls := data.Calls("GetNextPaidWaitlistByCoach"); len(calls) != 1 {
+		t.Fatalf("paid waitlist looked up %d times", len(calls))
+	}
+	if calls := data.Calls("CreateRacPassenger"); len(calls) != 0 {
+		t.Fatalf("RAC berths given out: %v", calls)
+	}
+}
+
+func TestPrepareChartExpiresHoldsMadeAfterTheFirstPass(t *testing.T) {
+	data := dbtest.New()
+	// nothing held at the first pass, booking 12 was held before the lock
+	data.Return("GetPendingBookingsByJourney")
+	data.Return("GetPendingBookingsByJourney", int32(12))
+	data.Return("LockJourneyForCharting", db.NullJourneyStatus{JourneyStatus: db.JourneyStatusOPEN, Valid: true})
+	data.Return("GetTrainJourneyById", db.TrainJourney{ID: 3, TrainID: pgtype.Int4{Int32: 4, Valid: true}})
+
+	h := &Handler{config: &config.Config{KAFKA_SEAT_TOPIC: "seats"}, store: data.Store()}
+	if err := h.PrepareChart(context.Background(), 3); err != nil {
+		t.Fatal(err)
+	}
+
+	statuses := data.Calls("UpdateBookingStatus")
+	if len(statuses) != 1 || statuses[0].Args[0] != int32(12) || statuses[0].Args[1] != db.BookingStatusEXPIRED {
+		t.Fatalf("booking statuses %v", statuses)
+	}
+	if calls := data.Calls("ReleaseSeatsByBooking"); len(calls) != 1 || calls[0].Args[0] != int32(12) {
+		t.Errorf("held seats kept: %v", calls)
+	}
+	if calls := data.Calls("MarkJourneyCharted"); len(calls) != 1 {
+		t.Errorf("journey charted %d times", len(calls))
+	}
+}
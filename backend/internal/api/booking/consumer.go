@@ -1,68 +1,133 @@
 package booking
 
 import (
+	"better-uptime/common/kafka"
+	"better-uptime/common/waitingroom"
 	db "better-uptime/internal/db/sqlc"
 	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"strconv"
 
 	"github.com/IBM/sarama"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
+type TatkalJob struct {
+	BookingID string         `json:"booking_id"`
+	UserID    string         `json:"user_id"`
+	Data      BookingRequest `json:"data"`
+	// the waiting room place the booking used, given back when it fails
+	Ticket waitingroom.Ticket `json:"ticket"`
+}
+
 type SeatReleasedEvent struct {
-	JourneyId string `json:"journey_id,omitempty"`
+	JourneyId int32  `json:"journey_id,omitempty"`
 	CoachType string `json:"coach_type,omitempty"`
+	// Quota the seats return to, empty for the general quota
+	Quota         string `json:"quota,omitempty"`
+	ReleasedSeats int64  `json:"released_seats,omitempty"`
+	Timestamp     int64  `json:"timestamp,omitempty"`
 }
 
-func (h *Handler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+// releasedQuota is the quota of the seats a booking gives up. Tatkal and
+// premium tatkal bookings only ever hold tatkal seats, including the ones
+// promoted from the tatkal waitlist.
+func releasedQuota(bookingType db.BookingType) string {
+	if isTatkal(bookingType) {
+		return string(db.SeatQuotaTATKAL)
+	}
+	return ""
+}
 
-	for msg := range claim.Messages() {
+// permanentError marks a failure that every retry would hit again, such as a
+// message that does not decode.
+type permanentError struct {
+	err error
+}
 
-		switch msg.Topic {
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// isRetryable tells transient failures (Postgres, Redis, Kafka being
+// unreachable) from outcomes that will not change by trying again.
+func isRetryable(err error) bool {
+	var permanent permanentError
+	var numErr *strconv.NumError
+
+	switch {
+	case errors.As(err, &permanent),
+		errors.As(err, &numErr),
+		errors.Is(err, ErrNotEnoughTatkalSeats),
+		errors.Is(err, ErrJourneyNotOpen),
+		errors.Is(err, pgx.ErrNoRows):
+		return false
+	}
+	return true
+}
 
-		case "tatkal_booking":
-			h.handleTatkal(session, msg)
+func (h *Handler) handleTatkal(ctx context.Context, msg *sarama.ConsumerMessage) error {
+	var job TatkalJob
 
-		case "seat_upgradation":
-			h.handleSeatUpgradation(session, msg)
-		}
+	if err := json.Unmarshal(msg.Value, &job); err != nil {
+		return permanentError{fmt.Errorf("invalid tatkal message: %w", err)}
 	}
 
-	return nil
+	return h.ProcessTatkalBooking(ctx, job.Data, job.UserID, job.BookingID, job.Ticket)
 }
 
-func (h *Handler) handleTatkal(session sarama.ConsumerGroupSession, msg *sarama.ConsumerMessage) {
-	var job TatkalJob
+func (h *Handler) handleSeatUpgradation(ctx context.Context, msg *sarama.ConsumerMessage) error {
+	var data SeatReleasedEvent
 
-	if err := json.Unmarshal(msg.Value, &job); err != nil {
-		log.Println("invalid tatkal message:", err)
-		session.MarkMessage(msg, "")
-		return
+	if err := json.Unmarshal(msg.Value, &data); err != nil {
+		return permanentError{fmt.Errorf("invalid seat message: %w", err)}
 	}
 
-	err := h.ProcessTatkalBooking(context.Background(), job.Data, job.UserID, job.BookingID)
-	if err != nil {
-		log.Println("booking failed:", err)
-		return
+	// tatkal seats go back to the tatkal waitlist only
+	if data.Quota == string(db.SeatQuotaTATKAL) {
+		return h.PromoteTatkalWaitlist(ctx, data.JourneyId, db.CoachType(data.CoachType))
 	}
 
-	session.MarkMessage(msg, "")
+	// RAC passengers are ahead of the waitlist for released seats
+	if err := h.PromoteRac(ctx, data.JourneyId, db.CoachType(data.CoachType)); err != nil {
+		return err
+	}
+
+	return h.PromoteWaitlist(ctx, data.JourneyId, db.CoachType(data.CoachType))
 }
 
-func (h *Handler) handleSeatUpgradation(session sarama.ConsumerGroupSession, msg *sarama.ConsumerMessage) {
-	var data SeatReleasedEvent
+func (h *Handler) handleDeadLetter(ctx context.Context, msg *sarama.ConsumerMessage) error {
+	var dl kafka.DeadLetter
 
-	if err := json.Unmarshal(msg.Value, &data); err != nil {
-		log.Println("invalid seat message:", err)
-		session.MarkMessage(msg, "")
-		return
+	if err := json.Unmarshal(msg.Value, &dl); err != nil {
+		return permanentError{fmt.Errorf("invalid dead letter: %w", err)}
 	}
 
-	err := h.PromoteWaitlist(context.Background(), data.JourneyId, db.CoachType(data.CoachType))
-	if err != nil {
-		log.Println("seat upgradation failed:", err)
-		return
+	// a tatkal job that ran out of attempts leaves its booking queued, the
+	// user is told it failed rather than left waiting. Replaying the job
+	// queues the booking again, see ReplayDeadLetter
+	if dl.Topic == h.config.KAFKA_TATKAL_TOPIC {
+		var job TatkalJob
+		if err := json.Unmarshal([]byte(dl.Payload), &job); err == nil {
+			if bookingId, err := strconv.Atoi(job.BookingID); err == nil {
+				if err := h.failTatkal(ctx, int32(bookingId), job.Ticket, errors.New("booking could not be processed, please try again")); err != nil {
+					return err
+				}
+			}
+		}
 	}
 
-	session.MarkMessage(msg, "")
+	return h.store.CreateDeadLetter(ctx, db.CreateDeadLetterParams{
+		Topic:            dl.Topic,
+		MessagePartition: dl.Partition,
+		MessageOffset:    dl.Offset,
+		MessageKey:       pgtype.Text{String: dl.Key, Valid: dl.Key != ""},
+		Payload:          dl.Payload,
+		Error:            dl.Error,
+		Retryable:        dl.Retryable,
+		Attempts:         int32(dl.Attempts),
+		FailedAt:         pgtype.Timestamp{Time: dl.FailedAt, Valid: true},
+	})
 }
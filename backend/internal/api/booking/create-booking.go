@@ -3,9 +3,12 @@ package booking
 import (
 	"better-uptime/common/logger"
 	"better-uptime/common/middleware"
-	"better-uptime/common/stripe"
+	"better-uptime/common/payment"
 	"better-uptime/common/util"
+	"better-uptime/common/waitingroom"
+	"better-uptime/internal/api/fare"
 	db "better-uptime/internal/db/sqlc"
+	"better-uptime/internal/outbox"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -17,16 +20,13 @@ import (
 )
 
 type BookingRequest struct {
-	JourneyId   int            `json:"journey_id,omitempty"`
-	BookingType db.BookingType `json:"booking_type,omitempty"`
-	SeatCount   int            `json:"seat_count,omitempty"`
-	CoachType   db.CoachType   `json:"coach_type,omitempty"`
-}
-
-type PublishJob struct {
-	BookingID string         `json:"booking_id"`
-	UserID    string         `json:"user_id"`
-	Data      BookingRequest `json:"data"`
+	JourneyId   int                `json:"journey_id,omitempty"`
+	BookingType db.BookingType     `json:"booking_type,omitempty"`
+	SeatCount   int                `json:"seat_count,omitempty"`
+	CoachType   db.CoachType       `json:"coach_type,omitempty"`
+	FromStation string             `json:"from_station,omitempty"`
+	ToStation   string             `json:"to_station,omitempty"`
+	Passengers  []PassengerRequest `json:"passengers,omitempty" validate:"required,min=1,max=6,dive"`
 }
 
 func (h *Handler) CreateBooking(w http.ResponseWriter, r *http.Request) {
@@ -52,6 +52,11 @@ func (h *Handler) CreateBooking(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if len(data.Passengers) != data.SeatCount {
+		util.ErrorJson(w, fmt.Errorf("passenger count %d does not match seat count %d", len(data.Passengers), data.SeatCount))
+		return
+	}
+
 	// rate limiter for upto 20 request in 10 minutes
 	err = h.RateLimitUser(ctx, userId.String(), 10* time.Minute, 20)
 	if err != nil {
@@ -59,18 +64,50 @@ func (h *Handler) CreateBooking(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// at the tatkal opening only users let in by the waiting room get as far
+	// as the database
+	var ticket waitingroom.Ticket
+	if isTatkal(data.BookingType) {
+		queueToken := r.Header.Get(waitingroom.TokenHeader)
+		if queueToken == "" {
+			util.ErrorJson(w, errors.New("join the waiting room for a queue token first"))
+			return
+		}
+
+		ticket, err = h.WaitingRoom.Verify(ctx, queueToken, userId.String(), int32(data.JourneyId), string(data.CoachType))
+		if err != nil {
+			util.ErrorJson(w, waitingRoomError(err))
+			return
+		}
+	}
+
 	train_journey, err := h.store.GetTrainJourneyById(ctx, int32(data.JourneyId))
 	if err != nil {
 		util.ErrorJson(w, errors.New("not able to get train journey details"))
+		return
 	}
 
-	if (train_journey.Status != db.NullJourneyStatus{JourneyStatus: "OPEN", Valid: true}) {
+	// once the chart is prepared only the seats left over are sold, as
+	// current booking, with no RAC or waitlist to fall back on
+	charted := train_journey.Status == db.NullJourneyStatus{JourneyStatus: db.JourneyStatusCHARTED, Valid: true}
+
+	if (!charted && train_journey.Status != db.NullJourneyStatus{JourneyStatus: "OPEN", Valid: true}) {
 		util.ErrorJson(w, fmt.Errorf("Not opened for booking"))
 		return
 	}
 
+	if charted && data.BookingType != db.BookingTypeNORMAL {
+		util.ErrorJson(w, errors.New("only current booking is open after charting"))
+		return
+	}
+
+	quota := db.SeatQuota(data.BookingType)
+	if charted {
+		quota = db.SeatQuotaCURRENT
+	}
+
 	// check only if the booking type is tatkal
-	if data.BookingType == "TATKAL" {
+	if isTatkal(data.BookingType) {
 		tatkal_data, err := h.store.ValidateTatkalWindow(ctx, util.ToPgInt4(train_journey.TrainID.Int32))
 		if err != nil {
 			util.ErrorJson(w, fmt.Errorf("not able to get tatkal data"))
@@ -83,48 +120,120 @@ func (h *Handler) CreateBooking(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	segment, err := h.resolveSegment(ctx, train_journey.TrainID.Int32, data.FromStation, data.ToStation)
+	if err != nil {
+		util.ErrorJson(w, err)
+		return
+	}
+
+	// a premium tatkal fare is quoted on the seats left now and locked for
+	// the booking's hold token
+	var breakdown fare.Breakdown
+	if data.BookingType == db.BookingTypePREMIUMTATKAL {
+		breakdown, err = h.quotePremiumTatkal(ctx, train_journey.TrainID.Int32, int32(data.JourneyId), segment.DistanceKm, data.CoachType, data.SeatCount)
+	} else {
+		breakdown, err = fare.Quote(ctx, h.store, train_journey.TrainID.Int32, segment.DistanceKm, data.CoachType, data.BookingType, data.SeatCount)
+	}
+	if err != nil {
+		util.ErrorJson(w, err)
+		return
+	}
+
+	fareBreakdown, err := json.Marshal(breakdown)
+	if err != nil {
+		util.ErrorJson(w, util.ErrInternal)
+		return
+	}
+
 	holdToken := string(uuid.New().String())
 
-	if data.BookingType == db.BookingTypeTATKAL {
+	pnr, err := h.generatePNR(ctx)
+	if err != nil {
+		util.ErrorJson(w, fmt.Errorf("not able to generate pnr"))
+		return
+	}
 
-		booking, err := h.store.CreateBooking(ctx, db.CreateBookingParams{
-			Userid:    pgtype.UUID{Bytes: userId, Valid: true},
-			JourneyID: util.ToPgInt4(int32(data.JourneyId)),
-			Holdtoken: pgtype.Text{String: holdToken, Valid: true},
-		})
+	if isTatkal(data.BookingType) {
 
-		job := PublishJob{
-			BookingID: fmt.Sprintf("%d", booking.ID),
-			UserID:    payload.UserId.String(),
-			Data:      data,
-		}
+		var booking db.Booking
 
-		value, err := json.Marshal(job)
-		if err != nil {
-			util.ErrorJson(w, fmt.Errorf("not able to parase the data"))
+		if err := h.WaitingRoom.Consume(ctx, ticket); err != nil {
+			util.ErrorJson(w, waitingRoomError(err))
 			return
 		}
 
-		partionKey := fmt.Sprintf("%d:%s:%s", data.JourneyId, data.CoachType, data.BookingType)
-		// partition should be according to the journeyId coach type booking type for the ordering reason
-		err = h.Kafka.Publish(ctx, "tatkal_booking", partionKey, value)
+		// the booking and its job are written together, the outbox relay
+		// publishes the job once this commits
+		err = h.store.ExecTx(ctx, func(q *db.Queries) error {
+			booking, err = q.CreateQueuedBooking(ctx, db.CreateQueuedBookingParams{
+				Userid:        pgtype.UUID{Bytes: userId, Valid: true},
+				JourneyID:     util.ToPgInt4(int32(data.JourneyId)),
+				BookingType:   data.BookingType,
+				Holdtoken:     pgtype.Text{String: holdToken, Valid: true},
+				Pnr:           pgtype.Text{String: pnr, Valid: true},
+				FromStationID: segment.FromStationID,
+				ToStationID:   segment.ToStationID,
+				LegMask:       segment.LegMask,
+			})
+			if err != nil {
+				return fmt.Errorf("not able to book seats: %w", err)
+			}
+
+			if data.BookingType == db.BookingTypePREMIUMTATKAL {
+				err = q.CreateFareLock(ctx, db.CreateFareLockParams{
+					HoldToken:     holdToken,
+					BookingID:     booking.ID,
+					Amount:        breakdown.Total,
+					FareBreakdown: fareBreakdown,
+				})
+				if err != nil {
+					return fmt.Errorf("not able to lock the fare: %w", err)
+				}
+			}
+
+			job := TatkalJob{
+				BookingID: fmt.Sprintf("%d", booking.ID),
+				UserID:    payload.UserId.String(),
+				Data:      data,
+				Ticket:    ticket,
+			}
+
+			// partition should be according to the journeyId coach type booking type for the ordering reason
+			partionKey := fmt.Sprintf("%d:%s:%s", data.JourneyId, data.CoachType, data.BookingType)
+			dedupKey := fmt.Sprintf("tatkal_booking:%d", booking.ID)
+			return outbox.Enqueue(ctx, q, h.config.KAFKA_TATKAL_TOPIC, partionKey, dedupKey, job)
+		})
 		if err != nil {
+			if releaseErr := h.WaitingRoom.Release(ctx, ticket); releaseErr != nil {
+				logger.Error("failed to release queue token of booking request: %v", releaseErr)
+			}
 			util.ErrorJson(w, err)
 			return
 		}
 
-		util.WriteJson(w, http.StatusAccepted, map[string]string{
-			"message": "Tatkal booking request accepted. Processing in background.",
+		util.WriteJson(w, http.StatusAccepted, map[string]interface{}{
+			"bookingId": booking.ID,
+			"pnr":       pnr,
+			"status":    StageQueued,
+			"statusUrl": fmt.Sprintf("/v1/booking/%d/status", booking.ID),
+			"streamUrl": fmt.Sprintf("/v1/booking/%d/status/stream", booking.ID),
+			"fare":      breakdown,
+			"message":   "Tatkal booking request accepted. Processing in background.",
 		})
 		return
 	} else {
 		var bookingId int
+		var rac bool
 
 		err = h.store.ExecTx(ctx, func(q *db.Queries) error {
 			booking, err := q.CreateBooking(ctx, db.CreateBookingParams{
-				Userid:    pgtype.UUID{Bytes: userId, Valid: true},
-				JourneyID: util.ToPgInt4(int32(data.JourneyId)),
-				Holdtoken: pgtype.Text{String: holdToken, Valid: true},
+				Userid:        pgtype.UUID{Bytes: userId, Valid: true},
+				JourneyID:     util.ToPgInt4(int32(data.JourneyId)),
+				Holdtoken:     pgtype.Text{String: holdToken, Valid: true},
+				Pnr:           pgtype.Text{String: pnr, Valid: true},
+				FromStationID: segment.FromStationID,
+				ToStationID:   segment.ToStationID,
+				LegMask:       segment.LegMask,
 			})
 			if err != nil {
 				return fmt.Errorf("not able to book seats: %w", err)
@@ -132,18 +241,42 @@ func (h *Handler) CreateBooking(w http.ResponseWriter, r *http.Request) {
 
 			bookingId = int(booking.ID)
 
-			seatIDs, err := q.LockAvailableSeats(ctx, db.LockAvailableSeatsParams{
-				JourneyID: int32(data.JourneyId),
-				CoachType: data.CoachType,
-				Quota:     db.SeatQuota(data.BookingType),
-				SeatLimit: int32(data.SeatCount),
+			// the payment is written with the booking, so waitlist promotion
+			// never finds the booking without one. Its checkout session is
+			// filled in once it is opened
+			_, err = q.CreatePayment(ctx, db.CreatePaymentParams{
+				Bookingid:     util.ToPgInt4(booking.ID),
+				Amount:        breakdown.Total,
+				FareBreakdown: fareBreakdown,
 			})
 			if err != nil {
-				return fmt.Errorf("not able to lock seats: %w", err)
+				return fmt.Errorf("not able to create payment: %w", err)
+			}
+
+			seatIDs, err := allocateSeats(ctx, q, int32(data.JourneyId), data.CoachType, quota, segment.LegMask, passengerNeeds(data.Passengers))
+			if err != nil {
+				return err
+			}
+
+			if charted && len(seatIDs) < data.SeatCount {
+				return errors.New("not enough current booking seats")
 			}
 
 			if len(seatIDs) < data.SeatCount {
-				err := q.UpdateBookingStatus(ctx, db.UpdateBookingStatusParams{
+				passengerIDs, err := insertPassengers(ctx, q, booking.ID, nil, data.Passengers)
+				if err != nil {
+					return err
+				}
+
+				// RAC comes before the waitlist, the booking is paid for as
+				// usual and its passengers share side lower berths until
+				// seats are released
+				rac, err = allocateRac(ctx, q, int32(data.JourneyId), data.CoachType, segment.LegMask, booking.ID, passengerIDs)
+				if err != nil || rac {
+					return err
+				}
+
+				err = q.UpdateBookingStatus(ctx, db.UpdateBookingStatusParams{
 					ID:     booking.ID,
 					Status: db.BookingStatusWAITLIST,
 				})
@@ -160,6 +293,7 @@ func (h *Handler) CreateBooking(w http.ResponseWriter, r *http.Request) {
 					JourneyID:      util.ToPgInt4(int32(data.JourneyId)),
 					Bookingid:      util.ToPgInt4(int32(bookingId)),
 					WaitlistNumber: int32(wlNumber),
+					CoachType:      db.NullCoachType{CoachType: data.CoachType, Valid: true},
 				})
 				if err != nil {
 					return err
@@ -168,13 +302,14 @@ func (h *Handler) CreateBooking(w http.ResponseWriter, r *http.Request) {
 				return nil
 			} else {
 				for _, seatID := range seatIDs {
-					err := q.HoldSeat(ctx, db.HoldSeatParams{
+					err := holdSeat(ctx, q, db.HoldSeatParams{
+						LegMask:   segment.LegMask,
 						JourneyID: int32(data.JourneyId),
 						SeatID:    seatID,
-						BookingID: util.ToPgInt4(booking.ID),
+						BookingID: booking.ID,
 					})
 					if err != nil {
-						return fmt.Errorf("failed to hold seat %d: %w", seatID, err)
+						return err
 					}
 				}
 
@@ -188,6 +323,9 @@ func (h *Handler) CreateBooking(w http.ResponseWriter, r *http.Request) {
 					}
 				}
 
+				if _, err := insertPassengers(ctx, q, booking.ID, seatIDs, data.Passengers); err != nil {
+					return err
+				}
 			}
 
 			return nil
@@ -199,30 +337,43 @@ func (h *Handler) CreateBooking(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		amount := CalculateFare(int32(data.SeatCount), data.CoachType, data.BookingType)
-
-		paymentIntent, err := stripe.StripeSession(ctx, userId.String(), fmt.Sprintf("%d", amount), "booking_train", h.config.STRIPE_SECRET_KEY, int(bookingId), holdToken)
+		session, err := h.Payments.CreateCheckoutSession(ctx, payment.CheckoutRequest{
+			BookingID:   int32(bookingId),
+			UserID:      userId.String(),
+			HoldToken:   holdToken,
+			Amount:      breakdown.Total,
+			Description: "booking_train",
+			ExpiresAt:   time.Now().Add(time.Duration(h.config.HOLD_TTL_SECONDS) * time.Second),
+		})
 		if err != nil {
 			updateErr := h.store.UpdateBookingStatus(ctx, db.UpdateBookingStatusParams{
 				ID:     int32(bookingId),
 				Status: db.BookingStatusEXPIRED,
 			})
 
+			// the hold sweeper expires the booking later, the caller still
+			// learns the booking failed
 			if updateErr != nil {
 				logger.Error("failed to expire booking %d: %v", bookingId, updateErr)
+				util.ErrorJson(w, errors.New("not able to create booking intent"))
 				return
 			}
 
-			_ = h.store.ReleaseSeatsByBooking(ctx, util.ToPgInt4(int32(bookingId)))
+			_ = h.store.ReleaseSeatsByBooking(ctx, int32(bookingId))
+			_ = h.store.ReleaseRacByBooking(ctx, int32(bookingId))
+			_ = h.store.UpdatePaymentStatus(ctx, db.UpdatePaymentStatusParams{
+				Bookingid: util.ToPgInt4(int32(bookingId)),
+				Status:    db.NullPaymentStatus{PaymentStatus: db.PaymentStatusFAILED, Valid: true},
+			})
 
 			util.ErrorJson(w, errors.New("not able to create booking intent"))
 			return
 		}
 
-		_, err = h.store.CreatePayment(ctx, db.CreatePaymentParams{
+		err = h.store.UpdatePaymentSession(ctx, db.UpdatePaymentSessionParams{
 			Bookingid:     util.ToPgInt4(int32(bookingId)),
-			Amount:        float64(amount),
-			Transactionid: paymentIntent.SessionURL.SessionID,
+			Transactionid: session.ID,
+			SessionUrl:    pgtype.Text{String: session.URL, Valid: true},
 		})
 
 		//Send user notification
@@ -238,19 +389,37 @@ func (h *Handler) CreateBooking(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		// paying now is optional, a booking paid up front is confirmed as
+		// soon as it gets seats and any other gets a hold to pay in then
 		if booking.Status == db.BookingStatusWAITLIST {
 			util.WriteJson(w, http.StatusOK, map[string]interface{}{
 				"bookingId": bookingId,
+				"pnr":       pnr,
 				"status":    "WAITLIST",
 				"message":   "Seats not available. You are on waitlist.",
+				"sessionUrl": map[string]interface{}{
+					"session_url": session.URL,
+					"session_id":  session.ID,
+				},
+				"fare": breakdown,
 			})
 			return
 		}
 
 		response := map[string]interface{}{
 			"bookingId":  bookingId,
-			"sessionUrl": paymentIntent.SessionURL,
-			"expires_in": 600,
+			"pnr":        pnr,
+			"sessionUrl": map[string]interface{}{
+				"session_url": session.URL,
+				"session_id":  session.ID,
+			},
+			"fare":       breakdown,
+			"expires_in": h.config.HOLD_TTL_SECONDS,
+		}
+
+		if rac {
+			response["status"] = "RAC"
+			response["message"] = "Berths not available. You are on RAC, sharing a side lower berth."
 		}
 
 		util.WriteJson(w, http.StatusOK, response)
@@ -258,7 +427,13 @@ func (h *Handler) CreateBooking(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func CalculateFare(seatIds int32, coachType db.CoachType, bookingType db.BookingType) int32 {
+// waitingRoomError passes on why a queue token was turned away and hides
+// redis failures.
+func waitingRoomError(err error) error {
+	if waitingroom.Rejected(err) {
+		return err
+	}
 
-	return seatIds * 100
+	logger.Error("waiting room failed: %v", err)
+	return util.ErrInternal
 }
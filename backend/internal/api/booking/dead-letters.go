@@ -0,0 +1,185 @@
+package booking
+
+import (
+	"better-uptime/common/logger"
+	"better-uptime/common/middleware"
+	"better-uptime/common/util"
+	"better-uptime/common/waitingroom"
+	db "better-uptime/internal/db/sqlc"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+const maxDeadLetterPage = 200
+
+func (h *Handler) ListDeadLetters(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	payload, err := middleware.GetFirebasePayloadFromContext(ctx)
+	if err != nil || payload.Role != "ADMIN" {
+		util.ErrorJson(w, util.ErrUnauthorized)
+		return
+	}
+
+	status := db.DeadLetterStatus(r.URL.Query().Get("status"))
+	if status == "" {
+		status = db.DeadLetterStatusPENDING
+	}
+	if status != db.DeadLetterStatusPENDING && status != db.DeadLetterStatusREPLAYED {
+		util.ErrorJson(w, errors.New("status must be PENDING or REPLAYED"))
+		return
+	}
+
+	limit := 50
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > maxDeadLetterPage {
+			util.ErrorJson(w, fmt.Errorf("limit must be between 1 and %d", maxDeadLetterPage))
+			return
+		}
+	}
+
+	letters, err := h.store.ListDeadLetters(ctx, db.ListDeadLettersParams{
+		Status: status,
+		Limit:  int32(limit),
+	})
+	if err != nil {
+		util.ErrorJson(w, util.ErrInternal)
+		return
+	}
+
+	util.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "Dead-lettered messages",
+		"data":    letters,
+	})
+}
+
+// ReplayDeadLetter puts the original message back on its topic, through the
+// outbox so a replay is recorded if and only if it is published. A message
+// that fails again is dead-lettered as a new entry. A tatkal job that failed
+// its booking queues the booking again on its waiting room place, unless the
+// user has used that place for another booking since.
+func (h *Handler) ReplayDeadLetter(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	payload, err := middleware.GetFirebasePayloadFromContext(ctx)
+	if err != nil || payload.Role != "ADMIN" {
+		util.ErrorJson(w, util.ErrUnauthorized)
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		util.ErrorJson(w, util.ErrNotValidRequest)
+		return
+	}
+
+	letter, err := h.store.GetDeadLetter(ctx, int32(id))
+	if err != nil {
+		util.ErrorJson(w, errors.New("dead letter not found"))
+		return
+	}
+
+	if letter.Status != db.DeadLetterStatusPENDING {
+		util.ErrorJson(w, errors.New("dead letter already replayed"))
+		return
+	}
+
+	failed, job, err := h.failedTatkalJob(ctx, letter)
+	if err != nil {
+		util.ErrorJson(w, util.ErrInternal)
+		return
+	}
+
+	// the booking takes its waiting room place back, it was given back when
+	// the booking failed
+	if failed != nil && job.Ticket.Number != 0 {
+		err := h.WaitingRoom.Consume(ctx, job.Ticket)
+		if errors.Is(err, waitingroom.ErrTokenUsed) {
+			util.ErrorJson(w, errors.New("the waiting room place of this booking has been used again"))
+			return
+		}
+		if err != nil {
+			util.ErrorJson(w, waitingRoomError(err))
+			return
+		}
+	}
+
+	err = h.store.ExecTx(ctx, func(q *db.Queries) error {
+		if failed != nil {
+			requeued, err := q.RequeueFailedBooking(ctx, failed.ID)
+			if err != nil {
+				return err
+			}
+			if requeued == 0 {
+				return errors.New("booking is no longer failed")
+			}
+		}
+
+		if err := q.MarkDeadLetterReplayed(ctx, letter.ID); err != nil {
+			return err
+		}
+
+		return q.CreateOutboxEvent(ctx, db.CreateOutboxEventParams{
+			Topic:      letter.Topic,
+			MessageKey: letter.MessageKey.String,
+			Payload:    []byte(letter.Payload),
+			DedupKey:   fmt.Sprintf("dead_letter_replay:%d", letter.ID),
+		})
+	})
+	if err != nil {
+		if failed != nil && job.Ticket.Number != 0 {
+			if releaseErr := h.WaitingRoom.Release(ctx, job.Ticket); releaseErr != nil {
+				logger.Error("failed to release queue token of booking %d: %v", failed.ID, releaseErr)
+			}
+		}
+		util.ErrorJson(w, fmt.Errorf("not able to replay message: %w", err))
+		return
+	}
+
+	if failed != nil {
+		h.publishProgress(ctx, failed.ID)
+	}
+
+	util.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "Message replayed",
+		"data":    letter.ID,
+	})
+}
+
+// failedTatkalJob returns the booking of a dead-lettered tatkal job when the
+// dead letter failed it, see handleDeadLetter, along with the job.
+func (h *Handler) failedTatkalJob(ctx context.Context, letter db.DeadLetter) (*db.Booking, TatkalJob, error) {
+	var job TatkalJob
+
+	if letter.Topic != h.config.KAFKA_TATKAL_TOPIC {
+		return nil, job, nil
+	}
+	if err := json.Unmarshal([]byte(letter.Payload), &job); err != nil {
+		return nil, job, nil
+	}
+	bookingId, err := strconv.Atoi(job.BookingID)
+	if err != nil {
+		return nil, job, nil
+	}
+
+	booking, err := h.store.GetBookingById(ctx, int32(bookingId))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, job, nil
+	}
+	if err != nil {
+		return nil, job, err
+	}
+	if booking.Status != db.BookingStatusFAILED {
+		return nil, job, nil
+	}
+
+	return &booking, job, nil
+}
@@ -0,0 +1,192 @@
+package booking
+
+import (
+	"better-uptime/common/firebase"
+	"better-uptime/common/kafka"
+	"better-uptime/common/middleware"
+	"better-uptime/common/waitingroom"
+	"better-uptime/config"
+	"better-uptime/internal/db/dbtest"
+	db "better-uptime/internal/db/sqlc"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/redis/go-redis/v9"
+)
+
+const testTatkalTopic = "tatkal_booking"
+
+func newDeadLetterHandler(t *testing.T, data *dbtest.DB) (*Handler, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	return &Handler{
+		config:      &config.Config{KAFKA_TATKAL_TOPIC: testTatkalTopic},
+		store:       data.Store(),
+		Redis:       *rdb,
+		WaitingRoom: waitingroom.NewRoom(rdb, "0123456789abcdef0123456789abcdef", 10, 30*time.Minute),
+	}, mr
+}
+
+// deadLetterTatkalJob dead-letters the job of queued booking 11, whose
+// waiting room place is in use, and returns the stored dead letter.
+func deadLetterTatkalJob(t *testing.T, h *Handler, data *dbtest.DB) (TatkalJob, db.DeadLetter) {
+	t.Helper()
+	ctx := context.Background()
+
+	job := TatkalJob{
+		BookingID: "11",
+		UserID:    uuid.NewString(),
+		Data:      BookingRequest{JourneyId: 3, BookingType: db.BookingTypeTATKAL, SeatCount: 1, CoachType: db.CoachType3A},
+		Ticket:    waitingroom.Ticket{JourneyID: 3, CoachType: "3A", Number: 1},
+	}
+	job.Ticket.UserID = job.UserID
+	if err := h.WaitingRoom.Consume(ctx, job.Ticket); err != nil {
+		t.Fatal(err)
+	}
+
+	payload, err := json.Marshal(job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, err := json.Marshal(kafka.DeadLetter{
+		Topic:    testTatkalTopic,
+		Key:      "3:3A:TATKAL",
+		Payload:  string(payload),
+		Error:    "connection refused",
+		Attempts: 5,
+		FailedAt: time.Now(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data.Return("FailQueuedBooking", int64(1))
+	if err := h.handleDeadLetter(ctx, &sarama.ConsumerMessage{Value: value}); err != nil {
+		t.Fatal(err)
+	}
+	if calls := data.Calls("FailQueuedBooking"); len(calls) != 1 || calls[0].Args[0] != int32(11) {
+		t.Fatalf("booking failed %v", calls)
+	}
+
+	stored := data.Calls("CreateDeadLetter")
+	if len(stored) != 1 {
+		t.Fatalf("%d dead letters stored", len(stored))
+	}
+
+	return job, db.DeadLetter{
+		ID:         9,
+		Topic:      stored[0].Args[0].(string),
+		MessageKey: stored[0].Args[3].(pgtype.Text),
+		Payload:    stored[0].Args[4].(string),
+		Status:     db.DeadLetterStatusPENDING,
+	}
+}
+
+func replayDeadLetter(h *Handler, id string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/admin/dead-letters/"+id+"/replay", nil)
+
+	route := chi.NewRouteContext()
+	route.URLParams.Add("id", id)
+	ctx := context.WithValue(req.Context(), chi.RouteCtxKey, route)
+	ctx = context.WithValue(ctx, middleware.TokenPayloadKey, firebase.FirebasePayload{UserId: uuid.New(), Role: "ADMIN"})
+
+	w := httptest.NewRecorder()
+	h.ReplayDeadLetter(w, req.WithContext(ctx))
+	return w
+}
+
+func failedTatkalBooking() db.Booking {
+	return db.Booking{
+		ID:          11,
+		BookingType: db.BookingTypeTATKAL,
+		Status:      db.BookingStatusFAILED,
+		FailureReason: pgtype.Text{
+			String: "booking could not be processed, please try again",
+			Valid:  true,
+		},
+	}
+}
+
+func TestReplayQueuesTheFailedTatkalBookingAgain(t *testing.T) {
+	data := dbtest.New()
+	h, mr := newDeadLetterHandler(t, data)
+
+	job, letter := deadLetterTatkalJob(t, h, data)
+	// failing the booking gave its waiting room place back
+	if mr.Exists("waitroom:3:3A:used:1") {
+		t.Fatal("waiting room place kept by a failed booking")
+	}
+
+	data.Return("GetDeadLetter", letter)
+	data.Return("GetBookingById", failedTatkalBooking())
+	data.Return("RequeueFailedBooking", int64(1))
+
+	w := replayDeadLetter(h, "9")
+	if w.Code != http.StatusOK {
+		t.Fatalf("replay returned %d: %s", w.Code, w.Body)
+	}
+
+	if calls := data.Calls("RequeueFailedBooking"); len(calls) != 1 || calls[0].Args[0] != int32(11) {
+		t.Errorf("booking requeued %v", calls)
+	}
+	if calls := data.Calls("MarkDeadLetterReplayed"); len(calls) != 1 {
+		t.Errorf("dead letter marked %v", calls)
+	}
+
+	queued := data.Calls("CreateOutboxEvent")
+	if len(queued) != 1 || queued[0].Args[0] != testTatkalTopic || queued[0].Args[1] != "3:3A:TATKAL" {
+		t.Fatalf("events queued %v", queued)
+	}
+	var replayed TatkalJob
+	if err := json.Unmarshal(queued[0].Args[2].([]byte), &replayed); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(replayed, job) {
+		t.Errorf("replayed %+v, want %+v", replayed, job)
+	}
+
+	// the booking is on its waiting room place again
+	if !mr.Exists("waitroom:3:3A:used:1") {
+		t.Error("waiting room place not taken back")
+	}
+}
+
+func TestReplayRefusesWhenThePlaceWasUsedAgain(t *testing.T) {
+	data := dbtest.New()
+	h, _ := newDeadLetterHandler(t, data)
+
+	job, letter := deadLetterTatkalJob(t, h, data)
+	// the user booked again on the place given back
+	if err := h.WaitingRoom.Consume(context.Background(), job.Ticket); err != nil {
+		t.Fatal(err)
+	}
+
+	data.Return("GetDeadLetter", letter)
+	data.Return("GetBookingById", failedTatkalBooking())
+
+	w := replayDeadLetter(h, "9")
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("replay returned %d: %s", w.Code, w.Body)
+	}
+
+	if calls := data.Calls("RequeueFailedBooking"); len(calls) != 0 {
+		t.Errorf("booking requeued %v", calls)
+	}
+	if calls := data.Calls("CreateOutboxEvent"); len(calls) != 0 {
+		t.Errorf("events queued %v", calls)
+	}
+	if calls := data.Calls("MarkDeadLetterReplayed"); len(calls) != 0 {
+		t.Errorf("dead letter marked %v", calls)
+	}
+}
@@ -0,0 +1,182 @@
+package booking
+
+import (
+	"better-uptime/common/logger"
+	"better-uptime/common/util"
+	db "better-uptime/internal/db/sqlc"
+	"better-uptime/internal/outbox"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const expireBatchSize = 100
+
+// RunHoldSweeper expires unpaid bookings every interval until ctx is done. It
+// is safe to run on every replica, see ExpireHolds.
+func (h *Handler) RunHoldSweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			expired, err := h.ExpireHolds(ctx)
+			if err != nil {
+				logger.Error("hold sweeper failed: %v", err)
+				continue
+			}
+			if expired > 0 {
+				logger.Info("hold sweeper expired %d bookings", expired)
+			}
+		}
+	}
+}
+
+// ExpireHolds expires PENDING bookings older than the hold TTL, releases their
+// seats, fails their payments and queues the released seats for promotion. Bookings are
+// claimed with SKIP LOCKED, so replicas sweeping at the same time split the
+// work instead of repeating it. Their checkout pages are closed once each
+// batch is committed.
+func (h *Handler) ExpireHolds(ctx context.Context) (int, error) {
+	total := 0
+
+	for {
+		var claimed []int32
+
+		err := h.store.ExecTx(ctx, func(q *db.Queries) error {
+			bookings, err := q.ExpireOldBooking(ctx, db.ExpireOldBookingParams{
+				TtlSeconds: int32(h.config.HOLD_TTL_SECONDS),
+				BatchSize:  expireBatchSize,
+			})
+			if err != nil {
+				return err
+			}
+			claimed = claimed[:0]
+
+			for _, booking := range bookings {
+				claimed = append(claimed, booking.ID)
+				if err := h.expireBooking(ctx, q, booking.ID, booking.JourneyID.Int32); err != nil {
+					return fmt.Errorf("failed to expire booking %d: %w", booking.ID, err)
+				}
+			}
+
+			return nil
+		})
+		if err != nil {
+			return total, err
+		}
+
+		for _, bookingId := range claimed {
+			h.closeCheckout(ctx, bookingId)
+		}
+
+		total += len(claimed)
+
+		if len(claimed) < expireBatchSize {
+			return total, nil
+		}
+	}
+}
+
+// expireBooking moves an unpaid booking's items and payment to their failed
+// states, frees its seats and RAC places and queues a seat_released event for
+// each coach type it held. The booking itself must already be EXPIRED.
+func (h *Handler) expireBooking(ctx context.Context, q *db.Queries, bookingId, journeyId int32) error {
+	if err := q.UpdateBookingItemStatus(ctx, db.UpdateBookingItemStatusParams{
+		Bookingid:     util.ToPgInt4(bookingId),
+		Bookingstatus: db.BookingStatusEXPIRED,
+	}); err != nil {
+		return err
+	}
+
+	if err := q.UpdatePaymentStatus(ctx, db.UpdatePaymentStatusParams{
+		Bookingid: util.ToPgInt4(bookingId),
+		Status:    db.NullPaymentStatus{PaymentStatus: db.PaymentStatusFAILED, Valid: true},
+	}); err != nil {
+		return err
+	}
+
+	seats, err := q.GetSeatSummaryByBooking(ctx, bookingId)
+	if err != nil {
+		return err
+	}
+
+	if err := q.ReleaseSeatsByBooking(ctx, bookingId); err != nil {
+		return err
+	}
+
+	rac, err := q.GetRacSummaryByBooking(ctx, bookingId)
+	if err != nil {
+		return err
+	}
+
+	if err := q.ReleaseRacByBooking(ctx, bookingId); err != nil {
+		return err
+	}
+
+	for _, r := range rac {
+		seats = append(seats, db.GetSeatSummaryByBookingRow{CoachType: r.CoachType, Seats: r.Seats})
+	}
+
+	return h.enqueueReleasedSeats(ctx, q, bookingId, journeyId, seats)
+}
+
+// closeCheckout expires the checkout page of a booking whose hold ran out.
+// Stripe keeps a page open for at least 30 minutes, longer than a hold, so
+// without this it could still be paid for seats sold to someone else. It runs
+// after the booking is committed as EXPIRED, a payment that gets through
+// before the page closes is refunded by handlePaymentSuccess. Failures are
+// only logged, the page expires on its own in the end.
+func (h *Handler) closeCheckout(ctx context.Context, bookingId int32) {
+	p, err := h.store.GetLatestPaymentByBooking(ctx, util.ToPgInt4(bookingId))
+	if err != nil {
+		if !errors.Is(err, pgx.ErrNoRows) {
+			logger.Error("failed to get the payment of booking %d: %v", bookingId, err)
+		}
+		return
+	}
+	if p.Transactionid == "" {
+		return
+	}
+
+	if err := h.Payments.ExpireSession(ctx, p.Transactionid); err != nil {
+		logger.Error("failed to close checkout %s of booking %d: %v", p.Transactionid, bookingId, err)
+	}
+}
+
+// enqueueReleasedSeats queues the same seat_released event as a cancellation
+// so waitlisted passengers can be promoted into the freed seats.
+func (h *Handler) enqueueReleasedSeats(ctx context.Context, q *db.Queries, bookingId, journeyId int32, seats []db.GetSeatSummaryByBookingRow) error {
+	if len(seats) == 0 {
+		return nil
+	}
+
+	booking, err := q.GetBookingById(ctx, bookingId)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range seats {
+		event := SeatReleasedEvent{
+			JourneyId:     journeyId,
+			CoachType:     string(s.CoachType),
+			Quota:         releasedQuota(booking.BookingType),
+			ReleasedSeats: s.Seats,
+			Timestamp:     time.Now().Unix(),
+		}
+
+		key := fmt.Sprintf("%d:%s", journeyId, s.CoachType)
+		dedupKey := fmt.Sprintf("seat_released:%d:%s", bookingId, s.CoachType)
+		if err := outbox.Enqueue(ctx, q, h.config.KAFKA_SEAT_TOPIC, key, dedupKey, event); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
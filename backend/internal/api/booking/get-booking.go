@@ -0,0 +1,123 @@
+package booking
+
+import (
+	"better-uptime/common/middleware"
+	"better-uptime/common/util"
+	db "better-uptime/internal/db/sqlc"
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type BookingResponse struct {
+	ID          int32               `json:"id"`
+	Pnr         string              `json:"pnr"`
+	JourneyID   int32               `json:"journey_id"`
+	BookingType db.BookingType      `json:"booking_type"`
+	Status      db.BookingStatus    `json:"status"`
+	CreatedAt   string              `json:"created_at"`
+	Passengers  []PassengerResponse `json:"passengers"`
+	// PaymentURL is where a PENDING booking can still be paid
+	PaymentURL string `json:"payment_url,omitempty"`
+}
+
+func (h *Handler) GetMyBookings(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	payload, err := middleware.GetFirebasePayloadFromContext(ctx)
+	if err != nil {
+		util.ErrorJson(w, util.ErrUnauthorized)
+		return
+	}
+
+	bookings, err := h.store.ListBookingsByUser(ctx, pgtype.UUID{Bytes: payload.UserId, Valid: true})
+	if err != nil {
+		util.ErrorJson(w, err)
+		return
+	}
+
+	response := make([]BookingResponse, 0, len(bookings))
+	for _, booking := range bookings {
+		result, err := h.buildBookingResponse(ctx, booking)
+		if err != nil {
+			util.ErrorJson(w, err)
+			return
+		}
+		response = append(response, result)
+	}
+
+	util.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "All bookings of the user",
+		"data":    response,
+	})
+}
+
+func (h *Handler) GetBooking(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	payload, err := middleware.GetFirebasePayloadFromContext(ctx)
+	if err != nil {
+		util.ErrorJson(w, util.ErrUnauthorized)
+		return
+	}
+
+	bookingId, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		util.ErrorJson(w, util.ErrNotValidRequest)
+		return
+	}
+
+	booking, err := h.store.GetBookingById(ctx, int32(bookingId))
+	if err != nil {
+		util.ErrorJson(w, errors.New("booking not found"))
+		return
+	}
+
+	if booking.Userid.Bytes != payload.UserId {
+		util.ErrorJson(w, util.ErrUnauthorized)
+		return
+	}
+
+	response, err := h.buildBookingResponse(ctx, booking)
+	if err != nil {
+		util.ErrorJson(w, err)
+		return
+	}
+
+	util.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "Booking details",
+		"data":    response,
+	})
+}
+
+func (h *Handler) buildBookingResponse(ctx context.Context, booking db.Booking) (BookingResponse, error) {
+	rows, err := h.store.GetPassengersByBooking(ctx, util.ToPgInt4(booking.ID))
+	if err != nil {
+		return BookingResponse{}, err
+	}
+
+	response := BookingResponse{
+		ID:          booking.ID,
+		Pnr:         booking.Pnr.String,
+		JourneyID:   booking.JourneyID.Int32,
+		BookingType: booking.BookingType,
+		Status:      booking.Status,
+		CreatedAt:   booking.Createdat.Time.Format("2006-01-02T15:04:05"),
+		Passengers:  toPassengerResponse(rows),
+	}
+
+	if booking.Status == db.BookingStatusPENDING {
+		paid, err := h.store.GetLatestPaymentByBooking(ctx, util.ToPgInt4(booking.ID))
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return BookingResponse{}, err
+		}
+		response.PaymentURL = paid.SessionUrl.String
+	}
+
+	return response, nil
+}
@@ -3,38 +3,55 @@ package booking
 import (
 	"better-uptime/common/kafka"
 	"better-uptime/common/middleware"
+	"better-uptime/common/payment"
 	"better-uptime/common/routes"
+	"better-uptime/common/waitingroom"
 	"better-uptime/config"
 	db "better-uptime/internal/db/sqlc"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/redis/go-redis/v9"
 )
 
 type Handler struct {
-	config *config.Config
-	store  db.Store
-	Redis  redis.Client
-	Kafka  kafka.Producer
+	config   *config.Config
+	store    db.Store
+	Redis    redis.Client
+	Kafka    kafka.Producer
+	Payments payment.PaymentGateway
+
+	// tatkal bookings are only taken from users let in by the waiting room
+	WaitingRoom *waitingroom.Room
 }
 
-func NewHandler(config *config.Config, store db.Store, Redis redis.Client, Kafka kafka.Producer) *Handler {
+func NewHandler(config *config.Config, store db.Store, Redis redis.Client, Kafka kafka.Producer, Payments payment.PaymentGateway) *Handler {
 	return &Handler{
-		config: config,
-		store:  store,
-		Redis:  Redis,
-		Kafka:  Kafka,
+		config:   config,
+		store:    store,
+		Redis:    Redis,
+		Kafka:    Kafka,
+		Payments: Payments,
+		WaitingRoom: waitingroom.NewRoom(&Redis, config.WAITING_ROOM_SECRET, config.WAITING_ROOM_ADMIT_PER_SECOND,
+			time.Duration(config.WAITING_ROOM_TOKEN_TTL_MINUTES)*time.Minute),
 	}
 }
 
 func (h *Handler) Routes() *chi.Mux {
 	router := routes.DefaultRouter()
 	router.Post("/webhook/stripe", h.StripeWebhook)
+	router.Get("/pnr/{pnr}", h.PnrStatus)
 	// without middleware
 
 	router.Group(func(r chi.Router) {
 		r.Use(middleware.TokenMiddleware(h.store))
 		r.Post("/create-booking", h.CreateBooking)
+		r.Get("/", h.GetMyBookings)
+		r.Get("/{id}", h.GetBooking)
+		r.Get("/{id}/status", h.GetBookingStatus)
+		r.Get("/{id}/status/stream", h.StreamBookingStatus)
+		r.Get("/admin/dead-letters", h.ListDeadLetters)
+		r.Post("/admin/dead-letters/{id}/replay", h.ReplayDeadLetter)
 
 		// with middleware
 
@@ -0,0 +1,129 @@
+package booking
+
+import (
+	"better-uptime/common/util"
+	db "better-uptime/internal/db/sqlc"
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type PassengerRequest struct {
+	Name            string `json:"name" validate:"required"`
+	Age             int    `json:"age" validate:"required,min=1,max=125"`
+	Gender          string `json:"gender" validate:"required,oneof=M F T"`
+	IdProofType     string `json:"id_proof_type,omitempty" validate:"omitempty,oneof=AADHAAR PAN PASSPORT DRIVING_LICENCE VOTER_ID"`
+	IdProofNumber   string `json:"id_proof_number,omitempty" validate:"required_with=IdProofType"`
+	BerthPreference string `json:"berth_preference,omitempty" validate:"omitempty,oneof=DOWN MID UP SIDE_DOWN SIDE_UP"`
+}
+
+type PassengerResponse struct {
+	ID              int32  `json:"id"`
+	Name            string `json:"name"`
+	Age             int32  `json:"age"`
+	Gender          string `json:"gender"`
+	IdProofType     string `json:"id_proof_type,omitempty"`
+	IdProofNumber   string `json:"id_proof_number,omitempty"`
+	BerthPreference string `json:"berth_preference,omitempty"`
+	SeatID          *int32 `json:"seat_id,omitempty"`
+	SeatNo          *int32 `json:"seat_no,omitempty"`
+	Berth           string `json:"berth,omitempty"`
+	CoachNumber     *int32 `json:"coach_number,omitempty"`
+	CoachType       string `json:"coach_type,omitempty"`
+	RacPosition     *int32 `json:"rac_position,omitempty"`
+	Cancelled       bool   `json:"cancelled,omitempty"`
+}
+
+// insertPassengers stores the manifest for a booking. When seats are given the
+// passengers are matched to them in order, as allocateSeats returns them,
+// otherwise (waitlist) they are stored without a seat. It returns the ids of
+// the stored passengers in order.
+func insertPassengers(ctx context.Context, q *db.Queries, bookingId int32, seatIDs []int32, passengers []PassengerRequest) ([]int32, error) {
+	ids := make([]int32, 0, len(passengers))
+
+	for i, p := range passengers {
+		var seatID pgtype.Int4
+		if i < len(seatIDs) {
+			seatID = util.ToPgInt4(seatIDs[i])
+		}
+
+		passenger, err := q.CreateBookingPassenger(ctx, db.CreateBookingPassengerParams{
+			BookingID:     util.ToPgInt4(bookingId),
+			SeatID:        seatID,
+			Name:          p.Name,
+			Age:           int32(p.Age),
+			Gender:        p.Gender,
+			IDProofType:   pgtype.Text{String: p.IdProofType, Valid: p.IdProofType != ""},
+			IDProofNumber: pgtype.Text{String: p.IdProofNumber, Valid: p.IdProofNumber != ""},
+			BerthPreference: db.NullBerthType{
+				BerthType: db.BerthType(p.BerthPreference),
+				Valid:     p.BerthPreference != "",
+			},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to store passenger %s: %w", p.Name, err)
+		}
+		ids = append(ids, passenger.ID)
+	}
+
+	return ids, nil
+}
+
+func toPassengerResponse(rows []db.GetPassengersByBookingRow) []PassengerResponse {
+	passengers := make([]PassengerResponse, 0, len(rows))
+
+	for _, row := range rows {
+		p := PassengerResponse{
+			ID:            row.ID,
+			Name:          row.Name,
+			Age:           row.Age,
+			Gender:        row.Gender,
+			IdProofType:   row.IDProofType.String,
+			IdProofNumber: row.IDProofNumber.String,
+		}
+
+		if row.BerthPreference.Valid {
+			p.BerthPreference = string(row.BerthPreference.BerthType)
+		}
+		// the seat they gave up may be someone else's now
+		if row.CancelledAt.Valid {
+			p.Cancelled = true
+			passengers = append(passengers, p)
+			continue
+		}
+		if row.SeatID.Valid {
+			p.SeatID = &row.SeatID.Int32
+		}
+		if row.Seatno.Valid {
+			p.SeatNo = &row.Seatno.Int32
+		}
+		if row.Berth.Valid {
+			p.Berth = string(row.Berth.BerthType)
+		}
+		if row.Coachnumber.Valid {
+			p.CoachNumber = &row.Coachnumber.Int32
+		}
+		if row.Coachtype.Valid {
+			p.CoachType = string(row.Coachtype.CoachType)
+		}
+		if row.RacID.Valid {
+			p.RacPosition = &row.RacPosition
+		}
+
+		passengers = append(passengers, p)
+	}
+
+	return passengers
+}
+
+// travelling leaves out the passengers of a booking that were cancelled.
+func travelling(rows []db.GetPassengersByBookingRow) []db.GetPassengersByBookingRow {
+	left := make([]db.GetPassengersByBookingRow, 0, len(rows))
+	for _, row := range rows {
+		if !row.CancelledAt.Valid {
+			left = append(left, row)
+		}
+	}
+	return left
+}
@@ -0,0 +1,218 @@
+package booking
+
+import (
+	"better-uptime/common/logger"
+	"better-uptime/common/util"
+	"better-uptime/internal/api/prediction"
+	db "better-uptime/internal/db/sqlc"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+var pnrPattern = regexp.MustCompile(`^[1-9][0-9]{9}$`)
+
+type PnrJourney struct {
+	ID     int32  `json:"id"`
+	Date   string `json:"date"`
+	Status string `json:"status"`
+}
+
+type PnrTrain struct {
+	Number      int32  `json:"number"`
+	Name        string `json:"name"`
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+}
+
+type PnrPassenger struct {
+	Name          string `json:"name"`
+	Age           int32  `json:"age"`
+	Gender        string `json:"gender"`
+	CoachType     string `json:"coach_type,omitempty"`
+	CoachNumber   *int32 `json:"coach_number,omitempty"`
+	SeatNo        *int32 `json:"seat_no,omitempty"`
+	Berth         string `json:"berth,omitempty"`
+	CurrentStatus string `json:"current_status"`
+}
+
+type PnrWaitlist struct {
+	Number   int32            `json:"number"`
+	Position int32            `json:"position"`
+	Status   db.WaitingStatus `json:"status"`
+	// on the tatkal waitlist rather than the general one
+	Tatkal bool `json:"tatkal,omitempty"`
+}
+
+type PnrStatusResponse struct {
+	Pnr         string           `json:"pnr"`
+	Status      db.BookingStatus `json:"status"`
+	BookingType db.BookingType   `json:"booking_type"`
+	Journey     PnrJourney       `json:"journey"`
+	Train       PnrTrain         `json:"train"`
+	Passengers  []PnrPassenger   `json:"passengers"`
+	Waitlist    *PnrWaitlist     `json:"waitlist,omitempty"`
+	// chance of a waitlisted booking being confirmed, when there is enough
+	// history to tell
+	Prediction *prediction.Estimate `json:"prediction,omitempty"`
+}
+
+// PnrStatus is public: anyone holding the PNR can see the journey and seats,
+// but not the ID proofs stored on the passengers.
+func (h *Handler) PnrStatus(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	pnr := chi.URLParam(r, "pnr")
+	if !pnrPattern.MatchString(pnr) {
+		util.ErrorJson(w, errors.New("pnr must be a 10 digit number"))
+		return
+	}
+
+	booking, err := h.store.GetBookingByPnr(ctx, pgtype.Text{String: pnr, Valid: true})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			util.ErrorJson(w, errors.New("pnr not found"))
+			return
+		}
+		util.ErrorJson(w, util.ErrInternal)
+		return
+	}
+
+	passengers, err := h.store.GetPassengersByBooking(ctx, util.ToPgInt4(booking.ID))
+	if err != nil {
+		util.ErrorJson(w, util.ErrInternal)
+		return
+	}
+
+	var (
+		waitlist *PnrWaitlist
+		estimate *prediction.Estimate
+	)
+	if booking.Status == db.BookingStatusWAITLIST && booking.BookingType == db.BookingTypeTATKAL {
+		wl, err := h.store.GetTatkalWaitlistByBooking(ctx, util.ToPgInt4(booking.ID))
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			util.ErrorJson(w, util.ErrInternal)
+			return
+		}
+		if err == nil {
+			waitlist = &PnrWaitlist{
+				Number:   wl.WlPosition,
+				Position: wl.Position,
+				Status:   wl.Status.WaitingStatus,
+				Tatkal:   true,
+			}
+		}
+	} else if booking.Status == db.BookingStatusWAITLIST {
+		wl, err := h.store.GetWaitlistByBooking(ctx, util.ToPgInt4(booking.ID))
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			util.ErrorJson(w, util.ErrInternal)
+			return
+		}
+		if err == nil {
+			waitlist = &PnrWaitlist{
+				Number:   wl.WaitlistNumber,
+				Position: wl.Position,
+				Status:   wl.Status,
+			}
+		}
+
+		// the prediction is extra, the status is still shown without it
+		estimate, err = prediction.ForBooking(ctx, h.store, booking.ID)
+		if err != nil {
+			logger.Error("failed to estimate booking %d: %v", booking.ID, err)
+		}
+	}
+
+	response := PnrStatusResponse{
+		Pnr:         booking.Pnr.String,
+		Status:      booking.Status,
+		BookingType: booking.BookingType,
+		Journey: PnrJourney{
+			ID:     booking.JourneyID.Int32,
+			Date:   booking.JourneyDate.Time.Format("2006-01-02"),
+			Status: string(booking.JourneyStatus.JourneyStatus),
+		},
+		Train: PnrTrain{
+			Number:      booking.Trainnumber,
+			Name:        booking.Trainname,
+			Source:      booking.Source,
+			Destination: booking.Destination,
+		},
+		Passengers: make([]PnrPassenger, 0, len(passengers)),
+		Waitlist:   waitlist,
+		Prediction: estimate,
+	}
+
+	for _, p := range toPassengerResponse(passengers) {
+		response.Passengers = append(response.Passengers, PnrPassenger{
+			Name:          p.Name,
+			Age:           p.Age,
+			Gender:        p.Gender,
+			CoachType:     p.CoachType,
+			CoachNumber:   p.CoachNumber,
+			SeatNo:        p.SeatNo,
+			Berth:         p.Berth,
+			CurrentStatus: passengerStatus(booking.Status, p, waitlist),
+		})
+	}
+
+	util.WriteJson(w, http.StatusOK, response)
+}
+
+// passengerStatus renders the short status shown against each passenger on a
+// PNR enquiry, e.g. "CNF", "RAC 4", "WL 12" or "TQWL 3" on the tatkal
+// waitlist. On a RAC booking the passengers already given a seat of their
+// own show as confirmed, and passengers cancelled off a booking show as
+// cancelled.
+func passengerStatus(status db.BookingStatus, passenger PassengerResponse, waitlist *PnrWaitlist) string {
+	if passenger.Cancelled {
+		return "CAN"
+	}
+
+	switch status {
+	case db.BookingStatusCONFIRMED, db.BookingStatusRAC:
+		if passenger.RacPosition != nil {
+			return fmt.Sprintf("RAC %d", *passenger.RacPosition)
+		}
+		return "CNF"
+	case db.BookingStatusWAITLIST:
+		if waitlist != nil && waitlist.Tatkal {
+			return fmt.Sprintf("TQWL %d", waitlist.Position)
+		}
+		if waitlist != nil {
+			return fmt.Sprintf("WL %d", waitlist.Position)
+		}
+		return "WL"
+	case db.BookingStatusCANCELLED:
+		return "CAN"
+	default:
+		return string(status)
+	}
+}
+
+// generatePNR draws PNRs until it finds one that is not in use yet. The unique
+// index on booking.pnr still guards against two requests racing for the same one.
+func (h *Handler) generatePNR(ctx context.Context) (string, error) {
+	for i := 0; i < 5; i++ {
+		pnr, err := util.GeneratePNR()
+		if err != nil {
+			return "", err
+		}
+
+		exists, err := h.store.PnrExists(ctx, pgtype.Text{String: pnr, Valid: true})
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			return pnr, nil
+		}
+	}
+
+	return "", errors.New("not able to generate a unique pnr")
+}
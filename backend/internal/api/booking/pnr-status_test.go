@@ -0,0 +1,68 @@
+package booking
+
+import (
+	db "better-uptime/internal/db/sqlc"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestPassengerStatus(t *testing.T) {
+	four := int32(4)
+
+	tests := []struct {
+		name      string
+		status    db.BookingStatus
+		passenger PassengerResponse
+		waitlist  *PnrWaitlist
+		want      string
+	}{
+		{"confirmed", db.BookingStatusCONFIRMED, PassengerResponse{}, nil, "CNF"},
+		{"rac", db.BookingStatusRAC, PassengerResponse{RacPosition: &four}, nil, "RAC 4"},
+		{"seated on a rac booking", db.BookingStatusRAC, PassengerResponse{}, nil, "CNF"},
+		{"waitlist", db.BookingStatusWAITLIST, PassengerResponse{}, &PnrWaitlist{Position: 12}, "WL 12"},
+		{"tatkal waitlist", db.BookingStatusWAITLIST, PassengerResponse{}, &PnrWaitlist{Position: 3, Tatkal: true}, "TQWL 3"},
+		{"waitlist gone", db.BookingStatusWAITLIST, PassengerResponse{}, nil, "WL"},
+		{"cancelled booking", db.BookingStatusCANCELLED, PassengerResponse{}, nil, "CAN"},
+		{"cancelled off a confirmed booking", db.BookingStatusCONFIRMED, PassengerResponse{Cancelled: true}, nil, "CAN"},
+		{"cancelled off a rac booking", db.BookingStatusRAC, PassengerResponse{Cancelled: true, RacPosition: &four}, nil, "CAN"},
+		{"pending", db.BookingStatusPENDING, PassengerResponse{}, nil, "PENDING"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := passengerStatus(tt.status, tt.passenger, tt.waitlist); got != tt.want {
+				t.Errorf("passengerStatus() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCancelledPassengersKeepNoSeat(t *testing.T) {
+	rows := []db.GetPassengersByBookingRow{
+		{ID: 1, Name: "Asha", SeatID: pgtype.Int4{Int32: 42, Valid: true}, Seatno: pgtype.Int4{Int32: 12, Valid: true}},
+		{
+			ID:          2,
+			Name:        "Ravi",
+			SeatID:      pgtype.Int4{Int32: 43, Valid: true},
+			Seatno:      pgtype.Int4{Int32: 13, Valid: true},
+			CancelledAt: pgtype.Timestamp{Time: time.Now(), Valid: true},
+		},
+	}
+
+	passengers := toPassengerResponse(rows)
+	if passengers[0].Cancelled || passengers[0].SeatNo == nil {
+		t.Errorf("travelling passenger shown as %+v", passengers[0])
+	}
+	if !passengers[1].Cancelled || passengers[1].SeatID != nil || passengers[1].SeatNo != nil {
+		t.Errorf("cancelled passenger shown as %+v", passengers[1])
+	}
+
+	if left := travelling(rows); len(left) != 1 || left[0].ID != 1 {
+		t.Errorf("travelling() = %+v", left)
+	}
+	if needs := storedNeeds(rows); len(needs) != 1 {
+		t.Errorf("storedNeeds() = %+v, want the one passenger travelling", needs)
+	}
+}
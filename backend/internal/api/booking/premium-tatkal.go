@@ -0,0 +1,47 @@
+package booking
+
+import (
+	"better-uptime/internal/api/fare"
+	db "better-uptime/internal/db/sqlc"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrNoPremiumWaitlist turns away a premium tatkal booking that found no seat,
+// it is confirmed at the fare it was quoted or not at all.
+var ErrNoPremiumWaitlist = errors.New("no tatkal seats left, premium tatkal has no waitlist")
+
+// isTatkal reports whether a booking takes tatkal seats, through the waiting
+// room and the tatkal worker.
+func isTatkal(bookingType db.BookingType) bool {
+	return bookingType == db.BookingTypeTATKAL || bookingType == db.BookingTypePREMIUMTATKAL
+}
+
+// quotePremiumTatkal prices a premium tatkal booking on the tatkal seats left
+// right now, as GetQuote does.
+func (h *Handler) quotePremiumTatkal(ctx context.Context, trainId, journeyId, distanceKm int32, coachType db.CoachType, passengers int) (fare.Breakdown, error) {
+	seatsLeft, err := fare.TatkalSeatsLeft(ctx, h.store, &h.Redis, journeyId, coachType)
+	if err != nil {
+		return fare.Breakdown{}, err
+	}
+
+	return fare.QuotePremiumTatkal(ctx, h.store, trainId, distanceKm, coachType, passengers, seatsLeft)
+}
+
+// lockedFare is the fare a premium tatkal booking was quoted when it was made,
+// which holds for as long as its hold token.
+func (h *Handler) lockedFare(ctx context.Context, booking db.Booking) (fare.Breakdown, error) {
+	lock, err := h.store.GetFareLock(ctx, booking.Holdtoken.String)
+	if err != nil {
+		return fare.Breakdown{}, fmt.Errorf("no fare locked for booking %d: %w", booking.ID, err)
+	}
+
+	var breakdown fare.Breakdown
+	if err := json.Unmarshal(lock.FareBreakdown, &breakdown); err != nil {
+		return fare.Breakdown{}, permanentError{err}
+	}
+
+	return breakdown, nil
+}
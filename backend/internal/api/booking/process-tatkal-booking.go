@@ -1,18 +1,39 @@
 package booking
 
 import (
+	"better-uptime/common/logger"
+	"better-uptime/common/payment"
 	"better-uptime/common/util"
+	"better-uptime/common/waitingroom"
+	"better-uptime/internal/api/fare"
 	db "better-uptime/internal/db/sqlc"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+var (
+	ErrNotEnoughTatkalSeats = errors.New("not enough tatkal seats available")
+	ErrJourneyNotOpen       = errors.New("journey not open for booking")
+
+	ErrAlreadyTatkalWaitlisted = errors.New("already on the tatkal waitlist of this journey")
+
+	// another delivery of the same job already held the seats
+	errTatkalProcessed = errors.New("tatkal booking already processed")
 )
 
 func (h *Handler) ProcessTatkalBooking(ctx context.Context,
 	data BookingRequest,
 	userId string,
-	bookingId string) error {
+	bookingId string,
+	ticket waitingroom.Ticket) error {
 
 	bookingIdInt, err := strconv.Atoi(bookingId)
 	if err != nil {
@@ -20,8 +41,17 @@ func (h *Handler) ProcessTatkalBooking(ctx context.Context,
 	}
 
 	booking, err := h.store.GetBookingById(ctx, int32(bookingIdInt))
-	if err == nil && (booking.Status == db.BookingStatusCONFIRMED || booking.Status == db.BookingStatusEXPIRED || booking.Status == db.BookingStatusPENDING ) {
-		return nil 
+	if err != nil {
+		return err
+	}
+	switch booking.Status {
+	case db.BookingStatusQUEUED:
+	case db.BookingStatusPENDING, db.BookingStatusWAITLIST:
+		// an earlier attempt held the seats, or waitlisted the booking, but
+		// did not get as far as the payment session
+		return h.openTatkalCheckout(ctx, booking, data, userId)
+	default:
+		return nil
 	}
 
 	// redis for handling massive crowd
@@ -37,43 +67,47 @@ func (h *Handler) ProcessTatkalBooking(ctx context.Context,
 
 	// removed the setNx as it was unable to handle scalability 2ms for locks * 1 million user = 2000s = 33 minutes for a seat
 
-	ok, err := h.reserveSeats(ctx, data)
+	ok, err := h.reserveSeats(ctx, data, booking.ID)
 	if err != nil {
 		return err // retryable
 	}
 	if !ok {
-		return errors.New("not enough tatkal seats available") // non-retryable
+		return h.waitlistTatkal(ctx, booking, data, userId, ticket) // non-retryable
 	}
 
 	err = h.store.ExecTx(ctx, func(q *db.Queries) error {
+		held, err := q.HoldQueuedBooking(ctx, booking.ID)
+		if err != nil {
+			return err
+		}
+		if held == 0 {
+			return errTatkalProcessed
+		}
+
 		journey, err := q.GetTrainJourneyById(ctx, int32(data.JourneyId))
 		if err != nil {
 			return err
 		}
 
 		if !journey.Status.Valid || journey.Status.JourneyStatus != db.JourneyStatusOPEN {
-			return errors.New("journey not open for booking")
+			return ErrJourneyNotOpen
 		}
 
-		seatIDs, err := q.LockAvailableSeats(ctx, db.LockAvailableSeatsParams{
-			JourneyID: int32(data.JourneyId),
-			CoachType: data.CoachType,
-			Quota:     db.SeatQuotaTATKAL,
-			SeatLimit: int32(data.SeatCount),
-		})
+		seatIDs, err := allocateSeats(ctx, q, int32(data.JourneyId), data.CoachType, db.SeatQuotaTATKAL, booking.LegMask, passengerNeeds(data.Passengers))
 		if err != nil {
-			return fmt.Errorf("not able to lock seats: %w", err)
+			return err
 		}
 
 		if len(seatIDs) < data.SeatCount {
-			return errors.New("not enough tatkal seats available")
+			return ErrNotEnoughTatkalSeats
 		}
 
 		for _, seatID := range seatIDs {
-			err := q.HoldSeat(ctx, db.HoldSeatParams{
+			err := holdSeat(ctx, q, db.HoldSeatParams{
+				LegMask:   booking.LegMask,
 				JourneyID: int32(data.JourneyId),
 				SeatID:    seatID,
-				BookingID: util.ToPgInt4(int32(bookingIdInt)),
+				BookingID: int32(bookingIdInt),
 			})
 			if err != nil {
 				return err
@@ -90,38 +124,285 @@ func (h *Handler) ProcessTatkalBooking(ctx context.Context,
 			}
 		}
 
+		_, err = insertPassengers(ctx, q, int32(bookingIdInt), seatIDs, data.Passengers)
+		return err
+
+	})
+
+	// the seats are held in the database now, or go back to the counter
+	if releaseErr := h.settleReservation(ctx, data, booking.ID, err != nil); releaseErr != nil {
+		logger.Error("failed to settle tatkal reservation of booking %d: %v", booking.ID, releaseErr)
+	}
+
+	if err != nil {
+		if errors.Is(err, errTatkalProcessed) {
+			return nil
+		}
+		if errors.Is(err, ErrNotEnoughTatkalSeats) {
+			return h.waitlistTatkal(ctx, booking, data, userId, ticket)
+		}
+		if !isRetryable(err) {
+			return h.failTatkal(ctx, booking.ID, ticket, err)
+		}
+		return err
+	}
+
+	h.publishProgress(ctx, booking.ID)
+
+	return h.openTatkalCheckout(ctx, booking, data, userId)
+}
+
+// openTatkalCheckout opens the payment session of a tatkal booking whose seats
+// are held, or that was waitlisted, and publishes the link. A booking that
+// already has one is only published again.
+func (h *Handler) openTatkalCheckout(ctx context.Context, booking db.Booking, data BookingRequest, userId string) error {
+	existing, err := h.store.GetLatestPaymentByBooking(ctx, util.ToPgInt4(booking.ID))
+	if err == nil && existing.SessionUrl.Valid {
+		h.publishProgress(ctx, booking.ID)
 		return nil
+	}
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+	// a waitlisted booking's payment was written when it was waitlisted
+	recorded := err == nil
+
+	breakdown, fareBreakdown, err := h.tatkalFare(ctx, booking, data)
+	if err != nil {
+		return err
+	}
 
+	// the hold began when the seats were held, not when the request was queued
+	session, err := h.Payments.CreateCheckoutSession(ctx, payment.CheckoutRequest{
+		BookingID:   booking.ID,
+		UserID:      userId,
+		HoldToken:   booking.Holdtoken.String,
+		Amount:      breakdown.Total,
+		Description: "booking_train",
+		ExpiresAt:   time.Now().Add(time.Duration(h.config.HOLD_TTL_SECONDS) * time.Second),
 	})
+	if err != nil {
+		return fmt.Errorf("not able to create the payment session: %w", err)
+	}
 
+	if recorded {
+		err = h.store.UpdatePaymentSession(ctx, db.UpdatePaymentSessionParams{
+			Bookingid:     util.ToPgInt4(booking.ID),
+			Transactionid: session.ID,
+			SessionUrl:    pgtype.Text{String: session.URL, Valid: true},
+		})
+	} else {
+		_, err = h.store.CreatePayment(ctx, db.CreatePaymentParams{
+			Bookingid:     util.ToPgInt4(booking.ID),
+			Amount:        breakdown.Total,
+			Transactionid: session.ID,
+			FareBreakdown: fareBreakdown,
+			SessionUrl:    pgtype.Text{String: session.URL, Valid: true},
+		})
+	}
+	if err != nil {
+		return fmt.Errorf("not able to create the payment: %w", err)
+	}
+
+	h.publishProgress(ctx, booking.ID)
+	return nil
+}
+
+// tatkalFare is what a queued tatkal booking is charged, and its breakdown
+// as stored with the payment.
+func (h *Handler) tatkalFare(ctx context.Context, booking db.Booking, data BookingRequest) (fare.Breakdown, []byte, error) {
+	journey, err := h.store.GetTrainJourneyById(ctx, int32(data.JourneyId))
+	if err != nil {
+		return fare.Breakdown{}, nil, err
+	}
+
+	segment, err := h.resolveSegment(ctx, journey.TrainID.Int32, data.FromStation, data.ToStation)
+	if err != nil {
+		return fare.Breakdown{}, nil, permanentError{err}
+	}
+
+	var breakdown fare.Breakdown
+	if booking.BookingType == db.BookingTypePREMIUMTATKAL {
+		breakdown, err = h.lockedFare(ctx, booking)
+		if err != nil {
+			return fare.Breakdown{}, nil, err
+		}
+	} else {
+		breakdown, err = fare.Quote(ctx, h.store, journey.TrainID.Int32, segment.DistanceKm, data.CoachType, db.BookingTypeTATKAL, data.SeatCount)
+		if err != nil {
+			return fare.Breakdown{}, nil, permanentError{err}
+		}
+	}
+
+	fareBreakdown, err := json.Marshal(breakdown)
+	if err != nil {
+		return fare.Breakdown{}, nil, permanentError{err}
+	}
+
+	return breakdown, fareBreakdown, nil
+}
+
+// waitlistTatkal puts a queued tatkal booking that found no tatkal seat on the
+// tatkal waitlist of its class and opens its payment session, as for the
+// general waitlist it is paid for up front. A user with a place still waiting
+// on the journey cannot take a second one, their booking fails instead, as
+// does a premium tatkal booking.
+func (h *Handler) waitlistTatkal(ctx context.Context, booking db.Booking, data BookingRequest, userId string, ticket waitingroom.Ticket) error {
+	if booking.BookingType == db.BookingTypePREMIUMTATKAL {
+		return h.failTatkal(ctx, booking.ID, ticket, ErrNoPremiumWaitlist)
+	}
+
+	breakdown, fareBreakdown, err := h.tatkalFare(ctx, booking, data)
+	if err != nil {
+		return err
+	}
+
+	err = h.store.ExecTx(ctx, func(q *db.Queries) error {
+		moved, err := q.WaitlistQueuedBooking(ctx, booking.ID)
+		if err != nil {
+			return err
+		}
+		if moved == 0 {
+			return errTatkalProcessed
+		}
+
+		err = q.LockTatkalWaitlist(ctx, db.LockTatkalWaitlistParams{
+			JourneyID: int32(data.JourneyId),
+			CoachType: string(data.CoachType),
+		})
+		if err != nil {
+			return err
+		}
+
+		_, err = q.InsertTatkalWaitlist(ctx, db.InsertTatkalWaitlistParams{
+			UserID:    uuid.UUID(booking.Userid.Bytes),
+			CoachType: data.CoachType,
+			JourneyID: util.ToPgInt4(int32(data.JourneyId)),
+			BookingID: util.ToPgInt4(booking.ID),
+		})
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrAlreadyTatkalWaitlisted
+		}
+		if err != nil {
+			return fmt.Errorf("not able to join the tatkal waitlist: %w", err)
+		}
+
+		if _, err := insertPassengers(ctx, q, booking.ID, nil, data.Passengers); err != nil {
+			return err
+		}
+
+		// written with the waitlist place, so promotion never finds the
+		// booking without a payment. Its session is opened next
+		_, err = q.CreatePayment(ctx, db.CreatePaymentParams{
+			Bookingid:     util.ToPgInt4(booking.ID),
+			Amount:        breakdown.Total,
+			FareBreakdown: fareBreakdown,
+		})
+		if err != nil {
+			return fmt.Errorf("not able to create the payment: %w", err)
+		}
+		return nil
+	})
+	if errors.Is(err, errTatkalProcessed) {
+		return nil
+	}
+	if errors.Is(err, ErrAlreadyTatkalWaitlisted) {
+		return h.failTatkal(ctx, booking.ID, ticket, err)
+	}
 	if err != nil {
-		// compensate
-		key := fmt.Sprintf("tatkal:available:%d:%s", data.JourneyId, data.CoachType)
-		_ = h.Redis.IncrBy(ctx, key, int64(data.SeatCount))
 		return err
 	}
 
+	h.publishProgress(ctx, booking.ID)
+
+	return h.openTatkalCheckout(ctx, booking, data, userId)
+}
+
+// failTatkal records why a queued tatkal booking did not get its seats and
+// tells the user. The job is settled then, it is not dead-lettered. The
+// waiting room place the booking used is given back, so the user can try
+// again without queueing afresh.
+func (h *Handler) failTatkal(ctx context.Context, bookingId int32, ticket waitingroom.Ticket, cause error) error {
+	_, err := h.store.FailQueuedBooking(ctx, db.FailQueuedBookingParams{
+		ID:            bookingId,
+		FailureReason: pgtype.Text{String: cause.Error(), Valid: true},
+	})
+	if err != nil {
+		return err
+	}
+
+	// jobs queued before tickets were carried have none to give back
+	if ticket.Number != 0 {
+		if err := h.WaitingRoom.Release(ctx, ticket); err != nil {
+			logger.Error("failed to release queue token of booking %d: %v", bookingId, err)
+		}
+	}
+
+	h.publishProgress(ctx, bookingId)
 	return nil
 }
 
+// reserveSeatsLua takes seats from the tatkal counter and notes them against
+// the booking until its hold is written, see WarmTatkalCounters. A booking
+// that already took its seats, before a redelivery of its job, takes none.
+//
+// KEYS[1] = seat counter, KEYS[2] = reservations
+// ARGV[1] = seats requested, ARGV[2] = booking id
 var reserveSeatsLua = `
--- reserve_seats.lua
--- KEYS[1] = seat key
--- ARGV[1] = seats requested
+if redis.call('HEXISTS', KEYS[2], ARGV[2]) == 1 then
+  return 1
+end
 local avail = tonumber(redis.call('GET', KEYS[1]) or '0')
 local req = tonumber(ARGV[1])
 if avail >= req then
   redis.call('DECRBY', KEYS[1], req)
+  redis.call('HSET', KEYS[2], ARGV[2], req)
+  local ttl = redis.call('PTTL', KEYS[1])
+  if ttl > 0 then
+    redis.call('PEXPIRE', KEYS[2], ttl)
+  end
   return 1
 end
 return 0
 `
 
-func (h *Handler) reserveSeats(ctx context.Context, data BookingRequest) (bool, error) {
-	key := fmt.Sprintf("tatkal:available:%d:%s", data.JourneyId, data.CoachType)
-	res, err := h.Redis.Eval(ctx, reserveSeatsLua, []string{key}, data.SeatCount).Result()
+// settleReservationLua forgets the seats a booking took from the counter,
+// giving them back when ARGV[2] is set.
+//
+// KEYS[1] = seat counter, KEYS[2] = reservations
+// ARGV[1] = booking id, ARGV[2] = give back
+var settleReservationLua = `
+local seats = tonumber(redis.call('HGET', KEYS[2], ARGV[1]) or '0')
+redis.call('HDEL', KEYS[2], ARGV[1])
+if ARGV[2] == '1' and seats > 0 and redis.call('EXISTS', KEYS[1]) == 1 then
+  redis.call('INCRBY', KEYS[1], seats)
+end
+return seats
+`
+
+func (h *Handler) reserveSeats(ctx context.Context, data BookingRequest, bookingId int32) (bool, error) {
+	keys := []string{
+		fare.TatkalCounterKey(int32(data.JourneyId), data.CoachType),
+		tatkalReservationsKey(int32(data.JourneyId), data.CoachType),
+	}
+	res, err := h.Redis.Eval(ctx, reserveSeatsLua, keys, data.SeatCount, bookingId).Result()
 	if err != nil {
 		return false, err
 	}
 	return res.(int64) == 1, nil
 }
+
+// settleReservation ends the reservation of reserveSeats once the booking's
+// transaction is over, giving the seats back to the counter when it did not
+// hold them.
+func (h *Handler) settleReservation(ctx context.Context, data BookingRequest, bookingId int32, giveBack bool) error {
+	keys := []string{
+		fare.TatkalCounterKey(int32(data.JourneyId), data.CoachType),
+		tatkalReservationsKey(int32(data.JourneyId), data.CoachType),
+	}
+	giveBackArg := "0"
+	if giveBack {
+		giveBackArg = "1"
+	}
+	return h.Redis.Eval(ctx, settleReservationLua, keys, bookingId, giveBackArg).Err()
+}
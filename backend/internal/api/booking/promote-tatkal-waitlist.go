@@ -0,0 +1,115 @@
+package booking
+
+import (
+	"better-uptime/common/logger"
+	"better-uptime/common/util"
+	db "better-uptime/internal/db/sqlc"
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// PromoteTatkalWaitlist is PromoteWaitlist for the tatkal waitlist of a
+// journey and class. Its bookings only move into tatkal seats given up by
+// other tatkal bookings, the general quota and waitlist are left alone.
+func (h *Handler) PromoteTatkalWaitlist(ctx context.Context, journeyId int32, coachType db.CoachType) error {
+	for {
+		var next *promotion
+
+		err := h.store.ExecTx(ctx, func(q *db.Queries) error {
+			var err error
+			next, err = promoteNextTatkalWaitlist(ctx, q, journeyId, coachType)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		if next == nil {
+			return nil
+		}
+
+		if next.HoldToken == "" {
+			logger.Info("tatkal waitlisted booking %d confirmed", next.BookingID)
+		} else if err := h.collectPayment(ctx, next); err != nil {
+			logger.Error("failed to collect payment for booking %d: %v", next.BookingID, err)
+		}
+
+		h.publishProgress(ctx, next.BookingID)
+	}
+}
+
+// promoteNextTatkalWaitlist moves the booking at the head of the tatkal
+// waitlist of a class into tatkal seats. It returns nil when the waitlist is
+// empty or its head does not fit.
+func promoteNextTatkalWaitlist(ctx context.Context, q *db.Queries, journeyId int32, coachType db.CoachType) (*promotion, error) {
+	var (
+		booking    db.Booking
+		passengers []db.GetPassengersByBookingRow
+		paid       db.Payment
+		wl         db.TatkalWaitlist
+	)
+
+	for {
+		var err error
+
+		wl, err = q.GetNextTatkalWaitlist(ctx, db.GetNextTatkalWaitlistParams{
+			JourneyID: util.ToPgInt4(journeyId),
+			CoachType: coachType,
+		})
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		booking, err = q.GetBookingById(ctx, wl.BookingID.Int32)
+		if err != nil {
+			return nil, err
+		}
+
+		passengers, err = q.GetPassengersByBooking(ctx, wl.BookingID)
+		if err != nil {
+			return nil, err
+		}
+
+		paid, err = q.GetLatestPaymentByBooking(ctx, wl.BookingID)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return nil, err
+		}
+		if err == nil && len(passengers) > 0 {
+			break
+		}
+
+		// the worker writes the payment with the waitlist place, a booking
+		// without one cannot be charged
+		logger.Error("dropping tatkal waitlisted booking %d, it has no payment or passengers", booking.ID)
+		if _, err := q.CancelTatkalWaitlist(ctx, wl.BookingID); err != nil {
+			return nil, err
+		}
+		err = q.UpdateBookingStatus(ctx, db.UpdateBookingStatusParams{
+			ID:     booking.ID,
+			Status: db.BookingStatusEXPIRED,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result, err := promoteIntoSeats(ctx, q, booking, passengers, paid, coachType, db.SeatQuotaTATKAL)
+	if err != nil || result == nil {
+		return nil, err
+	}
+
+	err = q.UpdateTatkalWaitlistStatus(ctx, db.UpdateTatkalWaitlistStatusParams{
+		ID:     wl.ID,
+		Status: db.NullWaitingStatus{WaitingStatus: db.WaitingStatusCONFIRMED, Valid: true},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
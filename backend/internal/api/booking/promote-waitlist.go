@@ -1,83 +1,270 @@
 package booking
 
 import (
+	"better-uptime/common/logger"
+	"better-uptime/common/payment"
+	"better-uptime/common/util"
 	db "better-uptime/internal/db/sqlc"
 	"context"
-	"strconv"
+	"errors"
+	"fmt"
+	"time"
 
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
-func (h *Handler) PromoteWaitlist(ctx context.Context, JourneyId string, CoachType db.CoachType) error {
+// promotion is a waitlisted booking that was just given seats.
+type promotion struct {
+	BookingID int32
+	JourneyID int32
+	UserID    string
+	Amount    float64
+	// HoldToken is set when the booking still has to be paid for
+	HoldToken string
+}
+
+// PromoteWaitlist works through the waitlist of a journey and class in order,
+// moving each booking into seats while there are enough free for all of its
+// passengers. A booking paid for up front is confirmed straight away; any
+// other has its seats held and gets a new payment page, and the hold sweeper
+// gives the seats to the next in line if it is not paid in time. It stops at
+// the first booking that does not fit, so nobody is overtaken.
+func (h *Handler) PromoteWaitlist(ctx context.Context, journeyId int32, coachType db.CoachType) error {
 	for {
+		var next *promotion
+
 		err := h.store.ExecTx(ctx, func(q *db.Queries) error {
-			JourneyID, err := strconv.Atoi(JourneyId)
-			train_journey, err := q.GetTrainJourneyById(ctx, int32(JourneyID))
-			if err != nil {
-				return err
-			}
+			var err error
+			next, err = promoteNextWaitlist(ctx, q, journeyId, coachType)
+			return err
+		})
+		if err != nil {
+			return err
+		}
 
-			availability, err := q.GetAvailableSeats(ctx, db.GetAvailableSeatsParams{
-				TrainID:     train_journey.TrainID,
-				JourneyDate: train_journey.JourneyDate,
-				Quota:       db.SeatQuotaNORMAL,
-			})
+		if next == nil {
+			return nil
+		}
 
-			if err != nil {
-				return err
-			}
-			var available int32
-			for _, a := range availability {
-				if a.CoachType == CoachType {
-					available = int32(a.AvailableSeats)
-					break
-				}
-			}
+		if next.HoldToken == "" {
+			logger.Info("waitlisted booking %d confirmed", next.BookingID)
+			continue
+		}
 
-			if available == 0 {
-				return nil
-			}
+		if err := h.collectPayment(ctx, next); err != nil {
+			logger.Error("failed to collect payment for booking %d: %v", next.BookingID, err)
+		}
+	}
+}
 
-			wl, err := q.GetNextWaitlist(ctx, pgtype.Int4{Int32: int32(JourneyID), Valid:  true})
-			if err != nil {
-				return nil
-			}
+// promoteNextWaitlist holds seats for the next waitlisted booking of a class
+// and confirms it if it is paid for. It returns nil when the waitlist is empty
+// or the booking at its head does not fit in the free seats.
+func promoteNextWaitlist(ctx context.Context, q *db.Queries, journeyId int32, coachType db.CoachType) (*promotion, error) {
+	var (
+		booking    db.Booking
+		passengers []db.GetPassengersByBookingRow
+		paid       db.Payment
+		wl         db.Waitlist
+	)
 
-			required := wl.WaitlistNumber
+	for {
+		var err error
 
-			if available < required {
-				return nil
-			}
+		wl, err = q.GetNextWaitlistByCoach(ctx, db.GetNextWaitlistByCoachParams{
+			JourneyID: util.ToPgInt4(journeyId),
+			CoachType: db.NullCoachType{CoachType: coachType, Valid: true},
+		})
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
 
-			err = q.ConfirmSeat(ctx, wl.Bookingid)
-			if err != nil {
-				return err
-			}
+		booking, err = q.GetBookingById(ctx, wl.Bookingid.Int32)
+		if err != nil {
+			return nil, err
+		}
 
-			// update booking
-			err = q.UpdateBookingStatus(ctx, db.UpdateBookingStatusParams{
-				ID:     wl.Bookingid.Int32,
-				Status: db.BookingStatusCONFIRMED,
-			})
+		passengers, err = q.GetPassengersByBooking(ctx, wl.Bookingid)
+		if err != nil {
+			return nil, err
+		}
+
+		paid, err = q.GetLatestPaymentByBooking(ctx, wl.Bookingid)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return nil, err
+		}
+		if err == nil && len(passengers) > 0 {
+			break
+		}
+
+		// a booking whose payment was never recorded cannot be charged, it
+		// leaves the waitlist instead of holding up everyone behind it. The
+		// payment is written in the transaction that waitlists the booking,
+		// so one committed without it never gets it
+		logger.Error("dropping waitlisted booking %d, it has no payment or passengers", booking.ID)
+		if err := q.CancelWaitlist(ctx, wl.Bookingid); err != nil {
+			return nil, err
+		}
+		err = q.UpdateBookingStatus(ctx, db.UpdateBookingStatusParams{
+			ID:     booking.ID,
+			Status: db.BookingStatusEXPIRED,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result, err := promoteIntoSeats(ctx, q, booking, passengers, paid, coachType, db.SeatQuotaNORMAL)
+	if err != nil || result == nil {
+		return nil, err
+	}
+
+	err = q.UpdateWaitlistStatus(ctx, db.UpdateWaitlistStatusParams{
+		ID:     wl.ID,
+		Status: db.WaitingStatusCONFIRMED,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// promoteIntoSeats holds seats of a quota for every passenger of a waitlisted
+// booking and confirms it if it is paid for, otherwise it starts a hold to be
+// paid. It returns nil when there are not enough free seats.
+func promoteIntoSeats(ctx context.Context, q *db.Queries, booking db.Booking, passengers []db.GetPassengersByBookingRow, paid db.Payment, coachType db.CoachType, quota db.SeatQuota) (*promotion, error) {
+	journeyId := booking.JourneyID.Int32
+	passengers = travelling(passengers)
+
+	seatIDs, err := allocateSeats(ctx, q, journeyId, coachType, quota, booking.LegMask, storedNeeds(passengers))
+	if err != nil {
+		return nil, err
+	}
+	if len(seatIDs) < len(passengers) {
+		return nil, nil
+	}
+
+	for i, seatID := range seatIDs {
+		err := holdSeat(ctx, q, db.HoldSeatParams{
+			LegMask:   booking.LegMask,
+			JourneyID: journeyId,
+			SeatID:    seatID,
+			BookingID: booking.ID,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = q.CreateBookingItem(ctx, db.CreateBookingItemParams{
+			Bookingid: util.ToPgInt4(booking.ID),
+			Seatid:    util.ToPgInt4(seatID),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create booking item: %w", err)
+		}
+
+		err = q.UpdatePassengerSeat(ctx, db.UpdatePassengerSeatParams{
+			ID:     passengers[i].ID,
+			SeatID: util.ToPgInt4(seatID),
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result := &promotion{
+		BookingID: booking.ID,
+		JourneyID: journeyId,
+		UserID:    uuid.UUID(booking.Userid.Bytes).String(),
+		Amount:    paid.Amount,
+	}
+
+	if paid.Status.Valid && paid.Status.PaymentStatus == db.PaymentStatusSUCCESS {
+		if err := q.ConfirmSeat(ctx, booking.ID); err != nil {
+			return nil, err
+		}
+
+		err = q.UpdateBookingItemStatus(ctx, db.UpdateBookingItemStatusParams{
+			Bookingid:     util.ToPgInt4(booking.ID),
+			Bookingstatus: db.BookingStatusCONFIRMED,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		err = q.UpdateBookingStatus(ctx, db.UpdateBookingStatusParams{
+			ID:     booking.ID,
+			Status: db.BookingStatusCONFIRMED,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return result, nil
+	}
+
+	// a new hold token keeps the expiry of the page opened while waitlisted
+	// from expiring this hold
+	result.HoldToken = uuid.New().String()
+	err = q.HoldPromotedBooking(ctx, db.HoldPromotedBookingParams{
+		ID:        booking.ID,
+		Holdtoken: pgtype.Text{String: result.HoldToken, Valid: true},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// collectPayment opens a payment page for the hold of a promoted booking. When
+// no page can be opened the booking is expired right away, so its seats go to
+// the next in line instead of sitting out the hold.
+func (h *Handler) collectPayment(ctx context.Context, p *promotion) error {
+	session, err := h.Payments.CreateCheckoutSession(ctx, payment.CheckoutRequest{
+		BookingID:   p.BookingID,
+		UserID:      p.UserID,
+		HoldToken:   p.HoldToken,
+		Amount:      p.Amount,
+		Description: "booking_train",
+		ExpiresAt:   time.Now().Add(time.Duration(h.config.HOLD_TTL_SECONDS) * time.Second),
+	})
+	if err != nil {
+		expireErr := h.store.ExecTx(ctx, func(q *db.Queries) error {
+			booking, err := q.GetBookingById(ctx, p.BookingID)
 			if err != nil {
 				return err
 			}
+			if booking.Status != db.BookingStatusPENDING {
+				return nil
+			}
 
-			// update waitlist
-			err = q.UpdateWaitlistStatus(ctx, db.UpdateWaitlistStatusParams{
-				ID:     wl.ID,
-				Status: db.WaitingStatusCONFIRMED,
+			err = q.UpdateBookingStatus(ctx, db.UpdateBookingStatusParams{
+				ID:     p.BookingID,
+				Status: db.BookingStatusEXPIRED,
 			})
 			if err != nil {
 				return err
 			}
 
-			return nil
-
+			return h.expireBooking(ctx, q, p.BookingID, p.JourneyID)
 		})
-
-		if err != nil {
-			return err
+		if expireErr != nil {
+			logger.Error("failed to expire booking %d: %v", p.BookingID, expireErr)
 		}
+
+		return fmt.Errorf("not able to create booking intent: %w", err)
 	}
+
+	return h.store.UpdatePaymentSession(ctx, db.UpdatePaymentSessionParams{
+		Bookingid:     util.ToPgInt4(p.BookingID),
+		Transactionid: session.ID,
+		SessionUrl:    pgtype.Text{String: session.URL, Valid: true},
+	})
 }
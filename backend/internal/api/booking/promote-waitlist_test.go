@@ -0,0 +1,96 @@
+package booking
+
+import (
+	"better-uptime/internal/db/dbtest"
+	db "better-uptime/internal/db/sqlc"
+	"context"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// waitlistedBooking queues a booking at the head of the waitlist, with one
+// passenger, its payment if there is one and a free seat to promote it into.
+func waitlistedBooking(data *dbtest.DB, paid *db.Payment) {
+	data.Return("GetNextWaitlistByCoach", db.Waitlist{ID: 2, Bookingid: pgtype.Int4{Int32: 4, Valid: true}})
+	data.Return("GetBookingById", db.Booking{
+		ID:        4,
+		JourneyID: pgtype.Int4{Int32: 3, Valid: true},
+		Status:    db.BookingStatusWAITLIST,
+		LegMask:   1,
+	})
+	data.Return("GetPassengersByBooking", db.GetPassengersByBookingRow{ID: 8, Name: "Asha", Age: 30, Gender: "F"})
+	if paid != nil {
+		data.Return("GetLatestPaymentByBooking", *paid)
+	}
+	data.Return("ListFreeSeats", db.ListFreeSeatsRow{SeatID: 50, CoachNumber: 1, SeatNo: 1, Berth: db.BerthTypeDOWN})
+	data.Return("LockFreeSeats", int32(50))
+	data.Return("CreateBookingItem", db.Bookingitem{ID: 1})
+}
+
+func TestPromotionKeepsBookingWhosePageIsNotOpenYet(t *testing.T) {
+	data := dbtest.New()
+	// written with the booking, the checkout page is opened after commit
+	waitlistedBooking(data, &db.Payment{
+		ID:        6,
+		Bookingid: pgtype.Int4{Int32: 4, Valid: true},
+		Amount:    500,
+		Status:    db.NullPaymentStatus{PaymentStatus: db.PaymentStatusPENDING, Valid: true},
+	})
+
+	next, err := promoteNextWaitlist(context.Background(), db.New(data), 3, db.CoachTypeSL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next == nil || next.BookingID != 4 || next.HoldToken == "" {
+		t.Fatalf("booking not promoted into a hold: %+v", next)
+	}
+
+	if calls := data.Calls("CancelWaitlist"); len(calls) != 0 {
+		t.Errorf("booking dropped off the waitlist: %v", calls)
+	}
+	if calls := data.Calls("HoldSeat"); len(calls) != 1 {
+		t.Errorf("%d seats held", len(calls))
+	}
+}
+
+func TestPromotionDropsBookingWithoutPayment(t *testing.T) {
+	data := dbtest.New()
+	waitlistedBooking(data, nil)
+	// the dropped booking was the only one waiting
+	data.Return("GetNextWaitlistByCoach")
+
+	next, err := promoteNextWaitlist(context.Background(), db.New(data), 3, db.CoachTypeSL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next != nil {
+		t.Fatalf("promoted %+v", next)
+	}
+
+	statuses := data.Calls("UpdateBookingStatus")
+	if len(statuses) != 1 || statuses[0].Args[1] != db.BookingStatusEXPIRED {
+		t.Fatalf("booking statuses %v", statuses)
+	}
+}
+
+func TestPromotionStopsWhenTheSeatWasNotHeld(t *testing.T) {
+	data := dbtest.New()
+	waitlistedBooking(data, &db.Payment{
+		ID:        6,
+		Bookingid: pgtype.Int4{Int32: 4, Valid: true},
+		Amount:    500,
+		Status:    db.NullPaymentStatus{PaymentStatus: db.PaymentStatusPENDING, Valid: true},
+	})
+	// the seat's legs were taken after it was locked free
+	data.Return("HoldSeat", int64(0))
+
+	if _, err := promoteNextWaitlist(context.Background(), db.New(data), 3, db.CoachTypeSL); err == nil {
+		t.Fatal("promoted without holding the seat")
+	}
+	for _, name := range []string{"CreateBookingItem", "UpdatePassengerSeat", "CancelWaitlist"} {
+		if calls := data.Calls(name); len(calls) != 0 {
+			t.Errorf("%s called for a seat not held", name)
+		}
+	}
+}
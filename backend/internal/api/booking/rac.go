@@ -0,0 +1,252 @@
+package booking
+
+import (
+	"better-uptime/common/util"
+	db "better-uptime/internal/db/sqlc"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// allocateRac puts the passengers of a booking on the RAC berths of their
+// class, two to a berth, filling berths in order. It allocates nothing and
+// returns false when there are not enough RAC places for all of them.
+func allocateRac(ctx context.Context, q *db.Queries, journeyId int32, coachType db.CoachType, legMask int64, bookingId int32, passengerIDs []int32) (bool, error) {
+	berths, err := q.LockRacBerths(ctx, db.LockRacBerthsParams{
+		JourneyID: journeyId,
+		CoachType: coachType,
+		LegMask:   legMask,
+	})
+	if err != nil {
+		return false, fmt.Errorf("not able to lock rac berths: %w", err)
+	}
+
+	places := make([]int32, 0, len(passengerIDs))
+	for _, berth := range berths {
+		for i := int32(0); i < berth.FreePlaces && len(places) < len(passengerIDs); i++ {
+			places = append(places, berth.SeatID)
+		}
+	}
+	if len(places) < len(passengerIDs) {
+		return false, nil
+	}
+
+	for i, passengerID := range passengerIDs {
+		racNumber, err := q.GetNextRacNumber(ctx, db.GetNextRacNumberParams{
+			JourneyID: journeyId,
+			CoachType: coachType,
+		})
+		if err != nil {
+			return false, err
+		}
+
+		err = q.CreateRacPassenger(ctx, db.CreateRacPassengerParams{
+			JourneyID:   journeyId,
+			SeatID:      places[i],
+			CoachType:   coachType,
+			BookingID:   bookingId,
+			PassengerID: passengerID,
+			LegMask:     legMask,
+			RacNumber:   racNumber,
+		})
+		if err != nil {
+			return false, fmt.Errorf("failed to allocate rac for passenger %d: %w", passengerID, err)
+		}
+	}
+
+	return true, nil
+}
+
+// PromoteRac moves passengers of a class up once seats are released: RAC
+// passengers of paid bookings are confirmed into free seats in RAC order, then
+// the RAC places they leave go to the waitlist in waitlist order. It stops at
+// the first passenger or booking that does not fit, so nobody is overtaken.
+// Waitlisted bookings that fit in free seats outright are left to
+// PromoteWaitlist.
+func (h *Handler) PromoteRac(ctx context.Context, journeyId int32, coachType db.CoachType) error {
+	for {
+		var promoted bool
+
+		err := h.store.ExecTx(ctx, func(q *db.Queries) error {
+			var err error
+
+			promoted, err = confirmNextRac(ctx, q, journeyId, coachType)
+			if err != nil || promoted {
+				return err
+			}
+
+			promoted, err = racNextWaitlist(ctx, q, journeyId, coachType)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		if !promoted {
+			return nil
+		}
+	}
+}
+
+// confirmNextRac gives the next RAC passenger a seat of their own. The booking
+// is confirmed once none of its passengers is left on RAC.
+func confirmNextRac(ctx context.Context, q *db.Queries, journeyId int32, coachType db.CoachType) (bool, error) {
+	rac, err := q.GetNextRacPassenger(ctx, db.GetNextRacPassengerParams{
+		JourneyID: journeyId,
+		CoachType: coachType,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	seatIDs, err := q.LockAvailableSeats(ctx, db.LockAvailableSeatsParams{
+		JourneyID: journeyId,
+		CoachType: coachType,
+		Quota:     db.SeatQuotaNORMAL,
+		LegMask:   rac.LegMask,
+		SeatLimit: 1,
+	})
+	if err != nil {
+		return false, fmt.Errorf("not able to lock seats: %w", err)
+	}
+	if len(seatIDs) == 0 {
+		return false, nil
+	}
+	seatID := seatIDs[0]
+
+	// the booking is paid, so the seat is held and sold straight away
+	err = holdSeat(ctx, q, db.HoldSeatParams{
+		LegMask:   rac.LegMask,
+		JourneyID: journeyId,
+		SeatID:    seatID,
+		BookingID: rac.BookingID,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	if err := q.ConfirmSeat(ctx, rac.BookingID); err != nil {
+		return false, err
+	}
+
+	_, err = q.CreateBookingItem(ctx, db.CreateBookingItemParams{
+		Bookingid: util.ToPgInt4(rac.BookingID),
+		Seatid:    util.ToPgInt4(seatID),
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to create booking item: %w", err)
+	}
+
+	err = q.ConfirmBookingItem(ctx, db.ConfirmBookingItemParams{
+		Bookingid: util.ToPgInt4(rac.BookingID),
+		Seatid:    util.ToPgInt4(seatID),
+	})
+	if err != nil {
+		return false, err
+	}
+
+	err = q.UpdatePassengerSeat(ctx, db.UpdatePassengerSeatParams{
+		ID:     rac.PassengerID,
+		SeatID: util.ToPgInt4(seatID),
+	})
+	if err != nil {
+		return false, err
+	}
+
+	if err := q.ConfirmRacPassenger(ctx, rac.ID); err != nil {
+		return false, err
+	}
+
+	left, err := q.CountRacByBooking(ctx, rac.BookingID)
+	if err != nil {
+		return false, err
+	}
+
+	if left == 0 {
+		err = q.UpdateBookingStatus(ctx, db.UpdateBookingStatusParams{
+			ID:     rac.BookingID,
+			Status: db.BookingStatusCONFIRMED,
+		})
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// racNextWaitlist moves the next paid waitlisted booking of a class to RAC
+// when there are RAC places for all of its passengers. An unpaid booking is
+// left on the waitlist, RAC is only promoted from paid bookings and would
+// otherwise hold its berths until charting.
+func racNextWaitlist(ctx context.Context, q *db.Queries, journeyId int32, coachType db.CoachType) (bool, error) {
+	wl, err := q.GetNextPaidWaitlistByCoach(ctx, db.GetNextPaidWaitlistByCoachParams{
+		JourneyID: util.ToPgInt4(journeyId),
+		CoachType: db.NullCoachType{CoachType: coachType, Valid: true},
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	booking, err := q.GetBookingById(ctx, wl.Bookingid.Int32)
+	if err != nil {
+		return false, err
+	}
+
+	passengers, err := q.GetPassengersByBooking(ctx, wl.Bookingid)
+	if err != nil {
+		return false, err
+	}
+	passengers = travelling(passengers)
+
+	// seats for the whole booking means it skips RAC altogether
+	seatIDs, err := q.LockAvailableSeats(ctx, db.LockAvailableSeatsParams{
+		JourneyID: journeyId,
+		CoachType: coachType,
+		Quota:     db.SeatQuotaNORMAL,
+		LegMask:   booking.LegMask,
+		SeatLimit: int32(len(passengers)),
+	})
+	if err != nil {
+		return false, fmt.Errorf("not able to lock seats: %w", err)
+	}
+	if len(seatIDs) >= len(passengers) {
+		return false, nil
+	}
+
+	passengerIDs := make([]int32, 0, len(passengers))
+	for _, p := range passengers {
+		passengerIDs = append(passengerIDs, p.ID)
+	}
+
+	ok, err := allocateRac(ctx, q, journeyId, coachType, booking.LegMask, booking.ID, passengerIDs)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	err = q.UpdateBookingStatus(ctx, db.UpdateBookingStatusParams{
+		ID:     booking.ID,
+		Status: db.BookingStatusRAC,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	err = q.UpdateWaitlistStatus(ctx, db.UpdateWaitlistStatusParams{
+		ID:     wl.ID,
+		Status: db.WaitingStatusRAC,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
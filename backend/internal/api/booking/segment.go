@@ -0,0 +1,51 @@
+package booking
+
+import (
+	"better-uptime/common/util"
+	db "better-uptime/internal/db/sqlc"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type journeySegment struct {
+	FromStationID pgtype.Int4
+	ToStationID   pgtype.Int4
+	LegMask       int64
+	// DistanceKm is 0 when the booking covers the whole journey
+	DistanceKm int32
+}
+
+// resolveSegment maps the boarding and destination stations of a request onto
+// the train route. A request without stations books the whole journey.
+func (h *Handler) resolveSegment(ctx context.Context, trainId int32, from, to string) (journeySegment, error) {
+	if from == "" && to == "" {
+		return journeySegment{LegMask: util.FullJourney}, nil
+	}
+	if from == "" || to == "" {
+		return journeySegment{}, errors.New("both from_station and to_station are required")
+	}
+
+	segment, err := h.store.GetRouteSegment(ctx, db.GetRouteSegmentParams{
+		TrainID:  trainId,
+		FromCode: strings.ToUpper(from),
+		ToCode:   strings.ToUpper(to),
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return journeySegment{}, fmt.Errorf("train does not run from %s to %s", from, to)
+		}
+		return journeySegment{}, err
+	}
+
+	return journeySegment{
+		FromStationID: util.ToPgInt4(segment.FromStationID),
+		ToStationID:   util.ToPgInt4(segment.ToStationID),
+		LegMask:       util.LegMask(segment.FromSequence, segment.ToSequence),
+		DistanceKm:    segment.ToDistanceKm - segment.FromDistanceKm,
+	}, nil
+}
@@ -0,0 +1,105 @@
+package booking
+
+import (
+	"better-uptime/common/logger"
+	"better-uptime/internal/api/fare"
+	db "better-uptime/internal/db/sqlc"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// counters are kept a while past the window so late compensations of
+// reserveSeats do not recreate them from zero
+const tatkalCounterGrace = time.Hour
+
+// tatkalReservationsKey holds the seats each booking took from the tatkal
+// counter of a class that its transaction has not written yet.
+func tatkalReservationsKey(journeyId int32, coachType db.CoachType) string {
+	return fmt.Sprintf("tatkal:reserved:%d:%s", journeyId, coachType)
+}
+
+// warmCounterLua sets a tatkal counter to the seats free in the database less
+// the seats reserved by bookings not written yet, which the database does not
+// count as taken. It returns the previous value, -1 when there was none, and
+// the new one.
+//
+// KEYS[1] = seat counter, KEYS[2] = reservations
+// ARGV[1] = free seats in the database, ARGV[2] = ttl in ms
+var warmCounterLua = `
+local reserved = 0
+for _, seats in ipairs(redis.call('HVALS', KEYS[2])) do
+  reserved = reserved + tonumber(seats)
+end
+local available = math.max(tonumber(ARGV[1]) - reserved, 0)
+local current = tonumber(redis.call('GET', KEYS[1]) or '-1')
+redis.call('SET', KEYS[1], available, 'PX', ARGV[2])
+if reserved > 0 then
+  redis.call('PEXPIRE', KEYS[2], ARGV[2])
+end
+return {current, available}
+`
+
+// RunTatkalWarmup loads and reconciles the tatkal counters every interval
+// until ctx is done.
+func (h *Handler) RunTatkalWarmup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := h.WarmTatkalCounters(ctx); err != nil {
+				logger.Error("tatkal warmup failed: %v", err)
+			}
+		}
+	}
+}
+
+// WarmTatkalCounters sets the tatkal counter of every class whose tatkal
+// window opens within TATKAL_WARMUP_LEAD_MINUTES, or is open, to the free
+// TATKAL seats in the database, less the seats of jobs that took them from
+// the counter but have not held them yet, and returns how many counters it
+// set. Run again while the window is open it puts right counters that
+// drifted, such as seats of expired or cancelled tatkal bookings that were
+// never added back. The database stays the authority: a counter that is too
+// high only lets a job through to LockAvailableSeats, which turns it away.
+func (h *Handler) WarmTatkalCounters(ctx context.Context) (int, error) {
+	// tatkal_config holds its times in UTC
+	now := time.Now().UTC()
+	lead := time.Duration(h.config.TATKAL_WARMUP_LEAD_MINUTES) * time.Minute
+
+	counters, err := h.store.ListTatkalCounters(ctx, db.ListTatkalCountersParams{
+		WarmUntil: pgtype.Timestamp{Time: now.Add(lead), Valid: true},
+		Now:       pgtype.Timestamp{Time: now, Valid: true},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, c := range counters {
+		key := fare.TatkalCounterKey(c.JourneyID, c.CoachType)
+		ttl := time.Until(c.TatkalEndTime.Time) + tatkalCounterGrace
+
+		res, err := h.Redis.Eval(ctx, warmCounterLua,
+			[]string{key, tatkalReservationsKey(c.JourneyID, c.CoachType)},
+			c.Available, ttl.Milliseconds(),
+		).Int64Slice()
+		if err != nil {
+			return 0, err
+		}
+
+		switch current, available := res[0], res[1]; {
+		case current < 0:
+			logger.Info("tatkal counter %s loaded with %d seats", key, available)
+		case current != available:
+			logger.Info("tatkal counter %s reconciled from %d to %d seats", key, current, available)
+		}
+	}
+
+	return len(counters), nil
+}
@@ -2,19 +2,21 @@ package booking
 
 import (
 	"better-uptime/common/logger"
+	"better-uptime/common/payment"
 	"better-uptime/common/util"
+	"better-uptime/internal/api/cancellation"
 	db "better-uptime/internal/db/sqlc"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"strconv"
 	"time"
 
-	"github.com/stripe/stripe-go/v84"
-	"github.com/stripe/stripe-go/v84/webhook"
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
 type BookingLockContext struct {
@@ -31,46 +33,36 @@ func (h *Handler) StripeWebhook(w http.ResponseWriter, r *http.Request) {
 		util.ErrorJson(w, errors.New("bad request"))
 		return
 	}
-	fmt.Println("🔥 webhook hit")
-	sig := r.Header.Get("Stripe-Signature")
-	fmt.Println(sig)
-	fmt.Println("🔥 secret", h.config.STRIPE_WEBHOOK_SECRET)
-	event, err := webhook.ConstructEventWithOptions(payload, sig, h.config.STRIPE_WEBHOOK_SECRET,
-	webhook.ConstructEventOptions{
-		IgnoreAPIVersionMismatch: true,
-	})
-	
+	event, err := h.Payments.VerifyWebhook(payload, r.Header)
 	if err != nil {
-		util.ErrorJson(w, fmt.Errorf("not able to create event", err),)
+		util.ErrorJson(w, err)
 		return
 	}
 
-	fmt.Println("✅ event type:", event.Type)
-
 	switch event.Type {
-	case "checkout.session.completed":
+	case payment.EventCheckoutCompleted:
 		h.handlePaymentSuccess(event, ctx)
 
-	case "checkout.session.expired":
+	case payment.EventCheckoutExpired:
 		h.handlePaymentExpired(event, ctx)
 
-	case "payment_intent.payment_failed":
+	case payment.EventPaymentFailed:
 		h.handlePaymentExpired(event, ctx)
+
+	case payment.EventRefundUpdated, payment.EventRefundFailed:
+		if err := cancellation.SettleRefund(ctx, h.store, event); err != nil {
+			logger.Error("failed to settle refund %s: %v", event.RefundID, err)
+			util.ErrorJson(w, err)
+			return
+		}
 	}
 
 	util.WriteJson(w, http.StatusOK, nil)
 
 }
 
-func (h *Handler) handlePaymentSuccess(event stripe.Event, ctx context.Context) {
-	var session stripe.CheckoutSession
-
-	if err := json.Unmarshal(event.Data.Raw, &session); err != nil {
-		logger.Error("failed to parse checkout session", err)
-		return
-	}
-
-	bookingIDStr := session.Metadata["booking_id"]
+func (h *Handler) handlePaymentSuccess(event *payment.Event, ctx context.Context) {
+	bookingIDStr := event.BookingID
 	if bookingIDStr == "" {
 		logger.Error("missing booking_id in metadata")
 		return
@@ -78,7 +70,7 @@ func (h *Handler) handlePaymentSuccess(event stripe.Event, ctx context.Context)
 
 	bookingId, err := strconv.Atoi(bookingIDStr)
 	if err != nil {
-		logger.Error("invalid booking_id", err)
+		logger.Error("invalid booking_id: %v", err)
 		return
 	}
 
@@ -88,25 +80,47 @@ func (h *Handler) handlePaymentSuccess(event stripe.Event, ctx context.Context)
 			return err
 		}
 
-		if booking.Status == db.BookingStatusCONFIRMED {
-			return nil
-		}
-
-		err = q.UpdateBookingStatus(ctx, db.UpdateBookingStatusParams{
-			ID:     int32(bookingId),
-			Status: db.BookingStatusCONFIRMED,
-		})
-
-		if err != nil {
-			return err
+		// only a booking waiting on its payment is confirmed by it. Any other
+		// was paid already, which a redelivered event finds, or lost its
+		// seats first: the hold ran out, it was cancelled or it failed
+		switch booking.Status {
+		case db.BookingStatusPENDING, db.BookingStatusRAC, db.BookingStatusWAITLIST:
+		default:
+			return refundLatePayment(ctx, q, booking, event.PaymentID)
 		}
 
-		err = q.UpdateBookingItemStatus(ctx, db.UpdateBookingItemStatusParams{
-			Bookingid:     util.ToPgInt4(int32(bookingId)),
-			Bookingstatus: db.BookingStatusCONFIRMED,
-		})
-		if err != nil {
-			return err
+		// paid up front while waitlisted, the booking stays on the waitlist
+		// and PromoteWaitlist confirms it once it gets seats
+		waitlisted := booking.Status == db.BookingStatusWAITLIST
+
+		if !waitlisted {
+			// passengers still sharing a berth keep the booking on RAC until
+			// PromoteRac confirms them
+			status := db.BookingStatusCONFIRMED
+			rac, err := q.CountRacByBooking(ctx, int32(bookingId))
+			if err != nil {
+				return err
+			}
+			if rac > 0 {
+				status = db.BookingStatusRAC
+			}
+
+			err = q.UpdateBookingStatus(ctx, db.UpdateBookingStatusParams{
+				ID:     int32(bookingId),
+				Status: status,
+			})
+
+			if err != nil {
+				return err
+			}
+
+			err = q.UpdateBookingItemStatus(ctx, db.UpdateBookingItemStatusParams{
+				Bookingid:     util.ToPgInt4(int32(bookingId)),
+				Bookingstatus: db.BookingStatusCONFIRMED,
+			})
+			if err != nil {
+				return err
+			}
 		}
 
 		err = q.UpdatePaymentStatus(ctx, db.UpdatePaymentStatusParams{
@@ -117,29 +131,100 @@ func (h *Handler) handlePaymentSuccess(event stripe.Event, ctx context.Context)
 			return err
 		}
 
-		err = q.ConfirmSeat(ctx, util.ToPgInt4(int32(bookingId)))
+		// refunds of this booking are made against the gateway's payment
+		if event.PaymentID != "" {
+			err = q.UpdatePaymentGatewayID(ctx, db.UpdatePaymentGatewayIDParams{
+				Bookingid:        util.ToPgInt4(int32(bookingId)),
+				GatewayPaymentID: pgtype.Text{String: event.PaymentID, Valid: true},
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		if waitlisted {
+			return nil
+		}
+
+		err = q.ConfirmSeat(ctx, int32(bookingId))
 		if err != nil {
 			return err
 		}
 
 		return nil
 	}); err != nil {
-		logger.Error("error occurred while updating booking status", err)
+		logger.Error("error occurred while updating booking status: %v", err)
+		return
 	}
 
+	h.publishProgress(ctx, int32(bookingId))
+}
+
+// refundLatePayment records a payment made after the booking expired, or was
+// cancelled or failed, and queues a full refund of it for the refund
+// processor. A redelivered webhook finds the payment already recorded and
+// does nothing.
+func refundLatePayment(ctx context.Context, q *db.Queries, booking db.Booking, paymentId string) error {
+	paid, err := q.GetLatestPaymentByBooking(ctx, util.ToPgInt4(booking.ID))
+	if err != nil {
+		return err
+	}
+	if paid.Status.PaymentStatus == db.PaymentStatusSUCCESS {
+		return nil
+	}
+
+	logger.Error("payment received for %s booking %d, refunding it", booking.Status, booking.ID)
+
+	err = q.UpdatePaymentStatus(ctx, db.UpdatePaymentStatusParams{
+		Bookingid: util.ToPgInt4(booking.ID),
+		Status:    db.NullPaymentStatus{PaymentStatus: db.PaymentStatusSUCCESS, Valid: true},
+	})
+	if err != nil {
+		return err
+	}
+
+	gatewayPaymentId := pgtype.Text{String: paymentId, Valid: paymentId != ""}
+	if gatewayPaymentId.Valid {
+		err = q.UpdatePaymentGatewayID(ctx, db.UpdatePaymentGatewayIDParams{
+			Bookingid:        util.ToPgInt4(booking.ID),
+			GatewayPaymentID: gatewayPaymentId,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	passengers, err := q.CountPassengersByBooking(ctx, util.ToPgInt4(booking.ID))
+	if err != nil {
+		return err
+	}
+
+	breakdown, err := json.Marshal(cancellation.HoldExpired(booking.BookingType, int(passengers), paid.Amount, time.Now()))
+	if err != nil {
+		return err
+	}
+
+	_, err = q.CreateRefund(ctx, db.CreateRefundParams{
+		Userid:             booking.Userid,
+		Bookingid:          util.ToPgInt4(booking.ID),
+		Amount:             int32(math.Round(paid.Amount)),
+		Status:             db.RefundStatusPENDING,
+		DeductionBreakdown: breakdown,
+		PaymentID:          gatewayPaymentId,
+		IdempotencyKey:     pgtype.Text{String: fmt.Sprintf("refund_%d_hold_expired", booking.ID), Valid: true},
+	})
+	if err != nil {
+		return fmt.Errorf("not able to create the refund: %w", err)
+	}
+
+	return nil
 }
 
 func (h *Handler) handlePaymentExpired(
-	event stripe.Event,
+	event *payment.Event,
 	ctx context.Context,
 ) {
-	var session stripe.CheckoutSession
-	if err := json.Unmarshal(event.Data.Raw, &session); err != nil {
-		logger.Error("failed to parse checkout session", err)
-		return
-	}
-
-	bookingIDStr := session.Metadata["booking_id"]
+	bookingIDStr := event.BookingID
 	if bookingIDStr == "" {
 		logger.Error("missing booking_id in metadata")
 		return
@@ -147,10 +232,11 @@ func (h *Handler) handlePaymentExpired(
 
 	bookingID, err := strconv.Atoi(bookingIDStr)
 	if err != nil {
-		logger.Error("invalid booking_id", err)
+		logger.Error("invalid booking_id: %v", err)
 		return
 	}
 
+	expired := false
 	err = h.store.ExecTx(ctx, func(q *db.Queries) error {
 
 		booking, err := q.GetBookingById(ctx, int32(bookingID))
@@ -158,7 +244,14 @@ func (h *Handler) handlePaymentExpired(
 			return err
 		}
 
-		if booking.Status == db.BookingStatusCONFIRMED {
+		// already confirmed, or already expired by the hold sweeper
+		if booking.Status != db.BookingStatusPENDING {
+			return nil
+		}
+
+		// the page opened while the booking was waitlisted, its promotion
+		// started a new hold with a page of its own
+		if event.HoldToken != "" && event.HoldToken != booking.Holdtoken.String {
 			return nil
 		}
 
@@ -170,28 +263,20 @@ func (h *Handler) handlePaymentExpired(
 			return err
 		}
 
-		// 2. BookingItems → EXPIRED
-		if err := q.UpdateBookingItemStatus(ctx, db.UpdateBookingItemStatusParams{
-			Bookingid:     util.ToPgInt4(int32(bookingID)),
-			Bookingstatus: db.BookingStatusEXPIRED,
-		}); err != nil {
-			return err
-		}
-
-		// 3. Payment → FAILED
-		if err := q.UpdatePaymentStatus(ctx, db.UpdatePaymentStatusParams{
-			Bookingid: util.ToPgInt4(int32(bookingID)),
-			Status:    db.NullPaymentStatus{PaymentStatus: db.PaymentStatusFAILED, Valid: true},
-		}); err != nil {
-			return err
-		}
-
-		return nil
+		// 2. BookingItems → EXPIRED, Payment → FAILED, seats released
+		expired = true
+		return h.expireBooking(ctx, q, int32(bookingID), booking.JourneyID.Int32)
 	})
 
 	if err != nil {
-		logger.Error("failed to expire booking", err)
+		logger.Error("failed to expire booking: %v", err)
 		return
 	}
 
+	// a failed payment leaves the page open for another try
+	if expired {
+		h.closeCheckout(ctx, int32(bookingID))
+	}
+
+	h.publishProgress(ctx, int32(bookingID))
 }
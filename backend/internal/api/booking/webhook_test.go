@@ -0,0 +1,208 @@
+package booking
+
+import (
+	"better-uptime/common/stripe"
+	"better-uptime/config"
+	"better-uptime/internal/api/cancellation"
+	"better-uptime/internal/db/dbtest"
+	db "better-uptime/internal/db/sqlc"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/redis/go-redis/v9"
+	"github.com/stripe/stripe-go/v84/webhook"
+)
+
+const testWebhookSecret = "whsec_test"
+
+func newWebhookHandler(store db.Store) *Handler {
+	// nothing listens there, progress updates fail and are only logged
+	rdb := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+
+	return &Handler{
+		config:   &config.Config{HOLD_TTL_SECONDS: 600},
+		store:    store,
+		Redis:    *rdb,
+		Payments: stripe.NewFakeGateway("http://localhost", "http://localhost/webhook", testWebhookSecret),
+	}
+}
+
+// sendCheckoutCompleted posts a signed checkout.session.completed webhook for
+// a booking.
+func sendCheckoutCompleted(t *testing.T, h *Handler, bookingId, paymentId string) {
+	t.Helper()
+
+	body, err := json.Marshal(map[string]interface{}{
+		"id":      "evt_test",
+		"object":  "event",
+		"type":    "checkout.session.completed",
+		"created": time.Now().Unix(),
+		"data": map[string]interface{}{"object": map[string]interface{}{
+			"id":             "cs_test",
+			"object":         "checkout.session",
+			"status":         "complete",
+			"payment_status": "paid",
+			"payment_intent": paymentId,
+			"metadata":       map[string]string{"booking_id": bookingId, "hold_token": "hold"},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed := webhook.GenerateTestSignedPayload(&webhook.UnsignedPayload{
+		Payload:   body,
+		Secret:    testWebhookSecret,
+		Timestamp: time.Now(),
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/webhook/stripe", bytes.NewReader(body))
+	req.Header.Set("Stripe-Signature", signed.Header)
+	w := httptest.NewRecorder()
+	h.StripeWebhook(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("webhook returned %d: %s", w.Code, w.Body)
+	}
+}
+
+func expiredBooking() db.Booking {
+	return db.Booking{
+		ID:          7,
+		Userid:      pgtype.UUID{Bytes: [16]byte{1}, Valid: true},
+		JourneyID:   pgtype.Int4{Int32: 3, Valid: true},
+		BookingType: db.BookingTypeNORMAL,
+		Status:      db.BookingStatusEXPIRED,
+		Holdtoken:   pgtype.Text{String: "hold", Valid: true},
+	}
+}
+
+func TestPaymentForExpiredBookingIsRefunded(t *testing.T) {
+	data := dbtest.New()
+	data.Return("GetBookingById", expiredBooking())
+	data.Return("GetLatestPaymentByBooking", db.Payment{
+		ID:            11,
+		Bookingid:     pgtype.Int4{Int32: 7, Valid: true},
+		Amount:        1234.6,
+		Status:        db.NullPaymentStatus{PaymentStatus: db.PaymentStatusFAILED, Valid: true},
+		Transactionid: "cs_test",
+	})
+	data.Return("CountPassengersByBooking", int64(2))
+	data.Return("CreateRefund", db.Refund{ID: 1})
+
+	sendCheckoutCompleted(t, newWebhookHandler(data.Store()), "7", "pi_test")
+
+	payments := data.Calls("UpdatePaymentStatus")
+	if len(payments) != 1 || payments[0].Args[1] != (db.NullPaymentStatus{PaymentStatus: db.PaymentStatusSUCCESS, Valid: true}) {
+		t.Fatalf("payment not recorded as paid: %v", payments)
+	}
+	if got := data.Calls("UpdatePaymentGatewayID"); len(got) != 1 || got[0].Args[1] != (pgtype.Text{String: "pi_test", Valid: true}) {
+		t.Fatalf("gateway payment not recorded: %v", got)
+	}
+
+	// the seats are gone, the booking is not confirmed
+	for _, name := range []string{"UpdateBookingStatus", "UpdateBookingItemStatus", "ConfirmSeat"} {
+		if calls := data.Calls(name); len(calls) != 0 {
+			t.Errorf("%s called for an expired booking", name)
+		}
+	}
+
+	refunds := data.Calls("CreateRefund")
+	if len(refunds) != 1 {
+		t.Fatalf("%d refunds created", len(refunds))
+	}
+	args := refunds[0].Args
+	if args[2] != int32(1235) {
+		t.Errorf("refunded %v, want the full 1235", args[2])
+	}
+	if args[3] != db.RefundStatusPENDING {
+		t.Errorf("refund status %v", args[3])
+	}
+	if args[5] != (pgtype.Text{String: "pi_test", Valid: true}) {
+		t.Errorf("refund against payment %v", args[5])
+	}
+	if args[6] != (pgtype.Text{String: "refund_7_hold_expired", Valid: true}) {
+		t.Errorf("idempotency key %v", args[6])
+	}
+
+	var deduction cancellation.Deduction
+	if err := json.Unmarshal(args[4].([]byte), &deduction); err != nil {
+		t.Fatal(err)
+	}
+	if deduction.Slab != cancellation.SlabHoldExpired || deduction.Deducted != 0 || deduction.Passengers != 2 {
+		t.Errorf("breakdown %+v", deduction)
+	}
+}
+
+func TestRedeliveredPaymentForExpiredBookingIsRefundedOnce(t *testing.T) {
+	data := dbtest.New()
+	data.Return("GetBookingById", expiredBooking())
+	data.Return("GetLatestPaymentByBooking", db.Payment{
+		ID:            11,
+		Bookingid:     pgtype.Int4{Int32: 7, Valid: true},
+		Amount:        1234.6,
+		Status:        db.NullPaymentStatus{PaymentStatus: db.PaymentStatusSUCCESS, Valid: true},
+		Transactionid: "cs_test",
+	})
+
+	sendCheckoutCompleted(t, newWebhookHandler(data.Store()), "7", "pi_test")
+
+	if calls := data.Calls("CreateRefund"); len(calls) != 0 {
+		t.Fatalf("refunded again: %v", calls)
+	}
+	if calls := data.Calls("UpdatePaymentStatus"); len(calls) != 0 {
+		t.Fatalf("payment updated again: %v", calls)
+	}
+}
+
+func TestPaymentForBookingThatLostItsSeatsIsNotConfirmed(t *testing.T) {
+	unpaid := db.NullPaymentStatus{PaymentStatus: db.PaymentStatusPENDING, Valid: true}
+	paid := db.NullPaymentStatus{PaymentStatus: db.PaymentStatusSUCCESS, Valid: true}
+
+	tests := []struct {
+		name     string
+		status   db.BookingStatus
+		payment  db.NullPaymentStatus
+		refunded bool
+	}{
+		{"cancelled before it was paid", db.BookingStatusCANCELLED, unpaid, true},
+		{"cancelled after it was paid", db.BookingStatusCANCELLED, paid, false},
+		{"failed tatkal booking", db.BookingStatusFAILED, unpaid, true},
+		{"queued tatkal booking", db.BookingStatusQUEUED, unpaid, true},
+		{"confirmed booking", db.BookingStatusCONFIRMED, paid, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			booking := expiredBooking()
+			booking.Status = tt.status
+
+			data := dbtest.New()
+			data.Return("GetBookingById", booking)
+			data.Return("GetLatestPaymentByBooking", db.Payment{
+				ID:        11,
+				Bookingid: pgtype.Int4{Int32: 7, Valid: true},
+				Amount:    500,
+				Status:    tt.payment,
+			})
+			data.Return("CountPassengersByBooking", int64(1))
+			data.Return("CreateRefund", db.Refund{ID: 1})
+
+			sendCheckoutCompleted(t, newWebhookHandler(data.Store()), "7", "pi_test")
+
+			for _, name := range []string{"UpdateBookingStatus", "UpdateBookingItemStatus", "ConfirmSeat"} {
+				if calls := data.Calls(name); len(calls) != 0 {
+					t.Errorf("%s called for a %s booking", name, tt.status)
+				}
+			}
+			if refunds := data.Calls("CreateRefund"); (len(refunds) == 1) != tt.refunded || len(refunds) > 1 {
+				t.Errorf("%d refunds created", len(refunds))
+			}
+		})
+	}
+}
@@ -2,14 +2,12 @@ package cancellation
 
 import (
 	"better-uptime/common/middleware"
-	"better-uptime/common/stripe"
 	"better-uptime/common/util"
 	db "better-uptime/internal/db/sqlc"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"strconv"
-	"time"
 
 	"github.com/jackc/pgx/v5/pgtype"
 )
@@ -23,6 +21,7 @@ func (h *Handler) CalculatingRefundAmount(w http.ResponseWriter, r *http.Request
 	payload, err := middleware.GetFirebasePayloadFromContext(ctx)
 	if err != nil {
 		util.ErrorJson(w, util.ErrUnauthorized)
+		return
 	}
 
 	userId := payload.UserId
@@ -40,8 +39,6 @@ func (h *Handler) CalculatingRefundAmount(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	fmt.Println("hello")
-
 	trainWithAmount, err := h.store.GetPaymentAndTrain(ctx, db.GetPaymentAndTrainParams{
 		Userid:    pgtype.UUID{Bytes: userId, Valid: true},
 		JourneyID: util.ToPgInt4(int32(JourneyId)),
@@ -56,106 +53,54 @@ func (h *Handler) CalculatingRefundAmount(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	if trainWithAmount.Status != db.BookingStatusCONFIRMED {
+	if trainWithAmount.Status != db.BookingStatusCONFIRMED && trainWithAmount.Status != db.BookingStatusRAC {
 		util.ErrorJson(w, fmt.Errorf("no seats were confirmed"))
 		return
 	}
 
-	fmt.Println("hello")
-	// calculate the refund
-	var amount float64
-	amount = trainWithAmount.Amount
-	amountStr := fmt.Sprintf("%.2f", amount)
-
 	bookingId := trainWithAmount.Bookingid
 
-	var releasedSeats int64
-
-	apiResponse, err := stripe.RefundSession(ctx, userId.String(), amountStr, trainWithAmount.Holdtoken.String, h.config.STRIPE_SECRET_KEY)
-	if err != nil || apiResponse == nil {
+	// every seat the booking still holds, earlier partial cancellations
+	// already gave up the others
+	seats, err := h.store.GetBookingLockContext(ctx, bookingId.Int32)
+	if err != nil {
 		util.ErrorJson(w, err)
+		return
+	}
+
+	seatIds := make([]int32, 0, len(seats))
+	for _, s := range seats {
+		seatIds = append(seatIds, s.SeatID)
 	}
-	//begin db transaction
-	err = h.store.ExecTx(ctx, func(q *db.Queries) error {
-		releasedSeats, err = q.CountSeatsByBooking(ctx, util.ToPgInt4(bookingId.Int32))
-		if err != nil {
-			return fmt.Errorf("failed to count seats: %w", err)
-		}
-		// update booking -> cancelled
-		err := q.UpdateBookingStatus(ctx, db.UpdateBookingStatusParams{
-			ID:     bookingId.Int32,
-			Status: db.BookingStatusCANCELLED,
-		})
-
-		if err != nil {
-			return fmt.Errorf("not able to update the db: %w", err)
-		}
-
-		if err := q.ReleaseSeatsByBooking(ctx, util.ToPgInt4(bookingId.Int32)); err != nil {
-			return fmt.Errorf("failed to release seats: %w", err)
-		}
-
-		// update payment
-
-		_, err = q.CreateRefund(ctx, db.CreateRefundParams{
-			Userid:    pgtype.UUID{Bytes: userId, Valid: true},
-			Bookingid: util.ToPgInt4(bookingId.Int32),
-			Amount:    int32(amount),
-			Status:    db.RefundStatusSUCCESS,
-		})
-		if err != nil {
-			return fmt.Errorf("not able to create the refund: %w", err)
-		}
-
-		err = q.DeleteBookingItem(ctx, util.ToPgInt4(bookingId.Int32))
-		if err != nil {
-			return fmt.Errorf("not able to delete  the booking items table: %w", err)
-		}
-		return nil
-	})
 
+	racIds, err := h.store.GetRacPassengersByBooking(ctx, bookingId.Int32)
 	if err != nil {
 		util.ErrorJson(w, err)
 		return
 	}
 
-	coachtype, err := h.store.GetCoachTypeByJourneyId(ctx, int32(JourneyId))
+	result, err := h.cancelSeats(ctx, seatCancellation{
+		UserID:          userId,
+		BookingID:       bookingId.Int32,
+		JourneyID:       int32(JourneyId),
+		BookingType:     trainWithAmount.BookingType,
+		PaymentID:       trainWithAmount.GatewayPaymentID.String,
+		Paid:            trainWithAmount.Amount,
+		SeatIDs:         seatIds,
+		RacPassengerIDs: racIds,
+	})
 	if err != nil {
-		util.ErrorJson(w, fmt.Errorf("not able to get the coach type"))
-	}
-
-	key := fmt.Sprintf("%d:%s", JourneyId, coachtype)
-
-	message := map[string]interface{}{
-		"journey_id":     JourneyId,
-		"coach_type":     coachtype,
-		"released_seats": releasedSeats,
-		"timestamp":      time.Now().Unix(),
+		util.ErrorJson(w, err)
+		return
 	}
 
-	value, _ := json.Marshal(message)
-	h.Kafka.Publish(ctx, "seat_released", key, value)
-
 	response := map[string]interface{}{
-		"message":         "refund in process",
-		"response_stripe": apiResponse,
+		"message":       "refund in process",
+		"deduction":     result.Deduction,
+		"refund_id":     result.RefundID,
+		"refund_status": result.RefundStatus,
 	}
 
 	util.WriteJson(w, http.StatusOK, response)
 
 }
-
-func CalculatateRefund(cancellationtime, arrivalTime time.Time, amount int) float64 {
-	timeDiff := arrivalTime.Sub(cancellationtime)
-
-	switch {
-	case timeDiff <= 0:
-		return 0
-	case timeDiff >= 24*time.Hour:
-		return float64(amount)
-	case timeDiff < 24*time.Hour:
-		return float64(amount / 2)
-	}
-
-	return 0
-}
@@ -0,0 +1,367 @@
+package cancellation
+
+import (
+	"better-uptime/common/middleware"
+	"better-uptime/common/util"
+	db "better-uptime/internal/db/sqlc"
+	"better-uptime/internal/outbox"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+var ErrSeatsNotCancellable = errors.New("some of the seats are not part of this booking or already cancelled")
+
+type CancelPassengersRequest struct {
+	PassengerIDs []int32 `json:"passenger_ids"`
+	SeatIDs      []int32 `json:"seat_ids"`
+}
+
+// seatCancellation is a request to cancel some of the seats of a paid
+// booking, along with passengers of it still on RAC. Paid is what was charged
+// for the whole booking and PaymentID the gateway's id for that payment.
+type seatCancellation struct {
+	UserID          uuid.UUID
+	BookingID       int32
+	JourneyID       int32
+	BookingType     db.BookingType
+	PaymentID       string
+	Paid            float64
+	SeatIDs         []int32
+	RacPassengerIDs []int32
+}
+
+type cancellationResult struct {
+	Deduction      Deduction       `json:"deduction"`
+	RefundID       int32           `json:"refund_id"`
+	RefundStatus   db.RefundStatus `json:"refund_status"`
+	CancelledSeats []int32         `json:"cancelled_seats"`
+	CancelledRac   []int32         `json:"cancelled_rac,omitempty"`
+	RemainingSeats int             `json:"remaining_seats"`
+}
+
+// CancelPassengers cancels some passengers of a confirmed or RAC booking,
+// given by passenger or seat id. The rest of the booking stays as it is.
+func (h *Handler) CancelPassengers(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	payload, err := middleware.GetFirebasePayloadFromContext(ctx)
+	if err != nil {
+		util.ErrorJson(w, util.ErrUnauthorized)
+		return
+	}
+
+	bookingId, err := strconv.Atoi(chi.URLParam(r, "bookingId"))
+	if err != nil {
+		util.ErrorJson(w, util.ErrNotValidRequest)
+		return
+	}
+
+	var data CancelPassengersRequest
+	err = util.ReadJsonAndValidate(w, r, &data)
+	if err != nil {
+		util.ErrorJson(w, util.ErrNotValidRequest)
+		return
+	}
+
+	if len(data.PassengerIDs) == 0 && len(data.SeatIDs) == 0 {
+		util.ErrorJson(w, util.ErrRequiredInputMissing("passenger_ids or seat_ids"))
+		return
+	}
+
+	booking, err := h.store.GetBookingById(ctx, int32(bookingId))
+	if err != nil {
+		util.ErrorJson(w, errors.New("booking not found"))
+		return
+	}
+
+	if booking.Userid.Bytes != payload.UserId {
+		util.ErrorJson(w, util.ErrUnauthorized)
+		return
+	}
+
+	if booking.Status != db.BookingStatusCONFIRMED && booking.Status != db.BookingStatusRAC {
+		util.ErrorJson(w, fmt.Errorf("no seats were confirmed"))
+		return
+	}
+
+	paid, err := h.store.GetPaymentByBooking(ctx, util.ToPgInt4(booking.ID))
+	if err != nil {
+		util.ErrorJson(w, fmt.Errorf("payment was not successfull during booking"))
+		return
+	}
+
+	seatIds := data.SeatIDs
+	var racIds []int32
+	if len(data.PassengerIDs) > 0 {
+		passengers, err := h.store.GetPassengersByBooking(ctx, util.ToPgInt4(booking.ID))
+		if err != nil {
+			util.ErrorJson(w, err)
+			return
+		}
+
+		byID := make(map[int32]db.GetPassengersByBookingRow, len(passengers))
+		for _, p := range passengers {
+			byID[p.ID] = p
+		}
+
+		for _, id := range data.PassengerIDs {
+			p, ok := byID[id]
+			if !ok {
+				util.ErrorJson(w, fmt.Errorf("passenger %d is not part of this booking", id))
+				return
+			}
+			if p.CancelledAt.Valid {
+				util.ErrorJson(w, ErrSeatsNotCancellable)
+				return
+			}
+			// a RAC passenger only shares a berth, there is no seat to give up
+			if !p.SeatID.Valid && p.RacID.Valid {
+				racIds = append(racIds, id)
+				continue
+			}
+			seatIds = append(seatIds, p.SeatID.Int32)
+		}
+	}
+
+	result, err := h.cancelSeats(ctx, seatCancellation{
+		UserID:          payload.UserId,
+		BookingID:       booking.ID,
+		JourneyID:       booking.JourneyID.Int32,
+		BookingType:     booking.BookingType,
+		PaymentID:       paid.GatewayPaymentID.String,
+		Paid:            paid.Amount,
+		SeatIDs:         seatIds,
+		RacPassengerIDs: racIds,
+	})
+	if err != nil {
+		util.ErrorJson(w, err)
+		return
+	}
+
+	util.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "refund in process",
+		"data":    result,
+	})
+}
+
+// cancelSeats queues a refund of the share of the payment for the seats and
+// RAC passengers under the cancellation policy, releases them and tells the
+// RAC and waitlist of their coach type. A RAC booking whose last RAC passenger
+// goes is confirmed, and any booking is cancelled once it has no one left. The
+// refund is sent to the gateway later by the refund processor.
+func (h *Handler) cancelSeats(ctx context.Context, c seatCancellation) (*cancellationResult, error) {
+	seatIds := slices.Clone(c.SeatIDs)
+	slices.Sort(seatIds)
+	seatIds = slices.Compact(seatIds)
+
+	racIds := slices.Clone(c.RacPassengerIDs)
+	slices.Sort(racIds)
+	racIds = slices.Compact(racIds)
+
+	summary, err := h.store.GetSeatSummaryBySeats(ctx, db.GetSeatSummaryBySeatsParams{
+		BookingID: c.BookingID,
+		SeatIds:   seatIds,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to count seats: %w", err)
+	}
+
+	racSummary, err := h.store.GetRacSummaryByPassengers(ctx, db.GetRacSummaryByPassengersParams{
+		BookingID:    c.BookingID,
+		PassengerIds: racIds,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to count rac passengers: %w", err)
+	}
+
+	classes := make(map[db.CoachType]bool)
+	seatsCancelled, racCancelled := 0, 0
+	for _, s := range summary {
+		seatsCancelled += int(s.Seats)
+		classes[s.CoachType] = true
+	}
+	for _, s := range racSummary {
+		racCancelled += int(s.Seats)
+		classes[s.CoachType] = true
+	}
+
+	cancelled := seatsCancelled + racCancelled
+	if cancelled == 0 || seatsCancelled != len(seatIds) || racCancelled != len(racIds) {
+		return nil, ErrSeatsNotCancellable
+	}
+	// a booking is made in one class
+	if len(classes) > 1 {
+		return nil, errors.New("seats of different classes cannot be cancelled together")
+	}
+	var coachType db.CoachType
+	for ct := range classes {
+		coachType = ct
+	}
+
+	// the payment covers every passenger the booking was made with, including
+	// ones cancelled earlier and ones that never got a seat of their own
+	total, err := h.store.CountPassengersByBooking(ctx, util.ToPgInt4(c.BookingID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to count passengers: %w", err)
+	}
+	if total < int64(cancelled) {
+		total = int64(cancelled)
+	}
+	share := round(c.Paid * float64(cancelled) / float64(total))
+
+	deduction, err := Evaluate(ctx, h.store, c.BookingID, coachType, c.BookingType, cancelled, share, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	breakdown, err := json.Marshal(deduction)
+	if err != nil {
+		return nil, err
+	}
+
+	seatKey := make([]string, 0, len(seatIds)+len(racIds))
+	for _, id := range seatIds {
+		seatKey = append(seatKey, strconv.Itoa(int(id)))
+	}
+	for _, id := range racIds {
+		seatKey = append(seatKey, "r"+strconv.Itoa(int(id)))
+	}
+
+	// nothing to send to the gateway when the policy keeps the whole fare
+	status := db.RefundStatusPENDING
+	amount := int32(math.Round(deduction.Refund))
+	if amount == 0 {
+		status = db.RefundStatusSUCCESS
+	}
+
+	var refund db.Refund
+	remaining := 0
+	err = h.store.ExecTx(ctx, func(q *db.Queries) error {
+		released, err := q.ReleaseSeatsBySeats(ctx, db.ReleaseSeatsBySeatsParams{
+			BookingID: c.BookingID,
+			SeatIds:   seatIds,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to release seats: %w", err)
+		}
+		// a concurrent cancellation of the same seats got there first
+		if released != int64(seatsCancelled) {
+			return ErrSeatsNotCancellable
+		}
+
+		// and the same for RAC passengers, or PromoteRac gave them a seat
+		racReleased, err := q.CancelRacPassengers(ctx, db.CancelRacPassengersParams{
+			BookingID:    c.BookingID,
+			PassengerIds: racIds,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to cancel rac passengers: %w", err)
+		}
+		if racReleased != int64(racCancelled) {
+			return ErrSeatsNotCancellable
+		}
+
+		err = q.CancelBookingItems(ctx, db.CancelBookingItemsParams{
+			BookingID: util.ToPgInt4(c.BookingID),
+			SeatIds:   seatIds,
+		})
+		if err != nil {
+			return fmt.Errorf("not able to cancel the booking items: %w", err)
+		}
+
+		err = q.CancelPassengers(ctx, db.CancelPassengersParams{
+			BookingID:    util.ToPgInt4(c.BookingID),
+			SeatIds:      seatIds,
+			PassengerIds: racIds,
+		})
+		if err != nil {
+			return fmt.Errorf("not able to cancel the passengers: %w", err)
+		}
+
+		left, err := q.GetSeatSummaryByBooking(ctx, c.BookingID)
+		if err != nil {
+			return fmt.Errorf("failed to count seats: %w", err)
+		}
+		for _, s := range left {
+			remaining += int(s.Seats)
+		}
+
+		racLeft, err := q.CountRacByBooking(ctx, c.BookingID)
+		if err != nil {
+			return fmt.Errorf("failed to count rac passengers: %w", err)
+		}
+
+		switch {
+		case remaining == 0 && racLeft == 0:
+			err = q.UpdateBookingStatus(ctx, db.UpdateBookingStatusParams{
+				ID:     c.BookingID,
+				Status: db.BookingStatusCANCELLED,
+			})
+		case racCancelled > 0 && racLeft == 0:
+			// everyone left on the booking has a seat of their own
+			err = q.UpdateBookingStatus(ctx, db.UpdateBookingStatusParams{
+				ID:     c.BookingID,
+				Status: db.BookingStatusCONFIRMED,
+			})
+		}
+		if err != nil {
+			return fmt.Errorf("not able to update the db: %w", err)
+		}
+		remaining += int(racLeft)
+
+		refund, err = q.CreateRefund(ctx, db.CreateRefundParams{
+			Userid:             pgtype.UUID{Bytes: c.UserID, Valid: true},
+			Bookingid:          util.ToPgInt4(c.BookingID),
+			Amount:             amount,
+			Status:             status,
+			DeductionBreakdown: breakdown,
+			PaymentID:          pgtype.Text{String: c.PaymentID, Valid: c.PaymentID != ""},
+			IdempotencyKey:     pgtype.Text{String: fmt.Sprintf("refund_%d_%s", c.BookingID, strings.Join(seatKey, "-")), Valid: true},
+		})
+		if err != nil {
+			return fmt.Errorf("not able to create the refund: %w", err)
+		}
+
+		// queued in the same transaction so the waitlist hears about every
+		// cancellation that commits, and none that rolls back
+		key := fmt.Sprintf("%d:%s", c.JourneyID, coachType)
+		dedupKey := fmt.Sprintf("seat_released:%d:%s:%s", c.BookingID, coachType, strings.Join(seatKey, "-"))
+
+		event := map[string]interface{}{
+			"journey_id":     c.JourneyID,
+			"coach_type":     coachType,
+			"released_seats": cancelled,
+			"timestamp":      time.Now().Unix(),
+		}
+		// tatkal seats are promoted from the tatkal waitlist
+		if c.BookingType == db.BookingTypeTATKAL || c.BookingType == db.BookingTypePREMIUMTATKAL {
+			event["quota"] = db.SeatQuotaTATKAL
+		}
+
+		return outbox.Enqueue(ctx, q, h.config.KAFKA_SEAT_TOPIC, key, dedupKey, event)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &cancellationResult{
+		Deduction:      deduction,
+		RefundID:       refund.ID,
+		RefundStatus:   refund.Status,
+		CancelledSeats: seatIds,
+		CancelledRac:   racIds,
+		RemainingSeats: remaining,
+	}, nil
+}
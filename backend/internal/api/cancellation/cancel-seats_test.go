@@ -0,0 +1,58 @@
+package cancellation
+
+import (
+	"better-uptime/config"
+	"better-uptime/internal/db/dbtest"
+	db "better-uptime/internal/db/sqlc"
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestCancelSeatsMarksPassengersCancelled(t *testing.T) {
+	data := dbtest.New()
+	data.Return("GetSeatSummaryBySeats", db.GetSeatSummaryBySeatsRow{CoachType: db.CoachType3A, Seats: 1})
+	data.Return("GetRacSummaryByPassengers", db.GetRacSummaryByPassengersRow{CoachType: db.CoachType3A, Seats: 1})
+	data.Return("CountPassengersByBooking", int64(3))
+	data.Return("GetCancellationRule", db.CancellationRule{CoachType: db.CoachType3A, BookingType: db.BookingTypeNORMAL, Refundable: true})
+	data.Return("GetBookingDeparture", db.GetBookingDepartureRow{
+		JourneyDate: pgtype.Date{Time: time.Now().AddDate(0, 0, 10), Valid: true},
+	})
+	data.Return("CancelRacPassengers", int64(1))
+	data.Return("GetSeatSummaryByBooking", db.GetSeatSummaryByBookingRow{CoachType: db.CoachType3A, Seats: 1})
+	data.Return("CountRacByBooking", int64(0))
+	data.Return("CreateRefund", db.Refund{ID: 1, Status: db.RefundStatusPENDING})
+
+	h := &Handler{store: data.Store(), config: &config.Config{KAFKA_SEAT_TOPIC: "seats"}}
+	_, err := h.cancelSeats(context.Background(), seatCancellation{
+		UserID:          uuid.New(),
+		BookingID:       7,
+		JourneyID:       3,
+		BookingType:     db.BookingTypeNORMAL,
+		Paid:            300,
+		SeatIDs:         []int32{42},
+		RacPassengerIDs: []int32{9},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	calls := data.Calls("CancelPassengers")
+	if len(calls) != 1 {
+		t.Fatalf("CancelPassengers called %d times", len(calls))
+	}
+	args := calls[0].Args
+	if args[0] != (pgtype.Int4{Int32: 7, Valid: true}) {
+		t.Errorf("passengers of booking %v cancelled", args[0])
+	}
+	if seats := args[1].([]int32); !slices.Equal(seats, []int32{42}) {
+		t.Errorf("passengers on seats %v cancelled, want 42", seats)
+	}
+	if ids := args[2].([]int32); !slices.Equal(ids, []int32{9}) {
+		t.Errorf("passengers %v cancelled, want the RAC passenger 9", ids)
+	}
+}
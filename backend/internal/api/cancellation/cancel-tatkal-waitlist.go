@@ -0,0 +1,146 @@
+package cancellation
+
+import (
+	"better-uptime/common/middleware"
+	"better-uptime/common/util"
+	db "better-uptime/internal/db/sqlc"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+var ErrNotTatkalWaitlisted = errors.New("booking is not on the tatkal waitlist")
+
+// CancelTatkalWaitlist takes a tatkal booking off the tatkal waitlist and
+// cancels it. It holds no seats, so nothing is released; a booking paid for
+// up front is refunded less the clerkage.
+func (h *Handler) CancelTatkalWaitlist(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	payload, err := middleware.GetFirebasePayloadFromContext(ctx)
+	if err != nil {
+		util.ErrorJson(w, util.ErrUnauthorized)
+		return
+	}
+
+	bookingId, err := strconv.Atoi(chi.URLParam(r, "bookingId"))
+	if err != nil {
+		util.ErrorJson(w, util.ErrNotValidRequest)
+		return
+	}
+
+	booking, err := h.store.GetBookingById(ctx, int32(bookingId))
+	if err != nil {
+		util.ErrorJson(w, errors.New("booking not found"))
+		return
+	}
+
+	if booking.Userid.Bytes != payload.UserId {
+		util.ErrorJson(w, util.ErrUnauthorized)
+		return
+	}
+
+	if booking.BookingType != db.BookingTypeTATKAL || booking.Status != db.BookingStatusWAITLIST {
+		util.ErrorJson(w, ErrNotTatkalWaitlisted)
+		return
+	}
+
+	var refund *db.Refund
+	var deduction *Deduction
+	err = h.store.ExecTx(ctx, func(q *db.Queries) error {
+		place, err := q.GetTatkalWaitlistByBooking(ctx, util.ToPgInt4(booking.ID))
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrNotTatkalWaitlisted
+			}
+			return err
+		}
+
+		// promoted or cancelled since the booking was read
+		left, err := q.CancelTatkalWaitlist(ctx, util.ToPgInt4(booking.ID))
+		if err != nil {
+			return err
+		}
+		if left == 0 {
+			return ErrNotTatkalWaitlisted
+		}
+
+		err = q.UpdateBookingStatus(ctx, db.UpdateBookingStatusParams{
+			ID:     booking.ID,
+			Status: db.BookingStatusCANCELLED,
+		})
+		if err != nil {
+			return fmt.Errorf("not able to update the db: %w", err)
+		}
+
+		paid, err := q.GetPaymentByBooking(ctx, util.ToPgInt4(booking.ID))
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		passengers, err := q.CountPassengersByBooking(ctx, util.ToPgInt4(booking.ID))
+		if err != nil {
+			return fmt.Errorf("failed to count passengers: %w", err)
+		}
+
+		d, err := EvaluateTatkalWaitlist(ctx, q, booking.ID, place.CoachType, int(passengers), paid.Amount, time.Now())
+		if err != nil {
+			return err
+		}
+		deduction = &d
+
+		breakdown, err := json.Marshal(d)
+		if err != nil {
+			return err
+		}
+
+		status := db.RefundStatusPENDING
+		amount := int32(math.Round(d.Refund))
+		if amount == 0 {
+			status = db.RefundStatusSUCCESS
+		}
+
+		created, err := q.CreateRefund(ctx, db.CreateRefundParams{
+			Userid:             booking.Userid,
+			Bookingid:          util.ToPgInt4(booking.ID),
+			Amount:             amount,
+			Status:             status,
+			DeductionBreakdown: breakdown,
+			PaymentID:          paid.GatewayPaymentID,
+			IdempotencyKey:     pgtype.Text{String: fmt.Sprintf("refund_%d_tatkal_waitlist", booking.ID), Valid: true},
+		})
+		if err != nil {
+			return fmt.Errorf("not able to create the refund: %w", err)
+		}
+		refund = &created
+
+		return nil
+	})
+	if err != nil {
+		util.ErrorJson(w, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"message": "removed from the tatkal waitlist",
+	}
+	if refund != nil {
+		response["message"] = "refund in process"
+		response["deduction"] = deduction
+		response["refund_id"] = refund.ID
+		response["refund_status"] = refund.Status
+	}
+
+	util.WriteJson(w, http.StatusOK, response)
+}
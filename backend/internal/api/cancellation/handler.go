@@ -3,6 +3,7 @@ package cancellation
 import (
 	"better-uptime/common/kafka"
 	"better-uptime/common/middleware"
+	"better-uptime/common/payment"
 	"better-uptime/common/routes"
 	"better-uptime/config"
 	db "better-uptime/internal/db/sqlc"
@@ -14,13 +15,15 @@ type Handler struct {
 	store  db.Store
 	config *config.Config
     Kafka  kafka.Producer
+	Payments payment.PaymentGateway
 }
 
-func NewHandler(config *config.Config, store db.Store, Kafka kafka.Producer) *Handler {
+func NewHandler(config *config.Config, store db.Store, Kafka kafka.Producer, Payments payment.PaymentGateway) *Handler {
 	return &Handler{
 		config: config,
 		store:  store,
 		Kafka: Kafka,
+		Payments: Payments,
 	}
 }
 
@@ -31,6 +34,11 @@ func (h *Handler) Routes() *chi.Mux {
 	router.Group(func(r chi.Router) {
 		r.Use(middleware.TokenMiddleware(h.store))
 		r.Post("/", h.CalculatingRefundAmount)
+		r.Get("/refunds", h.ListRefunds)
+		r.Post("/{bookingId}", h.CancelPassengers)
+		r.Post("/{bookingId}/tatkal-waitlist", h.CancelTatkalWaitlist)
+		r.Get("/rules", h.ListRules)
+		r.Put("/rules", h.UpsertRule)
 	})
 
 	return router
@@ -0,0 +1,229 @@
+package cancellation
+
+import (
+	"better-uptime/common/util"
+	db "better-uptime/internal/db/sqlc"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Slabs of the cancellation policy, from the most to the least generous.
+const (
+	SlabClerkage       = "MORE_THAN_48H"
+	Slab48h            = "48H_TO_12H"
+	Slab12h            = "12H_TO_4H"
+	Slab4h             = "LESS_THAN_4H"
+	SlabAfterCharting  = "AFTER_CHARTING"
+	SlabNonRefundable  = "NON_REFUNDABLE"
+	SlabAfterDeparture = "AFTER_DEPARTURE"
+)
+
+// SlabNotCleared is a waitlisted booking cancelled by charting, which is
+// refunded in full.
+const SlabNotCleared = "WAITLIST_NOT_CLEARED"
+
+// SlabTatkalWaitlist is a tatkal booking cancelled while on the tatkal
+// waitlist, by the user or by charting. Only the clerkage is kept.
+const SlabTatkalWaitlist = "TATKAL_WAITLIST"
+
+// SlabHoldExpired is a payment that came in after the hold of its booking ran
+// out. The booking never got its seats, so the payment is refunded in full.
+const SlabHoldExpired = "HOLD_EXPIRED"
+
+// Deduction is how the refund of a cancelled booking was worked out. It is
+// stored with the refund.
+type Deduction struct {
+	CoachType      db.CoachType   `json:"coach_type"`
+	BookingType    db.BookingType `json:"booking_type"`
+	Passengers     int            `json:"passengers"`
+	Fare           float64        `json:"fare"`
+	Departure      time.Time      `json:"departure"`
+	CancelledAt    time.Time      `json:"cancelled_at"`
+	HoursToDepart  float64        `json:"hours_to_depart"`
+	Slab           string         `json:"slab"`
+	Clerkage       float64        `json:"clerkage"`
+	PercentApplied float64        `json:"percent_applied"`
+	Deducted       float64        `json:"deducted"`
+	Refund         float64        `json:"refund"`
+}
+
+// Calculate applies a cancellation rule to a paid fare. Up to 48 hours before
+// departure only the clerkage is kept; closer to departure the slab's
+// percentage of the fare is kept, but never less than the clerkage. Nothing is
+// refunded once the chart is prepared, after departure, or when the rule is
+// not refundable.
+func Calculate(rule db.CancellationRule, fare float64, passengers int, departure, cancelledAt time.Time, charted bool) Deduction {
+	d := Deduction{
+		CoachType:     rule.CoachType,
+		BookingType:   rule.BookingType,
+		Passengers:    passengers,
+		Fare:          fare,
+		Departure:     departure,
+		CancelledAt:   cancelledAt,
+		HoursToDepart: round(departure.Sub(cancelledAt).Hours()),
+		Clerkage:      round(rule.ClerkagePerPassenger * float64(passengers)),
+	}
+
+	until := departure.Sub(cancelledAt)
+
+	switch {
+	case !rule.Refundable:
+		d.Slab = SlabNonRefundable
+		d.PercentApplied = 100
+	case charted:
+		d.Slab = SlabAfterCharting
+		d.PercentApplied = 100
+	case until <= 0:
+		d.Slab = SlabAfterDeparture
+		d.PercentApplied = 100
+	case until >= 48*time.Hour:
+		d.Slab = SlabClerkage
+	case until >= 12*time.Hour:
+		d.Slab = Slab48h
+		d.PercentApplied = rule.Deduction48hPercent
+	case until >= 4*time.Hour:
+		d.Slab = Slab12h
+		d.PercentApplied = rule.Deduction12hPercent
+	default:
+		d.Slab = Slab4h
+		d.PercentApplied = rule.Deduction4hPercent
+	}
+
+	deducted := d.Clerkage
+	if percent := fare * d.PercentApplied / 100; percent > deducted {
+		deducted = percent
+	}
+	if deducted > fare {
+		deducted = fare
+	}
+
+	d.Deducted = round(deducted)
+	d.Refund = round(fare - d.Deducted)
+
+	return d
+}
+
+// NotCleared is the refund of a booking still waitlisted when the chart is
+// prepared. It never got a seat, so nothing is deducted.
+func NotCleared(coachType db.CoachType, bookingType db.BookingType, passengers int, fare float64, departure, cancelledAt time.Time) Deduction {
+	return Deduction{
+		CoachType:     coachType,
+		BookingType:   bookingType,
+		Passengers:    passengers,
+		Fare:          fare,
+		Departure:     departure,
+		CancelledAt:   cancelledAt,
+		HoursToDepart: round(departure.Sub(cancelledAt).Hours()),
+		Slab:          SlabNotCleared,
+		Refund:        round(fare),
+	}
+}
+
+// HoldExpired is the refund of a payment made after its booking expired.
+// Nothing is deducted.
+func HoldExpired(bookingType db.BookingType, passengers int, fare float64, paidAt time.Time) Deduction {
+	return Deduction{
+		BookingType: bookingType,
+		Passengers:  passengers,
+		Fare:        fare,
+		CancelledAt: paidAt,
+		Slab:        SlabHoldExpired,
+		Refund:      round(fare),
+	}
+}
+
+// TatkalWaitlisted is the refund of a tatkal booking that never left the
+// tatkal waitlist. Confirmed tatkal tickets are not refundable, but a
+// waitlisted one gets its fare back less the clerkage of the rule.
+func TatkalWaitlisted(rule db.CancellationRule, fare float64, passengers int, departure, cancelledAt time.Time) Deduction {
+	clerkage := round(rule.ClerkagePerPassenger * float64(passengers))
+	if clerkage > fare {
+		clerkage = fare
+	}
+
+	return Deduction{
+		CoachType:     rule.CoachType,
+		BookingType:   rule.BookingType,
+		Passengers:    passengers,
+		Fare:          fare,
+		Departure:     departure,
+		CancelledAt:   cancelledAt,
+		HoursToDepart: round(departure.Sub(cancelledAt).Hours()),
+		Slab:          SlabTatkalWaitlist,
+		Clerkage:      clerkage,
+		Deducted:      round(clerkage),
+		Refund:        round(fare - clerkage),
+	}
+}
+
+// Evaluate looks up the rule and the departure of a booking and works out
+// what cancelling passengers of it at cancelledAt refunds, where fare is their
+// share of the payment. It takes a Querier so it can be used inside a
+// transaction as well.
+func Evaluate(ctx context.Context, q db.Querier, bookingID int32, coachType db.CoachType, bookingType db.BookingType, passengers int, fare float64, cancelledAt time.Time) (Deduction, error) {
+	rule, err := cancellationRule(ctx, q, coachType, bookingType)
+	if err != nil {
+		return Deduction{}, err
+	}
+
+	departure, charted, err := BookingDeparture(ctx, q, bookingID)
+	if err != nil {
+		return Deduction{}, err
+	}
+
+	return Calculate(rule, fare, passengers, departure, cancelledAt, charted), nil
+}
+
+// EvaluateTatkalWaitlist is Evaluate for a tatkal booking cancelled while
+// still on the tatkal waitlist.
+func EvaluateTatkalWaitlist(ctx context.Context, q db.Querier, bookingID int32, coachType db.CoachType, passengers int, fare float64, cancelledAt time.Time) (Deduction, error) {
+	rule, err := cancellationRule(ctx, q, coachType, db.BookingTypeTATKAL)
+	if err != nil {
+		return Deduction{}, err
+	}
+
+	departure, _, err := BookingDeparture(ctx, q, bookingID)
+	if err != nil {
+		return Deduction{}, err
+	}
+
+	return TatkalWaitlisted(rule, fare, passengers, departure, cancelledAt), nil
+}
+
+// BookingDeparture is when the train leaves the boarding station of a
+// booking, and whether the chart of its journey has been prepared.
+func BookingDeparture(ctx context.Context, q db.Querier, bookingID int32) (time.Time, bool, error) {
+	journey, err := q.GetBookingDeparture(ctx, bookingID)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("not able to get the departure: %w", err)
+	}
+
+	departure := util.AtISTClock(journey.JourneyDate.Time, journey.OriginDeparture).
+		Add(time.Duration(journey.DepartureOffsetMin) * time.Minute)
+	charted := journey.JourneyStatus.Valid && journey.JourneyStatus.JourneyStatus == db.JourneyStatusCHARTED
+
+	return departure, charted, nil
+}
+
+func cancellationRule(ctx context.Context, q db.Querier, coachType db.CoachType, bookingType db.BookingType) (db.CancellationRule, error) {
+	rule, err := q.GetCancellationRule(ctx, db.GetCancellationRuleParams{
+		CoachType:   coachType,
+		BookingType: bookingType,
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return db.CancellationRule{}, fmt.Errorf("no cancellation rule configured for %s %s", coachType, bookingType)
+		}
+		return db.CancellationRule{}, err
+	}
+	return rule, nil
+}
+
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,97 @@
+package cancellation
+
+import (
+	db "better-uptime/internal/db/sqlc"
+	"testing"
+	"time"
+)
+
+func testCancellationRule() db.CancellationRule {
+	return db.CancellationRule{
+		CoachType:            db.CoachType3A,
+		BookingType:          db.BookingTypeNORMAL,
+		ClerkagePerPassenger: 60,
+		Deduction48hPercent:  25,
+		Deduction12hPercent:  50,
+		Deduction4hPercent:   75,
+		Refundable:           true,
+	}
+}
+
+func TestCalculate(t *testing.T) {
+	departure := time.Date(2026, 3, 10, 6, 0, 0, 0, time.UTC)
+	nonRefundable := testCancellationRule()
+	nonRefundable.Refundable = false
+
+	tests := []struct {
+		name     string
+		rule     db.CancellationRule
+		fare     float64
+		before   time.Duration
+		charted  bool
+		slab     string
+		deducted float64
+		refund   float64
+	}{
+		{"days ahead keeps the clerkage", testCancellationRule(), 1000, 72 * time.Hour, false, SlabClerkage, 120, 880},
+		{"48 hours ahead keeps the clerkage", testCancellationRule(), 1000, 48 * time.Hour, false, SlabClerkage, 120, 880},
+		{"a day ahead", testCancellationRule(), 1000, 24 * time.Hour, false, Slab48h, 250, 750},
+		{"12 hours ahead", testCancellationRule(), 1000, 12 * time.Hour, false, Slab48h, 250, 750},
+		{"6 hours ahead", testCancellationRule(), 1000, 6 * time.Hour, false, Slab12h, 500, 500},
+		{"2 hours ahead", testCancellationRule(), 1000, 2 * time.Hour, false, Slab4h, 750, 250},
+		{"after departure", testCancellationRule(), 1000, -time.Hour, false, SlabAfterDeparture, 1000, 0},
+		{"after charting", testCancellationRule(), 1000, 24 * time.Hour, true, SlabAfterCharting, 1000, 0},
+		{"not refundable", nonRefundable, 1000, 72 * time.Hour, false, SlabNonRefundable, 1000, 0},
+		{"never less than the clerkage", testCancellationRule(), 200, 24 * time.Hour, false, Slab48h, 120, 80},
+		{"never more than the fare", testCancellationRule(), 100, 72 * time.Hour, false, SlabClerkage, 100, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := Calculate(tt.rule, tt.fare, 2, departure, departure.Add(-tt.before), tt.charted)
+
+			if d.Slab != tt.slab {
+				t.Errorf("slab %s, want %s", d.Slab, tt.slab)
+			}
+			if d.Deducted != tt.deducted || d.Refund != tt.refund {
+				t.Errorf("deducted %v and refunded %v, want %v and %v", d.Deducted, d.Refund, tt.deducted, tt.refund)
+			}
+			if d.Clerkage != 120 || d.Passengers != 2 || d.Fare != tt.fare {
+				t.Errorf("breakdown %+v", d)
+			}
+			if d.HoursToDepart != tt.before.Hours() {
+				t.Errorf("%v hours to depart, want %v", d.HoursToDepart, tt.before.Hours())
+			}
+		})
+	}
+}
+
+func TestNotClearedRefundsInFull(t *testing.T) {
+	departure := time.Date(2026, 3, 10, 6, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		fare   float64
+		before time.Duration
+	}{
+		{"at charting", 1234.567, 4 * time.Hour},
+		{"charted late", 500, 30 * time.Minute},
+		{"nothing paid", 0, 4 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NotCleared(db.CoachTypeSL, db.BookingTypeNORMAL, 3, tt.fare, departure, departure.Add(-tt.before))
+
+			if d.Slab != SlabNotCleared || d.Deducted != 0 || d.Clerkage != 0 {
+				t.Errorf("deducted %+v", d)
+			}
+			if d.Refund != round(tt.fare) {
+				t.Errorf("refunded %v of %v", d.Refund, tt.fare)
+			}
+			if d.Passengers != 3 || d.HoursToDepart != round(tt.before.Hours()) {
+				t.Errorf("breakdown %+v", d)
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package cancellation
+
+import (
+	"better-uptime/common/kafka"
+	"better-uptime/common/logger"
+	"better-uptime/common/payment"
+	db "better-uptime/internal/db/sqlc"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// RunRefundProcessor sends queued refunds to the payment gateway every
+// interval until ctx is done. It is safe to run on every replica, see
+// ProcessRefunds.
+func (h *Handler) RunRefundProcessor(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			submitted, err := h.ProcessRefunds(ctx)
+			if err != nil {
+				logger.Error("refund processor failed: %v", err)
+				continue
+			}
+			if submitted > 0 {
+				logger.Info("refund processor submitted %d refunds", submitted)
+			}
+		}
+	}
+}
+
+// ProcessRefunds sends every PENDING refund that is due to the gateway and
+// returns how many the gateway accepted. Accepted refunds stay PENDING until
+// the gateway's refund webhook settles them, unless the gateway settles them
+// right away. A failed call is retried with backoff; one the gateway rejects
+// for good, or that runs out of attempts, is marked FAILED. Refunds are
+// claimed with SKIP LOCKED and sent with their idempotency key, so replicas
+// never refund twice.
+func (h *Handler) ProcessRefunds(ctx context.Context) (int, error) {
+	batchSize := h.config.REFUND_BATCH_SIZE
+	policy := kafka.RetryPolicy{
+		MaxAttempts: h.config.REFUND_MAX_ATTEMPTS,
+		BaseDelay:   time.Duration(h.config.REFUND_RETRY_BASE_SECONDS) * time.Second,
+		MaxDelay:    time.Duration(h.config.REFUND_RETRY_MAX_SECONDS) * time.Second,
+	}
+
+	total := 0
+
+	for {
+		var claimed, submitted int
+
+		err := h.store.ExecTx(ctx, func(q *db.Queries) error {
+			submitted = 0
+
+			refunds, err := q.GetPendingRefunds(ctx, int32(batchSize))
+			if err != nil {
+				return err
+			}
+			claimed = len(refunds)
+
+			for _, refund := range refunds {
+				ok, err := h.submitRefund(ctx, q, refund, policy)
+				if err != nil {
+					return fmt.Errorf("failed to update refund %d: %w", refund.ID, err)
+				}
+				if ok {
+					submitted++
+				}
+			}
+
+			return nil
+		})
+		if err != nil {
+			return total, err
+		}
+
+		total += submitted
+		if claimed < batchSize {
+			return total, nil
+		}
+	}
+}
+
+// submitRefund sends one refund to the gateway and records the outcome. It
+// reports whether the gateway accepted the refund.
+func (h *Handler) submitRefund(ctx context.Context, q *db.Queries, refund db.Refund, policy kafka.RetryPolicy) (bool, error) {
+	if !refund.PaymentID.Valid || refund.PaymentID.String == "" {
+		return false, q.MarkRefundFailed(ctx, db.MarkRefundFailedParams{
+			ID:        refund.ID,
+			LastError: pgtype.Text{String: "no gateway payment recorded for the booking", Valid: true},
+		})
+	}
+
+	result, err := h.Payments.Refund(ctx, payment.RefundRequest{
+		PaymentID:      refund.PaymentID.String,
+		Amount:         float64(refund.Amount),
+		IdempotencyKey: refund.IdempotencyKey.String,
+	})
+	if err != nil {
+		lastError := pgtype.Text{String: err.Error(), Valid: true}
+		attempt := int(refund.Attempts) + 1
+
+		if errors.Is(err, payment.ErrRefundRejected) || attempt >= policy.MaxAttempts {
+			logger.Error("refund %d failed after %d attempts: %v", refund.ID, attempt, err)
+			return false, q.MarkRefundFailed(ctx, db.MarkRefundFailedParams{
+				ID:        refund.ID,
+				LastError: lastError,
+			})
+		}
+
+		return false, q.MarkRefundRetry(ctx, db.MarkRefundRetryParams{
+			LastError:         lastError,
+			RetryAfterSeconds: int32(policy.Backoff(attempt) / time.Second),
+			ID:                refund.ID,
+		})
+	}
+
+	return true, q.MarkRefundSubmitted(ctx, db.MarkRefundSubmittedParams{
+		ID:              refund.ID,
+		GatewayRefundID: pgtype.Text{String: result.ID, Valid: true},
+		Status:          refundStatus(result.Status),
+	})
+}
+
+// SettleRefund records the outcome a refund webhook reports. A refund the
+// gateway knows of but that is not recorded yet, because the processor's
+// transaction has not committed, returns an error so the gateway sends the
+// webhook again.
+func SettleRefund(ctx context.Context, store db.Store, event *payment.Event) error {
+	status := refundStatus(event.RefundStatus)
+	if status == db.RefundStatusPENDING {
+		return nil
+	}
+
+	gatewayID := pgtype.Text{String: event.RefundID, Valid: true}
+
+	settled, err := store.SettleRefund(ctx, db.SettleRefundParams{
+		GatewayRefundID: gatewayID,
+		Status:          status,
+	})
+	if err != nil {
+		return err
+	}
+	if settled > 0 {
+		return nil
+	}
+
+	// already settled by an earlier delivery of the webhook
+	if _, err := store.GetRefundByGatewayID(ctx, gatewayID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("refund %s is not recorded yet", event.RefundID)
+		}
+		return err
+	}
+	return nil
+}
+
+// refundStatus maps a gateway refund status to the one stored on the refund.
+func refundStatus(status payment.RefundStatus) db.RefundStatus {
+	switch status {
+	case payment.RefundSucceeded:
+		return db.RefundStatusSUCCESS
+	case payment.RefundFailed:
+		return db.RefundStatusFAILED
+	default:
+		return db.RefundStatusPENDING
+	}
+}
@@ -0,0 +1,64 @@
+package cancellation
+
+import (
+	"better-uptime/common/middleware"
+	"better-uptime/common/util"
+	db "better-uptime/internal/db/sqlc"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type RefundResponse struct {
+	ID          int32           `json:"id"`
+	BookingID   int32           `json:"booking_id"`
+	Pnr         string          `json:"pnr"`
+	Amount      int32           `json:"amount"`
+	Status      db.RefundStatus `json:"status"`
+	Deduction   json.RawMessage `json:"deduction,omitempty"`
+	Attempts    int32           `json:"attempts"`
+	LastError   string          `json:"last_error,omitempty"`
+	RequestedAt time.Time       `json:"requested_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+// ListRefunds lists the user's refunds, newest first, with where each one is
+// at: PENDING until the gateway settles it, then SUCCESS or FAILED.
+func (h *Handler) ListRefunds(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	payload, err := middleware.GetFirebasePayloadFromContext(ctx)
+	if err != nil {
+		util.ErrorJson(w, util.ErrUnauthorized)
+		return
+	}
+
+	refunds, err := h.store.ListRefundsByUser(ctx, pgtype.UUID{Bytes: payload.UserId, Valid: true})
+	if err != nil {
+		util.ErrorJson(w, err)
+		return
+	}
+
+	response := make([]RefundResponse, 0, len(refunds))
+	for _, refund := range refunds {
+		response = append(response, RefundResponse{
+			ID:          refund.ID,
+			BookingID:   refund.Bookingid.Int32,
+			Pnr:         refund.Pnr.String,
+			Amount:      refund.Amount,
+			Status:      refund.Status,
+			Deduction:   refund.DeductionBreakdown,
+			Attempts:    refund.Attempts,
+			LastError:   refund.LastError.String,
+			RequestedAt: refund.Createdat.Time,
+			UpdatedAt:   refund.Updatedat.Time,
+		})
+	}
+
+	util.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "Refunds",
+		"data":    response,
+	})
+}
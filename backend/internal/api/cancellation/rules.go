@@ -0,0 +1,75 @@
+package cancellation
+
+import (
+	"better-uptime/common/middleware"
+	"better-uptime/common/util"
+	db "better-uptime/internal/db/sqlc"
+	"net/http"
+)
+
+type CancellationRuleRequest struct {
+	CoachType            db.CoachType   `json:"coach_type" validate:"required,oneof=3A 2A 1A SL GN"`
+	BookingType          db.BookingType `json:"booking_type" validate:"required,oneof=NORMAL WAITLIST TATKAL PREMIUM_TATKAL"`
+	ClerkagePerPassenger float64        `json:"clerkage_per_passenger" validate:"min=0"`
+	Deduction48hPercent  float64        `json:"deduction_48h_percent" validate:"min=0,max=100"`
+	Deduction12hPercent  float64        `json:"deduction_12h_percent" validate:"min=0,max=100,gtefield=Deduction48hPercent"`
+	Deduction4hPercent   float64        `json:"deduction_4h_percent" validate:"min=0,max=100,gtefield=Deduction12hPercent"`
+	Refundable           bool           `json:"refundable"`
+}
+
+func (h *Handler) ListRules(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	payload, err := middleware.GetFirebasePayloadFromContext(ctx)
+	if err != nil || payload.Role != "ADMIN" {
+		util.ErrorJson(w, util.ErrUnauthorized)
+		return
+	}
+
+	rules, err := h.store.ListCancellationRules(ctx)
+	if err != nil {
+		util.ErrorJson(w, err)
+		return
+	}
+
+	util.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "Cancellation rules",
+		"data":    rules,
+	})
+}
+
+func (h *Handler) UpsertRule(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	payload, err := middleware.GetFirebasePayloadFromContext(ctx)
+	if err != nil || payload.Role != "ADMIN" {
+		util.ErrorJson(w, util.ErrUnauthorized)
+		return
+	}
+
+	var data CancellationRuleRequest
+	err = util.ReadJsonAndValidate(w, r, &data)
+	if err != nil {
+		util.ErrorJson(w, util.ErrNotValidRequest)
+		return
+	}
+
+	rule, err := h.store.UpsertCancellationRule(ctx, db.UpsertCancellationRuleParams{
+		CoachType:            data.CoachType,
+		BookingType:          data.BookingType,
+		ClerkagePerPassenger: data.ClerkagePerPassenger,
+		Deduction48hPercent:  data.Deduction48hPercent,
+		Deduction12hPercent:  data.Deduction12hPercent,
+		Deduction4hPercent:   data.Deduction4hPercent,
+		Refundable:           data.Refundable,
+	})
+	if err != nil {
+		util.ErrorJson(w, err)
+		return
+	}
+
+	util.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "Cancellation rule saved",
+		"data":    rule,
+	})
+}
@@ -0,0 +1,127 @@
+package fare
+
+import (
+	db "better-uptime/internal/db/sqlc"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Breakdown is the itemised fare for a booking. Every component is per
+// passenger except Total, which is what the user is charged.
+type Breakdown struct {
+	CoachType         db.CoachType   `json:"coach_type"`
+	BookingType       db.BookingType `json:"booking_type"`
+	DistanceKm        int32          `json:"distance_km"`
+	ChargeableKm      int32          `json:"chargeable_km"`
+	Passengers        int            `json:"passengers"`
+	BaseFare          float64        `json:"base_fare"`
+	ReservationCharge float64        `json:"reservation_charge"`
+	SuperfastCharge   float64        `json:"superfast_charge"`
+	TatkalCharge      float64        `json:"tatkal_charge"`
+	Gst               float64        `json:"gst"`
+	PerPassenger      float64        `json:"per_passenger"`
+	Total             float64        `json:"total"`
+	// premium tatkal only: the share of tatkal seats left when the fare was
+	// quoted, the multiplier that put on the base fare and what it added
+	SeatsLeftPercent float64 `json:"seats_left_percent,omitempty"`
+	FareMultiplier   float64 `json:"fare_multiplier,omitempty"`
+	DynamicCharge    float64 `json:"dynamic_charge,omitempty"`
+}
+
+// Calculate applies a fare rule to a journey. Distances shorter than the
+// rule's minimum are charged as the minimum, the tatkal premium is a percentage
+// of the base fare clamped to the rule's min/max, and GST is levied on the sum.
+func Calculate(rule db.FareRule, distanceKm int32, superfast bool, bookingType db.BookingType, passengers int) Breakdown {
+	return calculate(rule, distanceKm, superfast, bookingType, passengers, 1)
+}
+
+// calculate is Calculate with the base fare raised by a multiplier, which
+// only premium tatkal fares have.
+func calculate(rule db.FareRule, distanceKm int32, superfast bool, bookingType db.BookingType, passengers int, multiplier float64) Breakdown {
+	chargeableKm := distanceKm
+	if chargeableKm < rule.MinDistanceKm {
+		chargeableKm = rule.MinDistanceKm
+	}
+
+	b := Breakdown{
+		CoachType:         rule.CoachType,
+		BookingType:       bookingType,
+		DistanceKm:        distanceKm,
+		ChargeableKm:      chargeableKm,
+		Passengers:        passengers,
+		BaseFare:          round(rule.BaseFarePerKm * float64(chargeableKm)),
+		ReservationCharge: rule.ReservationCharge,
+	}
+
+	if superfast {
+		b.SuperfastCharge = rule.SuperfastCharge
+	}
+
+	if bookingType == db.BookingTypeTATKAL || bookingType == db.BookingTypePREMIUMTATKAL {
+		premium := b.BaseFare * rule.TatkalPremiumPercent / 100
+		if premium < rule.TatkalMinCharge {
+			premium = rule.TatkalMinCharge
+		}
+		if rule.TatkalMaxCharge > 0 && premium > rule.TatkalMaxCharge {
+			premium = rule.TatkalMaxCharge
+		}
+		b.TatkalCharge = round(premium)
+	}
+
+	if multiplier > 1 {
+		b.FareMultiplier = multiplier
+		b.DynamicCharge = round(b.BaseFare * (multiplier - 1))
+	}
+
+	subtotal := b.BaseFare + b.ReservationCharge + b.SuperfastCharge + b.TatkalCharge + b.DynamicCharge
+	b.Gst = round(subtotal * rule.GstPercent / 100)
+	b.PerPassenger = round(subtotal + b.Gst)
+	b.Total = round(b.PerPassenger * float64(passengers))
+
+	return b
+}
+
+// Quote looks up the train and the fare rule for the coach type and prices the
+// booking. A distance of 0 prices the whole journey of the train. It takes a
+// Querier so it can be used inside a transaction as well. Premium tatkal fares
+// depend on the seats left and are priced by QuotePremiumTatkal.
+func Quote(ctx context.Context, q db.Querier, trainID int32, distanceKm int32, coachType db.CoachType, bookingType db.BookingType, passengers int) (Breakdown, error) {
+	if bookingType == db.BookingTypePREMIUMTATKAL {
+		return Breakdown{}, errors.New("premium tatkal fares are quoted for a journey")
+	}
+
+	return quote(ctx, q, trainID, distanceKm, coachType, bookingType, passengers, 1)
+}
+
+func quote(ctx context.Context, q db.Querier, trainID int32, distanceKm int32, coachType db.CoachType, bookingType db.BookingType, passengers int, multiplier float64) (Breakdown, error) {
+	if passengers <= 0 {
+		return Breakdown{}, errors.New("at least one passenger is required")
+	}
+
+	train, err := q.GetTrainById(ctx, trainID)
+	if err != nil {
+		return Breakdown{}, fmt.Errorf("not able to get train %d: %w", trainID, err)
+	}
+
+	rule, err := q.GetFareRule(ctx, coachType)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Breakdown{}, fmt.Errorf("no fare configured for coach type %s", coachType)
+		}
+		return Breakdown{}, err
+	}
+
+	if distanceKm <= 0 {
+		distanceKm = train.DistanceKm
+	}
+
+	return calculate(rule, distanceKm, train.IsSuperfast, bookingType, passengers, multiplier), nil
+}
+
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,64 @@
+package fare
+
+import (
+	db "better-uptime/internal/db/sqlc"
+	"testing"
+)
+
+func testFareRule() db.FareRule {
+	return db.FareRule{
+		CoachType:            db.CoachType3A,
+		BaseFarePerKm:        1.5,
+		MinDistanceKm:        200,
+		ReservationCharge:    40,
+		SuperfastCharge:      45,
+		TatkalPremiumPercent: 30,
+		TatkalMinCharge:      100,
+		TatkalMaxCharge:      400,
+		GstPercent:           5,
+	}
+}
+
+func TestCalculate(t *testing.T) {
+	uncapped := testFareRule()
+	uncapped.TatkalMaxCharge = 0
+
+	tests := []struct {
+		name         string
+		rule         db.FareRule
+		distanceKm   int32
+		superfast    bool
+		bookingType  db.BookingType
+		passengers   int
+		chargeableKm int32
+		tatkal       float64
+		perPassenger float64
+		total        float64
+	}{
+		{"normal", testFareRule(), 500, false, db.BookingTypeNORMAL, 2, 500, 0, 829.5, 1659},
+		{"short trip charged the minimum", testFareRule(), 100, true, db.BookingTypeNORMAL, 1, 200, 0, 404.25, 404.25},
+		{"tatkal", testFareRule(), 500, false, db.BookingTypeTATKAL, 1, 500, 225, 1065.75, 1065.75},
+		{"tatkal premium raised to the minimum", testFareRule(), 200, false, db.BookingTypeTATKAL, 1, 200, 100, 462, 462},
+		{"tatkal premium capped", testFareRule(), 2000, false, db.BookingTypeTATKAL, 1, 2000, 400, 3612, 3612},
+		{"tatkal premium without a cap", uncapped, 2000, false, db.BookingTypeTATKAL, 1, 2000, 900, 4137, 4137},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := Calculate(tt.rule, tt.distanceKm, tt.superfast, tt.bookingType, tt.passengers)
+
+			if b.DistanceKm != tt.distanceKm || b.ChargeableKm != tt.chargeableKm {
+				t.Errorf("distance %d charged as %d, want %d charged as %d", b.DistanceKm, b.ChargeableKm, tt.distanceKm, tt.chargeableKm)
+			}
+			if b.TatkalCharge != tt.tatkal {
+				t.Errorf("tatkal charge %v, want %v", b.TatkalCharge, tt.tatkal)
+			}
+			if b.PerPassenger != tt.perPassenger || b.Total != tt.total {
+				t.Errorf("charged %v each, %v in all, want %v each, %v in all", b.PerPassenger, b.Total, tt.perPassenger, tt.total)
+			}
+			if b.FareMultiplier != 0 || b.DynamicCharge != 0 {
+				t.Errorf("raised by x%v for %v", b.FareMultiplier, b.DynamicCharge)
+			}
+		})
+	}
+}
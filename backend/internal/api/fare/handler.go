@@ -0,0 +1,41 @@
+package fare
+
+import (
+	"better-uptime/common/middleware"
+	"better-uptime/common/routes"
+	"better-uptime/config"
+	db "better-uptime/internal/db/sqlc"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/redis/go-redis/v9"
+)
+
+type Handler struct {
+	store  db.Store
+	config *config.Config
+	Redis  redis.Client
+}
+
+func NewHandler(config *config.Config, store db.Store, Redis redis.Client) *Handler {
+	return &Handler{
+		config: config,
+		store:  store,
+		Redis:  Redis,
+	}
+}
+
+func (h *Handler) Routes() *chi.Mux {
+	router := routes.DefaultRouter()
+
+	router.Group(func(r chi.Router) {
+		r.Use(middleware.TokenMiddleware(h.store))
+		r.Post("/quote", h.GetQuote)
+		r.Get("/rules", h.ListRules)
+		r.Put("/rules", h.UpsertRule)
+		r.Get("/premium-tatkal/{trainId}", h.GetPremiumCurve)
+		r.Put("/premium-tatkal/{trainId}", h.SetPremiumCurve)
+		r.Delete("/premium-tatkal/{trainId}", h.ResetPremiumCurve)
+	})
+
+	return router
+}
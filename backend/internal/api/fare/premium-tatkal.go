@@ -0,0 +1,267 @@
+package fare
+
+import (
+	"better-uptime/common/middleware"
+	"better-uptime/common/util"
+	db "better-uptime/internal/db/sqlc"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/redis/go-redis/v9"
+)
+
+// PremiumStep is a step of a premium tatkal fare curve: the base fare is
+// multiplied by FareMultiplier once the share of tatkal seats left falls to
+// SeatsLeftPercent.
+type PremiumStep struct {
+	SeatsLeftPercent int32   `json:"seats_left_percent" validate:"min=0,max=100"`
+	FareMultiplier   float64 `json:"fare_multiplier" validate:"min=1,max=10"`
+}
+
+// DefaultPremiumCurve prices premium tatkal on trains that have no curve of
+// their own.
+var DefaultPremiumCurve = []PremiumStep{
+	{SeatsLeftPercent: 100, FareMultiplier: 1.1},
+	{SeatsLeftPercent: 75, FareMultiplier: 1.3},
+	{SeatsLeftPercent: 50, FareMultiplier: 1.5},
+	{SeatsLeftPercent: 25, FareMultiplier: 2},
+	{SeatsLeftPercent: 10, FareMultiplier: 2.5},
+}
+
+type PremiumCurveRequest struct {
+	Steps []PremiumStep `json:"steps" validate:"required,min=1,max=20,dive"`
+}
+
+// Multiplier picks the step of a curve for the share of seats left, the
+// lowest step at or above it. Above every step the fare is not raised.
+func Multiplier(curve []PremiumStep, seatsLeftPercent float64) float64 {
+	multiplier := 1.0
+	lowest := int32(101)
+
+	for _, step := range curve {
+		if seatsLeftPercent <= float64(step.SeatsLeftPercent) && step.SeatsLeftPercent < lowest {
+			lowest = step.SeatsLeftPercent
+			multiplier = step.FareMultiplier
+		}
+	}
+
+	return multiplier
+}
+
+// SeatsLeftPercent is the share of a class's tatkal seats that are free.
+func SeatsLeftPercent(total, available int64) float64 {
+	if total <= 0 || available <= 0 {
+		return 0
+	}
+	if available > total {
+		return 100
+	}
+	return round(float64(available) * 100 / float64(total))
+}
+
+// TatkalCounterKey is the redis counter of free tatkal seats of a class that
+// the tatkal worker takes seats from before the database is touched.
+func TatkalCounterKey(journeyId int32, coachType db.CoachType) string {
+	return fmt.Sprintf("tatkal:available:%d:%s", journeyId, coachType)
+}
+
+// TatkalSeatsLeft is the share of a class's tatkal seats left right now. While
+// the tatkal window is warm the redis counter is ahead of the database, so it
+// is used in place of the free seats in seat_inventory.
+func TatkalSeatsLeft(ctx context.Context, q db.Querier, rdb *redis.Client, journeyId int32, coachType db.CoachType) (float64, error) {
+	inventory, err := q.GetTatkalInventory(ctx, db.GetTatkalInventoryParams{
+		JourneyID: journeyId,
+		CoachType: coachType,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	available := inventory.Available
+	counted, err := rdb.Get(ctx, TatkalCounterKey(journeyId, coachType)).Int64()
+	switch {
+	case err == nil:
+		available = counted
+	case !errors.Is(err, redis.Nil):
+		return 0, err
+	}
+
+	return SeatsLeftPercent(inventory.Total, available), nil
+}
+
+// PremiumCurve returns the premium tatkal curve of a train, or the default
+// one when it has none.
+func PremiumCurve(ctx context.Context, q db.Querier, trainID int32) ([]PremiumStep, error) {
+	rows, err := q.ListPremiumTatkalFares(ctx, trainID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rows) == 0 {
+		return DefaultPremiumCurve, nil
+	}
+
+	curve := make([]PremiumStep, 0, len(rows))
+	for _, row := range rows {
+		curve = append(curve, PremiumStep{
+			SeatsLeftPercent: row.SeatsLeftPercent,
+			FareMultiplier:   row.FareMultiplier,
+		})
+	}
+
+	return curve, nil
+}
+
+// QuotePremiumTatkal prices a premium tatkal booking: the tatkal fare with the
+// base fare raised by the step of the train's curve for the share of tatkal
+// seats left.
+func QuotePremiumTatkal(ctx context.Context, q db.Querier, trainID int32, distanceKm int32, coachType db.CoachType, passengers int, seatsLeftPercent float64) (Breakdown, error) {
+	curve, err := PremiumCurve(ctx, q, trainID)
+	if err != nil {
+		return Breakdown{}, err
+	}
+
+	b, err := quote(ctx, q, trainID, distanceKm, coachType, db.BookingTypePREMIUMTATKAL, passengers, Multiplier(curve, seatsLeftPercent))
+	if err != nil {
+		return Breakdown{}, err
+	}
+
+	b.SeatsLeftPercent = seatsLeftPercent
+	return b, nil
+}
+
+func (h *Handler) GetPremiumCurve(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	payload, err := middleware.GetFirebasePayloadFromContext(ctx)
+	if err != nil || payload.Role != "ADMIN" {
+		util.ErrorJson(w, util.ErrUnauthorized)
+		return
+	}
+
+	trainId, err := strconv.Atoi(chi.URLParam(r, "trainId"))
+	if err != nil {
+		util.ErrorJson(w, util.ErrNotValidRequest)
+		return
+	}
+
+	curve, err := PremiumCurve(ctx, h.store, int32(trainId))
+	if err != nil {
+		util.ErrorJson(w, err)
+		return
+	}
+
+	util.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "Premium tatkal fare curve",
+		"data":    curve,
+	})
+}
+
+// SetPremiumCurve replaces the premium tatkal curve of a train.
+func (h *Handler) SetPremiumCurve(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	payload, err := middleware.GetFirebasePayloadFromContext(ctx)
+	if err != nil || payload.Role != "ADMIN" {
+		util.ErrorJson(w, util.ErrUnauthorized)
+		return
+	}
+
+	trainId, err := strconv.Atoi(chi.URLParam(r, "trainId"))
+	if err != nil {
+		util.ErrorJson(w, util.ErrNotValidRequest)
+		return
+	}
+
+	var data PremiumCurveRequest
+	err = util.ReadJsonAndValidate(w, r, &data)
+	if err != nil {
+		util.ErrorJson(w, util.ErrNotValidRequest)
+		return
+	}
+
+	// the fare only goes up as the seats run out
+	steps := slices.Clone(data.Steps)
+	slices.SortFunc(steps, func(a, b PremiumStep) int {
+		return cmp.Compare(b.SeatsLeftPercent, a.SeatsLeftPercent)
+	})
+	for i := 1; i < len(steps); i++ {
+		if steps[i].SeatsLeftPercent == steps[i-1].SeatsLeftPercent {
+			util.ErrorJson(w, fmt.Errorf("more than one step at %d%% seats left", steps[i].SeatsLeftPercent))
+			return
+		}
+		if steps[i].FareMultiplier < steps[i-1].FareMultiplier {
+			util.ErrorJson(w, fmt.Errorf("the multiplier at %d%% seats left is lower than at %d%%", steps[i].SeatsLeftPercent, steps[i-1].SeatsLeftPercent))
+			return
+		}
+	}
+
+	if _, err := h.store.GetTrainById(ctx, int32(trainId)); err != nil {
+		util.ErrorJson(w, errors.New("train not found"))
+		return
+	}
+
+	var saved []db.PremiumTatkalFare
+	err = h.store.ExecTx(ctx, func(q *db.Queries) error {
+		if err := q.DeletePremiumTatkalFares(ctx, int32(trainId)); err != nil {
+			return err
+		}
+
+		for _, step := range steps {
+			fare, err := q.InsertPremiumTatkalFare(ctx, db.InsertPremiumTatkalFareParams{
+				TrainID:          int32(trainId),
+				SeatsLeftPercent: step.SeatsLeftPercent,
+				FareMultiplier:   step.FareMultiplier,
+			})
+			if err != nil {
+				return err
+			}
+			saved = append(saved, fare)
+		}
+
+		return nil
+	})
+	if err != nil {
+		util.ErrorJson(w, err)
+		return
+	}
+
+	util.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "Premium tatkal fare curve saved",
+		"data":    saved,
+	})
+}
+
+// ResetPremiumCurve deletes the premium tatkal curve of a train, which then
+// goes back to the default one.
+func (h *Handler) ResetPremiumCurve(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	payload, err := middleware.GetFirebasePayloadFromContext(ctx)
+	if err != nil || payload.Role != "ADMIN" {
+		util.ErrorJson(w, util.ErrUnauthorized)
+		return
+	}
+
+	trainId, err := strconv.Atoi(chi.URLParam(r, "trainId"))
+	if err != nil {
+		util.ErrorJson(w, util.ErrNotValidRequest)
+		return
+	}
+
+	if err := h.store.DeletePremiumTatkalFares(ctx, int32(trainId)); err != nil {
+		util.ErrorJson(w, err)
+		return
+	}
+
+	util.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "Premium tatkal fare curve reset to the default",
+		"data":    DefaultPremiumCurve,
+	})
+}
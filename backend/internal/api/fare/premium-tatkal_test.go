@@ -0,0 +1,72 @@
+package fare
+
+import (
+	db "better-uptime/internal/db/sqlc"
+	"testing"
+)
+
+func TestMultiplier(t *testing.T) {
+	tests := []struct {
+		name      string
+		curve     []PremiumStep
+		seatsLeft float64
+		want      float64
+	}{
+		{"all seats left", DefaultPremiumCurve, 100, 1.1},
+		{"between steps takes the one above", DefaultPremiumCurve, 80, 1.1},
+		{"on a step", DefaultPremiumCurve, 75, 1.3},
+		{"just above a step", DefaultPremiumCurve, 75.5, 1.1},
+		{"half left", DefaultPremiumCurve, 50, 1.5},
+		{"a quarter left", DefaultPremiumCurve, 25, 2},
+		{"last seats", DefaultPremiumCurve, 3, 2.5},
+		{"sold out", DefaultPremiumCurve, 0, 2.5},
+		{"above every step", []PremiumStep{{SeatsLeftPercent: 50, FareMultiplier: 2}}, 80, 1},
+		{"steps in any order", []PremiumStep{{SeatsLeftPercent: 10, FareMultiplier: 3}, {SeatsLeftPercent: 100, FareMultiplier: 1.2}}, 5, 3},
+		{"no curve", nil, 5, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Multiplier(tt.curve, tt.seatsLeft); got != tt.want {
+				t.Errorf("Multiplier(%v) = %v, want %v", tt.seatsLeft, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSeatsLeftPercent(t *testing.T) {
+	tests := []struct {
+		total, available int64
+		want             float64
+	}{
+		{100, 100, 100},
+		{100, 25, 25},
+		{3, 1, 33.33},
+		{100, 0, 0},
+		{100, -4, 0},
+		{0, 0, 0},
+		// a counter ahead of a class that lost seats
+		{10, 12, 100},
+	}
+
+	for _, tt := range tests {
+		if got := SeatsLeftPercent(tt.total, tt.available); got != tt.want {
+			t.Errorf("SeatsLeftPercent(%d, %d) = %v, want %v", tt.total, tt.available, got, tt.want)
+		}
+	}
+}
+
+func TestCalculateRaisesTheBaseFareOnly(t *testing.T) {
+	b := calculate(testFareRule(), 500, false, db.BookingTypePREMIUMTATKAL, 1, 2)
+
+	if b.FareMultiplier != 2 || b.DynamicCharge != 750 {
+		t.Fatalf("raised by x%v for %v, want x2 for 750", b.FareMultiplier, b.DynamicCharge)
+	}
+	// the tatkal premium stays on the base fare before it is raised
+	if b.TatkalCharge != 225 {
+		t.Errorf("tatkal charge %v, want 225", b.TatkalCharge)
+	}
+	if b.PerPassenger != 1853.25 {
+		t.Errorf("charged %v, want 1853.25", b.PerPassenger)
+	}
+}
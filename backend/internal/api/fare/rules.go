@@ -0,0 +1,167 @@
+package fare
+
+import (
+	"better-uptime/common/logger"
+	"better-uptime/common/middleware"
+	"better-uptime/common/util"
+	db "better-uptime/internal/db/sqlc"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type QuoteRequest struct {
+	JourneyId   int            `json:"journey_id" validate:"required"`
+	CoachType   db.CoachType   `json:"coach_type" validate:"required,oneof=3A 2A 1A SL GN"`
+	BookingType db.BookingType `json:"booking_type" validate:"required,oneof=NORMAL TATKAL PREMIUM_TATKAL"`
+	Passengers  int            `json:"passengers" validate:"required,min=1,max=6"`
+	FromStation string         `json:"from_station,omitempty"`
+	ToStation   string         `json:"to_station,omitempty"`
+}
+
+type FareRuleRequest struct {
+	CoachType            db.CoachType `json:"coach_type" validate:"required,oneof=3A 2A 1A SL GN"`
+	BaseFarePerKm        float64      `json:"base_fare_per_km" validate:"gt=0"`
+	MinDistanceKm        int          `json:"min_distance_km" validate:"min=0"`
+	ReservationCharge    float64      `json:"reservation_charge" validate:"min=0"`
+	SuperfastCharge      float64      `json:"superfast_charge" validate:"min=0"`
+	TatkalPremiumPercent float64      `json:"tatkal_premium_percent" validate:"min=0,max=100"`
+	TatkalMinCharge      float64      `json:"tatkal_min_charge" validate:"min=0"`
+	TatkalMaxCharge      float64      `json:"tatkal_max_charge" validate:"min=0,gtefield=TatkalMinCharge"`
+	GstPercent           float64      `json:"gst_percent" validate:"min=0,max=100"`
+}
+
+// GetQuote prices a journey the way booking it would, over the stations given
+// as from_station and to_station or else the whole route.
+func (h *Handler) GetQuote(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var data QuoteRequest
+	err := util.ReadJsonAndValidate(w, r, &data)
+	if err != nil {
+		util.ErrorJson(w, util.ErrNotValidRequest)
+		return
+	}
+
+	journey, err := h.store.GetTrainJourneyById(ctx, int32(data.JourneyId))
+	if err != nil {
+		util.ErrorJson(w, util.ErrNotValidRequest)
+		return
+	}
+
+	distanceKm, err := h.segmentDistance(ctx, journey.TrainID.Int32, data.FromStation, data.ToStation)
+	if err != nil {
+		util.ErrorJson(w, err)
+		return
+	}
+
+	var breakdown Breakdown
+	if data.BookingType == db.BookingTypePREMIUMTATKAL {
+		// the fare at the moment, the one charged is locked in when booking
+		var seatsLeft float64
+		seatsLeft, err = TatkalSeatsLeft(ctx, h.store, &h.Redis, journey.ID, data.CoachType)
+		if err == nil {
+			breakdown, err = QuotePremiumTatkal(ctx, h.store, journey.TrainID.Int32, distanceKm, data.CoachType, data.Passengers, seatsLeft)
+		}
+	} else {
+		breakdown, err = Quote(ctx, h.store, journey.TrainID.Int32, distanceKm, data.CoachType, data.BookingType, data.Passengers)
+	}
+	if err != nil {
+		util.ErrorJson(w, err)
+		return
+	}
+
+	util.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "Fare quote",
+		"data":    breakdown,
+	})
+}
+
+// segmentDistance is how far the train runs between two stations of its
+// route, found as booking does. 0 stands for the whole route.
+func (h *Handler) segmentDistance(ctx context.Context, trainId int32, from, to string) (int32, error) {
+	if from == "" && to == "" {
+		return 0, nil
+	}
+	if from == "" || to == "" {
+		return 0, errors.New("both from_station and to_station are required")
+	}
+
+	segment, err := h.store.GetRouteSegment(ctx, db.GetRouteSegmentParams{
+		TrainID:  trainId,
+		FromCode: strings.ToUpper(from),
+		ToCode:   strings.ToUpper(to),
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, fmt.Errorf("train does not run from %s to %s", from, to)
+		}
+		logger.Error("failed to get the route segment of train %d: %v", trainId, err)
+		return 0, util.ErrInternal
+	}
+
+	return segment.ToDistanceKm - segment.FromDistanceKm, nil
+}
+
+func (h *Handler) ListRules(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	payload, err := middleware.GetFirebasePayloadFromContext(ctx)
+	if err != nil || payload.Role != "ADMIN" {
+		util.ErrorJson(w, util.ErrUnauthorized)
+		return
+	}
+
+	rules, err := h.store.ListFareRules(ctx)
+	if err != nil {
+		util.ErrorJson(w, err)
+		return
+	}
+
+	util.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "Fare rules",
+		"data":    rules,
+	})
+}
+
+func (h *Handler) UpsertRule(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	payload, err := middleware.GetFirebasePayloadFromContext(ctx)
+	if err != nil || payload.Role != "ADMIN" {
+		util.ErrorJson(w, util.ErrUnauthorized)
+		return
+	}
+
+	var data FareRuleRequest
+	err = util.ReadJsonAndValidate(w, r, &data)
+	if err != nil {
+		util.ErrorJson(w, util.ErrNotValidRequest)
+		return
+	}
+
+	rule, err := h.store.UpsertFareRule(ctx, db.UpsertFareRuleParams{
+		CoachType:            data.CoachType,
+		BaseFarePerKm:        data.BaseFarePerKm,
+		MinDistanceKm:        int32(data.MinDistanceKm),
+		ReservationCharge:    data.ReservationCharge,
+		SuperfastCharge:      data.SuperfastCharge,
+		TatkalPremiumPercent: data.TatkalPremiumPercent,
+		TatkalMinCharge:      data.TatkalMinCharge,
+		TatkalMaxCharge:      data.TatkalMaxCharge,
+		GstPercent:           data.GstPercent,
+	})
+	if err != nil {
+		util.ErrorJson(w, err)
+		return
+	}
+
+	util.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "Fare rule saved",
+		"data":    rule,
+	})
+}
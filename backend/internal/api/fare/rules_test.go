@@ -0,0 +1,123 @@
+package fare
+
+import (
+	"better-uptime/config"
+	"better-uptime/internal/db/dbtest"
+	db "better-uptime/internal/db/sqlc"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/redis/go-redis/v9"
+)
+
+// counterHook answers GETs of a redis client with fixed values, without a
+// server.
+type counterHook map[string]string
+
+func (c counterHook) DialHook(next redis.DialHook) redis.DialHook { return next }
+
+func (c counterHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return next
+}
+
+func (c counterHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		get, ok := cmd.(*redis.StringCmd)
+		if !ok || cmd.Name() != "get" {
+			return next(ctx, cmd)
+		}
+		value, ok := c[cmd.Args()[1].(string)]
+		if !ok {
+			get.SetErr(redis.Nil)
+			return redis.Nil
+		}
+		get.SetVal(value)
+		return nil
+	}
+}
+
+var _ redis.Hook = counterHook(nil)
+
+func newQuoteHandler(data *dbtest.DB, counters map[string]string) *Handler {
+	rdb := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+	rdb.AddHook(counterHook(counters))
+
+	return NewHandler(&config.Config{}, data.Store(), *rdb)
+}
+
+func quoteData() *dbtest.DB {
+	data := dbtest.New()
+	data.Return("GetTrainJourneyById", db.TrainJourney{ID: 3, TrainID: pgtype.Int4{Int32: 5, Valid: true}})
+	data.Return("GetTatkalInventory", db.GetTatkalInventoryRow{Total: 100, Available: 100})
+	data.Return("GetTrainById", db.Train{ID: 5, DistanceKm: 100})
+	data.Return("GetFareRule", db.FareRule{CoachType: db.CoachType3A, BaseFarePerKm: 1})
+	return data
+}
+
+func premiumTatkalQuote() QuoteRequest {
+	return QuoteRequest{JourneyId: 3, CoachType: db.CoachType3A, BookingType: db.BookingTypePREMIUMTATKAL, Passengers: 1}
+}
+
+func getQuote(t *testing.T, h *Handler, req QuoteRequest) Breakdown {
+	t.Helper()
+
+	body, _ := json.Marshal(req)
+	w := httptest.NewRecorder()
+	h.GetQuote(w, httptest.NewRequest(http.MethodPost, "/fare/quote", bytes.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("quote returned %d: %s", w.Code, w.Body)
+	}
+
+	var res struct {
+		Data Breakdown `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	return res.Data
+}
+
+func TestPremiumTatkalQuoteUsesTheTatkalCounter(t *testing.T) {
+	// the database still has every seat, the counter knows 95 are taken
+	h := newQuoteHandler(quoteData(), map[string]string{TatkalCounterKey(3, db.CoachType3A): "5"})
+
+	b := getQuote(t, h, premiumTatkalQuote())
+	if b.SeatsLeftPercent != 5 || b.FareMultiplier != 2.5 {
+		t.Fatalf("quoted %v%% seats left at x%v, want 5%% at x2.5", b.SeatsLeftPercent, b.FareMultiplier)
+	}
+}
+
+func TestPremiumTatkalQuoteFallsBackToTheDatabase(t *testing.T) {
+	h := newQuoteHandler(quoteData(), nil)
+
+	b := getQuote(t, h, premiumTatkalQuote())
+	if b.SeatsLeftPercent != 100 || b.FareMultiplier != 1.1 {
+		t.Fatalf("quoted %v%% seats left at x%v, want 100%% at x1.1", b.SeatsLeftPercent, b.FareMultiplier)
+	}
+}
+
+func TestQuotePricesTheStationsAsked(t *testing.T) {
+	data := quoteData()
+	data.Return("GetRouteSegment", db.GetRouteSegmentRow{FromSequence: 2, ToSequence: 4, FromDistanceKm: 20, ToDistanceKm: 80})
+	h := newQuoteHandler(data, nil)
+
+	req := QuoteRequest{JourneyId: 3, CoachType: db.CoachType3A, BookingType: db.BookingTypeNORMAL, Passengers: 1}
+	if b := getQuote(t, h, req); b.DistanceKm != 100 {
+		t.Errorf("whole route quoted over %d km, want 100", b.DistanceKm)
+	}
+
+	req.FromStation, req.ToStation = "bpl", "jhs"
+	if b := getQuote(t, h, req); b.DistanceKm != 60 {
+		t.Errorf("segment quoted over %d km, want 60", b.DistanceKm)
+	}
+
+	calls := data.Calls("GetRouteSegment")
+	if len(calls) != 1 || calls[0].Args[1] != "BPL" || calls[0].Args[2] != "JHS" {
+		t.Errorf("segment looked up %v", calls)
+	}
+}
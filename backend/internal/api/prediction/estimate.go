@@ -0,0 +1,190 @@
+package prediction
+
+import (
+	"better-uptime/common/util"
+	"better-uptime/internal/api/cancellation"
+	db "better-uptime/internal/db/sqlc"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	ChanceHigh   = "HIGH"
+	ChanceMedium = "MEDIUM"
+	ChanceLow    = "LOW"
+)
+
+// below these many seats booked or bookings waitlisted the history says too
+// little about a train and class to go by
+const (
+	minBookedSeats = 20
+	minWaitlisted  = 10
+)
+
+// Estimate is the chance that a waitlisted booking gets seats before
+// departure.
+type Estimate struct {
+	Probability           int     `json:"probability"`
+	Chance                string  `json:"chance"`
+	ExpectedCancellations float64 `json:"expected_cancellations"`
+	SeatsNeeded           int64   `json:"seats_needed"`
+	DaysLeft              int     `json:"days_left"`
+}
+
+// Calculate estimates the chance of seatsNeeded seats coming free on a journey
+// with booked seats sold, daysLeft days before departure. stats are the
+// statistics of the train and class, which hold what was cancelled with at
+// most days_left days to go. Cancellations are taken to arrive independently
+// at the historical rate, so the chance is a Poisson tail; when enough
+// bookings were waitlisted before, it is averaged with how many of them
+// cleared. It returns nil when there is not enough history.
+func Calculate(stats []db.CancellationStat, booked int64, seatsNeeded int64, daysLeft int) *Estimate {
+	stat, ok := bucket(stats, daysLeft)
+	if !ok || stat.BookedSeats < minBookedSeats {
+		return nil
+	}
+
+	rate := float64(stat.CancelledSeats) / float64(stat.BookedSeats)
+	expected := rate * float64(booked)
+
+	p := poissonTail(expected, seatsNeeded)
+	if stat.Waitlisted >= minWaitlisted {
+		p = (p + float64(stat.Cleared)/float64(stat.Waitlisted)) / 2
+	}
+
+	probability := int(math.Round(p * 100))
+
+	return &Estimate{
+		Probability:           probability,
+		Chance:                chance(probability),
+		ExpectedCancellations: math.Round(expected*10) / 10,
+		SeatsNeeded:           seatsNeeded,
+		DaysLeft:              daysLeft,
+	}
+}
+
+// ForBooking estimates the chance of a waitlisted booking being confirmed. The
+// seats it needs are its own plus those of the bookings ahead of it in its
+// class. It returns nil when the booking is not on the waitlist or there is
+// not enough history. It takes a Querier so it can be used inside a
+// transaction as well.
+func ForBooking(ctx context.Context, q db.Querier, bookingID int32) (*Estimate, error) {
+	booking, err := q.GetBookingById(ctx, bookingID)
+	if err != nil {
+		return nil, err
+	}
+	if booking.Status != db.BookingStatusWAITLIST {
+		return nil, nil
+	}
+
+	wl, err := q.GetWaitlistByBooking(ctx, util.ToPgInt4(booking.ID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if wl.Status != db.WaitingStatusWAITING || !wl.CoachType.Valid {
+		return nil, nil
+	}
+	coachType := wl.CoachType.CoachType
+
+	passengers, err := q.CountPassengersByBooking(ctx, util.ToPgInt4(booking.ID))
+	if err != nil {
+		return nil, err
+	}
+
+	journey, err := q.GetTrainJourneyById(ctx, booking.JourneyID.Int32)
+	if err != nil {
+		return nil, fmt.Errorf("not able to get the journey: %w", err)
+	}
+
+	leaves, _, err := cancellation.BookingDeparture(ctx, q, booking.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	availability, err := q.GetAvailabilityByJourneys(ctx, db.GetAvailabilityByJourneysParams{
+		JourneyIds: []int32{booking.JourneyID.Int32},
+		LegMasks:   []int64{booking.LegMask},
+		Quota:      db.SeatQuotaNORMAL,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var booked int64
+	for _, a := range availability {
+		if a.CoachType == coachType {
+			booked = a.TotalSeats - a.AvailableSeats
+		}
+	}
+
+	stats, err := q.GetCancellationStats(ctx, db.GetCancellationStatsParams{
+		TrainID:   journey.TrainID.Int32,
+		CoachType: coachType,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return Calculate(stats, booked, int64(wl.SeatsAhead)+passengers, DaysLeft(leaves, time.Now())), nil
+}
+
+// DaysLeft is the number of whole days from now to departure.
+func DaysLeft(departure time.Time, now time.Time) int {
+	days := int(departure.Sub(now).Hours() / 24)
+	if days < 0 {
+		return 0
+	}
+	return days
+}
+
+// bucket picks the statistics of the smallest days_left that still covers
+// daysLeft, or the largest there is when the journey is further out. stats are
+// ordered by days_left.
+func bucket(stats []db.CancellationStat, daysLeft int) (db.CancellationStat, bool) {
+	if len(stats) == 0 {
+		return db.CancellationStat{}, false
+	}
+
+	for _, stat := range stats {
+		if int(stat.DaysLeft) >= daysLeft {
+			return stat, true
+		}
+	}
+
+	return stats[len(stats)-1], true
+}
+
+// poissonTail is the chance of at least n events when expected are expected.
+func poissonTail(expected float64, n int64) float64 {
+	if n <= 0 {
+		return 1
+	}
+
+	term := math.Exp(-expected)
+	below := 0.0
+	for k := int64(0); k < n; k++ {
+		below += term
+		term *= expected / float64(k+1)
+	}
+
+	return math.Max(0, 1-below)
+}
+
+func chance(probability int) string {
+	switch {
+	case probability >= 70:
+		return ChanceHigh
+	case probability >= 40:
+		return ChanceMedium
+	default:
+		return ChanceLow
+	}
+}
@@ -0,0 +1,67 @@
+package prediction
+
+import (
+	"better-uptime/common/logger"
+	"better-uptime/common/middleware"
+	"better-uptime/common/util"
+	db "better-uptime/internal/db/sqlc"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// GetBookingPrediction tells the owner of a waitlisted booking how likely it
+// is to be confirmed.
+func (h *Handler) GetBookingPrediction(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	payload, err := middleware.GetFirebasePayloadFromContext(ctx)
+	if err != nil {
+		util.ErrorJson(w, util.ErrUnauthorized)
+		return
+	}
+
+	bookingId, err := strconv.Atoi(chi.URLParam(r, "bookingId"))
+	if err != nil {
+		util.ErrorJson(w, util.ErrNotValidRequest)
+		return
+	}
+
+	booking, err := h.store.GetBookingById(ctx, int32(bookingId))
+	if err != nil {
+		util.ErrorJson(w, errors.New("booking not found"))
+		return
+	}
+
+	if booking.Userid.Bytes != payload.UserId {
+		util.ErrorJson(w, util.ErrUnauthorized)
+		return
+	}
+
+	if booking.Status != db.BookingStatusWAITLIST {
+		util.ErrorJson(w, errors.New("only waitlisted bookings have a prediction"))
+		return
+	}
+
+	estimate, err := ForBooking(ctx, h.store, booking.ID)
+	if err != nil {
+		logger.Error("failed to estimate booking %d: %v", booking.ID, err)
+		util.ErrorJson(w, util.ErrInternal)
+		return
+	}
+
+	if estimate == nil {
+		util.WriteJson(w, http.StatusOK, map[string]interface{}{
+			"message": "Not enough history to predict this booking",
+			"data":    nil,
+		})
+		return
+	}
+
+	util.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "Confirmation prediction",
+		"data":    estimate,
+	})
+}
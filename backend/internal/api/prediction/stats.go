@@ -0,0 +1,34 @@
+package prediction
+
+import (
+	"better-uptime/common/logger"
+	"context"
+	"time"
+)
+
+// RunStatsJob rebuilds the cancellation statistics once at start and then
+// every interval until ctx is cancelled.
+func (h *Handler) RunStatsJob(ctx context.Context, interval time.Duration) {
+	h.refreshStats(ctx)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			h.refreshStats(ctx)
+		}
+	}
+}
+
+func (h *Handler) refreshStats(ctx context.Context) {
+	rows, err := h.store.RefreshCancellationStats(ctx)
+	if err != nil {
+		logger.Error("failed to refresh cancellation stats: %v", err)
+		return
+	}
+	logger.Info("cancellation stats refreshed for %d train, class and day buckets", rows)
+}
@@ -2,6 +2,7 @@ package api
 
 import (
 	"better-uptime/common/routes"
+	"better-uptime/common/stripe"
 
 	"github.com/go-chi/chi/v5"
 )
@@ -14,6 +15,14 @@ func (app *Server) routes() *chi.Mux {
 		r.Mount("/train",app.trainHandler.Routes())
 		r.Mount("/booking",app.bookingHandler.Routes())
 		r.Mount("/cancel", app.cancelHandler.Routes())
+		r.Mount("/fare", app.fareHandler.Routes())
+		r.Mount("/prediction", app.predictionHandler.Routes())
+		r.Mount("/tatkal", app.tatkalHandler.Routes())
+
+		// local checkout page of the fake gateway
+		if fake, ok := app.payments.(*stripe.FakeGateway); ok {
+			r.Mount("/fake-payment", fake.Routes())
+		}
 	})
 
 	return router
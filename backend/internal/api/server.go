@@ -1,16 +1,23 @@
 package api
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"time"
 
 	"better-uptime/common/kafka"
+	"better-uptime/common/payment"
 	"better-uptime/config"
 	"better-uptime/internal/api/auth"
 	"better-uptime/internal/api/booking"
 	"better-uptime/internal/api/cancellation"
+	"better-uptime/internal/api/fare"
+	"better-uptime/internal/api/prediction"
+	"better-uptime/internal/api/tatkal"
 	"better-uptime/internal/api/train"
 	db "better-uptime/internal/db/sqlc"
+	"better-uptime/internal/outbox"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/redis/go-redis/v9"
@@ -25,7 +32,11 @@ type Server struct {
 	trainHandler   *train.Handler
 	bookingHandler *booking.Handler
 	cancelHandler *cancellation.Handler
+	fareHandler    *fare.Handler
+	predictionHandler *prediction.Handler
+	tatkalHandler  *tatkal.Handler
 	kafka          kafka.Producer
+	payments       payment.PaymentGateway
 }
 
 type ServerConfig struct {
@@ -40,20 +51,25 @@ type ServerConfig struct {
 }
 
 // NewServer creates a new API server instance
-func NewServer(store db.Store, cfg *config.Config, rdb redis.Client, kafka kafka.Producer) *Server {
+func NewServer(store db.Store, cfg *config.Config, rdb redis.Client, kafka kafka.Producer, payments payment.PaymentGateway) *Server {
 
 	// Create the server instance first
 	server := &Server{
 		store: store,
 		cfg:   cfg,
 		rdb:   rdb,
+		kafka: kafka,
+		payments: payments,
 	}
 
 	// Initialize the auth handler with only required dependencies
 	server.authHandler = auth.NewHandler(cfg, store)
-	server.bookingHandler = booking.NewHandler(cfg, store, rdb, kafka)
+	server.bookingHandler = booking.NewHandler(cfg, store, rdb, kafka, payments)
 	server.trainHandler = train.NewHandler(cfg, store)
-	server.cancelHandler = cancellation.NewHandler(cfg, store, kafka);
+	server.cancelHandler = cancellation.NewHandler(cfg, store, kafka, payments);
+	server.fareHandler = fare.NewHandler(cfg, store, rdb)
+	server.predictionHandler = prediction.NewHandler(cfg, store)
+	server.tatkalHandler = tatkal.NewHandler(cfg, store, rdb, kafka)
 
 	// You can now mount auth routes here like:
 	// r.Post("/login", server.authHandler.Login)
@@ -63,6 +79,29 @@ func NewServer(store db.Store, cfg *config.Config, rdb redis.Client, kafka kafka
 	return server
 }
 
+// StartBackgroundJobs runs the periodic jobs of the API process until ctx is
+// cancelled.
+func (s *Server) StartBackgroundJobs(ctx context.Context) {
+	interval := time.Duration(s.cfg.HOLD_SWEEP_INTERVAL_SECONDS) * time.Second
+	go s.bookingHandler.RunHoldSweeper(ctx, interval)
+
+	relay := outbox.NewRelay(s.store, s.kafka, s.cfg.OUTBOX_BATCH_SIZE)
+	pollInterval := time.Duration(s.cfg.OUTBOX_POLL_INTERVAL_MS) * time.Millisecond
+	go relay.Run(ctx, pollInterval, s.cfg.OUTBOX_RETENTION_HOURS)
+
+	refundInterval := time.Duration(s.cfg.REFUND_POLL_INTERVAL_MS) * time.Millisecond
+	go s.cancelHandler.RunRefundProcessor(ctx, refundInterval)
+
+	statsInterval := time.Duration(s.cfg.PREDICTION_REFRESH_INTERVAL_MINUTES) * time.Minute
+	go s.predictionHandler.RunStatsJob(ctx, statsInterval)
+
+	chartInterval := time.Duration(s.cfg.CHART_SWEEP_INTERVAL_SECONDS) * time.Second
+	go s.bookingHandler.RunChartPreparation(ctx, chartInterval)
+
+	warmupInterval := time.Duration(s.cfg.TATKAL_WARMUP_INTERVAL_SECONDS) * time.Second
+	go s.bookingHandler.RunTatkalWarmup(ctx, warmupInterval)
+}
+
 // Start launches the HTTP server
 func (s *Server) Start() error {
 	addr := fmt.Sprintf(":%s", s.cfg.PORT)
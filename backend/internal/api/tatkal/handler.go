@@ -5,8 +5,10 @@ import (
 	"better-uptime/common/middleware"
 	"better-uptime/common/ratelimiter"
 	"better-uptime/common/routes"
+	"better-uptime/common/waitingroom"
 	"better-uptime/config"
 	db "better-uptime/internal/db/sqlc"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/redis/go-redis/v9"
@@ -18,6 +20,7 @@ type Handler struct {
 	RateLimiter *ratelimiter.RedisRateLimiter
 	Redis       redis.Client
 	Kafka       kafka.Producer
+	WaitingRoom *waitingroom.Room
 }
 
 func NewHandler(config *config.Config, store db.Store, Redis redis.Client, Kafka kafka.Producer) *Handler {
@@ -27,6 +30,8 @@ func NewHandler(config *config.Config, store db.Store, Redis redis.Client, Kafka
 		RateLimiter: ratelimiter.NewRedisRateLimiter(&Redis),
 		Redis:       Redis,
 		Kafka:       Kafka,
+		WaitingRoom: waitingroom.NewRoom(&Redis, config.WAITING_ROOM_SECRET, config.WAITING_ROOM_ADMIT_PER_SECOND,
+			time.Duration(config.WAITING_ROOM_TOKEN_TTL_MINUTES)*time.Minute),
 	}
 }
 
@@ -35,7 +40,10 @@ func (h *Handler) Routes() *chi.Mux {
 
 	router.Group(func(r chi.Router) {
 		r.Use(middleware.TokenMiddleware(h.store))
-
+		r.Post("/waiting-room/join", h.JoinWaitingRoom)
+		r.Get("/waiting-room/status", h.WaitingRoomStatus)
+		r.Get("/waiting-room/stream", h.StreamWaitingRoom)
+		r.Put("/waiting-room/admin/rate", h.SetWaitingRoomRate)
 	})
 
 	return router
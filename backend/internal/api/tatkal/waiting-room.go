@@ -0,0 +1,212 @@
+package tatkal
+
+import (
+	"better-uptime/common/logger"
+	"better-uptime/common/middleware"
+	"better-uptime/common/util"
+	"better-uptime/common/waitingroom"
+	db "better-uptime/internal/db/sqlc"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// the position is pushed to subscribers this often
+const streamInterval = time.Second
+
+type JoinRequest struct {
+	JourneyId int          `json:"journey_id" validate:"required"`
+	CoachType db.CoachType `json:"coach_type" validate:"required,oneof=3A 2A 1A SL GN"`
+}
+
+type RateRequest struct {
+	JourneyId      int          `json:"journey_id" validate:"required"`
+	CoachType      db.CoachType `json:"coach_type" validate:"required,oneof=3A 2A 1A SL GN"`
+	AdmitPerSecond int          `json:"admit_per_second" validate:"min=0"`
+}
+
+// JoinWaitingRoom puts the user in the queue of a journey and class and
+// returns their queue token and position. The token goes in the
+// X-Queue-Token header of the tatkal booking once it is admitted. Only an
+// open journey whose class has tatkal configured has a queue.
+func (h *Handler) JoinWaitingRoom(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	payload, err := middleware.GetFirebasePayloadFromContext(ctx)
+	if err != nil {
+		util.ErrorJson(w, util.ErrUnauthorized)
+		return
+	}
+
+	var data JoinRequest
+	if err := util.ReadJsonAndValidate(w, r, &data); err != nil {
+		util.ErrorJson(w, util.ErrNotValidRequest)
+		return
+	}
+
+	journey, err := h.store.GetTatkalJourneyStatus(ctx, db.GetTatkalJourneyStatusParams{
+		ID:        int32(data.JourneyId),
+		CoachType: data.CoachType,
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			util.ErrorJson(w, fmt.Errorf("no tatkal quota for %s on journey %d", data.CoachType, data.JourneyId))
+			return
+		}
+		logger.Error("failed to get tatkal journey %d %s: %v", data.JourneyId, data.CoachType, err)
+		util.ErrorJson(w, util.ErrInternal)
+		return
+	}
+	if !journey.Valid || journey.JourneyStatus != db.JourneyStatusOPEN {
+		util.ErrorJson(w, errors.New("journey not open for booking"))
+		return
+	}
+
+	status, err := h.WaitingRoom.Join(ctx, int32(data.JourneyId), string(data.CoachType), payload.UserId.String())
+	if err != nil {
+		logger.Error("failed to join waiting room of journey %d %s: %v", data.JourneyId, data.CoachType, err)
+		util.ErrorJson(w, util.ErrInternal)
+		return
+	}
+
+	util.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "Joined the waiting room",
+		"data":    status,
+	})
+}
+
+// WaitingRoomStatus returns the position of a queue token, given as ?token=
+// or in the X-Queue-Token header.
+func (h *Handler) WaitingRoomStatus(w http.ResponseWriter, r *http.Request) {
+	status, err := h.queueStatus(r)
+	if err != nil {
+		util.ErrorJson(w, err)
+		return
+	}
+
+	util.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "Waiting room status",
+		"data":    status,
+	})
+}
+
+// StreamWaitingRoom sends the position of a queue token as server-sent
+// events every second until it is admitted or the client goes away.
+func (h *Handler) StreamWaitingRoom(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		util.ErrorJson(w, errors.New("streaming is not supported"))
+		return
+	}
+
+	status, err := h.queueStatus(r)
+	if err != nil {
+		util.ErrorJson(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	ticker := time.NewTicker(streamInterval)
+	defer ticker.Stop()
+
+	for {
+		event, err := json.Marshal(status)
+		if err != nil {
+			return
+		}
+
+		fmt.Fprintf(w, "event: position\ndata: %s\n\n", event)
+		flusher.Flush()
+
+		if status.Admitted {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		status, err = h.queueStatus(r)
+		if err != nil {
+			fmt.Fprintf(w, "event: error\ndata: %q\n\n", err.Error())
+			flusher.Flush()
+			return
+		}
+	}
+}
+
+// SetWaitingRoomRate changes how many users per second the queue of a
+// journey and class lets in. 0 goes back to WAITING_ROOM_ADMIT_PER_SECOND.
+func (h *Handler) SetWaitingRoomRate(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	payload, err := middleware.GetFirebasePayloadFromContext(ctx)
+	if err != nil || payload.Role != "ADMIN" {
+		util.ErrorJson(w, util.ErrUnauthorized)
+		return
+	}
+
+	var data RateRequest
+	if err := util.ReadJsonAndValidate(w, r, &data); err != nil {
+		util.ErrorJson(w, util.ErrNotValidRequest)
+		return
+	}
+
+	err = h.WaitingRoom.SetRate(ctx, int32(data.JourneyId), string(data.CoachType), data.AdmitPerSecond)
+	if err != nil {
+		logger.Error("failed to set waiting room rate of journey %d %s: %v", data.JourneyId, data.CoachType, err)
+		util.ErrorJson(w, util.ErrInternal)
+		return
+	}
+
+	util.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "Waiting room rate updated",
+		"data":    data,
+	})
+}
+
+// queueStatus reads the position of the request's queue token, which must
+// belong to the user making it.
+func (h *Handler) queueStatus(r *http.Request) (waitingroom.Status, error) {
+	ctx := r.Context()
+
+	payload, err := middleware.GetFirebasePayloadFromContext(ctx)
+	if err != nil {
+		return waitingroom.Status{}, util.ErrUnauthorized
+	}
+
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		token = r.Header.Get(waitingroom.TokenHeader)
+	}
+	if token == "" {
+		return waitingroom.Status{}, util.ErrTokenMissing
+	}
+
+	ticket, status, err := h.WaitingRoom.Status(ctx, token)
+	if err != nil {
+		if waitingroom.Rejected(err) {
+			return waitingroom.Status{}, err
+		}
+		logger.Error("failed to read waiting room status: %v", err)
+		return waitingroom.Status{}, util.ErrInternal
+	}
+
+	if ticket.UserID != payload.UserId.String() {
+		return waitingroom.Status{}, waitingroom.ErrInvalidToken
+	}
+
+	return status, nil
+}
@@ -0,0 +1,67 @@
+package tatkal
+
+import (
+	"better-uptime/common/firebase"
+	"better-uptime/common/middleware"
+	"better-uptime/common/waitingroom"
+	"better-uptime/internal/db/dbtest"
+	db "better-uptime/internal/db/sqlc"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+func joinWaitingRoom(h *Handler) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/waiting-room/join", strings.NewReader(`{"journey_id": 3, "coach_type": "3A"}`))
+	ctx := context.WithValue(req.Context(), middleware.TokenPayloadKey, firebase.FirebasePayload{UserId: uuid.New(), Role: "USER"})
+
+	w := httptest.NewRecorder()
+	h.JoinWaitingRoom(w, req.WithContext(ctx))
+	return w
+}
+
+func TestWaitingRoomOnlyQueuesOpenTatkalClasses(t *testing.T) {
+	open := db.NullJourneyStatus{JourneyStatus: db.JourneyStatusOPEN, Valid: true}
+	charted := db.NullJourneyStatus{JourneyStatus: db.JourneyStatusCHARTED, Valid: true}
+
+	tests := []struct {
+		name   string
+		status []interface{}
+		want   int
+	}{
+		{"no such journey or no tatkal for the class", nil, http.StatusBadRequest},
+		{"charted journey", []interface{}{charted}, http.StatusBadRequest},
+		{"open journey", []interface{}{open}, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mr := miniredis.RunT(t)
+			rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+			data := dbtest.New()
+			if tt.status != nil {
+				data.Return("GetTatkalJourneyStatus", tt.status...)
+			}
+			h := &Handler{
+				store:       data.Store(),
+				WaitingRoom: waitingroom.NewRoom(rdb, "0123456789abcdef0123456789abcdef", 10, 30*time.Minute),
+			}
+
+			w := joinWaitingRoom(h)
+			if w.Code != tt.want {
+				t.Fatalf("got %d: %s", w.Code, w.Body)
+			}
+			if queued := mr.Exists("waitroom:3:3A"); queued != (tt.want == http.StatusOK) {
+				t.Errorf("queue created %v", queued)
+			}
+		})
+	}
+}
@@ -83,18 +83,24 @@ func (h *Handler) CreateCoachesAndSeats(w http.ResponseWriter, r *http.Request)
 // getBerthAllocationSimple - Simple berth allocation
 func getBerthAllocationSimple(config SeatConfiguration) []BerthAllocation {
 	switch config.CoachType {
-	case "1A", "2A", "3A":
+	case "1A", "2A":
 		// AC coaches: alternate berths
 		return []BerthAllocation{
 			{BerthType: "DOWN", Count: config.SeatsPerCoach / 2},
 			{BerthType: "UP", Count: config.SeatsPerCoach / 2},
 		}
-	case "SL":
-		// Sleeper: mixed berths
+	case "SL", "3A":
+		// Sleeper and 3 tier: a bay has 6 berths across the compartment and
+		// a side lower and side upper along the aisle. Side lowers are the
+		// RAC berths, see InitializeSeatInventory
+		side := config.SeatsPerCoach / 8
+		tier := (config.SeatsPerCoach - 2*side) / 3
 		return []BerthAllocation{
-			{BerthType: "DOWN", Count: config.SeatsPerCoach / 3},
-			{BerthType: "MID", Count: config.SeatsPerCoach / 3},
-			{BerthType: "UP", Count: config.SeatsPerCoach / 3},
+			{BerthType: "DOWN", Count: tier},
+			{BerthType: "MID", Count: tier},
+			{BerthType: "UP", Count: tier},
+			{BerthType: "SIDE_DOWN", Count: side},
+			{BerthType: "SIDE_UP", Count: side},
 		}
 	case "GN":
 		// General: all lower berth (for simplicity)
@@ -59,8 +59,9 @@ func (h *Handler) CreateJourney(w http.ResponseWriter, r *http.Request) {
 
 		// ✅ Step 2: Initialize Seat Inventory
 		err = q.InitializeSeatInventory(ctx, db.InitializeSeatInventoryParams{
-			JourneyID: journey.ID,
-			Trainid:   util.ToPgInt4(int32(req.TrainID)),
+			JourneyID:     journey.ID,
+			Trainid:       util.ToPgInt4(int32(req.TrainID)),
+			TatkalPercent: float64(h.config.TATKAL_QUOTA_PERCENT),
 		})
 		if err != nil {
 			return err
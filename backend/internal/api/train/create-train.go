@@ -18,6 +18,8 @@ type CreateTrainRequest struct {
 	Destination string `json:"destination"`
 	Day         string `json:"day"`
 	ArrivalTime string `json:"arrival_time"`
+	DistanceKm  int    `json:"distance_km"`
+	IsSuperfast bool   `json:"is_superfast"`
 }
 
 type CreateTrainResponse struct {
@@ -64,6 +66,8 @@ func (h *Handler) CreateTrain(w http.ResponseWriter, r *http.Request) {
 		Trainname:   data.TrainName,
 		Source:      data.Source,
 		Destination: data.Destination,
+		DistanceKm:  int32(data.DistanceKm),
+		IsSuperfast: data.IsSuperfast,
 	})
 	if err != nil {
 		util.ErrorJson(w, err)
@@ -29,7 +29,7 @@ func (h *Handler) GetAvailableSeats(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	logger.Debug(travelDate.String())
+	logger.Debug("%s", travelDate.String())
 
 	seats, err := h.store.GetAvailableSeats(ctx, db.GetAvailableSeatsParams{
 		TrainID:     util.ToPgInt4(data.TrainID),
@@ -0,0 +1,98 @@
+package train
+
+import (
+	"better-uptime/common/middleware"
+	"better-uptime/common/util"
+	db "better-uptime/internal/db/sqlc"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// GetReservationChart returns the reservation chart of a charted journey,
+// every coach or the one given by ?coach=<number>, as JSON or with
+// ?format=csv as a single CSV. The chart lists every passenger's name, age
+// and seat, so only admins can read it.
+func (h *Handler) GetReservationChart(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	payload, err := middleware.GetFirebasePayloadFromContext(ctx)
+	if err != nil || payload.Role != "ADMIN" {
+		util.ErrorJson(w, util.ErrUnauthorized)
+		return
+	}
+
+	journeyId, err := strconv.Atoi(chi.URLParam(r, "journeyId"))
+	if err != nil {
+		util.ErrorJson(w, util.ErrNotValidRequest)
+		return
+	}
+
+	format := strings.ToLower(r.URL.Query().Get("format"))
+	if format != "" && format != "json" && format != "csv" {
+		util.ErrorJson(w, errors.New("format must be json or csv"))
+		return
+	}
+
+	coach := 0
+	if c := r.URL.Query().Get("coach"); c != "" {
+		coach, err = strconv.Atoi(c)
+		if err != nil {
+			util.ErrorJson(w, errors.New("coach must be a coach number"))
+			return
+		}
+	}
+
+	charts, err := h.store.ListReservationCharts(ctx, int32(journeyId))
+	if err != nil {
+		util.ErrorJson(w, util.ErrInternal)
+		return
+	}
+
+	selected := make([]db.ReservationChart, 0, len(charts))
+	for _, chart := range charts {
+		if coach != 0 && chart.CoachNumber != int32(coach) {
+			continue
+		}
+		selected = append(selected, chart)
+	}
+
+	if len(selected) == 0 {
+		util.ErrorJson(w, errors.New("no chart prepared for this journey"))
+		return
+	}
+
+	if format == "csv" {
+		// every coach's chart starts with the same header, it is written once
+		var out strings.Builder
+		for i, chart := range selected {
+			csv := chart.ChartCsv
+			if i > 0 {
+				if _, rest, ok := strings.Cut(csv, "\n"); ok {
+					csv = rest
+				}
+			}
+			out.WriteString(csv)
+		}
+
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", "attachment; filename=chart-"+strconv.Itoa(journeyId)+".csv")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(out.String()))
+		return
+	}
+
+	data := make([]json.RawMessage, 0, len(selected))
+	for _, chart := range selected {
+		data = append(data, chart.Chart)
+	}
+
+	util.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "Reservation chart",
+		"data":    data,
+	})
+}
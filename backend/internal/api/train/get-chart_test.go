@@ -0,0 +1,62 @@
+package train
+
+import (
+	"better-uptime/common/firebase"
+	"better-uptime/common/middleware"
+	"better-uptime/config"
+	"better-uptime/internal/db/dbtest"
+	db "better-uptime/internal/db/sqlc"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+func getChart(h *Handler, role string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/journey/5/chart?format=csv", nil)
+
+	route := chi.NewRouteContext()
+	route.URLParams.Add("journeyId", "5")
+	ctx := context.WithValue(req.Context(), chi.RouteCtxKey, route)
+	if role != "" {
+		ctx = context.WithValue(ctx, middleware.TokenPayloadKey, firebase.FirebasePayload{UserId: uuid.New(), Role: role})
+	}
+
+	w := httptest.NewRecorder()
+	h.GetReservationChart(w, req.WithContext(ctx))
+	return w
+}
+
+func TestReservationChartIsForAdminsOnly(t *testing.T) {
+	data := dbtest.New()
+	data.Return("ListReservationCharts", db.ReservationChart{
+		JourneyID:   5,
+		CoachNumber: 1,
+		CoachType:   db.CoachTypeSL,
+		Chart:       []byte(`{}`),
+		ChartCsv:    "coach,seat,name\nS1,1,Asha\n",
+	})
+	h := NewHandler(&config.Config{}, data.Store())
+
+	for _, role := range []string{"", "USER"} {
+		w := getChart(h, role)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("role %q got %d", role, w.Code)
+		}
+		if strings.Contains(w.Body.String(), "Asha") {
+			t.Errorf("role %q read the chart", role)
+		}
+	}
+	if calls := data.Calls("ListReservationCharts"); len(calls) != 0 {
+		t.Errorf("charts read for a user who may not see them")
+	}
+
+	w := getChart(h, "ADMIN")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Asha") {
+		t.Fatalf("admin got %d: %s", w.Code, w.Body)
+	}
+}
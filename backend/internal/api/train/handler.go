@@ -24,6 +24,7 @@ func NewHandler(config *config.Config, store db.Store) *Handler {
 func (h *Handler) Routes() *chi.Mux {
 	router := routes.DefaultRouter()
 	// without middleware
+	router.Get("/search", h.SearchTrains)
 
 	router.Group(func(r chi.Router) {
 		r.Use(middleware.TokenMiddleware(h.store))
@@ -32,6 +33,12 @@ func (h *Handler) Routes() *chi.Mux {
 		r.Post("/coach-seat", h.CreateCoachesAndSeats)
 		r.Post("/get-all-seats",h.GetAvailableSeats)
 		r.Post("/create-journey", h.CreateJourney)
+		r.Get("/stations", h.ListStations)
+		r.Post("/station", h.CreateStation)
+		r.Put("/station/{id}", h.UpdateStation)
+		r.Get("/route/{trainId}", h.GetRoute)
+		r.Put("/route/{trainId}", h.SaveRoute)
+		r.Get("/journey/{journeyId}/chart", h.GetReservationChart)
 
 	})
 
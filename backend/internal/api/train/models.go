@@ -13,9 +13,11 @@ const (
 )
 
 const (
-	BerthUpper  BerthType = "UP"
-	BerthLower  BerthType = "DOWN"
-	BerthMiddle BerthType = "MID"
+	BerthUpper     BerthType = "UP"
+	BerthLower     BerthType = "DOWN"
+	BerthMiddle    BerthType = "MID"
+	BerthSideLower BerthType = "SIDE_DOWN"
+	BerthSideUpper BerthType = "SIDE_UP"
 )
 
 // SeatConfiguration defines how seats should be arranged in a coach
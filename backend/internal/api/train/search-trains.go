@@ -0,0 +1,259 @@
+package train
+
+import (
+	"better-uptime/common/util"
+	"better-uptime/internal/api/fare"
+	"better-uptime/internal/api/prediction"
+	db "better-uptime/internal/db/sqlc"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type ClassAvailability struct {
+	CoachType      db.CoachType `json:"coach_type"`
+	AvailableSeats int64        `json:"available_seats"`
+	TotalSeats     int64        `json:"total_seats"`
+	Fare           float64      `json:"fare"`
+	// seats already on the waitlist, and the chance of a booking made now
+	// being confirmed once the class is full
+	Waitlist   int64                `json:"waitlist"`
+	Prediction *prediction.Estimate `json:"prediction,omitempty"`
+}
+
+type SearchResult struct {
+	TrainID         int32               `json:"train_id"`
+	TrainNumber     int32               `json:"train_number"`
+	TrainName       string              `json:"train_name"`
+	JourneyID       int32               `json:"journey_id"`
+	JourneyDate     string              `json:"journey_date"`
+	JourneyStatus   string              `json:"journey_status"`
+	FromCode        string              `json:"from_code"`
+	FromName        string              `json:"from_name"`
+	ToCode          string              `json:"to_code"`
+	ToName          string              `json:"to_name"`
+	DepartureTime   time.Time           `json:"departure_time"`
+	ArrivalTime     time.Time           `json:"arrival_time"`
+	DurationMinutes int                 `json:"duration_minutes"`
+	DistanceKm      int32               `json:"distance_km"`
+	Classes         []ClassAvailability `json:"classes"`
+}
+
+// SearchTrains lists the trains that run from one station to another on a
+// travel date, with availability and fare per class. Sort by departure
+// (default), duration or fare.
+func (h *Handler) SearchTrains(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+
+	from := strings.ToUpper(strings.TrimSpace(query.Get("from")))
+	to := strings.ToUpper(strings.TrimSpace(query.Get("to")))
+	if from == "" || to == "" || from == to {
+		util.ErrorJson(w, errors.New("from and to must be two different station codes"))
+		return
+	}
+
+	travelDate, err := time.ParseInLocation("2006-01-02", query.Get("date"), util.IST)
+	if err != nil {
+		util.ErrorJson(w, util.ErrInvalidTimeFormat)
+		return
+	}
+
+	quota := db.SeatQuotaNORMAL
+	if q := strings.ToUpper(query.Get("quota")); q != "" {
+		quota = db.SeatQuota(q)
+		if quota != db.SeatQuotaNORMAL && quota != db.SeatQuotaTATKAL {
+			util.ErrorJson(w, errors.New("quota must be NORMAL or TATKAL"))
+			return
+		}
+	}
+
+	class := db.CoachType(strings.ToUpper(query.Get("class")))
+	switch class {
+	case "", db.CoachType3A, db.CoachType2A, db.CoachType1A, db.CoachTypeSL, db.CoachTypeGN:
+	default:
+		util.ErrorJson(w, errors.New("class must be one of 3A 2A 1A SL GN"))
+		return
+	}
+
+	sortBy := strings.ToLower(query.Get("sort"))
+	if sortBy == "" {
+		sortBy = "departure"
+	}
+	if sortBy != "departure" && sortBy != "duration" && sortBy != "fare" {
+		util.ErrorJson(w, errors.New("sort must be departure, duration or fare"))
+		return
+	}
+
+	rows, err := h.store.SearchTrains(ctx, db.SearchTrainsParams{
+		FromCode:   from,
+		ToCode:     to,
+		TravelDate: pgtype.Date{Time: travelDate, Valid: true},
+	})
+	if err != nil {
+		util.ErrorJson(w, err)
+		return
+	}
+
+	journeyIds := make([]int32, 0, len(rows))
+	legMasks := make([]int64, 0, len(rows))
+	for _, row := range rows {
+		journeyIds = append(journeyIds, row.JourneyID)
+		legMasks = append(legMasks, util.LegMask(row.FromSequence, row.ToSequence))
+	}
+
+	availability, err := h.store.GetAvailabilityByJourneys(ctx, db.GetAvailabilityByJourneysParams{
+		JourneyIds: journeyIds,
+		LegMasks:   legMasks,
+		Quota:      quota,
+	})
+	if err != nil {
+		util.ErrorJson(w, err)
+		return
+	}
+
+	byJourney := make(map[int32][]db.GetAvailabilityByJourneysRow)
+	for _, a := range availability {
+		byJourney[a.JourneyID] = append(byJourney[a.JourneyID], a)
+	}
+
+	type classKey struct {
+		ID        int32
+		CoachType db.CoachType
+	}
+
+	waitlisted, err := h.store.GetWaitlistSeatsByJourneys(ctx, journeyIds)
+	if err != nil {
+		util.ErrorJson(w, err)
+		return
+	}
+
+	waitlistSeats := make(map[classKey]int64, len(waitlisted))
+	for _, wl := range waitlisted {
+		waitlistSeats[classKey{wl.JourneyID.Int32, wl.CoachType.CoachType}] = wl.Seats
+	}
+
+	trainIds := make([]int32, 0, len(rows))
+	for _, row := range rows {
+		trainIds = append(trainIds, row.TrainID)
+	}
+
+	cancellations, err := h.store.GetCancellationStatsByTrains(ctx, trainIds)
+	if err != nil {
+		util.ErrorJson(w, err)
+		return
+	}
+
+	// ordered by days_left within each train and class, as Calculate expects
+	stats := make(map[classKey][]db.CancellationStat)
+	for _, stat := range cancellations {
+		key := classKey{stat.TrainID, stat.CoachType}
+		stats[key] = append(stats[key], stat)
+	}
+
+	rules, err := h.store.ListFareRules(ctx)
+	if err != nil {
+		util.ErrorJson(w, err)
+		return
+	}
+
+	fareRules := make(map[db.CoachType]db.FareRule, len(rules))
+	for _, rule := range rules {
+		fareRules[rule.CoachType] = rule
+	}
+
+	bookingType := db.BookingTypeNORMAL
+	if quota == db.SeatQuotaTATKAL {
+		bookingType = db.BookingTypeTATKAL
+	}
+
+	results := make([]SearchResult, 0, len(rows))
+	for _, row := range rows {
+		originDeparture := util.AtISTClock(row.JourneyDate.Time, row.OriginDeparture)
+		departure := originDeparture.Add(time.Duration(row.DepartureOffsetMin) * time.Minute)
+		arrival := originDeparture.Add(time.Duration(row.ArrivalOffsetMin) * time.Minute)
+		distance := row.ToDistanceKm - row.FromDistanceKm
+
+		result := SearchResult{
+			TrainID:         row.TrainID,
+			TrainNumber:     row.Trainnumber,
+			TrainName:       row.Trainname,
+			JourneyID:       row.JourneyID,
+			JourneyDate:     row.JourneyDate.Time.Format("2006-01-02"),
+			JourneyStatus:   string(row.Status.JourneyStatus),
+			FromCode:        row.FromCode,
+			FromName:        row.FromName,
+			ToCode:          row.ToCode,
+			ToName:          row.ToName,
+			DepartureTime:   util.ConvertUTCToIST(departure),
+			ArrivalTime:     util.ConvertUTCToIST(arrival),
+			DurationMinutes: int(row.ArrivalOffsetMin - row.DepartureOffsetMin),
+			DistanceKm:      distance,
+			Classes:         []ClassAvailability{},
+		}
+
+		for _, a := range byJourney[row.JourneyID] {
+			if class != "" && a.CoachType != class {
+				continue
+			}
+
+			c := ClassAvailability{
+				CoachType:      a.CoachType,
+				AvailableSeats: a.AvailableSeats,
+				TotalSeats:     a.TotalSeats,
+			}
+			if rule, ok := fareRules[a.CoachType]; ok {
+				c.Fare = fare.Calculate(rule, distance, row.IsSuperfast, bookingType, 1).PerPassenger
+			}
+			if quota == db.SeatQuotaNORMAL {
+				c.Waitlist = waitlistSeats[classKey{row.JourneyID, a.CoachType}]
+				if a.AvailableSeats == 0 {
+					c.Prediction = prediction.Calculate(
+						stats[classKey{row.TrainID, a.CoachType}],
+						a.TotalSeats-a.AvailableSeats,
+						c.Waitlist+1,
+						prediction.DaysLeft(departure, time.Now()),
+					)
+				}
+			}
+			result.Classes = append(result.Classes, c)
+		}
+
+		// the train does not have the requested class at all
+		if class != "" && len(result.Classes) == 0 {
+			continue
+		}
+
+		results = append(results, result)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		switch sortBy {
+		case "duration":
+			return results[i].DurationMinutes < results[j].DurationMinutes
+		case "fare":
+			return lowestFare(results[i]) < lowestFare(results[j])
+		default:
+			return results[i].DepartureTime.Before(results[j].DepartureTime)
+		}
+	})
+
+	util.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "Trains between stations",
+		"data":    results,
+	})
+}
+
+func lowestFare(result SearchResult) float64 {
+	lowest := 0.0
+	for i, c := range result.Classes {
+		if i == 0 || c.Fare < lowest {
+			lowest = c.Fare
+		}
+	}
+	return lowest
+}
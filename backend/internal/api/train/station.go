@@ -0,0 +1,101 @@
+package train
+
+import (
+	"better-uptime/common/middleware"
+	"better-uptime/common/util"
+	db "better-uptime/internal/db/sqlc"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type StationRequest struct {
+	Code string `json:"code" validate:"required,min=2,max=5,alpha"`
+	Name string `json:"name" validate:"required"`
+	Zone string `json:"zone,omitempty"`
+}
+
+type UpdateStationRequest struct {
+	Name string `json:"name" validate:"required"`
+	Zone string `json:"zone,omitempty"`
+}
+
+func (h *Handler) CreateStation(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	payload, err := middleware.GetFirebasePayloadFromContext(ctx)
+	if err != nil || payload.Role != "ADMIN" {
+		util.ErrorJson(w, util.ErrUnauthorized)
+		return
+	}
+
+	var data StationRequest
+	err = util.ReadJsonAndValidate(w, r, &data)
+	if err != nil {
+		util.ErrorJson(w, util.ErrNotValidRequest)
+		return
+	}
+
+	station, err := h.store.CreateStation(ctx, db.CreateStationParams{
+		Code: strings.ToUpper(data.Code),
+		Name: data.Name,
+		Zone: pgtype.Text{String: data.Zone, Valid: data.Zone != ""},
+	})
+	if err != nil {
+		util.ErrorJson(w, err)
+		return
+	}
+
+	util.WriteJson(w, http.StatusCreated, station)
+}
+
+func (h *Handler) UpdateStation(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	payload, err := middleware.GetFirebasePayloadFromContext(ctx)
+	if err != nil || payload.Role != "ADMIN" {
+		util.ErrorJson(w, util.ErrUnauthorized)
+		return
+	}
+
+	stationId, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		util.ErrorJson(w, util.ErrNotValidRequest)
+		return
+	}
+
+	var data UpdateStationRequest
+	err = util.ReadJsonAndValidate(w, r, &data)
+	if err != nil {
+		util.ErrorJson(w, util.ErrNotValidRequest)
+		return
+	}
+
+	station, err := h.store.UpdateStation(ctx, db.UpdateStationParams{
+		ID:   int32(stationId),
+		Name: data.Name,
+		Zone: pgtype.Text{String: data.Zone, Valid: data.Zone != ""},
+	})
+	if err != nil {
+		util.ErrorJson(w, err)
+		return
+	}
+
+	util.WriteJson(w, http.StatusOK, station)
+}
+
+func (h *Handler) ListStations(w http.ResponseWriter, r *http.Request) {
+	stations, err := h.store.ListStations(r.Context())
+	if err != nil {
+		util.ErrorJson(w, err)
+		return
+	}
+
+	util.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "All stations",
+		"data":    stations,
+	})
+}
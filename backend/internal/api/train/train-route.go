@@ -0,0 +1,216 @@
+package train
+
+import (
+	"better-uptime/common/logger"
+	"better-uptime/common/middleware"
+	"better-uptime/common/util"
+	db "better-uptime/internal/db/sqlc"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+type RouteStopRequest struct {
+	StationCode        string `json:"station_code" validate:"required"`
+	ArrivalOffsetMin   int    `json:"arrival_offset_min" validate:"min=0"`
+	DepartureOffsetMin int    `json:"departure_offset_min" validate:"min=0"`
+	DayNumber          int    `json:"day_number" validate:"required,min=1"`
+	DistanceKm         int    `json:"distance_km" validate:"min=0"`
+}
+
+type SaveRouteRequest struct {
+	Stops []RouteStopRequest `json:"stops" validate:"required,min=2,max=64,dive"`
+}
+
+// routeError is a route edit refused for a reason the admin can fix, its
+// message is sent back as is.
+type routeError string
+
+func (e routeError) Error() string { return string(e) }
+
+type TrainRouteResponse struct {
+	TrainID    int32                 `json:"train_id"`
+	DistanceKm int32                 `json:"distance_km"`
+	Stops      []db.GetTrainRouteRow `json:"stops"`
+}
+
+// SaveRoute replaces the whole route of a train. Stops are taken in the order
+// they are sent, so the same call is used to create a route and to edit it.
+// A route is only edited while no journey of the train is open or booked.
+func (h *Handler) SaveRoute(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	payload, err := middleware.GetFirebasePayloadFromContext(ctx)
+	if err != nil || payload.Role != "ADMIN" {
+		util.ErrorJson(w, util.ErrUnauthorized)
+		return
+	}
+
+	trainId, err := strconv.Atoi(chi.URLParam(r, "trainId"))
+	if err != nil {
+		util.ErrorJson(w, util.ErrNotValidRequest)
+		return
+	}
+
+	var data SaveRouteRequest
+	err = util.ReadJsonAndValidate(w, r, &data)
+	if err != nil {
+		util.ErrorJson(w, util.ErrNotValidRequest)
+		return
+	}
+
+	if err := validateRoute(data.Stops); err != nil {
+		util.ErrorJson(w, err)
+		return
+	}
+
+	err = h.store.ExecTx(ctx, func(q *db.Queries) error {
+		// serialise route edits with coach/seat layout changes of the same train
+		_, err := q.LockTrainForLayout(ctx, int32(trainId))
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return routeError(fmt.Sprintf("train %d not found", trainId))
+			}
+			return err
+		}
+
+		// bookings and seat segments are stop sequences of the current
+		// route, a new one would put them between other stations
+		journeys, err := q.CountJourneysOnRoute(ctx, util.ToPgInt4(int32(trainId)))
+		if err != nil {
+			return err
+		}
+		if journeys > 0 {
+			return routeError("route cannot be changed while the train has open or booked journeys")
+		}
+
+		err = q.DeleteTrainRoute(ctx, int32(trainId))
+		if err != nil {
+			return err
+		}
+
+		var origin, terminus db.Station
+		for i, stop := range data.Stops {
+			station, err := q.GetStationByCode(ctx, strings.ToUpper(stop.StationCode))
+			if err != nil {
+				if errors.Is(err, pgx.ErrNoRows) {
+					return routeError(fmt.Sprintf("unknown station %s", stop.StationCode))
+				}
+				return err
+			}
+
+			_, err = q.CreateRouteStop(ctx, db.CreateRouteStopParams{
+				TrainID:            int32(trainId),
+				StationID:          station.ID,
+				StopSequence:       int32(i + 1),
+				ArrivalOffsetMin:   int32(stop.ArrivalOffsetMin),
+				DepartureOffsetMin: int32(stop.DepartureOffsetMin),
+				DayNumber:          int32(stop.DayNumber),
+				DistanceKm:         int32(stop.DistanceKm),
+			})
+			if err != nil {
+				return fmt.Errorf("failed to save stop %s: %w", station.Code, err)
+			}
+
+			if i == 0 {
+				origin = station
+			}
+			terminus = station
+		}
+
+		return q.UpdateTrainRouteSummary(ctx, db.UpdateTrainRouteSummaryParams{
+			ID:          int32(trainId),
+			Source:      origin.Name,
+			Destination: terminus.Name,
+			DistanceKm:  int32(data.Stops[len(data.Stops)-1].DistanceKm),
+		})
+	})
+	if err != nil {
+		var refused routeError
+		if errors.As(err, &refused) {
+			util.ErrorJson(w, refused)
+			return
+		}
+		logger.Error("failed to save route of train %d: %v", trainId, err)
+		util.ErrorJson(w, util.ErrInternal)
+		return
+	}
+
+	h.writeRoute(w, r, int32(trainId))
+}
+
+func (h *Handler) GetRoute(w http.ResponseWriter, r *http.Request) {
+	trainId, err := strconv.Atoi(chi.URLParam(r, "trainId"))
+	if err != nil {
+		util.ErrorJson(w, util.ErrNotValidRequest)
+		return
+	}
+
+	h.writeRoute(w, r, int32(trainId))
+}
+
+func (h *Handler) writeRoute(w http.ResponseWriter, r *http.Request, trainId int32) {
+	stops, err := h.store.GetTrainRoute(r.Context(), trainId)
+	if err != nil {
+		logger.Error("failed to read route of train %d: %v", trainId, err)
+		util.ErrorJson(w, util.ErrInternal)
+		return
+	}
+
+	response := TrainRouteResponse{
+		TrainID: trainId,
+		Stops:   stops,
+	}
+	if len(stops) > 0 {
+		response.DistanceKm = stops[len(stops)-1].DistanceKm
+	}
+
+	util.WriteJson(w, http.StatusOK, response)
+}
+
+// validateRoute checks that the stops move forward in time and distance. The
+// origin must be at distance 0 and nothing can arrive before the previous stop
+// has departed.
+func validateRoute(stops []RouteStopRequest) error {
+	if stops[0].DistanceKm != 0 || stops[0].ArrivalOffsetMin != 0 || stops[0].DepartureOffsetMin != 0 {
+		return errors.New("origin must have zero distance and offsets")
+	}
+	if stops[0].DayNumber != 1 {
+		return errors.New("origin must be on day 1")
+	}
+
+	seen := make(map[string]bool, len(stops))
+	for i, stop := range stops {
+		code := strings.ToUpper(stop.StationCode)
+		if seen[code] {
+			return fmt.Errorf("station %s appears more than once", code)
+		}
+		seen[code] = true
+
+		if stop.DepartureOffsetMin < stop.ArrivalOffsetMin {
+			return fmt.Errorf("stop %s departs before it arrives", code)
+		}
+
+		if i == 0 {
+			continue
+		}
+
+		prev := stops[i-1]
+		if stop.ArrivalOffsetMin <= prev.DepartureOffsetMin {
+			return fmt.Errorf("stop %s arrives before the previous stop departs", code)
+		}
+		if stop.DistanceKm <= prev.DistanceKm {
+			return fmt.Errorf("distance to %s must be greater than the previous stop", code)
+		}
+		if stop.DayNumber < prev.DayNumber {
+			return fmt.Errorf("day number of %s goes backwards", code)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,68 @@
+package train
+
+import (
+	"better-uptime/common/firebase"
+	"better-uptime/common/middleware"
+	"better-uptime/config"
+	"better-uptime/internal/db/dbtest"
+	db "better-uptime/internal/db/sqlc"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+const twoStopRoute = `{"stops": [
+	{"station_code": "NDLS", "day_number": 1},
+	{"station_code": "BCT", "arrival_offset_min": 960, "departure_offset_min": 960, "day_number": 2, "distance_km": 1384}
+]}`
+
+func saveRoute(h *Handler) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPut, "/train/4/route", strings.NewReader(twoStopRoute))
+
+	route := chi.NewRouteContext()
+	route.URLParams.Add("trainId", "4")
+	ctx := context.WithValue(req.Context(), chi.RouteCtxKey, route)
+	ctx = context.WithValue(ctx, middleware.TokenPayloadKey, firebase.FirebasePayload{UserId: uuid.New(), Role: "ADMIN"})
+
+	w := httptest.NewRecorder()
+	h.SaveRoute(w, req.WithContext(ctx))
+	return w
+}
+
+func TestRouteIsNotEditedUnderBookedJourneys(t *testing.T) {
+	data := dbtest.New()
+	data.Return("LockTrainForLayout", int32(4))
+	data.Return("CountJourneysOnRoute", int64(2))
+	h := NewHandler(&config.Config{}, data.Store())
+
+	w := saveRoute(h)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "open or booked journeys") {
+		t.Fatalf("got %d: %s", w.Code, w.Body)
+	}
+	if calls := data.Calls("DeleteTrainRoute"); len(calls) != 0 {
+		t.Error("route deleted under booked journeys")
+	}
+}
+
+func TestRouteEditHidesDatabaseErrors(t *testing.T) {
+	data := dbtest.New()
+	data.Return("LockTrainForLayout", int32(4))
+	data.Return("CountJourneysOnRoute", int64(0))
+	data.Return("GetStationByCode", db.Station{ID: 1, Code: "NDLS", Name: "New Delhi"})
+	data.Fail("CreateRouteStop", errors.New(`ERROR: insert or update on table "train_route" violates foreign key constraint (SQLSTATE 23503)`))
+	h := NewHandler(&config.Config{}, data.Store())
+
+	w := saveRoute(h)
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("got %d: %s", w.Code, w.Body)
+	}
+	if strings.Contains(w.Body.String(), "SQLSTATE") {
+		t.Errorf("database error sent to the client: %s", w.Body)
+	}
+}
@@ -0,0 +1,234 @@
+// Package dbtest answers sqlc queries from memory, so handlers can be tested
+// without a database. Queries are told apart by their sqlc name, results are
+// queued per name and every call is recorded.
+package dbtest
+
+import (
+	db "better-uptime/internal/db/sqlc"
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Call is one query run against a DB.
+type Call struct {
+	Name string
+	Args []interface{}
+}
+
+// DB is a db.DBTX that answers from memory.
+type DB struct {
+	mu      sync.Mutex
+	results map[string][][]interface{}
+	errs    map[string]error
+	calls   []Call
+}
+
+func New() *DB {
+	return &DB{
+		results: map[string][][]interface{}{},
+		errs:    map[string]error{},
+	}
+}
+
+// Store returns a db.Store whose queries and transactions all run against d.
+// Transactions are not rolled back, the calls of a failed one stay recorded.
+func (d *DB) Store() db.Store {
+	return &store{Queries: db.New(d), d: d}
+}
+
+type store struct {
+	*db.Queries
+	d *DB
+}
+
+func (s *store) ExecTx(ctx context.Context, fn func(*db.Queries) error) error {
+	return fn(db.New(s.d))
+}
+
+// Return queues the rows of the next call of a query. A row is a struct with
+// a field for each column the query scans, in order, as sqlc generates them,
+// or a plain value for a query of one column. The last result queued for a
+// query is kept for every call after it. A :one query with no rows, or with
+// nothing queued, fails with pgx.ErrNoRows.
+func (d *DB) Return(name string, rows ...interface{}) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.results[name] = append(d.results[name], rows)
+}
+
+// Fail makes every call of a query fail with err.
+func (d *DB) Fail(name string, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.errs[name] = err
+}
+
+// Calls returns the calls of a query, in the order they were made.
+func (d *DB) Calls(name string) []Call {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var calls []Call
+	for _, c := range d.calls {
+		if c.Name == name {
+			calls = append(calls, c)
+		}
+	}
+	return calls
+}
+
+// record logs a call and returns what it should answer.
+func (d *DB) record(sql string, args []interface{}) (string, []interface{}, error) {
+	name := queryName(sql)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.calls = append(d.calls, Call{Name: name, Args: args})
+	if err := d.errs[name]; err != nil {
+		return name, nil, err
+	}
+
+	queued := d.results[name]
+	if len(queued) == 0 {
+		return name, nil, nil
+	}
+	rows := queued[0]
+	if len(queued) > 1 {
+		d.results[name] = queued[1:]
+	}
+	return name, rows, nil
+}
+
+// queryName reads the name off the "-- name: GetBookingById :one" line sqlc
+// starts every query with.
+func queryName(sql string) string {
+	fields := strings.Fields(strings.SplitN(sql, "\n", 2)[0])
+	if len(fields) < 3 || fields[0] != "--" || fields[1] != "name:" {
+		return sql
+	}
+	return fields[2]
+}
+
+// Exec reports one row affected, or the int64 queued for the query, for an
+// :execrows query.
+func (d *DB) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	_, results, err := d.record(sql, args)
+	if err != nil {
+		return pgconn.CommandTag{}, err
+	}
+	if affected, ok := firstOf(results).(int64); ok {
+		return pgconn.NewCommandTag(fmt.Sprintf("OK %d", affected)), nil
+	}
+	return pgconn.NewCommandTag("OK 1"), nil
+}
+
+func (d *DB) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	_, results, err := d.record(sql, args)
+	if err != nil {
+		return nil, err
+	}
+	return &rows{results: results, at: -1}, nil
+}
+
+func (d *DB) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	_, results, err := d.record(sql, args)
+	if err == nil && len(results) == 0 {
+		err = pgx.ErrNoRows
+	}
+	return &row{result: firstOf(results), err: err}
+}
+
+func firstOf(results []interface{}) interface{} {
+	if len(results) == 0 {
+		return nil
+	}
+	return results[0]
+}
+
+type row struct {
+	result interface{}
+	err    error
+}
+
+func (r *row) Scan(dest ...interface{}) error {
+	if r.err != nil {
+		return r.err
+	}
+	return scan(r.result, dest)
+}
+
+type rows struct {
+	results []interface{}
+	at      int
+	err     error
+}
+
+func (r *rows) Close()                                       {}
+func (r *rows) Err() error                                   { return r.err }
+func (r *rows) CommandTag() pgconn.CommandTag                { return pgconn.NewCommandTag("SELECT") }
+func (r *rows) FieldDescriptions() []pgconn.FieldDescription { return nil }
+func (r *rows) RawValues() [][]byte                          { return nil }
+func (r *rows) Conn() *pgx.Conn                              { return nil }
+
+func (r *rows) Next() bool {
+	if r.err != nil || r.at+1 >= len(r.results) {
+		return false
+	}
+	r.at++
+	return true
+}
+
+func (r *rows) Scan(dest ...interface{}) error {
+	if err := scan(r.results[r.at], dest); err != nil {
+		r.err = err
+		return err
+	}
+	return nil
+}
+
+func (r *rows) Values() ([]interface{}, error) {
+	v := reflect.ValueOf(r.results[r.at])
+	if v.Kind() != reflect.Struct {
+		return []interface{}{v.Interface()}, nil
+	}
+
+	values := make([]interface{}, v.NumField())
+	for i := range values {
+		values[i] = v.Field(i).Interface()
+	}
+	return values, nil
+}
+
+// scan copies a queued row into the destinations of a sqlc Scan call.
+func scan(result interface{}, dest []interface{}) error {
+	v := reflect.ValueOf(result)
+
+	if len(dest) == 1 {
+		target := reflect.ValueOf(dest[0]).Elem()
+		if v.IsValid() && v.Type().AssignableTo(target.Type()) {
+			target.Set(v)
+			return nil
+		}
+	}
+
+	if v.Kind() != reflect.Struct || v.NumField() != len(dest) {
+		return fmt.Errorf("dbtest: a %T row does not scan into %d columns", result, len(dest))
+	}
+
+	for i, d := range dest {
+		target := reflect.ValueOf(d).Elem()
+		field := v.Field(i)
+		if !field.Type().AssignableTo(target.Type()) {
+			return fmt.Errorf("dbtest: column %d of a %T row is %s, scanned into %s", i, result, field.Type(), target.Type())
+		}
+		target.Set(field)
+	}
+	return nil
+}
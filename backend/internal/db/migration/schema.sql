@@ -13,24 +13,33 @@ CREATE TYPE day_of_week AS ENUM ('MON', 'TUE', 'WED', 'THU', 'FRI', 'SAT','SUN')
 
 CREATE type coach_type as ENUM ('3A','2A','1A','SL','GN');
 
-CREATE type berth_type as ENUM ('UP','DOWN','MID');
+CREATE type berth_type as ENUM ('UP','DOWN','MID','SIDE_DOWN','SIDE_UP');
 
+-- a tatkal booking is QUEUED until the worker holds its seats, and FAILED
+-- when it could not get them
 CREATE TYPE booking_status AS ENUM (
     'PENDING',
     'CONFIRMED',
+    'RAC',
     'WAITLIST',
     'CANCELLED',
-    'EXPIRED'
+    'EXPIRED',
+    'QUEUED',
+    'FAILED'
 );
 
+-- a PREMIUM_TATKAL booking takes tatkal seats at a fare that rises as they
+-- run out, see premium_tatkal_fare
 CREATE TYPE booking_type as ENUM (
     'NORMAL',
     'WAITLIST',
-    'TATKAL'
+    'TATKAL',
+    'PREMIUM_TATKAL'
 );
 
 CREATE type waiting_status as ENUM (
     'WAITING',
+    'RAC',
     'CONFIRMED',
     'CANCELLED'
 );
@@ -55,6 +64,8 @@ CREATE TYPE seat_status AS ENUM (
 
 CREATE TYPE journey_status AS ENUM ('OPEN','CHARTED','CANCELLED');
 
+CREATE TYPE dead_letter_status AS ENUM ('PENDING', 'REPLAYED');
+
 
 CREATE TABLE users (
     id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
@@ -78,6 +89,9 @@ CREATE TABLE train (
     destination TEXT NOT NULL,
     CONSTRAINT unique_train_service UNIQUE (trainNumber)
 );
+
+ALTER TABLE train ADD COLUMN distance_km INT NOT NULL DEFAULT 0;
+ALTER TABLE train ADD COLUMN is_superfast BOOLEAN NOT NULL DEFAULT false;
  -- things are changingn here
 CREATE TABLE train_schedule (
     id  SERIAL PRIMARY KEY,
@@ -94,6 +108,31 @@ CREATE TABLE train_schedule (
 --     ALTER COLUMN departureTime TYPE TIME,
 --     ALTER COLUMN departureTime SET NOT NULL;
 
+CREATE TABLE station (
+    id SERIAL PRIMARY KEY,
+    code TEXT NOT NULL UNIQUE,
+    name TEXT NOT NULL,
+    zone TEXT,
+    created_at TIMESTAMP DEFAULT now()
+);
+
+-- ordered stops of a train. offsets are minutes after the departure from the
+-- origin, so the origin has 0/0 and the terminus has arrival = departure.
+CREATE TABLE train_route (
+    id SERIAL PRIMARY KEY,
+    train_id INT NOT NULL REFERENCES train(id) ON DELETE CASCADE,
+    station_id INT NOT NULL REFERENCES station(id),
+    stop_sequence INT NOT NULL,
+    arrival_offset_min INT NOT NULL DEFAULT 0,
+    departure_offset_min INT NOT NULL DEFAULT 0,
+    day_number INT NOT NULL DEFAULT 1,
+    distance_km INT NOT NULL DEFAULT 0,
+    CONSTRAINT unique_route_sequence UNIQUE (train_id, stop_sequence),
+    CONSTRAINT unique_route_station UNIQUE (train_id, station_id)
+);
+
+CREATE INDEX idx_train_route_station ON train_route(station_id);
+
 CREATE TABLE coach (
    id SERIAL PRIMARY KEY,
    trainId INTEGER REFERENCES train(id) on delete CASCADE,
@@ -123,7 +162,11 @@ CREATE TABLE train_journey (
 
 
 
-CREATE TYPE seat_quota AS ENUM ('NORMAL', 'TATKAL');
+-- side lower berths of SL and 3A coaches are held back in the RAC quota and
+-- only given out, two passengers to a berth, once the NORMAL quota is sold out.
+-- charting moves every seat still free into the CURRENT quota, the only one
+-- sold after the chart is prepared
+CREATE TYPE seat_quota AS ENUM ('NORMAL', 'TATKAL', 'RAC', 'CURRENT');
 
 -- made for working on tatkal not implemented yet
 CREATE TABLE seat_inventory (
@@ -136,6 +179,25 @@ CREATE TABLE seat_inventory (
   PRIMARY KEY (journey_id, seat_id)
 );
 
+-- bit n of a mask is the leg between route stops n+1 and n+2. a seat can be
+-- sold to anyone whose legs do not overlap the held or confirmed ones, and a
+-- mask of -1 is the whole journey for trains without a route.
+ALTER TABLE seat_inventory ADD COLUMN held_mask BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE seat_inventory ADD COLUMN confirmed_mask BIGINT NOT NULL DEFAULT 0;
+
+-- which legs of a seat each booking holds. this replaces seat_inventory.booking_id,
+-- which can only point at one booking per seat.
+CREATE TABLE seat_segment (
+  journey_id INT NOT NULL,
+  seat_id INT NOT NULL,
+  booking_id INT NOT NULL REFERENCES booking(id) ON DELETE CASCADE,
+  leg_mask BIGINT NOT NULL,
+  status seat_status NOT NULL DEFAULT 'HELD',
+  created_at TIMESTAMP DEFAULT now(),
+  PRIMARY KEY (journey_id, seat_id, booking_id),
+  FOREIGN KEY (journey_id, seat_id) REFERENCES seat_inventory(journey_id, seat_id)
+);
+
 -- i have changed the tatkal schema
 
 CREATE Table tatkal_config (
@@ -149,6 +211,42 @@ CREATE Table tatkal_config (
     UNIQUE(train_id, coach_type)
 );
 
+-- per km fare and fixed charges per class, editable by admins
+CREATE TABLE fare_rule (
+    id SERIAL PRIMARY KEY,
+    coach_type coach_type NOT NULL UNIQUE,
+    base_fare_per_km FLOAT NOT NULL,
+    min_distance_km INT NOT NULL DEFAULT 0,
+    reservation_charge FLOAT NOT NULL DEFAULT 0,
+    superfast_charge FLOAT NOT NULL DEFAULT 0,
+    tatkal_premium_percent FLOAT NOT NULL DEFAULT 0,
+    tatkal_min_charge FLOAT NOT NULL DEFAULT 0,
+    tatkal_max_charge FLOAT NOT NULL DEFAULT 0,
+    gst_percent FLOAT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP DEFAULT now()
+);
+
+INSERT INTO fare_rule (coach_type, base_fare_per_km, min_distance_km, reservation_charge, superfast_charge, tatkal_premium_percent, tatkal_min_charge, tatkal_max_charge, gst_percent)
+VALUES
+    ('GN', 0.25, 0, 0, 15, 10, 10, 15, 0),
+    ('SL', 0.45, 200, 20, 30, 10, 100, 200, 0),
+    ('3A', 1.20, 300, 40, 45, 30, 300, 400, 5),
+    ('2A', 1.75, 300, 50, 45, 30, 400, 500, 5),
+    ('1A', 2.95, 300, 60, 75, 30, 400, 500, 5);
+
+-- the premium tatkal fare curve of a train. the base fare is multiplied by
+-- fare_multiplier while the share of the tatkal seats of the class left free
+-- is at most seats_left_percent, the lowest such step applying. trains
+-- without steps use fare.DefaultPremiumCurve
+CREATE TABLE premium_tatkal_fare (
+    id SERIAL PRIMARY KEY,
+    train_id INT NOT NULL REFERENCES train(id) ON DELETE CASCADE,
+    seats_left_percent INT NOT NULL CHECK (seats_left_percent BETWEEN 0 AND 100),
+    fare_multiplier FLOAT NOT NULL CHECK (fare_multiplier >= 1),
+    updated_at TIMESTAMP DEFAULT now(),
+    UNIQUE (train_id, seats_left_percent)
+);
+
 CREATE TABLE tatkal_waitlist (
     id SERIAL PRIMARY KEY,
     user_id UUID REFERENCES users(id) not null,
@@ -160,6 +258,12 @@ CREATE TABLE tatkal_waitlist (
    UNIQUE(user_id, journey_id)
 );
 
+-- tatkal requests that found no tatkal seat wait here, apart from the general
+-- waitlist, for tatkal seats given up later. wl_position counts per journey
+-- and class, and a user holds one place per journey
+ALTER TABLE tatkal_waitlist ADD COLUMN booking_id INT REFERENCES booking(id);
+ALTER TABLE tatkal_waitlist ADD COLUMN updated_at TIMESTAMP DEFAULT now();
+
 
 
 
@@ -172,6 +276,9 @@ CREATE TABLE payment (
     createdAt TIMESTAMP DEFAULT now()
 );
 
+-- itemized fare the payment amount was computed from
+ALTER TABLE payment ADD COLUMN fare_breakdown JSONB;
+
 CREATE TABLE booking (
     id SERIAL PRIMARY KEY,
     userId UUID REFERENCES users(id) ON DELETE RESTRICT,
@@ -182,6 +289,27 @@ CREATE TABLE booking (
     createdAt TIMESTAMP NOT NULL DEFAULT now()
 );
 
+ALTER TABLE booking ADD COLUMN pnr TEXT;
+ALTER TABLE booking ADD COLUMN from_station_id INT REFERENCES station(id);
+ALTER TABLE booking ADD COLUMN to_station_id INT REFERENCES station(id);
+ALTER TABLE booking ADD COLUMN leg_mask BIGINT NOT NULL DEFAULT -1;
+-- when the current hold began, NULL meaning at createdAt. a waitlisted booking
+-- promoted into seats gets a fresh hold to pay in
+ALTER TABLE booking ADD COLUMN hold_started_at TIMESTAMP;
+-- why a FAILED booking did not go through
+ALTER TABLE booking ADD COLUMN failure_reason TEXT;
+
+-- the fare a premium tatkal booking was quoted when it was made. it is what
+-- the booking is charged for as long as it keeps the hold token, however the
+-- fare moves in the meantime
+CREATE TABLE fare_lock (
+    hold_token TEXT PRIMARY KEY,
+    booking_id INT NOT NULL REFERENCES booking(id) ON DELETE CASCADE,
+    amount FLOAT NOT NULL,
+    fare_breakdown JSONB NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
 CREATE TABLE bookingItem (
     id SERIAL PRIMARY KEY,
     bookingId INT REFERENCES booking(id) ON DELETE CASCADE,
@@ -199,7 +327,6 @@ REFERENCES booking(id)
 ON DELETE RESTRICT;
 
 
--- not made table till now
 CREATE TABLE booking_passenger (
     id SERIAL PRIMARY KEY,
     booking_id INT REFERENCES booking(id) ON DELETE CASCADE,
@@ -207,10 +334,19 @@ CREATE TABLE booking_passenger (
     name TEXT NOT NULL,
     age INT NOT NULL,
     gender TEXT NOT NULL,
+    id_proof_type TEXT,
+    id_proof_number TEXT,
     created_at TIMESTAMP DEFAULT now(),
     UNIQUE (booking_id, seat_id)
 );
 
+-- the berth a passenger asked for, allocation tries to honour it
+ALTER TABLE booking_passenger ADD COLUMN berth_preference berth_type;
+
+-- when a passenger was cancelled, the rest of the booking still travelling.
+-- the seat_id is kept so the passenger can be found by the seat given up.
+ALTER TABLE booking_passenger ADD COLUMN cancelled_at TIMESTAMP;
+
 
 CREATE TABLE Refund (
     id SERIAL PRIMARY KEY,
@@ -223,6 +359,67 @@ CREATE TABLE Refund (
 
 );
 
+-- deductions applied when a booking is cancelled, per class and quota. the
+-- clerkage is a flat charge per passenger and the least that is kept; the
+-- percentages of the fare apply once departure is less than 48, 12 and 4 hours
+-- away. nothing is refunded after charting, or at all when refundable is false.
+CREATE TABLE cancellation_rule (
+    id SERIAL PRIMARY KEY,
+    coach_type coach_type NOT NULL,
+    booking_type booking_type NOT NULL,
+    clerkage_per_passenger FLOAT NOT NULL DEFAULT 0,
+    deduction_48h_percent FLOAT NOT NULL DEFAULT 0,
+    deduction_12h_percent FLOAT NOT NULL DEFAULT 0,
+    deduction_4h_percent FLOAT NOT NULL DEFAULT 100,
+    refundable BOOLEAN NOT NULL DEFAULT true,
+    updated_at TIMESTAMP DEFAULT now(),
+    UNIQUE (coach_type, booking_type)
+);
+
+INSERT INTO cancellation_rule (coach_type, booking_type, clerkage_per_passenger, deduction_48h_percent, deduction_12h_percent, deduction_4h_percent, refundable)
+VALUES
+    ('GN', 'NORMAL', 60, 25, 50, 100, true),
+    ('SL', 'NORMAL', 120, 25, 50, 100, true),
+    ('3A', 'NORMAL', 180, 25, 50, 100, true),
+    ('2A', 'NORMAL', 200, 25, 50, 100, true),
+    ('1A', 'NORMAL', 240, 25, 50, 100, true),
+    ('GN', 'WAITLIST', 60, 25, 50, 100, true),
+    ('SL', 'WAITLIST', 120, 25, 50, 100, true),
+    ('3A', 'WAITLIST', 180, 25, 50, 100, true),
+    ('2A', 'WAITLIST', 200, 25, 50, 100, true),
+    ('1A', 'WAITLIST', 240, 25, 50, 100, true),
+    ('GN', 'TATKAL', 60, 25, 50, 100, false),
+    ('SL', 'TATKAL', 120, 25, 50, 100, false),
+    ('3A', 'TATKAL', 180, 25, 50, 100, false),
+    ('2A', 'TATKAL', 200, 25, 50, 100, false),
+    ('1A', 'TATKAL', 240, 25, 50, 100, false),
+    ('GN', 'PREMIUM_TATKAL', 60, 25, 50, 100, false),
+    ('SL', 'PREMIUM_TATKAL', 120, 25, 50, 100, false),
+    ('3A', 'PREMIUM_TATKAL', 180, 25, 50, 100, false),
+    ('2A', 'PREMIUM_TATKAL', 200, 25, 50, 100, false),
+    ('1A', 'PREMIUM_TATKAL', 240, 25, 50, 100, false);
+
+-- how the refund amount was arrived at, see cancellation.Deduction
+ALTER TABLE Refund ADD COLUMN deduction_breakdown JSONB;
+
+-- refunds are queued PENDING by a cancellation, sent to the payment gateway by
+-- the refund processor, and settled by the gateway's refund webhooks.
+-- payment_id is what the gateway refunds, idempotency_key makes a resent
+-- request return the first refund instead of paying out twice.
+ALTER TABLE Refund ADD COLUMN payment_id TEXT;
+ALTER TABLE Refund ADD COLUMN idempotency_key TEXT UNIQUE;
+ALTER TABLE Refund ADD COLUMN gateway_refund_id TEXT UNIQUE;
+ALTER TABLE Refund ADD COLUMN attempts INT NOT NULL DEFAULT 0;
+ALTER TABLE Refund ADD COLUMN last_error TEXT;
+ALTER TABLE Refund ADD COLUMN next_attempt_at TIMESTAMP NOT NULL DEFAULT now();
+
+-- the gateway's id of the completed payment (a Stripe payment intent), which
+-- refunds are made against
+ALTER TABLE payment ADD COLUMN gateway_payment_id TEXT;
+
+-- the checkout page the booking can be paid on
+ALTER TABLE payment ADD COLUMN session_url TEXT;
+
 CREATE TABLE waitlist (
     id SERIAL PRIMARY KEY,
     journey_id INT REFERENCES train_journey(id),
@@ -234,6 +431,88 @@ CREATE TABLE waitlist (
     updatedAt TIMESTAMP not NULL DEFAULT now()
 );
 
+-- the class a waitlisted booking asked for, so it is promoted into that class
+ALTER TABLE waitlist ADD COLUMN coach_type coach_type;
+
+-- passengers travelling RAC on a berth of the RAC quota, two to a berth for
+-- the legs they travel. rac_number is the order RAC was given out in for the
+-- journey and class, which is also the order RAC passengers are confirmed in.
+-- passengers keep no seat in booking_passenger until they are confirmed.
+CREATE TABLE rac_passenger (
+    id SERIAL PRIMARY KEY,
+    journey_id INT NOT NULL,
+    seat_id INT NOT NULL,
+    coach_type coach_type NOT NULL,
+    booking_id INT NOT NULL REFERENCES booking(id) ON DELETE CASCADE,
+    passenger_id INT NOT NULL UNIQUE REFERENCES booking_passenger(id) ON DELETE CASCADE,
+    leg_mask BIGINT NOT NULL,
+    rac_number INT NOT NULL,
+    status waiting_status NOT NULL DEFAULT 'WAITING',
+    createdAt TIMESTAMP NOT NULL DEFAULT now(),
+    updatedAt TIMESTAMP NOT NULL DEFAULT now(),
+    FOREIGN KEY (journey_id, seat_id) REFERENCES seat_inventory(journey_id, seat_id)
+);
+
+-- how often seats of a train and class were given up, from journeys that have
+-- run. a row counts the seats cancelled, and the bookings waitlisted, with at
+-- most days_left days to departure. rebuilt by the prediction job
+CREATE TABLE cancellation_stat (
+    train_id INT NOT NULL REFERENCES train(id) ON DELETE CASCADE,
+    coach_type coach_type NOT NULL,
+    days_left INT NOT NULL,
+    booked_seats BIGINT NOT NULL,
+    cancelled_seats BIGINT NOT NULL,
+    waitlisted BIGINT NOT NULL,
+    cleared BIGINT NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT now(),
+    PRIMARY KEY (train_id, coach_type, days_left)
+);
+
+-- the reservation chart of each coach, made when the journey is charted
+CREATE TABLE reservation_chart (
+    journey_id INT NOT NULL REFERENCES train_journey(id) ON DELETE CASCADE,
+    coach_id INT NOT NULL REFERENCES coach(id) ON DELETE CASCADE,
+    coach_number INT NOT NULL,
+    coach_type coach_type NOT NULL,
+    chart JSONB NOT NULL,
+    chart_csv TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    PRIMARY KEY (journey_id, coach_id)
+);
+
+-- messages the booking consumers gave up on, stored from the dead-letter topic
+-- so they can be inspected and replayed
+CREATE TABLE dead_letter (
+    id SERIAL PRIMARY KEY,
+    topic TEXT NOT NULL,
+    message_partition INT NOT NULL,
+    message_offset BIGINT NOT NULL,
+    message_key TEXT,
+    payload TEXT NOT NULL,
+    error TEXT NOT NULL,
+    retryable BOOLEAN NOT NULL,
+    attempts INT NOT NULL,
+    status dead_letter_status NOT NULL DEFAULT 'PENDING',
+    failed_at TIMESTAMP NOT NULL,
+    replayed_at TIMESTAMP,
+    createdAt TIMESTAMP NOT NULL DEFAULT now(),
+    UNIQUE (topic, message_partition, message_offset)
+);
+
+-- events written in the same transaction as the change they describe, and
+-- published to Kafka by the outbox relay once it commits
+CREATE TABLE outbox (
+    id SERIAL PRIMARY KEY,
+    topic TEXT NOT NULL,
+    message_key TEXT NOT NULL DEFAULT '',
+    payload JSONB NOT NULL,
+    dedup_key TEXT NOT NULL UNIQUE,
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT,
+    createdAt TIMESTAMP NOT NULL DEFAULT now(),
+    published_at TIMESTAMP
+);
+
 -- should me moved to top
 
 
@@ -248,10 +527,26 @@ CREATE INDEX idx_booking_user ON booking(userId);
 CREATE INDEX idx_booking_status ON booking(status);
 CREATE INDEX idx_payment_status ON payment(status);
 CREATE INDEX idx_booking_journey ON booking(journey_id);
+CREATE UNIQUE INDEX idx_booking_pnr ON booking(pnr);
 CREATE INDEX idx_inventory_search
 ON seat_inventory (journey_id, coach_type, quota, status);
 
 CREATE INDEX idx_inventory_booking
 ON seat_inventory (booking_id);
 
+CREATE INDEX idx_segment_booking ON seat_segment (booking_id);
+
+CREATE INDEX idx_passenger_booking ON booking_passenger(booking_id);
+
+CREATE INDEX idx_dead_letter_status ON dead_letter(status);
+
+CREATE INDEX idx_outbox_pending ON outbox(id) WHERE published_at IS NULL;
+
+CREATE INDEX idx_refund_pending ON Refund(next_attempt_at) WHERE status = 'PENDING' AND gateway_refund_id IS NULL;
+
+CREATE INDEX idx_refund_user ON Refund(userId);
+
+CREATE INDEX idx_rac_booking ON rac_passenger(booking_id);
+
+CREATE INDEX idx_rac_waiting ON rac_passenger(journey_id, coach_type, rac_number) WHERE status = 'WAITING';
 
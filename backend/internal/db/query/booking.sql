@@ -1,6 +1,6 @@
 -- name: CreateBooking :one
-INSERT INTO booking (userId, journey_id, booking_type, status, holdToken)
-VALUES ($1, $2, 'NORMAL', 'PENDING', $3)
+INSERT INTO booking (userId, journey_id, booking_type, status, holdToken, pnr, from_station_id, to_station_id, leg_mask)
+VALUES ($1, $2, 'NORMAL', 'PENDING', $3, $4, $5, $6, $7)
 RETURNING *;
 
 -- name: CreateBookingItem :one
@@ -17,11 +17,11 @@ WHERE id = $1;
 SELECT * FROM booking WHERE holdToken = $1;
 
 -- name: GetBookedSeats :many
-SELECT si.seat_id
-FROM seat_inventory si
-JOIN booking b ON si.booking_id = b.id
+SELECT DISTINCT ss.seat_id
+FROM seat_segment ss
+JOIN booking b ON ss.booking_id = b.id
 WHERE b.journey_id = $1
-  AND si.status IN ('HELD','CONFIRMED');
+  AND ss.status IN ('HELD','CONFIRMED');
 
 
 -- name: GetBookingbyUserId :many
@@ -40,11 +40,20 @@ WHERE userid = $1
 ORDER BY createdAt DESC
 LIMIT 1;
 
--- name: ExpireOldBooking :exec
+-- name: ExpireOldBooking :many
+-- SKIP LOCKED lets several replicas sweep at the same time without picking
+-- the same booking, and leaves alone a booking a webhook is confirming.
 UPDATE booking
-SET status='EXPIRED'
- WHERE status='PENDING'
-   AND createdat < now() - INTERVAL '10 minutes';
+SET status = 'EXPIRED'
+WHERE id IN (
+    SELECT id FROM booking
+    WHERE status = 'PENDING'
+      AND COALESCE(hold_started_at, createdAt) < now() - make_interval(secs => sqlc.arg(ttl_seconds)::int)
+    ORDER BY COALESCE(hold_started_at, createdAt)
+    LIMIT sqlc.arg(batch_size)::int
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING id, journey_id;
 
 
 -- name: GetBookingItemsByBooking :many
@@ -72,29 +81,91 @@ WHERE journey_id = $1
 
 
 -- name: CreatePayment :one
- INSERT into payment (bookingId,amount,transactionId)
- VALUES($1,$2,$3)
+ INSERT into payment (bookingId,amount,transactionId,fare_breakdown,session_url)
+ VALUES($1,$2,$3,$4,$5)
  RETURNING *;
 
+-- name: GetLatestPaymentByBooking :one
+SELECT * FROM payment
+WHERE bookingId = $1
+ORDER BY id DESC
+LIMIT 1;
+
+-- name: UpdatePaymentSession :exec
+UPDATE payment SET transactionId = $2, session_url = $3 WHERE bookingId = $1;
+
 -- name: UpdateBookingItemStatus :exec
 UPDATE bookingItem SET bookingStatus = $2 WHERE bookingId = $1;
 
+-- name: ConfirmBookingItem :exec
+UPDATE bookingItem SET bookingStatus = 'CONFIRMED'
+WHERE bookingId = $1 AND seatId = $2;
+
+-- name: CancelBookingItems :exec
+UPDATE bookingItem SET bookingStatus = 'CANCELLED'
+WHERE bookingId = sqlc.arg(booking_id)
+  AND seatId = ANY(sqlc.arg(seat_ids)::int[]);
+
 -- name: UpdatePaymentStatus :exec
 UPDATE payment SET status = $2 WHERE bookingId = $1;
 
+-- name: UpdatePaymentGatewayID :exec
+UPDATE payment SET gateway_payment_id = $2 WHERE bookingId = $1;
+
 -- name: GetBookingLockContext :many
 SELECT
     b.journey_id,
-    si.seat_id,
+    ss.seat_id,
     b.holdToken
 FROM booking b
-JOIN seat_inventory si ON si.booking_id = b.id
+JOIN seat_segment ss ON ss.booking_id = b.id
 WHERE b.id = $1;
 
 -- name: DeleteBookingItem :exec
 DELETE FROM
 bookingItem b WHERE bookingId = $1 ;
 
+-- name: HoldPromotedBooking :exec
+-- a waitlisted booking that got seats but is not paid for yet
+UPDATE booking
+SET status = 'PENDING',
+    holdToken = $2,
+    hold_started_at = now()
+WHERE id = $1;
+
+-- name: CreateQueuedBooking :one
+-- a tatkal or premium tatkal booking waiting for the worker to hold its seats
+INSERT INTO booking (userId, journey_id, booking_type, status, holdToken, pnr, from_station_id, to_station_id, leg_mask)
+VALUES ($1, $2, $3, 'QUEUED', $4, $5, $6, $7, $8)
+RETURNING *;
+
+-- name: HoldQueuedBooking :execrows
+-- the worker got seats for a queued tatkal booking, it is paid for in the
+-- hold TTL like any other
+UPDATE booking
+SET status = 'PENDING',
+    hold_started_at = now()
+WHERE id = $1 AND status = 'QUEUED';
+
+-- name: WaitlistQueuedBooking :execrows
+-- a queued tatkal booking that found no tatkal seat
+UPDATE booking
+SET status = 'WAITLIST'
+WHERE id = $1 AND status = 'QUEUED';
+
+-- name: FailQueuedBooking :execrows
+UPDATE booking
+SET status = 'FAILED',
+    failure_reason = $2
+WHERE id = $1 AND status = 'QUEUED';
+
+-- name: RequeueFailedBooking :execrows
+-- a failed tatkal booking whose job is replayed from the dead-letter topic
+UPDATE booking
+SET status = 'QUEUED',
+    failure_reason = NULL
+WHERE id = $1 AND status = 'FAILED';
+
 -- name: GetBookingById :one
 SELECT * from booking
 where id = $1;
@@ -105,3 +176,30 @@ SELECT COUNT(*) FROM bookingItem WHERE bookingId = $1;
 
 
 
+
+-- name: ListBookingsByUser :many
+SELECT * FROM booking
+WHERE userId = $1
+ORDER BY createdAt DESC;
+
+-- name: PnrExists :one
+SELECT EXISTS (SELECT 1 FROM booking WHERE pnr = $1);
+
+-- name: GetBookingByPnr :one
+SELECT
+    b.id,
+    b.journey_id,
+    b.booking_type,
+    b.status,
+    b.pnr,
+    b.createdAt,
+    tj.journey_date,
+    tj.status AS journey_status,
+    t.trainNumber,
+    t.trainName,
+    t.source,
+    t.destination
+FROM booking b
+JOIN train_journey tj ON tj.id = b.journey_id
+JOIN train t ON t.id = tj.train_id
+WHERE b.pnr = $1;
@@ -8,7 +8,53 @@ WHERE b.journey_id = $2 AND b.userId = $1 AND p.status = 'SUCCESS';
 
 
 -- name: CreateRefund :one
-INSERT INTO refund (userId , bookingId , amount , status , createdAt, updatedAt) 
-VALUES ( $1 , $2 , $3 , $4 , now() , now() )
+INSERT INTO refund (userId , bookingId , amount , status , deduction_breakdown , payment_id , idempotency_key , createdAt, updatedAt) 
+VALUES ( $1 , $2 , $3 , $4 , $5 , $6 , $7 , now() , now() )
 RETURNING *;
 
+-- name: GetBookingDeparture :one
+-- departure from the boarding station: the origin leaves at the schedule's
+-- time on the journey date and the stop is departure_offset_min after that.
+-- bookings without a boarding station are treated as boarding at the origin.
+SELECT
+    tj.journey_date,
+    tj.status AS journey_status,
+    ts.departureTime AS origin_departure,
+    COALESCE(tr.departure_offset_min, 0)::int AS departure_offset_min
+FROM booking b
+JOIN train_journey tj ON tj.id = b.journey_id
+JOIN train_schedule ts ON ts.id = tj.schedule_id
+LEFT JOIN train_route tr ON tr.train_id = tj.train_id AND tr.station_id = b.from_station_id
+WHERE b.id = $1;
+
+-- name: GetPaymentByBooking :one
+SELECT * FROM payment
+WHERE bookingId = $1 AND status = 'SUCCESS';
+
+-- name: GetCancellationRule :one
+SELECT * FROM cancellation_rule
+WHERE coach_type = $1 AND booking_type = $2;
+
+-- name: ListCancellationRules :many
+SELECT * FROM cancellation_rule
+ORDER BY coach_type, booking_type;
+
+-- name: UpsertCancellationRule :one
+INSERT INTO cancellation_rule (
+    coach_type,
+    booking_type,
+    clerkage_per_passenger,
+    deduction_48h_percent,
+    deduction_12h_percent,
+    deduction_4h_percent,
+    refundable
+)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+ON CONFLICT (coach_type, booking_type) DO UPDATE SET
+    clerkage_per_passenger = EXCLUDED.clerkage_per_passenger,
+    deduction_48h_percent = EXCLUDED.deduction_48h_percent,
+    deduction_12h_percent = EXCLUDED.deduction_12h_percent,
+    deduction_4h_percent = EXCLUDED.deduction_4h_percent,
+    refundable = EXCLUDED.refundable,
+    updated_at = now()
+RETURNING *;
@@ -0,0 +1,140 @@
+-- name: ListJourneysToChart :many
+-- open journeys up to a date, with the time their train leaves its origin to
+-- tell which are due
+SELECT tj.id, tj.journey_date, ts.departureTime AS origin_departure
+FROM train_journey tj
+JOIN train_schedule ts ON ts.id = tj.schedule_id
+WHERE tj.status = 'OPEN'
+  AND tj.journey_date <= $1
+ORDER BY tj.journey_date, ts.departureTime;
+
+-- name: LockJourneyForCharting :one
+SELECT status
+FROM train_journey
+WHERE id = $1
+FOR UPDATE;
+
+-- name: MarkJourneyCharted :exec
+UPDATE train_journey
+SET status = 'CHARTED'
+WHERE id = $1;
+
+-- name: GetCoachTypesByJourney :many
+SELECT DISTINCT coach_type
+FROM seat_inventory
+WHERE journey_id = $1
+ORDER BY coach_type;
+
+-- name: GetPendingBookingsByJourney :many
+SELECT id
+FROM booking
+WHERE journey_id = $1
+  AND status = 'PENDING'
+ORDER BY id
+FOR UPDATE;
+
+-- name: GetUnpaidRacBookingsByJourney :many
+-- bookings on RAC that were never paid for
+SELECT b.id
+FROM booking b
+WHERE b.journey_id = $1
+  AND b.status = 'RAC'
+  AND NOT EXISTS (SELECT 1 FROM payment p WHERE p.bookingId = b.id AND p.status = 'SUCCESS')
+ORDER BY b.id
+FOR UPDATE OF b;
+
+-- name: GetWaitingBookingsByJourney :many
+-- bookings still on the waitlist, with the last payment made for each
+SELECT
+    b.id,
+    b.userId,
+    b.booking_type,
+    w.coach_type,
+    p.amount,
+    p.status AS payment_status,
+    p.gateway_payment_id
+FROM waitlist w
+JOIN booking b ON b.id = w.bookingId
+LEFT JOIN LATERAL (
+    SELECT amount, status, gateway_payment_id
+    FROM payment
+    WHERE bookingId = b.id
+    ORDER BY id DESC
+    LIMIT 1
+) p ON true
+WHERE w.journey_id = $1
+  AND w.status = 'WAITING'
+  AND b.status = 'WAITLIST'
+ORDER BY w.id
+FOR UPDATE OF w, b;
+
+-- name: FreezeSeatInventory :execrows
+-- moves every seat of a journey into the CURRENT quota, except RAC berths
+-- still shared by RAC passengers, which are not tracked in the seat masks
+UPDATE seat_inventory si
+SET quota = 'CURRENT'
+WHERE si.journey_id = $1
+  AND NOT EXISTS (
+      SELECT 1
+      FROM rac_passenger r
+      WHERE r.journey_id = si.journey_id
+        AND r.seat_id = si.seat_id
+        AND r.status = 'WAITING'
+  );
+
+-- name: GetChartPassengers :many
+-- everyone travelling on a journey, on a seat of their own or on RAC, in
+-- coach and berth order
+SELECT
+    s.coachId AS coach_id,
+    s.seatNo AS seat_no,
+    s.berth,
+    b.pnr,
+    bp.name,
+    bp.age,
+    bp.gender,
+    COALESCE(fs.code, '')::text AS from_code,
+    COALESCE(ts.code, '')::text AS to_code,
+    'CNF'::text AS chart_status
+FROM booking b
+JOIN bookingItem bi ON bi.bookingId = b.id AND bi.bookingStatus = 'CONFIRMED'
+JOIN booking_passenger bp ON bp.booking_id = b.id AND bp.seat_id = bi.seatId
+JOIN seat s ON s.id = bi.seatId
+LEFT JOIN station fs ON fs.id = b.from_station_id
+LEFT JOIN station ts ON ts.id = b.to_station_id
+WHERE b.journey_id = sqlc.arg(journey_id)::int
+  AND b.status IN ('CONFIRMED', 'RAC')
+UNION ALL
+SELECT
+    s.coachId,
+    s.seatNo,
+    s.berth,
+    b.pnr,
+    bp.name,
+    bp.age,
+    bp.gender,
+    COALESCE(fs.code, '')::text,
+    COALESCE(ts.code, '')::text,
+    ('RAC ' || r.rac_number)::text
+FROM rac_passenger r
+JOIN booking b ON b.id = r.booking_id
+JOIN booking_passenger bp ON bp.id = r.passenger_id
+JOIN seat s ON s.id = r.seat_id
+LEFT JOIN station fs ON fs.id = b.from_station_id
+LEFT JOIN station ts ON ts.id = b.to_station_id
+WHERE r.journey_id = sqlc.arg(journey_id)::int
+  AND r.status = 'WAITING'
+ORDER BY coach_id, seat_no, chart_status;
+
+-- name: SaveReservationChart :exec
+INSERT INTO reservation_chart (journey_id, coach_id, coach_number, coach_type, chart, chart_csv)
+VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT (journey_id, coach_id) DO UPDATE
+SET chart = EXCLUDED.chart,
+    chart_csv = EXCLUDED.chart_csv,
+    created_at = now();
+
+-- name: ListReservationCharts :many
+SELECT * FROM reservation_chart
+WHERE journey_id = $1
+ORDER BY coach_type, coach_number;
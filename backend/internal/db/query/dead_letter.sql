@@ -0,0 +1,32 @@
+-- name: CreateDeadLetter :exec
+-- The same message can be dead-lettered twice if the consumer restarts before
+-- committing its offset, keep the first copy.
+INSERT INTO dead_letter (
+    topic,
+    message_partition,
+    message_offset,
+    message_key,
+    payload,
+    error,
+    retryable,
+    attempts,
+    failed_at
+)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+ON CONFLICT (topic, message_partition, message_offset) DO NOTHING;
+
+-- name: GetDeadLetter :one
+SELECT * FROM dead_letter
+WHERE id = $1;
+
+-- name: ListDeadLetters :many
+SELECT * FROM dead_letter
+WHERE status = $1
+ORDER BY id DESC
+LIMIT $2;
+
+-- name: MarkDeadLetterReplayed :exec
+UPDATE dead_letter
+SET status = 'REPLAYED',
+    replayed_at = now()
+WHERE id = $1;
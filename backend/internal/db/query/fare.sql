@@ -0,0 +1,54 @@
+-- name: GetFareRule :one
+SELECT * FROM fare_rule
+WHERE coach_type = $1;
+
+-- name: ListFareRules :many
+SELECT * FROM fare_rule
+ORDER BY coach_type;
+
+-- name: UpsertFareRule :one
+INSERT INTO fare_rule (
+    coach_type,
+    base_fare_per_km,
+    min_distance_km,
+    reservation_charge,
+    superfast_charge,
+    tatkal_premium_percent,
+    tatkal_min_charge,
+    tatkal_max_charge,
+    gst_percent
+)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+ON CONFLICT (coach_type) DO UPDATE SET
+    base_fare_per_km = EXCLUDED.base_fare_per_km,
+    min_distance_km = EXCLUDED.min_distance_km,
+    reservation_charge = EXCLUDED.reservation_charge,
+    superfast_charge = EXCLUDED.superfast_charge,
+    tatkal_premium_percent = EXCLUDED.tatkal_premium_percent,
+    tatkal_min_charge = EXCLUDED.tatkal_min_charge,
+    tatkal_max_charge = EXCLUDED.tatkal_max_charge,
+    gst_percent = EXCLUDED.gst_percent,
+    updated_at = now()
+RETURNING *;
+
+-- name: ListPremiumTatkalFares :many
+SELECT * FROM premium_tatkal_fare
+WHERE train_id = $1
+ORDER BY seats_left_percent;
+
+-- name: DeletePremiumTatkalFares :exec
+DELETE FROM premium_tatkal_fare
+WHERE train_id = $1;
+
+-- name: InsertPremiumTatkalFare :one
+INSERT INTO premium_tatkal_fare (train_id, seats_left_percent, fare_multiplier)
+VALUES ($1, $2, $3)
+RETURNING *;
+
+-- name: CreateFareLock :exec
+INSERT INTO fare_lock (hold_token, booking_id, amount, fare_breakdown)
+VALUES ($1, $2, $3, $4);
+
+-- name: GetFareLock :one
+SELECT * FROM fare_lock
+WHERE hold_token = $1;
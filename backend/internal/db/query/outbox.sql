@@ -0,0 +1,31 @@
+-- name: CreateOutboxEvent :exec
+-- an event is queued at most once per dedup key, so a retried request does
+-- not announce the same change twice
+INSERT INTO outbox (topic, message_key, payload, dedup_key)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (dedup_key) DO NOTHING;
+
+-- name: DeletePublishedOutbox :exec
+DELETE FROM outbox
+WHERE published_at < now() - make_interval(hours => sqlc.arg(retention_hours)::int);
+
+-- name: GetPendingOutbox :many
+-- plain FOR UPDATE rather than SKIP LOCKED: a second relay waits for the first
+-- one instead of publishing newer events ahead of older ones
+SELECT * FROM outbox
+WHERE published_at IS NULL
+ORDER BY id
+LIMIT $1
+FOR UPDATE;
+
+-- name: MarkOutboxFailed :exec
+UPDATE outbox
+SET attempts = attempts + 1,
+    last_error = $2
+WHERE id = $1;
+
+-- name: MarkOutboxPublished :exec
+UPDATE outbox
+SET attempts = attempts + 1,
+    published_at = now()
+WHERE id = $1;
@@ -0,0 +1,53 @@
+-- name: CreateBookingPassenger :one
+INSERT INTO booking_passenger (booking_id, seat_id, name, age, gender, id_proof_type, id_proof_number, berth_preference)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+RETURNING *;
+
+-- name: GetPassengersByBooking :many
+SELECT
+    bp.id,
+    bp.booking_id,
+    bp.seat_id,
+    bp.name,
+    bp.age,
+    bp.gender,
+    bp.id_proof_type,
+    bp.id_proof_number,
+    bp.berth_preference,
+    bp.cancelled_at,
+    s.seatno,
+    s.berth,
+    c.coachnumber,
+    c.coachtype,
+    r.id AS rac_id,
+    ((
+        SELECT COUNT(*)
+        FROM rac_passenger ahead
+        WHERE ahead.journey_id = r.journey_id
+          AND ahead.coach_type = r.coach_type
+          AND ahead.status = 'WAITING'
+          AND ahead.rac_number < r.rac_number
+    ) + 1)::int AS rac_position
+FROM booking_passenger bp
+LEFT JOIN rac_passenger r ON r.passenger_id = bp.id AND r.status = 'WAITING'
+LEFT JOIN seat s ON s.id = COALESCE(bp.seat_id, r.seat_id)
+LEFT JOIN coach c ON c.id = s.coachId
+WHERE bp.booking_id = $1
+ORDER BY bp.id;
+
+-- name: CancelPassengers :exec
+-- marks the passengers of a booking on the given seats, or with the given
+-- ids, cancelled. passengers cancelled before keep the time they were.
+UPDATE booking_passenger
+SET cancelled_at = now()
+WHERE booking_id = sqlc.arg(booking_id)
+  AND cancelled_at IS NULL
+  AND (seat_id = ANY(sqlc.arg(seat_ids)::int[]) OR id = ANY(sqlc.arg(passenger_ids)::int[]));
+
+-- name: UpdatePassengerSeat :exec
+UPDATE booking_passenger
+SET seat_id = $2
+WHERE id = $1;
+
+-- name: CountPassengersByBooking :one
+SELECT COUNT(*) FROM booking_passenger WHERE booking_id = $1;
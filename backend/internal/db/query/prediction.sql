@@ -0,0 +1,84 @@
+-- name: RefreshCancellationStats :execrows
+-- rebuilds the statistics from journeys that have run. seats count once
+-- booked, cancellations by the hours to departure their refund was worked out
+-- with, and a waitlisted booking cleared once it left the waitlist for RAC or
+-- a seat.
+WITH booked AS (
+    SELECT tj.train_id, c.coachtype AS coach_type, COUNT(*) AS seats
+    FROM bookingItem bi
+    JOIN booking b ON b.id = bi.bookingId
+    JOIN train_journey tj ON tj.id = b.journey_id
+    JOIN seat s ON s.id = bi.seatId
+    JOIN coach c ON c.id = s.coachId
+    WHERE tj.journey_date < CURRENT_DATE
+      AND tj.train_id IS NOT NULL
+      AND bi.bookingStatus IN ('CONFIRMED', 'CANCELLED')
+    GROUP BY tj.train_id, c.coachtype
+),
+cancelled AS (
+    SELECT
+        tj.train_id,
+        (r.deduction_breakdown->>'coach_type')::coach_type AS coach_type,
+        GREATEST(FLOOR((r.deduction_breakdown->>'hours_to_depart')::float / 24), 0) AS days_left,
+        SUM((r.deduction_breakdown->>'passengers')::int) AS seats
+    FROM refund r
+    JOIN booking b ON b.id = r.bookingId
+    JOIN train_journey tj ON tj.id = b.journey_id
+    WHERE tj.journey_date < CURRENT_DATE
+      AND r.deduction_breakdown IS NOT NULL
+      AND r.deduction_breakdown->>'slab' NOT IN ('WAITLIST_NOT_CLEARED', 'TATKAL_WAITLIST')
+    GROUP BY 1, 2, 3
+),
+waitlisted AS (
+    SELECT
+        tj.train_id,
+        w.coach_type,
+        GREATEST(tj.journey_date - w.createdAt::date, 0) AS days_left,
+        COUNT(*) AS bookings,
+        COUNT(*) FILTER (WHERE w.status IN ('RAC', 'CONFIRMED')) AS cleared
+    FROM waitlist w
+    JOIN train_journey tj ON tj.id = w.journey_id
+    WHERE tj.journey_date < CURRENT_DATE
+      AND w.coach_type IS NOT NULL
+    GROUP BY 1, 2, 3
+),
+buckets AS (
+    SELECT unnest(ARRAY[0, 1, 2, 3, 5, 7, 10, 15, 30, 60, 120]) AS days_left
+)
+INSERT INTO cancellation_stat (train_id, coach_type, days_left, booked_seats, cancelled_seats, waitlisted, cleared, updated_at)
+SELECT
+    bk.train_id,
+    bk.coach_type,
+    d.days_left,
+    bk.seats,
+    COALESCE((
+        SELECT SUM(c.seats) FROM cancelled c
+        WHERE c.train_id = bk.train_id AND c.coach_type = bk.coach_type AND c.days_left <= d.days_left
+    ), 0),
+    COALESCE((
+        SELECT SUM(w.bookings) FROM waitlisted w
+        WHERE w.train_id = bk.train_id AND w.coach_type = bk.coach_type AND w.days_left <= d.days_left
+    ), 0),
+    COALESCE((
+        SELECT SUM(w.cleared) FROM waitlisted w
+        WHERE w.train_id = bk.train_id AND w.coach_type = bk.coach_type AND w.days_left <= d.days_left
+    ), 0),
+    now()
+FROM booked bk
+CROSS JOIN buckets d
+ON CONFLICT (train_id, coach_type, days_left) DO UPDATE
+SET booked_seats = EXCLUDED.booked_seats,
+    cancelled_seats = EXCLUDED.cancelled_seats,
+    waitlisted = EXCLUDED.waitlisted,
+    cleared = EXCLUDED.cleared,
+    updated_at = EXCLUDED.updated_at;
+
+-- name: GetCancellationStats :many
+SELECT * FROM cancellation_stat
+WHERE train_id = $1 AND coach_type = $2
+ORDER BY days_left;
+
+-- name: GetCancellationStatsByTrains :many
+SELECT * FROM cancellation_stat
+WHERE train_id = ANY(sqlc.arg(train_ids)::int[])
+ORDER BY train_id, coach_type, days_left;
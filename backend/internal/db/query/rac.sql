@@ -0,0 +1,101 @@
+-- name: LockRacBerths :many
+-- locks the RAC berths of a class and returns how many more passengers each
+-- can take on the given legs. a berth is shared by two.
+WITH berths AS (
+    SELECT seat_id
+    FROM seat_inventory
+    WHERE journey_id = sqlc.arg(journey_id)
+      AND coach_type = sqlc.arg(coach_type)
+      AND quota = 'RAC'
+    ORDER BY seat_id
+    FOR UPDATE
+)
+SELECT
+    b.seat_id,
+    (2 - COUNT(r.id))::int AS free_places
+FROM berths b
+LEFT JOIN rac_passenger r
+    ON r.journey_id = sqlc.arg(journey_id)
+   AND r.seat_id = b.seat_id
+   AND r.status = 'WAITING'
+   AND (r.leg_mask & sqlc.arg(leg_mask)::bigint) <> 0
+GROUP BY b.seat_id
+HAVING COUNT(r.id) < 2
+ORDER BY b.seat_id;
+
+-- name: GetNextRacNumber :one
+WITH locked_rows AS (
+    SELECT rac_number
+    FROM rac_passenger
+    WHERE journey_id = $1
+      AND coach_type = $2
+    FOR UPDATE
+)
+SELECT (COALESCE(MAX(rac_number), 0) + 1)::int
+FROM locked_rows;
+
+-- name: CreateRacPassenger :exec
+INSERT INTO rac_passenger (journey_id, seat_id, coach_type, booking_id, passenger_id, leg_mask, rac_number)
+VALUES ($1, $2, $3, $4, $5, $6, $7);
+
+-- name: GetNextRacPassenger :one
+-- the RAC passenger of a paid booking that is confirmed next
+SELECT r.id, r.booking_id, r.passenger_id, r.leg_mask
+FROM rac_passenger r
+JOIN booking b ON b.id = r.booking_id
+WHERE r.journey_id = $1
+  AND r.coach_type = $2
+  AND r.status = 'WAITING'
+  AND b.status = 'RAC'
+  AND EXISTS (SELECT 1 FROM payment p WHERE p.bookingId = b.id AND p.status = 'SUCCESS')
+ORDER BY r.rac_number
+LIMIT 1
+FOR UPDATE OF r SKIP LOCKED;
+
+-- name: ConfirmRacPassenger :exec
+UPDATE rac_passenger
+SET status = 'CONFIRMED',
+    updatedAt = now()
+WHERE id = $1;
+
+-- name: CountRacByBooking :one
+SELECT COUNT(*)
+FROM rac_passenger
+WHERE booking_id = $1
+  AND status = 'WAITING';
+
+-- name: GetRacPassengersByBooking :many
+SELECT passenger_id
+FROM rac_passenger
+WHERE booking_id = $1
+  AND status = 'WAITING'
+ORDER BY rac_number;
+
+-- name: GetRacSummaryByBooking :many
+SELECT coach_type, COUNT(*) AS seats
+FROM rac_passenger
+WHERE booking_id = $1
+  AND status = 'WAITING'
+GROUP BY coach_type;
+
+-- name: GetRacSummaryByPassengers :many
+SELECT coach_type, COUNT(*) AS seats
+FROM rac_passenger
+WHERE booking_id = sqlc.arg(booking_id)
+  AND passenger_id = ANY(sqlc.arg(passenger_ids)::int[])
+  AND status = 'WAITING'
+GROUP BY coach_type;
+
+-- name: CancelRacPassengers :execrows
+-- a passenger that was already cancelled or confirmed is not counted
+UPDATE rac_passenger
+SET status = 'CANCELLED',
+    updatedAt = now()
+WHERE booking_id = sqlc.arg(booking_id)
+  AND passenger_id = ANY(sqlc.arg(passenger_ids)::int[])
+  AND status = 'WAITING';
+
+-- name: ReleaseRacByBooking :exec
+-- an unpaid booking gives its RAC places back
+DELETE FROM rac_passenger
+WHERE booking_id = $1;
@@ -0,0 +1,66 @@
+-- name: GetPendingRefunds :many
+-- SKIP LOCKED lets several workers process refunds at the same time without
+-- sending the same one twice.
+SELECT * FROM refund
+WHERE status = 'PENDING'
+  AND gateway_refund_id IS NULL
+  AND next_attempt_at <= now()
+ORDER BY id
+LIMIT $1
+FOR UPDATE SKIP LOCKED;
+
+-- name: GetRefundByGatewayID :one
+SELECT * FROM refund
+WHERE gateway_refund_id = $1;
+
+-- name: ListRefundsByUser :many
+SELECT
+    r.id,
+    r.bookingId,
+    b.pnr,
+    r.amount,
+    r.status,
+    r.deduction_breakdown,
+    r.attempts,
+    r.last_error,
+    r.createdAt,
+    r.updatedAt
+FROM refund r
+JOIN booking b ON b.id = r.bookingId
+WHERE r.userId = $1
+ORDER BY r.createdAt DESC;
+
+-- name: MarkRefundFailed :exec
+UPDATE refund
+SET status = 'FAILED',
+    attempts = attempts + 1,
+    last_error = $2,
+    updatedAt = now()
+WHERE id = $1;
+
+-- name: MarkRefundRetry :exec
+-- the gateway could not be reached or refused for now, try again later
+UPDATE refund
+SET attempts = attempts + 1,
+    last_error = sqlc.arg(last_error),
+    next_attempt_at = now() + make_interval(secs => sqlc.arg(retry_after_seconds)::int),
+    updatedAt = now()
+WHERE id = sqlc.arg(id);
+
+-- name: MarkRefundSubmitted :exec
+UPDATE refund
+SET gateway_refund_id = $2,
+    status = $3,
+    attempts = attempts + 1,
+    last_error = NULL,
+    updatedAt = now()
+WHERE id = $1;
+
+-- name: SettleRefund :execrows
+-- only a PENDING refund is settled, so a late or repeated webhook does not
+-- undo an earlier outcome
+UPDATE refund
+SET status = $2,
+    updatedAt = now()
+WHERE gateway_refund_id = $1
+  AND status = 'PENDING';
@@ -0,0 +1,107 @@
+-- name: CreateStation :one
+INSERT INTO station (code, name, zone)
+VALUES ($1, $2, $3)
+RETURNING *;
+
+-- name: UpdateStation :one
+UPDATE station
+SET name = $2,
+    zone = $3
+WHERE id = $1
+RETURNING *;
+
+-- name: ListStations :many
+SELECT * FROM station
+ORDER BY code;
+
+-- name: GetStationByCode :one
+SELECT * FROM station
+WHERE code = $1;
+
+-- name: CountJourneysOnRoute :one
+-- journeys whose bookings are mapped onto the current route: open for booking, or holding any booking
+SELECT count(*) FROM train_journey tj
+WHERE tj.train_id = $1
+  AND (tj.status = 'OPEN' OR EXISTS (SELECT 1 FROM booking b WHERE b.journey_id = tj.id));
+
+-- name: DeleteTrainRoute :exec
+DELETE FROM train_route
+WHERE train_id = $1;
+
+-- name: CreateRouteStop :one
+INSERT INTO train_route (
+    train_id,
+    station_id,
+    stop_sequence,
+    arrival_offset_min,
+    departure_offset_min,
+    day_number,
+    distance_km
+)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING *;
+
+-- name: GetTrainRoute :many
+SELECT tr.*, s.code, s.name
+FROM train_route tr
+JOIN station s ON s.id = tr.station_id
+WHERE tr.train_id = $1
+ORDER BY tr.stop_sequence;
+
+-- name: GetRouteSegment :one
+SELECT
+    src.stop_sequence AS from_sequence,
+    src.station_id AS from_station_id,
+    src.distance_km AS from_distance_km,
+    dst.stop_sequence AS to_sequence,
+    dst.station_id AS to_station_id,
+    dst.distance_km AS to_distance_km
+FROM train_route src
+JOIN station fs ON fs.id = src.station_id
+JOIN train_route dst ON dst.train_id = src.train_id AND dst.stop_sequence > src.stop_sequence
+JOIN station tst ON tst.id = dst.station_id
+WHERE src.train_id = sqlc.arg(train_id)
+  AND fs.code = sqlc.arg(from_code)
+  AND tst.code = sqlc.arg(to_code);
+
+-- name: UpdateTrainRouteSummary :exec
+UPDATE train
+SET source = $2,
+    destination = $3,
+    distance_km = $4
+WHERE id = $1;
+
+-- name: SearchTrains :many
+-- a train serves the search when it stops at both stations in order. The
+-- journey is looked up by the date it left its origin, which is earlier than
+-- the travel date when the boarding station is reached on a later day.
+SELECT
+    t.id AS train_id,
+    t.trainNumber,
+    t.trainName,
+    t.is_superfast,
+    tj.id AS journey_id,
+    tj.journey_date,
+    tj.status,
+    ts.departureTime AS origin_departure,
+    src.stop_sequence AS from_sequence,
+    src.departure_offset_min,
+    src.distance_km AS from_distance_km,
+    dst.stop_sequence AS to_sequence,
+    dst.arrival_offset_min,
+    dst.distance_km AS to_distance_km,
+    fs.code AS from_code,
+    fs.name AS from_name,
+    tst.code AS to_code,
+    tst.name AS to_name
+FROM train_route src
+JOIN station fs ON fs.id = src.station_id
+JOIN train_route dst ON dst.train_id = src.train_id AND dst.stop_sequence > src.stop_sequence
+JOIN station tst ON tst.id = dst.station_id
+JOIN train t ON t.id = src.train_id
+JOIN train_journey tj ON tj.train_id = t.id
+JOIN train_schedule ts ON ts.id = tj.schedule_id
+WHERE fs.code = sqlc.arg(from_code)
+  AND tst.code = sqlc.arg(to_code)
+  AND tj.journey_date = sqlc.arg(travel_date)::date - (src.day_number - 1)
+  AND tj.status <> 'CANCELLED';
@@ -3,3 +3,131 @@ SELECT * from
 tatkal_config
 where train_id = $1;
 
+-- name: ListTatkalCounters :many
+-- free tatkal seats per class of the open journeys whose tatkal window opens
+-- by warm_until and has not closed at now. a seat counts when it is free for
+-- the whole journey.
+SELECT
+    si.journey_id,
+    si.coach_type,
+    tc.tatkal_end_time,
+    COUNT(*) FILTER (WHERE (si.held_mask | si.confirmed_mask) = 0) AS available
+FROM tatkal_config tc
+JOIN train_journey tj ON tj.train_id = tc.train_id
+JOIN seat_inventory si ON si.journey_id = tj.id AND si.coach_type = tc.coach_type
+WHERE tc.tatkal_start_time <= sqlc.arg(warm_until)
+  AND tc.tatkal_end_time > sqlc.arg(now)
+  AND tj.status = 'OPEN'
+  AND tj.journey_date >= CURRENT_DATE
+  AND si.quota = 'TATKAL'
+GROUP BY si.journey_id, si.coach_type, tc.tatkal_end_time
+ORDER BY si.journey_id, si.coach_type;
+
+-- name: LockTatkalWaitlist :exec
+-- serialises handing out positions on the tatkal waitlist of a journey and
+-- class until the transaction ends
+SELECT pg_advisory_xact_lock(sqlc.arg(journey_id)::int, hashtext(sqlc.arg(coach_type)::text));
+
+-- name: InsertTatkalWaitlist :one
+-- gives a booking the next position on the tatkal waitlist of its class. a
+-- user keeps one place per journey: a place of theirs that was confirmed or
+-- cancelled is taken over, one still waiting returns no row.
+INSERT INTO tatkal_waitlist (user_id, coach_type, journey_id, booking_id, wl_position, status)
+SELECT sqlc.arg(user_id), sqlc.arg(coach_type), sqlc.arg(journey_id), sqlc.arg(booking_id), COALESCE(MAX(wl_position), 0) + 1, 'WAITING'
+FROM tatkal_waitlist
+WHERE journey_id = sqlc.arg(journey_id)
+  AND coach_type = sqlc.arg(coach_type)
+ON CONFLICT (user_id, journey_id) DO UPDATE
+SET coach_type = EXCLUDED.coach_type,
+    booking_id = EXCLUDED.booking_id,
+    wl_position = EXCLUDED.wl_position,
+    status = 'WAITING',
+    created_at = now(),
+    updated_at = now()
+WHERE tatkal_waitlist.status <> 'WAITING'
+RETURNING *;
+
+-- name: GetNextTatkalWaitlist :one
+SELECT *
+FROM tatkal_waitlist
+WHERE journey_id = $1
+  AND coach_type = $2
+  AND status = 'WAITING'
+ORDER BY wl_position
+LIMIT 1
+FOR UPDATE SKIP LOCKED;
+
+-- name: UpdateTatkalWaitlistStatus :exec
+UPDATE tatkal_waitlist
+SET status = $2,
+    updated_at = now()
+WHERE id = $1;
+
+-- name: CancelTatkalWaitlist :execrows
+UPDATE tatkal_waitlist
+SET status = 'CANCELLED',
+    updated_at = now()
+WHERE booking_id = $1
+  AND status = 'WAITING';
+
+-- name: GetTatkalWaitlistByBooking :one
+-- position is counted among the places still waiting in the class
+SELECT
+    w.wl_position,
+    w.status,
+    w.coach_type,
+    ((
+        SELECT COUNT(*)
+        FROM tatkal_waitlist ahead
+        WHERE ahead.journey_id = w.journey_id
+          AND ahead.coach_type = w.coach_type
+          AND ahead.status = 'WAITING'
+          AND ahead.wl_position < w.wl_position
+    ) + 1)::int AS position
+FROM tatkal_waitlist w
+WHERE w.booking_id = $1;
+
+-- name: GetTatkalWaitingBookingsByJourney :many
+-- bookings still on the tatkal waitlist, with the last payment made for each
+SELECT
+    b.id,
+    b.userId,
+    b.booking_type,
+    w.coach_type,
+    p.amount,
+    p.status AS payment_status,
+    p.gateway_payment_id
+FROM tatkal_waitlist w
+JOIN booking b ON b.id = w.booking_id
+LEFT JOIN LATERAL (
+    SELECT amount, status, gateway_payment_id
+    FROM payment
+    WHERE bookingId = b.id
+    ORDER BY id DESC
+    LIMIT 1
+) p ON true
+WHERE w.journey_id = $1
+  AND w.status = 'WAITING'
+  AND b.status = 'WAITLIST'
+ORDER BY w.id
+FOR UPDATE OF w, b;
+
+-- name: GetTatkalInventory :one
+-- the tatkal seats of a class and how many of them are free for the whole
+-- journey
+SELECT
+    COUNT(*) AS total,
+    COUNT(*) FILTER (WHERE (held_mask | confirmed_mask) = 0) AS available
+FROM seat_inventory
+WHERE journey_id = $1
+  AND coach_type = $2
+  AND quota = 'TATKAL';
+
+-- name: GetTatkalJourneyStatus :one
+-- the status of a journey whose train has tatkal configured for the class, no
+-- row when there is no such journey or class
+SELECT tj.status
+FROM train_journey tj
+JOIN tatkal_config tc ON tc.train_id = tj.train_id
+WHERE tj.id = $1
+  AND tc.coach_type = $2;
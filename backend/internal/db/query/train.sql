@@ -1,6 +1,6 @@
 -- name: CreateTrain :one
-INSERT into train(trainNumber,trainName,source,destination )
-VALUES ( $1 ,$2 ,$3,$4) 
+INSERT into train(trainNumber,trainName,source,destination,distance_km,is_superfast )
+VALUES ( $1 ,$2 ,$3,$4,$5,$6) 
 RETURNING *;
 
 -- name: CreateTrainSchedule :one
@@ -61,6 +61,22 @@ WHERE tj.train_id = sqlc.arg(train_id)
 GROUP BY si.coach_type
 ORDER BY si.coach_type;
 
+-- name: GetAvailabilityByJourneys :many
+SELECT
+    si.journey_id,
+    si.coach_type,
+    COUNT(*) FILTER (WHERE ((si.held_mask | si.confirmed_mask) & req.leg_mask) = 0) AS available_seats,
+    COUNT(*) AS total_seats
+FROM seat_inventory si
+JOIN (
+    SELECT
+        unnest(sqlc.arg(journey_ids)::int[]) AS journey_id,
+        unnest(sqlc.arg(leg_masks)::bigint[]) AS leg_mask
+) req ON req.journey_id = si.journey_id
+WHERE si.quota = sqlc.arg(quota)
+GROUP BY si.journey_id, si.coach_type
+ORDER BY si.journey_id, si.coach_type;
+
 
 -- SELECT *
 -- FROM get_available_seats(1, '2026-01-15');
@@ -88,38 +104,89 @@ SELECT COUNT(*) = $1::int as all_seat_belong,
 
 -- below are not applied till now
 
--- name: HoldSeat :exec
-UPDATE seat_inventory
-SET status = 'HELD',
-    booking_id = $3
-WHERE journey_id = $1
-  AND seat_id = $2
-  AND status = 'AVAILABLE';
+-- name: HoldSeat :execrows
+WITH held AS (
+    UPDATE seat_inventory
+    SET held_mask = held_mask | sqlc.arg(leg_mask)::bigint,
+        status = CASE WHEN confirmed_mask = 0 THEN 'HELD' ELSE status END
+    WHERE journey_id = sqlc.arg(journey_id)
+      AND seat_id = sqlc.arg(seat_id)
+      AND ((held_mask | confirmed_mask) & sqlc.arg(leg_mask)::bigint) = 0
+    RETURNING journey_id, seat_id
+)
+INSERT INTO seat_segment (journey_id, seat_id, booking_id, leg_mask, status)
+SELECT journey_id, seat_id, sqlc.arg(booking_id)::int, sqlc.arg(leg_mask)::bigint, 'HELD'
+FROM held;
 
 -- name: ConfirmSeat :exec
-UPDATE seat_inventory
-SET status = 'CONFIRMED'
-WHERE booking_id = $1
-AND status = 'HELD';
-
-
--- name: ReleaseExpiredSeats :exec
-UPDATE seat_inventory
-SET status = 'AVAILABLE',
-    booking_id = NULL
-WHERE status = 'HELD'
-AND booking_id IN (
-    SELECT id FROM booking
-    WHERE status = 'PENDING'
-    AND createdAt < now() - interval '5 minutes'
-);
+WITH confirmed AS (
+    UPDATE seat_segment
+    SET status = 'CONFIRMED'
+    WHERE booking_id = $1
+      AND status = 'HELD'
+    RETURNING journey_id, seat_id, leg_mask
+)
+UPDATE seat_inventory si
+SET held_mask = si.held_mask & ~c.leg_mask,
+    confirmed_mask = si.confirmed_mask | c.leg_mask,
+    status = 'CONFIRMED'
+FROM confirmed c
+WHERE si.journey_id = c.journey_id
+  AND si.seat_id = c.seat_id;
+
+-- name: GetSeatSummaryByBooking :many
+SELECT si.coach_type, COUNT(*) AS seats
+FROM seat_segment ss
+JOIN seat_inventory si ON si.journey_id = ss.journey_id AND si.seat_id = ss.seat_id
+WHERE ss.booking_id = $1
+GROUP BY si.coach_type;
 
 -- name: ReleaseSeatsByBooking :exec
-UPDATE seat_inventory
-SET status = 'AVAILABLE',
-    booking_id = NULL
-WHERE status = 'HELD'
-AND booking_id = $1;
+WITH released AS (
+    DELETE FROM seat_segment
+    WHERE booking_id = $1
+    RETURNING journey_id, seat_id, leg_mask
+)
+UPDATE seat_inventory si
+SET held_mask = si.held_mask & ~r.leg_mask,
+    confirmed_mask = si.confirmed_mask & ~r.leg_mask,
+    status = CASE
+        WHEN (si.confirmed_mask & ~r.leg_mask) <> 0 THEN 'CONFIRMED'
+        WHEN (si.held_mask & ~r.leg_mask) <> 0 THEN 'HELD'
+        ELSE 'AVAILABLE'
+    END
+FROM released r
+WHERE si.journey_id = r.journey_id
+  AND si.seat_id = r.seat_id;
+
+-- name: GetSeatSummaryBySeats :many
+SELECT si.coach_type, COUNT(*) AS seats
+FROM seat_segment ss
+JOIN seat_inventory si ON si.journey_id = ss.journey_id AND si.seat_id = ss.seat_id
+WHERE ss.booking_id = sqlc.arg(booking_id)
+  AND ss.seat_id = ANY(sqlc.arg(seat_ids)::int[])
+GROUP BY si.coach_type;
+
+-- name: ReleaseSeatsBySeats :execrows
+-- frees some of the seats of a booking and leaves the others held or sold.
+-- a seat that was already released is not counted.
+WITH released AS (
+    DELETE FROM seat_segment
+    WHERE booking_id = sqlc.arg(booking_id)
+      AND seat_id = ANY(sqlc.arg(seat_ids)::int[])
+    RETURNING journey_id, seat_id, leg_mask
+)
+UPDATE seat_inventory si
+SET held_mask = si.held_mask & ~r.leg_mask,
+    confirmed_mask = si.confirmed_mask & ~r.leg_mask,
+    status = CASE
+        WHEN (si.confirmed_mask & ~r.leg_mask) <> 0 THEN 'CONFIRMED'
+        WHEN (si.held_mask & ~r.leg_mask) <> 0 THEN 'HELD'
+        ELSE 'AVAILABLE'
+    END
+FROM released r
+WHERE si.journey_id = r.journey_id
+  AND si.seat_id = r.seat_id;
 
 -- name: GetNextCoachNumber :one
 SELECT COALESCE(MAX(coachNumber), 0) + 1
@@ -139,31 +206,90 @@ from train_journey
 where id = $1;
 
 -- name: LockAvailableSeats :many
+-- seats that are already sold for other legs come first, so untouched seats
+-- stay free for passengers travelling the whole route.
 SELECT seat_id
 FROM seat_inventory
 WHERE journey_id = sqlc.arg(journey_id)
   AND coach_type = sqlc.arg(coach_type)
   AND quota = sqlc.arg(quota)
-  AND status = 'AVAILABLE'
-ORDER BY seat_id
+  AND ((held_mask | confirmed_mask) & sqlc.arg(leg_mask)::bigint) = 0
+ORDER BY (held_mask | confirmed_mask) = 0, seat_id
 FOR UPDATE SKIP LOCKED
 LIMIT sqlc.arg(seat_limit);
 
+-- name: ListFreeSeats :many
+-- free seats of a class with where they are in the train, for the allocator to
+-- choose from. nothing is locked here, LockFreeSeats locks the chosen ones.
+SELECT
+    si.seat_id,
+    c.coachNumber AS coach_number,
+    s.seatNo AS seat_no,
+    s.berth,
+    ((si.held_mask | si.confirmed_mask) = 0)::boolean AS untouched
+FROM seat_inventory si
+JOIN seat s ON s.id = si.seat_id
+JOIN coach c ON c.id = s.coachId
+WHERE si.journey_id = sqlc.arg(journey_id)
+  AND si.coach_type = sqlc.arg(coach_type)
+  AND si.quota = sqlc.arg(quota)
+  AND ((si.held_mask | si.confirmed_mask) & sqlc.arg(leg_mask)::bigint) = 0
+ORDER BY c.coachNumber, s.seatNo;
+
+-- name: LockFreeSeats :many
+-- locks those of the given seats that are still free for the legs. a seat
+-- another booking has locked or taken since it was listed is left out.
+SELECT seat_id
+FROM seat_inventory
+WHERE journey_id = sqlc.arg(journey_id)
+  AND seat_id = ANY(sqlc.arg(seat_ids)::int[])
+  AND quota = sqlc.arg(quota)
+  AND ((held_mask | confirmed_mask) & sqlc.arg(leg_mask)::bigint) = 0
+FOR UPDATE SKIP LOCKED;
+
 -- name: GetCoachTypeByJourneyId :one
 select coach_type 
 from seat_inventory
 WHERE journey_id = $1;
 
 -- name: InitializeSeatInventory :exec
+-- side lower berths of SL and 3A go to the RAC quota. of the other seats of
+-- a class with tatkal configured, tatkal_percent (rounded down) go to the
+-- TATKAL quota, a berth number at a time across the coaches so that every
+-- coach has some.
+WITH seats AS (
+    SELECT
+        s.id,
+        s.seatNo,
+        c.coachNumber,
+        c.coachtype,
+        s.berth = 'SIDE_DOWN' AND c.coachtype IN ('SL', '3A') AS rac,
+        EXISTS (
+            SELECT 1 FROM tatkal_config tc
+            WHERE tc.train_id = c.trainId AND tc.coach_type = c.coachtype
+        ) AS tatkal
+    FROM seat s
+    JOIN coach c ON s.coachId = c.id
+    WHERE c.trainId = $2
+),
+ranked AS (
+    SELECT
+        seats.*,
+        ROW_NUMBER() OVER (PARTITION BY coachtype, rac ORDER BY seatNo, coachNumber) AS n,
+        COUNT(*) OVER (PARTITION BY coachtype, rac) AS total
+    FROM seats
+)
 INSERT INTO seat_inventory (journey_id, seat_id, coach_type, quota, status)
-SELECT 
-    $1,                   
-    s.id,
-    c.coachtype,
-    'NORMAL',              
+SELECT
+    $1,
+    r.id,
+    r.coachtype,
+    CASE
+        WHEN r.rac THEN 'RAC'
+        WHEN r.tatkal AND r.n <= FLOOR(r.total * sqlc.arg(tatkal_percent)::float / 100) THEN 'TATKAL'
+        ELSE 'NORMAL'
+    END::seat_quota,
     'AVAILABLE'
-FROM seat s
-JOIN coach c ON s.coachId = c.id
-WHERE c.trainId = $2;
+FROM ranked r;
 
 
@@ -13,9 +13,10 @@ INSERT INTO waitlist (
   journey_id,
   bookingId,
   waitlist_number,
+  coach_type,
   status
 )
-VALUES ($1, $2, $3, 'WAITING');
+VALUES ($1, $2, $3, $4, 'WAITING');
 
 -- name: GetNextWaitlist :one
 SELECT *
@@ -26,6 +27,29 @@ ORDER BY priority_level DESC, waitlist_number ASC
 LIMIT 1
 FOR UPDATE SKIP LOCKED;
 
+-- name: GetNextWaitlistByCoach :one
+SELECT *
+FROM waitlist
+WHERE journey_id = $1
+  AND coach_type = $2
+  AND status = 'WAITING'
+ORDER BY priority_level DESC, waitlist_number ASC
+LIMIT 1
+FOR UPDATE SKIP LOCKED;
+
+-- name: GetNextPaidWaitlistByCoach :one
+-- the next waitlisted booking of a class that has been paid for, only those
+-- are moved to RAC
+SELECT w.*
+FROM waitlist w
+WHERE w.journey_id = $1
+  AND w.coach_type = $2
+  AND w.status = 'WAITING'
+  AND EXISTS (SELECT 1 FROM payment p WHERE p.bookingId = w.bookingId AND p.status = 'SUCCESS')
+ORDER BY w.priority_level DESC, w.waitlist_number ASC
+LIMIT 1
+FOR UPDATE OF w SKIP LOCKED;
+
 -- name: GetWaitlistBatch :many
 SELECT *
 FROM waitlist
@@ -48,4 +72,44 @@ WHERE bookingId = $1;
 UPDATE waitlist
 SET status = $2,
     updatedAt = now()
-WHERE id = $1;
\ No newline at end of file
+WHERE id = $1;
+
+-- name: GetWaitlistByBooking :one
+-- position is counted within the class, which is waitlisted and promoted on
+-- its own. seats_ahead are the passengers of the bookings ahead.
+SELECT
+    w.waitlist_number,
+    w.status,
+    w.coach_type,
+    ((
+        SELECT COUNT(*)
+        FROM waitlist ahead
+        WHERE ahead.journey_id = w.journey_id
+          AND ahead.coach_type IS NOT DISTINCT FROM w.coach_type
+          AND ahead.status = 'WAITING'
+          AND (ahead.priority_level > w.priority_level
+               OR (ahead.priority_level = w.priority_level AND ahead.waitlist_number < w.waitlist_number))
+    ) + 1)::int AS position,
+    (
+        SELECT COUNT(*)
+        FROM waitlist ahead
+        JOIN booking_passenger bp ON bp.booking_id = ahead.bookingId
+        WHERE ahead.journey_id = w.journey_id
+          AND ahead.coach_type IS NOT DISTINCT FROM w.coach_type
+          AND ahead.status = 'WAITING'
+          AND (ahead.priority_level > w.priority_level
+               OR (ahead.priority_level = w.priority_level AND ahead.waitlist_number < w.waitlist_number))
+    )::int AS seats_ahead
+FROM waitlist w
+WHERE w.bookingId = $1
+ORDER BY w.id DESC
+LIMIT 1;
+
+-- name: GetWaitlistSeatsByJourneys :many
+SELECT w.journey_id, w.coach_type, COUNT(bp.id) AS seats
+FROM waitlist w
+JOIN booking_passenger bp ON bp.booking_id = w.bookingId
+WHERE w.journey_id = ANY(sqlc.arg(journey_ids)::int[])
+  AND w.status = 'WAITING'
+  AND w.coach_type IS NOT NULL
+GROUP BY w.journey_id, w.coach_type;
\ No newline at end of file
@@ -11,6 +11,37 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const cancelBookingItems = `-- name: CancelBookingItems :exec
+UPDATE bookingItem SET bookingStatus = 'CANCELLED'
+WHERE bookingId = $1
+  AND seatId = ANY($2::int[])
+`
+
+type CancelBookingItemsParams struct {
+	BookingID pgtype.Int4 `json:"booking_id"`
+	SeatIds   []int32     `json:"seat_ids"`
+}
+
+func (q *Queries) CancelBookingItems(ctx context.Context, arg CancelBookingItemsParams) error {
+	_, err := q.db.Exec(ctx, cancelBookingItems, arg.BookingID, arg.SeatIds)
+	return err
+}
+
+const confirmBookingItem = `-- name: ConfirmBookingItem :exec
+UPDATE bookingItem SET bookingStatus = 'CONFIRMED'
+WHERE bookingId = $1 AND seatId = $2
+`
+
+type ConfirmBookingItemParams struct {
+	Bookingid pgtype.Int4 `json:"bookingid"`
+	Seatid    pgtype.Int4 `json:"seatid"`
+}
+
+func (q *Queries) ConfirmBookingItem(ctx context.Context, arg ConfirmBookingItemParams) error {
+	_, err := q.db.Exec(ctx, confirmBookingItem, arg.Bookingid, arg.Seatid)
+	return err
+}
+
 const countActiveBookingByTrain = `-- name: CountActiveBookingByTrain :one
 SELECT COUNT(*)
 FROM booking
@@ -37,19 +68,31 @@ func (q *Queries) CountSeatsByBooking(ctx context.Context, bookingid pgtype.Int4
 }
 
 const createBooking = `-- name: CreateBooking :one
-INSERT INTO booking (userId, journey_id, booking_type, status, holdToken)
-VALUES ($1, $2, 'NORMAL', 'PENDING', $3)
-RETURNING id, userid, journey_id, booking_type, status, holdtoken, createdat
+INSERT INTO booking (userId, journey_id, booking_type, status, holdToken, pnr, from_station_id, to_station_id, leg_mask)
+VALUES ($1, $2, 'NORMAL', 'PENDING', $3, $4, $5, $6, $7)
+RETURNING id, userid, journey_id, booking_type, status, holdtoken, createdat, pnr, from_station_id, to_station_id, leg_mask, hold_started_at, failure_reason
 `
 
 type CreateBookingParams struct {
-	Userid    pgtype.UUID `json:"userid"`
-	JourneyID pgtype.Int4 `json:"journey_id"`
-	Holdtoken pgtype.Text `json:"holdtoken"`
+	Userid        pgtype.UUID `json:"userid"`
+	JourneyID     pgtype.Int4 `json:"journey_id"`
+	Holdtoken     pgtype.Text `json:"holdtoken"`
+	Pnr           pgtype.Text `json:"pnr"`
+	FromStationID pgtype.Int4 `json:"from_station_id"`
+	ToStationID   pgtype.Int4 `json:"to_station_id"`
+	LegMask       int64       `json:"leg_mask"`
 }
 
 func (q *Queries) CreateBooking(ctx context.Context, arg CreateBookingParams) (Booking, error) {
-	row := q.db.QueryRow(ctx, createBooking, arg.Userid, arg.JourneyID, arg.Holdtoken)
+	row := q.db.QueryRow(ctx, createBooking,
+		arg.Userid,
+		arg.JourneyID,
+		arg.Holdtoken,
+		arg.Pnr,
+		arg.FromStationID,
+		arg.ToStationID,
+		arg.LegMask,
+	)
 	var i Booking
 	err := row.Scan(
 		&i.ID,
@@ -59,6 +102,12 @@ func (q *Queries) CreateBooking(ctx context.Context, arg CreateBookingParams) (B
 		&i.Status,
 		&i.Holdtoken,
 		&i.Createdat,
+		&i.Pnr,
+		&i.FromStationID,
+		&i.ToStationID,
+		&i.LegMask,
+		&i.HoldStartedAt,
+		&i.FailureReason,
 	)
 	return i, err
 }
@@ -87,19 +136,27 @@ func (q *Queries) CreateBookingItem(ctx context.Context, arg CreateBookingItemPa
 }
 
 const createPayment = `-- name: CreatePayment :one
- INSERT into payment (bookingId,amount,transactionId)
- VALUES($1,$2,$3)
- RETURNING id, bookingid, amount, status, transactionid, createdat
+ INSERT into payment (bookingId,amount,transactionId,fare_breakdown,session_url)
+ VALUES($1,$2,$3,$4,$5)
+ RETURNING id, bookingid, amount, status, transactionid, createdat, fare_breakdown, gateway_payment_id, session_url
 `
 
 type CreatePaymentParams struct {
 	Bookingid     pgtype.Int4 `json:"bookingid"`
 	Amount        float64     `json:"amount"`
 	Transactionid string      `json:"transactionid"`
+	FareBreakdown []byte      `json:"fare_breakdown"`
+	SessionUrl    pgtype.Text `json:"session_url"`
 }
 
 func (q *Queries) CreatePayment(ctx context.Context, arg CreatePaymentParams) (Payment, error) {
-	row := q.db.QueryRow(ctx, createPayment, arg.Bookingid, arg.Amount, arg.Transactionid)
+	row := q.db.QueryRow(ctx, createPayment,
+		arg.Bookingid,
+		arg.Amount,
+		arg.Transactionid,
+		arg.FareBreakdown,
+		arg.SessionUrl,
+	)
 	var i Payment
 	err := row.Scan(
 		&i.ID,
@@ -108,6 +165,58 @@ func (q *Queries) CreatePayment(ctx context.Context, arg CreatePaymentParams) (P
 		&i.Status,
 		&i.Transactionid,
 		&i.Createdat,
+		&i.FareBreakdown,
+		&i.GatewayPaymentID,
+		&i.SessionUrl,
+	)
+	return i, err
+}
+
+const createQueuedBooking = `-- name: CreateQueuedBooking :one
+
+INSERT INTO booking (userId, journey_id, booking_type, status, holdToken, pnr, from_station_id, to_station_id, leg_mask)
+VALUES ($1, $2, $3, 'QUEUED', $4, $5, $6, $7, $8)
+RETURNING id, userid, journey_id, booking_type, status, holdtoken, createdat, pnr, from_station_id, to_station_id, leg_mask, hold_started_at, failure_reason
+`
+
+type CreateQueuedBookingParams struct {
+	Userid        pgtype.UUID `json:"userid"`
+	JourneyID     pgtype.Int4 `json:"journey_id"`
+	BookingType   BookingType `json:"booking_type"`
+	Holdtoken     pgtype.Text `json:"holdtoken"`
+	Pnr           pgtype.Text `json:"pnr"`
+	FromStationID pgtype.Int4 `json:"from_station_id"`
+	ToStationID   pgtype.Int4 `json:"to_station_id"`
+	LegMask       int64       `json:"leg_mask"`
+}
+
+// a tatkal or premium tatkal booking waiting for the worker to hold its seats
+func (q *Queries) CreateQueuedBooking(ctx context.Context, arg CreateQueuedBookingParams) (Booking, error) {
+	row := q.db.QueryRow(ctx, createQueuedBooking,
+		arg.Userid,
+		arg.JourneyID,
+		arg.BookingType,
+		arg.Holdtoken,
+		arg.Pnr,
+		arg.FromStationID,
+		arg.ToStationID,
+		arg.LegMask,
+	)
+	var i Booking
+	err := row.Scan(
+		&i.ID,
+		&i.Userid,
+		&i.JourneyID,
+		&i.BookingType,
+		&i.Status,
+		&i.Holdtoken,
+		&i.Createdat,
+		&i.Pnr,
+		&i.FromStationID,
+		&i.ToStationID,
+		&i.LegMask,
+		&i.HoldStartedAt,
+		&i.FailureReason,
 	)
 	return i, err
 }
@@ -164,20 +273,75 @@ func (q *Queries) DeleteBookingItemsByBooking(ctx context.Context, bookingid pgt
 	return err
 }
 
-const expireOldBooking = `-- name: ExpireOldBooking :exec
+const expireOldBooking = `-- name: ExpireOldBooking :many
+
 UPDATE booking
-SET status='EXPIRED'
- WHERE status='PENDING'
-   AND createdat < now() - INTERVAL '10 minutes'
+SET status = 'EXPIRED'
+WHERE id IN (
+    SELECT id FROM booking
+    WHERE status = 'PENDING'
+      AND COALESCE(hold_started_at, createdAt) < now() - make_interval(secs => $1::int)
+    ORDER BY COALESCE(hold_started_at, createdAt)
+    LIMIT $2::int
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING id, journey_id
 `
 
-func (q *Queries) ExpireOldBooking(ctx context.Context) error {
-	_, err := q.db.Exec(ctx, expireOldBooking)
-	return err
+type ExpireOldBookingParams struct {
+	TtlSeconds int32 `json:"ttl_seconds"`
+	BatchSize  int32 `json:"batch_size"`
+}
+
+type ExpireOldBookingRow struct {
+	ID        int32       `json:"id"`
+	JourneyID pgtype.Int4 `json:"journey_id"`
+}
+
+// SKIP LOCKED lets several replicas sweep at the same time without picking
+// the same booking, and leaves alone a booking a webhook is confirming.
+func (q *Queries) ExpireOldBooking(ctx context.Context, arg ExpireOldBookingParams) ([]ExpireOldBookingRow, error) {
+	rows, err := q.db.Query(ctx, expireOldBooking, arg.TtlSeconds, arg.BatchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ExpireOldBookingRow{}
+	for rows.Next() {
+		var i ExpireOldBookingRow
+		if err := rows.Scan(&i.ID, &i.JourneyID); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const failQueuedBooking = `-- name: FailQueuedBooking :execrows
+UPDATE booking
+SET status = 'FAILED',
+    failure_reason = $2
+WHERE id = $1 AND status = 'QUEUED'
+`
+
+type FailQueuedBookingParams struct {
+	ID            int32       `json:"id"`
+	FailureReason pgtype.Text `json:"failure_reason"`
+}
+
+func (q *Queries) FailQueuedBooking(ctx context.Context, arg FailQueuedBookingParams) (int64, error) {
+	result, err := q.db.Exec(ctx, failQueuedBooking, arg.ID, arg.FailureReason)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
 }
 
 const getActiveBookingByUser = `-- name: GetActiveBookingByUser :one
-SELECT id, userid, journey_id, booking_type, status, holdtoken, createdat
+SELECT id, userid, journey_id, booking_type, status, holdtoken, createdat, pnr, from_station_id, to_station_id, leg_mask, hold_started_at, failure_reason
 FROM booking
 WHERE userid = $1
   AND status = 'PENDING'
@@ -197,16 +361,22 @@ func (q *Queries) GetActiveBookingByUser(ctx context.Context, userid pgtype.UUID
 		&i.Status,
 		&i.Holdtoken,
 		&i.Createdat,
+		&i.Pnr,
+		&i.FromStationID,
+		&i.ToStationID,
+		&i.LegMask,
+		&i.HoldStartedAt,
+		&i.FailureReason,
 	)
 	return i, err
 }
 
 const getBookedSeats = `-- name: GetBookedSeats :many
-SELECT si.seat_id
-FROM seat_inventory si
-JOIN booking b ON si.booking_id = b.id
+SELECT DISTINCT ss.seat_id
+FROM seat_segment ss
+JOIN booking b ON ss.booking_id = b.id
 WHERE b.journey_id = $1
-  AND si.status IN ('HELD','CONFIRMED')
+  AND ss.status IN ('HELD','CONFIRMED')
 `
 
 func (q *Queries) GetBookedSeats(ctx context.Context, journeyID pgtype.Int4) ([]int32, error) {
@@ -230,7 +400,7 @@ func (q *Queries) GetBookedSeats(ctx context.Context, journeyID pgtype.Int4) ([]
 }
 
 const getBookingByHoldToken = `-- name: GetBookingByHoldToken :one
-SELECT id, userid, journey_id, booking_type, status, holdtoken, createdat FROM booking WHERE holdToken = $1
+SELECT id, userid, journey_id, booking_type, status, holdtoken, createdat, pnr, from_station_id, to_station_id, leg_mask, hold_started_at, failure_reason FROM booking WHERE holdToken = $1
 `
 
 func (q *Queries) GetBookingByHoldToken(ctx context.Context, holdtoken pgtype.Text) (Booking, error) {
@@ -244,12 +414,18 @@ func (q *Queries) GetBookingByHoldToken(ctx context.Context, holdtoken pgtype.Te
 		&i.Status,
 		&i.Holdtoken,
 		&i.Createdat,
+		&i.Pnr,
+		&i.FromStationID,
+		&i.ToStationID,
+		&i.LegMask,
+		&i.HoldStartedAt,
+		&i.FailureReason,
 	)
 	return i, err
 }
 
 const getBookingById = `-- name: GetBookingById :one
-SELECT id, userid, journey_id, booking_type, status, holdtoken, createdat from booking
+SELECT id, userid, journey_id, booking_type, status, holdtoken, createdat, pnr, from_station_id, to_station_id, leg_mask, hold_started_at, failure_reason from booking
 where id = $1
 `
 
@@ -264,6 +440,67 @@ func (q *Queries) GetBookingById(ctx context.Context, id int32) (Booking, error)
 		&i.Status,
 		&i.Holdtoken,
 		&i.Createdat,
+		&i.Pnr,
+		&i.FromStationID,
+		&i.ToStationID,
+		&i.LegMask,
+		&i.HoldStartedAt,
+		&i.FailureReason,
+	)
+	return i, err
+}
+
+const getBookingByPnr = `-- name: GetBookingByPnr :one
+SELECT
+    b.id,
+    b.journey_id,
+    b.booking_type,
+    b.status,
+    b.pnr,
+    b.createdAt,
+    tj.journey_date,
+    tj.status AS journey_status,
+    t.trainNumber,
+    t.trainName,
+    t.source,
+    t.destination
+FROM booking b
+JOIN train_journey tj ON tj.id = b.journey_id
+JOIN train t ON t.id = tj.train_id
+WHERE b.pnr = $1
+`
+
+type GetBookingByPnrRow struct {
+	ID            int32             `json:"id"`
+	JourneyID     pgtype.Int4       `json:"journey_id"`
+	BookingType   BookingType       `json:"booking_type"`
+	Status        BookingStatus     `json:"status"`
+	Pnr           pgtype.Text       `json:"pnr"`
+	Createdat     pgtype.Timestamp  `json:"createdat"`
+	JourneyDate   pgtype.Date       `json:"journey_date"`
+	JourneyStatus NullJourneyStatus `json:"journey_status"`
+	Trainnumber   int32             `json:"trainnumber"`
+	Trainname     string            `json:"trainname"`
+	Source        string            `json:"source"`
+	Destination   string            `json:"destination"`
+}
+
+func (q *Queries) GetBookingByPnr(ctx context.Context, pnr pgtype.Text) (GetBookingByPnrRow, error) {
+	row := q.db.QueryRow(ctx, getBookingByPnr, pnr)
+	var i GetBookingByPnrRow
+	err := row.Scan(
+		&i.ID,
+		&i.JourneyID,
+		&i.BookingType,
+		&i.Status,
+		&i.Pnr,
+		&i.Createdat,
+		&i.JourneyDate,
+		&i.JourneyStatus,
+		&i.Trainnumber,
+		&i.Trainname,
+		&i.Source,
+		&i.Destination,
 	)
 	return i, err
 }
@@ -295,10 +532,10 @@ func (q *Queries) GetBookingItemsByBooking(ctx context.Context, bookingid pgtype
 const getBookingLockContext = `-- name: GetBookingLockContext :many
 SELECT
     b.journey_id,
-    si.seat_id,
+    ss.seat_id,
     b.holdToken
 FROM booking b
-JOIN seat_inventory si ON si.booking_id = b.id
+JOIN seat_segment ss ON ss.booking_id = b.id
 WHERE b.id = $1
 `
 
@@ -329,7 +566,7 @@ func (q *Queries) GetBookingLockContext(ctx context.Context, id int32) ([]GetBoo
 }
 
 const getBookingbyUserId = `-- name: GetBookingbyUserId :many
-SELECT bi.id, bi.bookingid, bi.seatid, bi.bookingstatus , b.id, b.userid, b.journey_id, b.booking_type, b.status, b.holdtoken, b.createdat
+SELECT bi.id, bi.bookingid, bi.seatid, bi.bookingstatus , b.id, b.userid, b.journey_id, b.booking_type, b.status, b.holdtoken, b.createdat, b.pnr, b.from_station_id, b.to_station_id, b.leg_mask, b.hold_started_at, b.failure_reason
 FROM booking b 
 JOIN bookingItem bi 
 ON b.id = bi.bookingId
@@ -348,6 +585,12 @@ type GetBookingbyUserIdRow struct {
 	Status        BookingStatus    `json:"status"`
 	Holdtoken     pgtype.Text      `json:"holdtoken"`
 	Createdat     pgtype.Timestamp `json:"createdat"`
+	Pnr           pgtype.Text      `json:"pnr"`
+	FromStationID pgtype.Int4      `json:"from_station_id"`
+	ToStationID   pgtype.Int4      `json:"to_station_id"`
+	LegMask       int64            `json:"leg_mask"`
+	HoldStartedAt pgtype.Timestamp `json:"hold_started_at"`
+	FailureReason pgtype.Text      `json:"failure_reason"`
 }
 
 func (q *Queries) GetBookingbyUserId(ctx context.Context, userid pgtype.UUID) ([]GetBookingbyUserIdRow, error) {
@@ -371,6 +614,12 @@ func (q *Queries) GetBookingbyUserId(ctx context.Context, userid pgtype.UUID) ([
 			&i.Status,
 			&i.Holdtoken,
 			&i.Createdat,
+			&i.Pnr,
+			&i.FromStationID,
+			&i.ToStationID,
+			&i.LegMask,
+			&i.HoldStartedAt,
+			&i.FailureReason,
 		); err != nil {
 			return nil, err
 		}
@@ -382,6 +631,136 @@ func (q *Queries) GetBookingbyUserId(ctx context.Context, userid pgtype.UUID) ([
 	return items, nil
 }
 
+const getLatestPaymentByBooking = `-- name: GetLatestPaymentByBooking :one
+SELECT id, bookingid, amount, status, transactionid, createdat, fare_breakdown, gateway_payment_id, session_url FROM payment
+WHERE bookingId = $1
+ORDER BY id DESC
+LIMIT 1
+`
+
+func (q *Queries) GetLatestPaymentByBooking(ctx context.Context, bookingid pgtype.Int4) (Payment, error) {
+	row := q.db.QueryRow(ctx, getLatestPaymentByBooking, bookingid)
+	var i Payment
+	err := row.Scan(
+		&i.ID,
+		&i.Bookingid,
+		&i.Amount,
+		&i.Status,
+		&i.Transactionid,
+		&i.Createdat,
+		&i.FareBreakdown,
+		&i.GatewayPaymentID,
+		&i.SessionUrl,
+	)
+	return i, err
+}
+
+const holdPromotedBooking = `-- name: HoldPromotedBooking :exec
+
+UPDATE booking
+SET status = 'PENDING',
+    holdToken = $2,
+    hold_started_at = now()
+WHERE id = $1
+`
+
+type HoldPromotedBookingParams struct {
+	ID        int32       `json:"id"`
+	Holdtoken pgtype.Text `json:"holdtoken"`
+}
+
+// a waitlisted booking that got seats but is not paid for yet
+func (q *Queries) HoldPromotedBooking(ctx context.Context, arg HoldPromotedBookingParams) error {
+	_, err := q.db.Exec(ctx, holdPromotedBooking, arg.ID, arg.Holdtoken)
+	return err
+}
+
+const holdQueuedBooking = `-- name: HoldQueuedBooking :execrows
+
+UPDATE booking
+SET status = 'PENDING',
+    hold_started_at = now()
+WHERE id = $1 AND status = 'QUEUED'
+`
+
+// the worker got seats for a queued tatkal booking, it is paid for in the
+// hold TTL like any other
+func (q *Queries) HoldQueuedBooking(ctx context.Context, id int32) (int64, error) {
+	result, err := q.db.Exec(ctx, holdQueuedBooking, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const listBookingsByUser = `-- name: ListBookingsByUser :many
+SELECT id, userid, journey_id, booking_type, status, holdtoken, createdat, pnr, from_station_id, to_station_id, leg_mask, hold_started_at, failure_reason FROM booking
+WHERE userId = $1
+ORDER BY createdAt DESC
+`
+
+func (q *Queries) ListBookingsByUser(ctx context.Context, userid pgtype.UUID) ([]Booking, error) {
+	rows, err := q.db.Query(ctx, listBookingsByUser, userid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Booking{}
+	for rows.Next() {
+		var i Booking
+		if err := rows.Scan(
+			&i.ID,
+			&i.Userid,
+			&i.JourneyID,
+			&i.BookingType,
+			&i.Status,
+			&i.Holdtoken,
+			&i.Createdat,
+			&i.Pnr,
+			&i.FromStationID,
+			&i.ToStationID,
+			&i.LegMask,
+			&i.HoldStartedAt,
+			&i.FailureReason,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const pnrExists = `-- name: PnrExists :one
+SELECT EXISTS (SELECT 1 FROM booking WHERE pnr = $1)
+`
+
+func (q *Queries) PnrExists(ctx context.Context, pnr pgtype.Text) (bool, error) {
+	row := q.db.QueryRow(ctx, pnrExists, pnr)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
+const requeueFailedBooking = `-- name: RequeueFailedBooking :execrows
+
+UPDATE booking
+SET status = 'QUEUED',
+    failure_reason = NULL
+WHERE id = $1 AND status = 'FAILED'
+`
+
+// a failed tatkal booking whose job is replayed from the dead-letter topic
+func (q *Queries) RequeueFailedBooking(ctx context.Context, id int32) (int64, error) {
+	result, err := q.db.Exec(ctx, requeueFailedBooking, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const updateBookingItemStatus = `-- name: UpdateBookingItemStatus :exec
 UPDATE bookingItem SET bookingStatus = $2 WHERE bookingId = $1
 `
@@ -412,6 +791,35 @@ func (q *Queries) UpdateBookingStatus(ctx context.Context, arg UpdateBookingStat
 	return err
 }
 
+const updatePaymentGatewayID = `-- name: UpdatePaymentGatewayID :exec
+UPDATE payment SET gateway_payment_id = $2 WHERE bookingId = $1
+`
+
+type UpdatePaymentGatewayIDParams struct {
+	Bookingid        pgtype.Int4 `json:"bookingid"`
+	GatewayPaymentID pgtype.Text `json:"gateway_payment_id"`
+}
+
+func (q *Queries) UpdatePaymentGatewayID(ctx context.Context, arg UpdatePaymentGatewayIDParams) error {
+	_, err := q.db.Exec(ctx, updatePaymentGatewayID, arg.Bookingid, arg.GatewayPaymentID)
+	return err
+}
+
+const updatePaymentSession = `-- name: UpdatePaymentSession :exec
+UPDATE payment SET transactionId = $2, session_url = $3 WHERE bookingId = $1
+`
+
+type UpdatePaymentSessionParams struct {
+	Bookingid     pgtype.Int4 `json:"bookingid"`
+	Transactionid string      `json:"transactionid"`
+	SessionUrl    pgtype.Text `json:"session_url"`
+}
+
+func (q *Queries) UpdatePaymentSession(ctx context.Context, arg UpdatePaymentSessionParams) error {
+	_, err := q.db.Exec(ctx, updatePaymentSession, arg.Bookingid, arg.Transactionid, arg.SessionUrl)
+	return err
+}
+
 const updatePaymentStatus = `-- name: UpdatePaymentStatus :exec
 UPDATE payment SET status = $2 WHERE bookingId = $1
 `
@@ -425,3 +833,19 @@ func (q *Queries) UpdatePaymentStatus(ctx context.Context, arg UpdatePaymentStat
 	_, err := q.db.Exec(ctx, updatePaymentStatus, arg.Bookingid, arg.Status)
 	return err
 }
+
+const waitlistQueuedBooking = `-- name: WaitlistQueuedBooking :execrows
+
+UPDATE booking
+SET status = 'WAITLIST'
+WHERE id = $1 AND status = 'QUEUED'
+`
+
+// a queued tatkal booking that found no tatkal seat
+func (q *Queries) WaitlistQueuedBooking(ctx context.Context, id int32) (int64, error) {
+	result, err := q.db.Exec(ctx, waitlistQueuedBooking, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
@@ -7,21 +7,25 @@ package db
 
 import (
 	"context"
+	"time"
 
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
 const createRefund = `-- name: CreateRefund :one
-INSERT INTO refund (userId , bookingId , amount , status , createdAt, updatedAt) 
-VALUES ( $1 , $2 , $3 , $4 , now() , now() )
-RETURNING id, userid, bookingid, amount, status, createdat, updatedat
+INSERT INTO refund (userId , bookingId , amount , status , deduction_breakdown , payment_id , idempotency_key , createdAt, updatedAt) 
+VALUES ( $1 , $2 , $3 , $4 , $5 , $6 , $7 , now() , now() )
+RETURNING id, userid, bookingid, amount, status, createdat, updatedat, deduction_breakdown, payment_id, idempotency_key, gateway_refund_id, attempts, last_error, next_attempt_at
 `
 
 type CreateRefundParams struct {
-	Userid    pgtype.UUID  `json:"userid"`
-	Bookingid pgtype.Int4  `json:"bookingid"`
-	Amount    int32        `json:"amount"`
-	Status    RefundStatus `json:"status"`
+	Userid             pgtype.UUID  `json:"userid"`
+	Bookingid          pgtype.Int4  `json:"bookingid"`
+	Amount             int32        `json:"amount"`
+	Status             RefundStatus `json:"status"`
+	DeductionBreakdown []byte       `json:"deduction_breakdown"`
+	PaymentID          pgtype.Text  `json:"payment_id"`
+	IdempotencyKey     pgtype.Text  `json:"idempotency_key"`
 }
 
 func (q *Queries) CreateRefund(ctx context.Context, arg CreateRefundParams) (Refund, error) {
@@ -30,6 +34,9 @@ func (q *Queries) CreateRefund(ctx context.Context, arg CreateRefundParams) (Ref
 		arg.Bookingid,
 		arg.Amount,
 		arg.Status,
+		arg.DeductionBreakdown,
+		arg.PaymentID,
+		arg.IdempotencyKey,
 	)
 	var i Refund
 	err := row.Scan(
@@ -40,12 +47,82 @@ func (q *Queries) CreateRefund(ctx context.Context, arg CreateRefundParams) (Ref
 		&i.Status,
 		&i.Createdat,
 		&i.Updatedat,
+		&i.DeductionBreakdown,
+		&i.PaymentID,
+		&i.IdempotencyKey,
+		&i.GatewayRefundID,
+		&i.Attempts,
+		&i.LastError,
+		&i.NextAttemptAt,
+	)
+	return i, err
+}
+
+const getBookingDeparture = `-- name: GetBookingDeparture :one
+
+SELECT
+    tj.journey_date,
+    tj.status AS journey_status,
+    ts.departureTime AS origin_departure,
+    COALESCE(tr.departure_offset_min, 0)::int AS departure_offset_min
+FROM booking b
+JOIN train_journey tj ON tj.id = b.journey_id
+JOIN train_schedule ts ON ts.id = tj.schedule_id
+LEFT JOIN train_route tr ON tr.train_id = tj.train_id AND tr.station_id = b.from_station_id
+WHERE b.id = $1
+`
+
+type GetBookingDepartureRow struct {
+	JourneyDate        pgtype.Date       `json:"journey_date"`
+	JourneyStatus      NullJourneyStatus `json:"journey_status"`
+	OriginDeparture    time.Time         `json:"origin_departure"`
+	DepartureOffsetMin int32             `json:"departure_offset_min"`
+}
+
+// departure from the boarding station: the origin leaves at the schedule's
+// time on the journey date and the stop is departure_offset_min after that.
+// bookings without a boarding station are treated as boarding at the origin.
+func (q *Queries) GetBookingDeparture(ctx context.Context, id int32) (GetBookingDepartureRow, error) {
+	row := q.db.QueryRow(ctx, getBookingDeparture, id)
+	var i GetBookingDepartureRow
+	err := row.Scan(
+		&i.JourneyDate,
+		&i.JourneyStatus,
+		&i.OriginDeparture,
+		&i.DepartureOffsetMin,
+	)
+	return i, err
+}
+
+const getCancellationRule = `-- name: GetCancellationRule :one
+SELECT id, coach_type, booking_type, clerkage_per_passenger, deduction_48h_percent, deduction_12h_percent, deduction_4h_percent, refundable, updated_at FROM cancellation_rule
+WHERE coach_type = $1 AND booking_type = $2
+`
+
+type GetCancellationRuleParams struct {
+	CoachType   CoachType   `json:"coach_type"`
+	BookingType BookingType `json:"booking_type"`
+}
+
+func (q *Queries) GetCancellationRule(ctx context.Context, arg GetCancellationRuleParams) (CancellationRule, error) {
+	row := q.db.QueryRow(ctx, getCancellationRule, arg.CoachType, arg.BookingType)
+	var i CancellationRule
+	err := row.Scan(
+		&i.ID,
+		&i.CoachType,
+		&i.BookingType,
+		&i.ClerkagePerPassenger,
+		&i.Deduction48hPercent,
+		&i.Deduction12hPercent,
+		&i.Deduction4hPercent,
+		&i.Refundable,
+		&i.UpdatedAt,
 	)
 	return i, err
 }
 
 const getPaymentAndTrain = `-- name: GetPaymentAndTrain :one
-SELECT b.id, b.userid, b.journey_id, b.booking_type, b.status, b.holdtoken, b.createdat , p.id, p.bookingid, p.amount, p.status, p.transactionid, p.createdat
+SELECT b.id, b.userid, b.journey_id, b.booking_type, b.status, b.holdtoken, b.createdat, b.pnr, b.from_station_id, b.to_station_id, b.leg_mask, b.hold_started_at, b.failure_reason , p.id, p.bookingid, p.amount, p.status, p.transactionid, p.createdat, p.fare_breakdown, p.gateway_payment_id, p.session_url
 FROM
 booking b JOIN
 payment p ON b.id = p.bookingId
@@ -58,19 +135,28 @@ type GetPaymentAndTrainParams struct {
 }
 
 type GetPaymentAndTrainRow struct {
-	ID            int32             `json:"id"`
-	Userid        pgtype.UUID       `json:"userid"`
-	JourneyID     pgtype.Int4       `json:"journey_id"`
-	BookingType   BookingType       `json:"booking_type"`
-	Status        BookingStatus     `json:"status"`
-	Holdtoken     pgtype.Text       `json:"holdtoken"`
-	Createdat     pgtype.Timestamp  `json:"createdat"`
-	ID_2          int32             `json:"id_2"`
-	Bookingid     pgtype.Int4       `json:"bookingid"`
-	Amount        float64           `json:"amount"`
-	Status_2      NullPaymentStatus `json:"status_2"`
-	Transactionid string            `json:"transactionid"`
-	Createdat_2   pgtype.Timestamp  `json:"createdat_2"`
+	ID               int32             `json:"id"`
+	Userid           pgtype.UUID       `json:"userid"`
+	JourneyID        pgtype.Int4       `json:"journey_id"`
+	BookingType      BookingType       `json:"booking_type"`
+	Status           BookingStatus     `json:"status"`
+	Holdtoken        pgtype.Text       `json:"holdtoken"`
+	Createdat        pgtype.Timestamp  `json:"createdat"`
+	Pnr              pgtype.Text       `json:"pnr"`
+	FromStationID    pgtype.Int4       `json:"from_station_id"`
+	ToStationID      pgtype.Int4       `json:"to_station_id"`
+	LegMask          int64             `json:"leg_mask"`
+	HoldStartedAt    pgtype.Timestamp  `json:"hold_started_at"`
+	FailureReason    pgtype.Text       `json:"failure_reason"`
+	ID_2             int32             `json:"id_2"`
+	Bookingid        pgtype.Int4       `json:"bookingid"`
+	Amount           float64           `json:"amount"`
+	Status_2         NullPaymentStatus `json:"status_2"`
+	Transactionid    string            `json:"transactionid"`
+	Createdat_2      pgtype.Timestamp  `json:"createdat_2"`
+	FareBreakdown    []byte            `json:"fare_breakdown"`
+	GatewayPaymentID pgtype.Text       `json:"gateway_payment_id"`
+	SessionUrl       pgtype.Text       `json:"session_url"`
 }
 
 func (q *Queries) GetPaymentAndTrain(ctx context.Context, arg GetPaymentAndTrainParams) (GetPaymentAndTrainRow, error) {
@@ -84,12 +170,134 @@ func (q *Queries) GetPaymentAndTrain(ctx context.Context, arg GetPaymentAndTrain
 		&i.Status,
 		&i.Holdtoken,
 		&i.Createdat,
+		&i.Pnr,
+		&i.FromStationID,
+		&i.ToStationID,
+		&i.LegMask,
+		&i.HoldStartedAt,
+		&i.FailureReason,
 		&i.ID_2,
 		&i.Bookingid,
 		&i.Amount,
 		&i.Status_2,
 		&i.Transactionid,
 		&i.Createdat_2,
+		&i.FareBreakdown,
+		&i.GatewayPaymentID,
+		&i.SessionUrl,
+	)
+	return i, err
+}
+
+const getPaymentByBooking = `-- name: GetPaymentByBooking :one
+SELECT id, bookingid, amount, status, transactionid, createdat, fare_breakdown, gateway_payment_id, session_url FROM payment
+WHERE bookingId = $1 AND status = 'SUCCESS'
+`
+
+func (q *Queries) GetPaymentByBooking(ctx context.Context, bookingid pgtype.Int4) (Payment, error) {
+	row := q.db.QueryRow(ctx, getPaymentByBooking, bookingid)
+	var i Payment
+	err := row.Scan(
+		&i.ID,
+		&i.Bookingid,
+		&i.Amount,
+		&i.Status,
+		&i.Transactionid,
+		&i.Createdat,
+		&i.FareBreakdown,
+		&i.GatewayPaymentID,
+		&i.SessionUrl,
+	)
+	return i, err
+}
+
+const listCancellationRules = `-- name: ListCancellationRules :many
+SELECT id, coach_type, booking_type, clerkage_per_passenger, deduction_48h_percent, deduction_12h_percent, deduction_4h_percent, refundable, updated_at FROM cancellation_rule
+ORDER BY coach_type, booking_type
+`
+
+func (q *Queries) ListCancellationRules(ctx context.Context) ([]CancellationRule, error) {
+	rows, err := q.db.Query(ctx, listCancellationRules)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []CancellationRule{}
+	for rows.Next() {
+		var i CancellationRule
+		if err := rows.Scan(
+			&i.ID,
+			&i.CoachType,
+			&i.BookingType,
+			&i.ClerkagePerPassenger,
+			&i.Deduction48hPercent,
+			&i.Deduction12hPercent,
+			&i.Deduction4hPercent,
+			&i.Refundable,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const upsertCancellationRule = `-- name: UpsertCancellationRule :one
+INSERT INTO cancellation_rule (
+    coach_type,
+    booking_type,
+    clerkage_per_passenger,
+    deduction_48h_percent,
+    deduction_12h_percent,
+    deduction_4h_percent,
+    refundable
+)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+ON CONFLICT (coach_type, booking_type) DO UPDATE SET
+    clerkage_per_passenger = EXCLUDED.clerkage_per_passenger,
+    deduction_48h_percent = EXCLUDED.deduction_48h_percent,
+    deduction_12h_percent = EXCLUDED.deduction_12h_percent,
+    deduction_4h_percent = EXCLUDED.deduction_4h_percent,
+    refundable = EXCLUDED.refundable,
+    updated_at = now()
+RETURNING id, coach_type, booking_type, clerkage_per_passenger, deduction_48h_percent, deduction_12h_percent, deduction_4h_percent, refundable, updated_at
+`
+
+type UpsertCancellationRuleParams struct {
+	CoachType            CoachType   `json:"coach_type"`
+	BookingType          BookingType `json:"booking_type"`
+	ClerkagePerPassenger float64     `json:"clerkage_per_passenger"`
+	Deduction48hPercent  float64     `json:"deduction_48h_percent"`
+	Deduction12hPercent  float64     `json:"deduction_12h_percent"`
+	Deduction4hPercent   float64     `json:"deduction_4h_percent"`
+	Refundable           bool        `json:"refundable"`
+}
+
+func (q *Queries) UpsertCancellationRule(ctx context.Context, arg UpsertCancellationRuleParams) (CancellationRule, error) {
+	row := q.db.QueryRow(ctx, upsertCancellationRule,
+		arg.CoachType,
+		arg.BookingType,
+		arg.ClerkagePerPassenger,
+		arg.Deduction48hPercent,
+		arg.Deduction12hPercent,
+		arg.Deduction4hPercent,
+		arg.Refundable,
+	)
+	var i CancellationRule
+	err := row.Scan(
+		&i.ID,
+		&i.CoachType,
+		&i.BookingType,
+		&i.ClerkagePerPassenger,
+		&i.Deduction48hPercent,
+		&i.Deduction12hPercent,
+		&i.Deduction4hPercent,
+		&i.Refundable,
+		&i.UpdatedAt,
 	)
 	return i, err
 }
@@ -16,9 +16,11 @@ import (
 type BerthType string
 
 const (
-	BerthTypeUP   BerthType = "UP"
-	BerthTypeDOWN BerthType = "DOWN"
-	BerthTypeMID  BerthType = "MID"
+	BerthTypeUP       BerthType = "UP"
+	BerthTypeDOWN     BerthType = "DOWN"
+	BerthTypeMID      BerthType = "MID"
+	BerthTypeSIDEDOWN BerthType = "SIDE_DOWN"
+	BerthTypeSIDEUP   BerthType = "SIDE_UP"
 )
 
 func (e *BerthType) Scan(src interface{}) error {
@@ -61,9 +63,12 @@ type BookingStatus string
 const (
 	BookingStatusPENDING   BookingStatus = "PENDING"
 	BookingStatusCONFIRMED BookingStatus = "CONFIRMED"
+	BookingStatusRAC       BookingStatus = "RAC"
 	BookingStatusWAITLIST  BookingStatus = "WAITLIST"
 	BookingStatusCANCELLED BookingStatus = "CANCELLED"
 	BookingStatusEXPIRED   BookingStatus = "EXPIRED"
+	BookingStatusQUEUED    BookingStatus = "QUEUED"
+	BookingStatusFAILED    BookingStatus = "FAILED"
 )
 
 func (e *BookingStatus) Scan(src interface{}) error {
@@ -104,9 +109,10 @@ func (ns NullBookingStatus) Value() (driver.Value, error) {
 type BookingType string
 
 const (
-	BookingTypeNORMAL   BookingType = "NORMAL"
-	BookingTypeWAITLIST BookingType = "WAITLIST"
-	BookingTypeTATKAL   BookingType = "TATKAL"
+	BookingTypeNORMAL        BookingType = "NORMAL"
+	BookingTypeWAITLIST      BookingType = "WAITLIST"
+	BookingTypeTATKAL        BookingType = "TATKAL"
+	BookingTypePREMIUMTATKAL BookingType = "PREMIUM_TATKAL"
 )
 
 func (e *BookingType) Scan(src interface{}) error {
@@ -236,6 +242,48 @@ func (ns NullDayOfWeek) Value() (driver.Value, error) {
 	return string(ns.DayOfWeek), nil
 }
 
+type DeadLetterStatus string
+
+const (
+	DeadLetterStatusPENDING  DeadLetterStatus = "PENDING"
+	DeadLetterStatusREPLAYED DeadLetterStatus = "REPLAYED"
+)
+
+func (e *DeadLetterStatus) Scan(src interface{}) error {
+	switch s := src.(type) {
+	case []byte:
+		*e = DeadLetterStatus(s)
+	case string:
+		*e = DeadLetterStatus(s)
+	default:
+		return fmt.Errorf("unsupported scan type for DeadLetterStatus: %T", src)
+	}
+	return nil
+}
+
+type NullDeadLetterStatus struct {
+	DeadLetterStatus DeadLetterStatus `json:"dead_letter_status"`
+	Valid            bool             `json:"valid"` // Valid is true if DeadLetterStatus is not NULL
+}
+
+// Scan implements the Scanner interface.
+func (ns *NullDeadLetterStatus) Scan(value interface{}) error {
+	if value == nil {
+		ns.DeadLetterStatus, ns.Valid = "", false
+		return nil
+	}
+	ns.Valid = true
+	return ns.DeadLetterStatus.Scan(value)
+}
+
+// Value implements the driver Valuer interface.
+func (ns NullDeadLetterStatus) Value() (driver.Value, error) {
+	if !ns.Valid {
+		return nil, nil
+	}
+	return string(ns.DeadLetterStatus), nil
+}
+
 type JourneyStatus string
 
 const (
@@ -411,8 +459,10 @@ func (ns NullRefundStatus) Value() (driver.Value, error) {
 type SeatQuota string
 
 const (
-	SeatQuotaNORMAL SeatQuota = "NORMAL"
-	SeatQuotaTATKAL SeatQuota = "TATKAL"
+	SeatQuotaNORMAL  SeatQuota = "NORMAL"
+	SeatQuotaTATKAL  SeatQuota = "TATKAL"
+	SeatQuotaRAC     SeatQuota = "RAC"
+	SeatQuotaCURRENT SeatQuota = "CURRENT"
 )
 
 func (e *SeatQuota) Scan(src interface{}) error {
@@ -539,6 +589,7 @@ type WaitingStatus string
 
 const (
 	WaitingStatusWAITING   WaitingStatus = "WAITING"
+	WaitingStatusRAC       WaitingStatus = "RAC"
 	WaitingStatusCONFIRMED WaitingStatus = "CONFIRMED"
 	WaitingStatusCANCELLED WaitingStatus = "CANCELLED"
 )
@@ -579,23 +630,33 @@ func (ns NullWaitingStatus) Value() (driver.Value, error) {
 }
 
 type Booking struct {
-	ID          int32            `json:"id"`
-	Userid      pgtype.UUID      `json:"userid"`
-	JourneyID   pgtype.Int4      `json:"journey_id"`
-	BookingType BookingType      `json:"booking_type"`
-	Status      BookingStatus    `json:"status"`
-	Holdtoken   pgtype.Text      `json:"holdtoken"`
-	Createdat   pgtype.Timestamp `json:"createdat"`
+	ID            int32            `json:"id"`
+	Userid        pgtype.UUID      `json:"userid"`
+	JourneyID     pgtype.Int4      `json:"journey_id"`
+	BookingType   BookingType      `json:"booking_type"`
+	Status        BookingStatus    `json:"status"`
+	Holdtoken     pgtype.Text      `json:"holdtoken"`
+	Createdat     pgtype.Timestamp `json:"createdat"`
+	Pnr           pgtype.Text      `json:"pnr"`
+	FromStationID pgtype.Int4      `json:"from_station_id"`
+	ToStationID   pgtype.Int4      `json:"to_station_id"`
+	LegMask       int64            `json:"leg_mask"`
+	HoldStartedAt pgtype.Timestamp `json:"hold_started_at"`
+	FailureReason pgtype.Text      `json:"failure_reason"`
 }
 
 type BookingPassenger struct {
-	ID        int32            `json:"id"`
-	BookingID pgtype.Int4      `json:"booking_id"`
-	SeatID    pgtype.Int4      `json:"seat_id"`
-	Name      string           `json:"name"`
-	Age       int32            `json:"age"`
-	Gender    string           `json:"gender"`
-	CreatedAt pgtype.Timestamp `json:"created_at"`
+	ID              int32            `json:"id"`
+	BookingID       pgtype.Int4      `json:"booking_id"`
+	SeatID          pgtype.Int4      `json:"seat_id"`
+	Name            string           `json:"name"`
+	Age             int32            `json:"age"`
+	Gender          string           `json:"gender"`
+	IDProofType     pgtype.Text      `json:"id_proof_type"`
+	IDProofNumber   pgtype.Text      `json:"id_proof_number"`
+	CreatedAt       pgtype.Timestamp `json:"created_at"`
+	BerthPreference NullBerthType    `json:"berth_preference"`
+	CancelledAt     pgtype.Timestamp `json:"cancelled_at"`
 }
 
 type Bookingitem struct {
@@ -605,6 +666,29 @@ type Bookingitem struct {
 	Bookingstatus BookingStatus `json:"bookingstatus"`
 }
 
+type CancellationRule struct {
+	ID                   int32            `json:"id"`
+	CoachType            CoachType        `json:"coach_type"`
+	BookingType          BookingType      `json:"booking_type"`
+	ClerkagePerPassenger float64          `json:"clerkage_per_passenger"`
+	Deduction48hPercent  float64          `json:"deduction_48h_percent"`
+	Deduction12hPercent  float64          `json:"deduction_12h_percent"`
+	Deduction4hPercent   float64          `json:"deduction_4h_percent"`
+	Refundable           bool             `json:"refundable"`
+	UpdatedAt            pgtype.Timestamp `json:"updated_at"`
+}
+
+type CancellationStat struct {
+	TrainID        int32            `json:"train_id"`
+	CoachType      CoachType        `json:"coach_type"`
+	DaysLeft       int32            `json:"days_left"`
+	BookedSeats    int64            `json:"booked_seats"`
+	CancelledSeats int64            `json:"cancelled_seats"`
+	Waitlisted     int64            `json:"waitlisted"`
+	Cleared        int64            `json:"cleared"`
+	UpdatedAt      pgtype.Timestamp `json:"updated_at"`
+}
+
 type Coach struct {
 	ID          int32       `json:"id"`
 	Trainid     pgtype.Int4 `json:"trainid"`
@@ -612,23 +696,115 @@ type Coach struct {
 	Coachnumber int32       `json:"coachnumber"`
 }
 
+type DeadLetter struct {
+	ID               int32            `json:"id"`
+	Topic            string           `json:"topic"`
+	MessagePartition int32            `json:"message_partition"`
+	MessageOffset    int64            `json:"message_offset"`
+	MessageKey       pgtype.Text      `json:"message_key"`
+	Payload          string           `json:"payload"`
+	Error            string           `json:"error"`
+	Retryable        bool             `json:"retryable"`
+	Attempts         int32            `json:"attempts"`
+	Status           DeadLetterStatus `json:"status"`
+	FailedAt         pgtype.Timestamp `json:"failed_at"`
+	ReplayedAt       pgtype.Timestamp `json:"replayed_at"`
+	Createdat        pgtype.Timestamp `json:"createdat"`
+}
+
+type FareLock struct {
+	HoldToken     string           `json:"hold_token"`
+	BookingID     int32            `json:"booking_id"`
+	Amount        float64          `json:"amount"`
+	FareBreakdown []byte           `json:"fare_breakdown"`
+	CreatedAt     pgtype.Timestamp `json:"created_at"`
+}
+
+type FareRule struct {
+	ID                   int32            `json:"id"`
+	CoachType            CoachType        `json:"coach_type"`
+	BaseFarePerKm        float64          `json:"base_fare_per_km"`
+	MinDistanceKm        int32            `json:"min_distance_km"`
+	ReservationCharge    float64          `json:"reservation_charge"`
+	SuperfastCharge      float64          `json:"superfast_charge"`
+	TatkalPremiumPercent float64          `json:"tatkal_premium_percent"`
+	TatkalMinCharge      float64          `json:"tatkal_min_charge"`
+	TatkalMaxCharge      float64          `json:"tatkal_max_charge"`
+	GstPercent           float64          `json:"gst_percent"`
+	UpdatedAt            pgtype.Timestamp `json:"updated_at"`
+}
+
+type Outbox struct {
+	ID          int32            `json:"id"`
+	Topic       string           `json:"topic"`
+	MessageKey  string           `json:"message_key"`
+	Payload     []byte           `json:"payload"`
+	DedupKey    string           `json:"dedup_key"`
+	Attempts    int32            `json:"attempts"`
+	LastError   pgtype.Text      `json:"last_error"`
+	Createdat   pgtype.Timestamp `json:"createdat"`
+	PublishedAt pgtype.Timestamp `json:"published_at"`
+}
+
 type Payment struct {
-	ID            int32             `json:"id"`
-	Bookingid     pgtype.Int4       `json:"bookingid"`
-	Amount        float64           `json:"amount"`
-	Status        NullPaymentStatus `json:"status"`
-	Transactionid string            `json:"transactionid"`
-	Createdat     pgtype.Timestamp  `json:"createdat"`
+	ID               int32             `json:"id"`
+	Bookingid        pgtype.Int4       `json:"bookingid"`
+	Amount           float64           `json:"amount"`
+	Status           NullPaymentStatus `json:"status"`
+	Transactionid    string            `json:"transactionid"`
+	Createdat        pgtype.Timestamp  `json:"createdat"`
+	FareBreakdown    []byte            `json:"fare_breakdown"`
+	GatewayPaymentID pgtype.Text       `json:"gateway_payment_id"`
+	SessionUrl       pgtype.Text       `json:"session_url"`
+}
+
+type PremiumTatkalFare struct {
+	ID               int32            `json:"id"`
+	TrainID          int32            `json:"train_id"`
+	SeatsLeftPercent int32            `json:"seats_left_percent"`
+	FareMultiplier   float64          `json:"fare_multiplier"`
+	UpdatedAt        pgtype.Timestamp `json:"updated_at"`
+}
+
+type RacPassenger struct {
+	ID          int32            `json:"id"`
+	JourneyID   int32            `json:"journey_id"`
+	SeatID      int32            `json:"seat_id"`
+	CoachType   CoachType        `json:"coach_type"`
+	BookingID   int32            `json:"booking_id"`
+	PassengerID int32            `json:"passenger_id"`
+	LegMask     int64            `json:"leg_mask"`
+	RacNumber   int32            `json:"rac_number"`
+	Status      WaitingStatus    `json:"status"`
+	Createdat   pgtype.Timestamp `json:"createdat"`
+	Updatedat   pgtype.Timestamp `json:"updatedat"`
 }
 
 type Refund struct {
-	ID        int32            `json:"id"`
-	Userid    pgtype.UUID      `json:"userid"`
-	Bookingid pgtype.Int4      `json:"bookingid"`
-	Amount    int32            `json:"amount"`
-	Status    RefundStatus     `json:"status"`
-	Createdat pgtype.Timestamp `json:"createdat"`
-	Updatedat pgtype.Timestamp `json:"updatedat"`
+	ID                 int32            `json:"id"`
+	Userid             pgtype.UUID      `json:"userid"`
+	Bookingid          pgtype.Int4      `json:"bookingid"`
+	Amount             int32            `json:"amount"`
+	Status             RefundStatus     `json:"status"`
+	Createdat          pgtype.Timestamp `json:"createdat"`
+	Updatedat          pgtype.Timestamp `json:"updatedat"`
+	DeductionBreakdown []byte           `json:"deduction_breakdown"`
+	PaymentID          pgtype.Text      `json:"payment_id"`
+	IdempotencyKey     pgtype.Text      `json:"idempotency_key"`
+	GatewayRefundID    pgtype.Text      `json:"gateway_refund_id"`
+	Attempts           int32            `json:"attempts"`
+	LastError          pgtype.Text      `json:"last_error"`
+	NextAttemptAt      pgtype.Timestamp `json:"next_attempt_at"`
+}
+
+type ReservationChart struct {
+	JourneyID   int32            `json:"journey_id"`
+	CoachID     int32            `json:"coach_id"`
+	CoachNumber int32            `json:"coach_number"`
+	CoachType   CoachType        `json:"coach_type"`
+	Chart       []byte           `json:"chart"`
+	ChartCsv    string           `json:"chart_csv"`
+	CreatedAt   pgtype.Timestamp `json:"created_at"`
 }
 
 type Seat struct {
@@ -639,12 +815,31 @@ type Seat struct {
 }
 
 type SeatInventory struct {
-	JourneyID int32       `json:"journey_id"`
-	SeatID    int32       `json:"seat_id"`
-	CoachType CoachType   `json:"coach_type"`
-	Quota     SeatQuota   `json:"quota"`
-	Status    SeatStatus  `json:"status"`
-	BookingID pgtype.Int4 `json:"booking_id"`
+	JourneyID     int32       `json:"journey_id"`
+	SeatID        int32       `json:"seat_id"`
+	CoachType     CoachType   `json:"coach_type"`
+	Quota         SeatQuota   `json:"quota"`
+	Status        SeatStatus  `json:"status"`
+	BookingID     pgtype.Int4 `json:"booking_id"`
+	HeldMask      int64       `json:"held_mask"`
+	ConfirmedMask int64       `json:"confirmed_mask"`
+}
+
+type SeatSegment struct {
+	JourneyID int32            `json:"journey_id"`
+	SeatID    int32            `json:"seat_id"`
+	BookingID int32            `json:"booking_id"`
+	LegMask   int64            `json:"leg_mask"`
+	Status    SeatStatus       `json:"status"`
+	CreatedAt pgtype.Timestamp `json:"created_at"`
+}
+
+type Station struct {
+	ID        int32            `json:"id"`
+	Code      string           `json:"code"`
+	Name      string           `json:"name"`
+	Zone      pgtype.Text      `json:"zone"`
+	CreatedAt pgtype.Timestamp `json:"created_at"`
 }
 
 type TatkalConfig struct {
@@ -665,6 +860,8 @@ type TatkalWaitlist struct {
 	WlPosition int32             `json:"wl_position"`
 	Status     NullWaitingStatus `json:"status"`
 	CreatedAt  pgtype.Timestamp  `json:"created_at"`
+	BookingID  pgtype.Int4       `json:"booking_id"`
+	UpdatedAt  pgtype.Timestamp  `json:"updated_at"`
 }
 
 type Train struct {
@@ -673,6 +870,8 @@ type Train struct {
 	Trainname   string `json:"trainname"`
 	Source      string `json:"source"`
 	Destination string `json:"destination"`
+	DistanceKm  int32  `json:"distance_km"`
+	IsSuperfast bool   `json:"is_superfast"`
 }
 
 type TrainJourney struct {
@@ -684,6 +883,17 @@ type TrainJourney struct {
 	CreatedAt   pgtype.Timestamp  `json:"created_at"`
 }
 
+type TrainRoute struct {
+	ID                 int32 `json:"id"`
+	TrainID            int32 `json:"train_id"`
+	StationID          int32 `json:"station_id"`
+	StopSequence       int32 `json:"stop_sequence"`
+	ArrivalOffsetMin   int32 `json:"arrival_offset_min"`
+	DepartureOffsetMin int32 `json:"departure_offset_min"`
+	DayNumber          int32 `json:"day_number"`
+	DistanceKm         int32 `json:"distance_km"`
+}
+
 type TrainSchedule struct {
 	ID            int32       `json:"id"`
 	Trainid       pgtype.Int4 `json:"trainid"`
@@ -713,4 +923,5 @@ type Waitlist struct {
 	PriorityLevel  pgtype.Int4      `json:"priority_level"`
 	Createdat      pgtype.Timestamp `json:"createdat"`
 	Updatedat      pgtype.Timestamp `json:"updatedat"`
+	CoachType      NullCoachType    `json:"coach_type"`
 }
@@ -12,16 +12,42 @@ import (
 )
 
 type Querier interface {
+	CancelBookingItems(ctx context.Context, arg CancelBookingItemsParams) error
+	// marks the passengers of a booking on the given seats, or with the given
+	// ids, cancelled. passengers cancelled before keep the time they were.
+	CancelPassengers(ctx context.Context, arg CancelPassengersParams) error
+	// a passenger that was already cancelled or confirmed is not counted
+	CancelRacPassengers(ctx context.Context, arg CancelRacPassengersParams) (int64, error)
+	CancelTatkalWaitlist(ctx context.Context, bookingID pgtype.Int4) (int64, error)
 	CancelWaitlist(ctx context.Context, bookingid pgtype.Int4) error
-	ConfirmSeat(ctx context.Context, bookingID pgtype.Int4) error
+	ConfirmBookingItem(ctx context.Context, arg ConfirmBookingItemParams) error
+	ConfirmRacPassenger(ctx context.Context, id int32) error
+	ConfirmSeat(ctx context.Context, bookingID int32) error
 	CountActiveBookingByTrain(ctx context.Context, journeyID pgtype.Int4) (int64, error)
+	// journeys whose bookings are mapped onto the current route: open for booking, or holding any booking
+	CountJourneysOnRoute(ctx context.Context, trainID pgtype.Int4) (int64, error)
+	CountPassengersByBooking(ctx context.Context, bookingID pgtype.Int4) (int64, error)
+	CountRacByBooking(ctx context.Context, bookingID int32) (int64, error)
 	CountSeatsByBooking(ctx context.Context, bookingid pgtype.Int4) (int64, error)
 	CreateBooking(ctx context.Context, arg CreateBookingParams) (Booking, error)
 	CreateBookingItem(ctx context.Context, arg CreateBookingItemParams) (Bookingitem, error)
+	CreateBookingPassenger(ctx context.Context, arg CreateBookingPassengerParams) (BookingPassenger, error)
 	CreateCoach(ctx context.Context, arg CreateCoachParams) (Coach, error)
+	// The same message can be dead-lettered twice if the consumer restarts before
+	// committing its offset, keep the first copy.
+	CreateDeadLetter(ctx context.Context, arg CreateDeadLetterParams) error
+	CreateFareLock(ctx context.Context, arg CreateFareLockParams) error
+	// an event is queued at most once per dedup key, so a retried request does
+	// not announce the same change twice
+	CreateOutboxEvent(ctx context.Context, arg CreateOutboxEventParams) error
 	CreatePayment(ctx context.Context, arg CreatePaymentParams) (Payment, error)
+	// a tatkal or premium tatkal booking waiting for the worker to hold its seats
+	CreateQueuedBooking(ctx context.Context, arg CreateQueuedBookingParams) (Booking, error)
+	CreateRacPassenger(ctx context.Context, arg CreateRacPassengerParams) error
 	CreateRefund(ctx context.Context, arg CreateRefundParams) (Refund, error)
+	CreateRouteStop(ctx context.Context, arg CreateRouteStopParams) (TrainRoute, error)
 	CreateSeat(ctx context.Context, arg CreateSeatParams) (Seat, error)
+	CreateStation(ctx context.Context, arg CreateStationParams) (Station, error)
 	CreateTrain(ctx context.Context, arg CreateTrainParams) (Train, error)
 	CreateTrainJourney(ctx context.Context, arg CreateTrainJourneyParams) (TrainJourney, error)
 	CreateTrainSchedule(ctx context.Context, arg CreateTrainScheduleParams) (TrainSchedule, error)
@@ -29,51 +55,203 @@ type Querier interface {
 	CurrentAvailableSeats(ctx context.Context, arg CurrentAvailableSeatsParams) ([]int32, error)
 	DeleteBookingItem(ctx context.Context, bookingid pgtype.Int4) error
 	DeleteBookingItemsByBooking(ctx context.Context, bookingid pgtype.Int4) error
+	DeletePremiumTatkalFares(ctx context.Context, trainID int32) error
+	DeletePublishedOutbox(ctx context.Context, retentionHours int32) error
+	DeleteTrainRoute(ctx context.Context, trainID int32) error
 	DeleteWaitlist(ctx context.Context, bookingid pgtype.Int4) error
-	ExpireOldBooking(ctx context.Context) error
+	// SKIP LOCKED lets several replicas sweep at the same time without picking
+	// the same booking, and leaves alone a booking a webhook is confirming.
+	ExpireOldBooking(ctx context.Context, arg ExpireOldBookingParams) ([]ExpireOldBookingRow, error)
+	FailQueuedBooking(ctx context.Context, arg FailQueuedBookingParams) (int64, error)
 	FindOrCreateUser(ctx context.Context, arg FindOrCreateUserParams) (FindOrCreateUserRow, error)
+	// moves every seat of a journey into the CURRENT quota, except RAC berths
+	// still shared by RAC passengers, which are not tracked in the seat masks
+	FreezeSeatInventory(ctx context.Context, journeyID int32) (int64, error)
 	GetActiveBookingByUser(ctx context.Context, userid pgtype.UUID) (Booking, error)
 	GetAllTrain(ctx context.Context) ([]GetAllTrainRow, error)
+	GetAvailabilityByJourneys(ctx context.Context, arg GetAvailabilityByJourneysParams) ([]GetAvailabilityByJourneysRow, error)
 	GetAvailableSeats(ctx context.Context, arg GetAvailableSeatsParams) ([]GetAvailableSeatsRow, error)
 	GetBookedSeats(ctx context.Context, journeyID pgtype.Int4) ([]int32, error)
 	GetBookingByHoldToken(ctx context.Context, holdtoken pgtype.Text) (Booking, error)
 	GetBookingById(ctx context.Context, id int32) (Booking, error)
+	GetBookingByPnr(ctx context.Context, pnr pgtype.Text) (GetBookingByPnrRow, error)
+	// departure from the boarding station: the origin leaves at the schedule's
+	// time on the journey date and the stop is departure_offset_min after that.
+	// bookings without a boarding station are treated as boarding at the origin.
+	GetBookingDeparture(ctx context.Context, id int32) (GetBookingDepartureRow, error)
 	GetBookingItemsByBooking(ctx context.Context, bookingid pgtype.Int4) ([]pgtype.Int4, error)
 	GetBookingLockContext(ctx context.Context, id int32) ([]GetBookingLockContextRow, error)
 	GetBookingbyUserId(ctx context.Context, userid pgtype.UUID) ([]GetBookingbyUserIdRow, error)
+	GetCancellationRule(ctx context.Context, arg GetCancellationRuleParams) (CancellationRule, error)
+	GetCancellationStats(ctx context.Context, arg GetCancellationStatsParams) ([]CancellationStat, error)
+	GetCancellationStatsByTrains(ctx context.Context, trainIds []int32) ([]CancellationStat, error)
+	// everyone travelling on a journey, on a seat of their own or on RAC, in
+	// coach and berth order
+	GetChartPassengers(ctx context.Context, journeyID int32) ([]GetChartPassengersRow, error)
 	GetCoachTypeByJourneyId(ctx context.Context, journeyID int32) (CoachType, error)
+	GetCoachTypesByJourney(ctx context.Context, journeyID int32) ([]CoachType, error)
 	GetCoachesByTrain(ctx context.Context, trainid pgtype.Int4) ([]Coach, error)
+	GetDeadLetter(ctx context.Context, id int32) (DeadLetter, error)
+	GetFareLock(ctx context.Context, holdToken string) (FareLock, error)
+	GetFareRule(ctx context.Context, coachType CoachType) (FareRule, error)
+	GetLatestPaymentByBooking(ctx context.Context, bookingid pgtype.Int4) (Payment, error)
 	GetNextCoachNumber(ctx context.Context, trainid pgtype.Int4) (int, error)
+	// the next waitlisted booking of a class that has been paid for, only those
+	// are moved to RAC
+	GetNextPaidWaitlistByCoach(ctx context.Context, arg GetNextPaidWaitlistByCoachParams) (Waitlist, error)
+	GetNextRacNumber(ctx context.Context, arg GetNextRacNumberParams) (int32, error)
+	// the RAC passenger of a paid booking that is confirmed next
+	GetNextRacPassenger(ctx context.Context, arg GetNextRacPassengerParams) (GetNextRacPassengerRow, error)
+	GetNextTatkalWaitlist(ctx context.Context, arg GetNextTatkalWaitlistParams) (TatkalWaitlist, error)
 	GetNextWaitlist(ctx context.Context, journeyID pgtype.Int4) (Waitlist, error)
+	GetNextWaitlistByCoach(ctx context.Context, arg GetNextWaitlistByCoachParams) (Waitlist, error)
 	GetNextWaitlistNumber(ctx context.Context, journeyID pgtype.Int4) (int, error)
+	GetPassengersByBooking(ctx context.Context, bookingID pgtype.Int4) ([]GetPassengersByBookingRow, error)
 	GetPaymentAndTrain(ctx context.Context, arg GetPaymentAndTrainParams) (GetPaymentAndTrainRow, error)
+	GetPaymentByBooking(ctx context.Context, bookingid pgtype.Int4) (Payment, error)
+	GetPendingBookingsByJourney(ctx context.Context, journeyID pgtype.Int4) ([]int32, error)
+	// plain FOR UPDATE rather than SKIP LOCKED: a second relay waits for the first
+	// one instead of publishing newer events ahead of older ones
+	GetPendingOutbox(ctx context.Context, limit int32) ([]Outbox, error)
+	// SKIP LOCKED lets several workers process refunds at the same time without
+	// sending the same one twice.
+	GetPendingRefunds(ctx context.Context, limit int32) ([]Refund, error)
+	GetRacPassengersByBooking(ctx context.Context, bookingID int32) ([]int32, error)
+	GetRacSummaryByBooking(ctx context.Context, bookingID int32) ([]GetRacSummaryByBookingRow, error)
+	GetRacSummaryByPassengers(ctx context.Context, arg GetRacSummaryByPassengersParams) ([]GetRacSummaryByPassengersRow, error)
+	GetRefundByGatewayID(ctx context.Context, gatewayRefundID pgtype.Text) (Refund, error)
+	GetRouteSegment(ctx context.Context, arg GetRouteSegmentParams) (GetRouteSegmentRow, error)
+	GetSeatSummaryByBooking(ctx context.Context, bookingID int32) ([]GetSeatSummaryByBookingRow, error)
+	GetSeatSummaryBySeats(ctx context.Context, arg GetSeatSummaryBySeatsParams) ([]GetSeatSummaryBySeatsRow, error)
 	GetSeatsByCoach(ctx context.Context, coachid pgtype.Int4) ([]Seat, error)
 	GetSeatsByTrain(ctx context.Context, trainid pgtype.Int4) ([]Seat, error)
+	GetStationByCode(ctx context.Context, code string) (Station, error)
+	// the tatkal seats of a class and how many of them are free for the whole
+	// journey
+	GetTatkalInventory(ctx context.Context, arg GetTatkalInventoryParams) (GetTatkalInventoryRow, error)
+	// the status of a journey whose train has tatkal configured for the class, no
+	// row when there is no such journey or class
+	GetTatkalJourneyStatus(ctx context.Context, arg GetTatkalJourneyStatusParams) (NullJourneyStatus, error)
+	// bookings still on the tatkal waitlist, with the last payment made for each
+	GetTatkalWaitingBookingsByJourney(ctx context.Context, journeyID pgtype.Int4) ([]GetTatkalWaitingBookingsByJourneyRow, error)
+	// position is counted among the places still waiting in the class
+	GetTatkalWaitlistByBooking(ctx context.Context, bookingID pgtype.Int4) (GetTatkalWaitlistByBookingRow, error)
 	GetTrainById(ctx context.Context, id int32) (Train, error)
 	GetTrainJourneyById(ctx context.Context, id int32) (TrainJourney, error)
+	GetTrainRoute(ctx context.Context, trainID int32) ([]GetTrainRouteRow, error)
 	GetTrainScheduleByDay(ctx context.Context, arg GetTrainScheduleByDayParams) (TrainSchedule, error)
+	// bookings on RAC that were never paid for
+	GetUnpaidRacBookingsByJourney(ctx context.Context, journeyID pgtype.Int4) ([]int32, error)
 	GetUserByEmail(ctx context.Context, email string) (User, error)
 	GetUserByID(ctx context.Context, id uuid.UUID) (User, error)
+	// bookings still on the waitlist, with the last payment made for each
+	GetWaitingBookingsByJourney(ctx context.Context, journeyID pgtype.Int4) ([]GetWaitingBookingsByJourneyRow, error)
 	GetWaitlistBatch(ctx context.Context, arg GetWaitlistBatchParams) ([]Waitlist, error)
+	// position is counted within the class, which is waitlisted and promoted on
+	// its own. seats_ahead are the passengers of the bookings ahead.
+	GetWaitlistByBooking(ctx context.Context, bookingid pgtype.Int4) (GetWaitlistByBookingRow, error)
+	GetWaitlistSeatsByJourneys(ctx context.Context, journeyIds []int32) ([]GetWaitlistSeatsByJourneysRow, error)
+	// a waitlisted booking that got seats but is not paid for yet
+	HoldPromotedBooking(ctx context.Context, arg HoldPromotedBookingParams) error
+	// the worker got seats for a queued tatkal booking, it is paid for in the
+	// hold TTL like any other
+	HoldQueuedBooking(ctx context.Context, id int32) (int64, error)
 	// below are not applied till now
-	HoldSeat(ctx context.Context, arg HoldSeatParams) error
+	HoldSeat(ctx context.Context, arg HoldSeatParams) (int64, error)
+	// side lower berths of SL and 3A go to the RAC quota. of the other seats of
+	// a class with tatkal configured, tatkal_percent (rounded down) go to the
+	// TATKAL quota, a berth number at a time across the coaches so that every
+	// coach has some.
 	InitializeSeatInventory(ctx context.Context, arg InitializeSeatInventoryParams) error
+	InsertPremiumTatkalFare(ctx context.Context, arg InsertPremiumTatkalFareParams) (PremiumTatkalFare, error)
+	// gives a booking the next position on the tatkal waitlist of its class. a
+	// user keeps one place per journey: a place of theirs that was confirmed or
+	// cancelled is taken over, one still waiting returns no row.
+	InsertTatkalWaitlist(ctx context.Context, arg InsertTatkalWaitlistParams) (TatkalWaitlist, error)
 	InsertWaitlist(ctx context.Context, arg InsertWaitlistParams) error
+	ListBookingsByUser(ctx context.Context, userid pgtype.UUID) ([]Booking, error)
+	ListCancellationRules(ctx context.Context) ([]CancellationRule, error)
+	ListDeadLetters(ctx context.Context, arg ListDeadLettersParams) ([]DeadLetter, error)
+	ListFareRules(ctx context.Context) ([]FareRule, error)
+	// free seats of a class with where they are in the train, for the allocator to
+	// choose from. nothing is locked here, LockFreeSeats locks the chosen ones.
+	ListFreeSeats(ctx context.Context, arg ListFreeSeatsParams) ([]ListFreeSeatsRow, error)
+	// open journeys up to a date, with the time their train leaves its origin to
+	// tell which are due
+	ListJourneysToChart(ctx context.Context, journeyDate pgtype.Date) ([]ListJourneysToChartRow, error)
+	ListPremiumTatkalFares(ctx context.Context, trainID int32) ([]PremiumTatkalFare, error)
+	ListRefundsByUser(ctx context.Context, userid pgtype.UUID) ([]ListRefundsByUserRow, error)
+	ListReservationCharts(ctx context.Context, journeyID int32) ([]ReservationChart, error)
+	ListStations(ctx context.Context) ([]Station, error)
+	// free tatkal seats per class of the open journeys whose tatkal window opens
+	// by warm_until and has not closed at now. a seat counts when it is free for
+	// the whole journey.
+	ListTatkalCounters(ctx context.Context, arg ListTatkalCountersParams) ([]ListTatkalCountersRow, error)
+	// seats that are already sold for other legs come first, so untouched seats
+	// stay free for passengers travelling the whole route.
 	LockAvailableSeats(ctx context.Context, arg LockAvailableSeatsParams) ([]int32, error)
+	// locks those of the given seats that are still free for the legs. a seat
+	// another booking has locked or taken since it was listed is left out.
+	LockFreeSeats(ctx context.Context, arg LockFreeSeatsParams) ([]int32, error)
+	LockJourneyForCharting(ctx context.Context, id int32) (NullJourneyStatus, error)
+	// locks the RAC berths of a class and returns how many more passengers each
+	// can take on the given legs. a berth is shared by two.
+	LockRacBerths(ctx context.Context, arg LockRacBerthsParams) ([]LockRacBerthsRow, error)
+	// serialises handing out positions on the tatkal waitlist of a journey and
+	// class until the transaction ends
+	LockTatkalWaitlist(ctx context.Context, arg LockTatkalWaitlistParams) error
 	LockTrainForLayout(ctx context.Context, id int32) (int32, error)
-	ReleaseExpiredSeats(ctx context.Context) error
-	ReleaseSeatsByBooking(ctx context.Context, bookingID pgtype.Int4) error
+	MarkDeadLetterReplayed(ctx context.Context, id int32) error
+	MarkJourneyCharted(ctx context.Context, id int32) error
+	MarkOutboxFailed(ctx context.Context, arg MarkOutboxFailedParams) error
+	MarkOutboxPublished(ctx context.Context, id int32) error
+	MarkRefundFailed(ctx context.Context, arg MarkRefundFailedParams) error
+	// the gateway could not be reached or refused for now, try again later
+	MarkRefundRetry(ctx context.Context, arg MarkRefundRetryParams) error
+	MarkRefundSubmitted(ctx context.Context, arg MarkRefundSubmittedParams) error
+	PnrExists(ctx context.Context, pnr pgtype.Text) (bool, error)
+	// rebuilds the statistics from journeys that have run. seats count once
+	// booked, cancellations by the hours to departure their refund was worked out
+	// with, and a waitlisted booking cleared once it left the waitlist for RAC or
+	// a seat.
+	RefreshCancellationStats(ctx context.Context) (int64, error)
+	// an unpaid booking gives its RAC places back
+	ReleaseRacByBooking(ctx context.Context, bookingID int32) error
+	ReleaseSeatsByBooking(ctx context.Context, bookingID int32) error
+	// frees some of the seats of a booking and leaves the others held or sold.
+	// a seat that was already released is not counted.
+	ReleaseSeatsBySeats(ctx context.Context, arg ReleaseSeatsBySeatsParams) (int64, error)
+	// a failed tatkal booking whose job is replayed from the dead-letter topic
+	RequeueFailedBooking(ctx context.Context, id int32) (int64, error)
+	SaveReservationChart(ctx context.Context, arg SaveReservationChartParams) error
+	// a train serves the search when it stops at both stations in order. The
+	// journey is looked up by the date it left its origin, which is earlier than
+	// the travel date when the boarding station is reached on a later day.
+	SearchTrains(ctx context.Context, arg SearchTrainsParams) ([]SearchTrainsRow, error)
+	// only a PENDING refund is settled, so a late or repeated webhook does not
+	// undo an earlier outcome
+	SettleRefund(ctx context.Context, arg SettleRefundParams) (int64, error)
 	UpdateBookingItemStatus(ctx context.Context, arg UpdateBookingItemStatusParams) error
 	UpdateBookingStatus(ctx context.Context, arg UpdateBookingStatusParams) error
+	UpdatePassengerSeat(ctx context.Context, arg UpdatePassengerSeatParams) error
+	UpdatePaymentGatewayID(ctx context.Context, arg UpdatePaymentGatewayIDParams) error
+	UpdatePaymentSession(ctx context.Context, arg UpdatePaymentSessionParams) error
 	UpdatePaymentStatus(ctx context.Context, arg UpdatePaymentStatusParams) error
+	UpdateStation(ctx context.Context, arg UpdateStationParams) (Station, error)
+	UpdateTatkalWaitlistStatus(ctx context.Context, arg UpdateTatkalWaitlistStatusParams) error
+	UpdateTrainRouteSummary(ctx context.Context, arg UpdateTrainRouteSummaryParams) error
 	UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) error
 	UpdateWaitlistStatus(ctx context.Context, arg UpdateWaitlistStatusParams) error
+	UpsertCancellationRule(ctx context.Context, arg UpsertCancellationRuleParams) (CancellationRule, error)
+	UpsertFareRule(ctx context.Context, arg UpsertFareRuleParams) (FareRule, error)
 	ValidateSchedule(ctx context.Context, arg ValidateScheduleParams) (int64, error)
 	ValidateSeatsBelongToTrain(ctx context.Context, arg ValidateSeatsBelongToTrainParams) (ValidateSeatsBelongToTrainRow, error)
 	ValidateTatkalWindow(ctx context.Context, trainID pgtype.Int4) (TatkalConfig, error)
 	// SELECT *
 	// FROM get_available_seats(1, '2026-01-15');
 	ValidateTrain(ctx context.Context, id int32) (int64, error)
+	// a queued tatkal booking that found no tatkal seat
+	WaitlistQueuedBooking(ctx context.Context, id int32) (int64, error)
 }
 
 var _ Querier = (*Queries)(nil)
@@ -8,9 +8,358 @@ package db
 import (
 	"context"
 
+	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const cancelTatkalWaitlist = `-- name: CancelTatkalWaitlist :execrows
+UPDATE tatkal_waitlist
+SET status = 'CANCELLED',
+    updated_at = now()
+WHERE booking_id = $1
+  AND status = 'WAITING'
+`
+
+func (q *Queries) CancelTatkalWaitlist(ctx context.Context, bookingID pgtype.Int4) (int64, error) {
+	result, err := q.db.Exec(ctx, cancelTatkalWaitlist, bookingID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const getNextTatkalWaitlist = `-- name: GetNextTatkalWaitlist :one
+SELECT id, user_id, coach_type, journey_id, wl_position, status, created_at, booking_id, updated_at
+FROM tatkal_waitlist
+WHERE journey_id = $1
+  AND coach_type = $2
+  AND status = 'WAITING'
+ORDER BY wl_position
+LIMIT 1
+FOR UPDATE SKIP LOCKED
+`
+
+type GetNextTatkalWaitlistParams struct {
+	JourneyID pgtype.Int4 `json:"journey_id"`
+	CoachType CoachType   `json:"coach_type"`
+}
+
+func (q *Queries) GetNextTatkalWaitlist(ctx context.Context, arg GetNextTatkalWaitlistParams) (TatkalWaitlist, error) {
+	row := q.db.QueryRow(ctx, getNextTatkalWaitlist, arg.JourneyID, arg.CoachType)
+	var i TatkalWaitlist
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.CoachType,
+		&i.JourneyID,
+		&i.WlPosition,
+		&i.Status,
+		&i.CreatedAt,
+		&i.BookingID,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const getTatkalInventory = `-- name: GetTatkalInventory :one
+
+SELECT
+    COUNT(*) AS total,
+    COUNT(*) FILTER (WHERE (held_mask | confirmed_mask) = 0) AS available
+FROM seat_inventory
+WHERE journey_id = $1
+  AND coach_type = $2
+  AND quota = 'TATKAL'
+`
+
+type GetTatkalInventoryParams struct {
+	JourneyID int32     `json:"journey_id"`
+	CoachType CoachType `json:"coach_type"`
+}
+
+type GetTatkalInventoryRow struct {
+	Total     int64 `json:"total"`
+	Available int64 `json:"available"`
+}
+
+// the tatkal seats of a class and how many of them are free for the whole
+// journey
+func (q *Queries) GetTatkalInventory(ctx context.Context, arg GetTatkalInventoryParams) (GetTatkalInventoryRow, error) {
+	row := q.db.QueryRow(ctx, getTatkalInventory, arg.JourneyID, arg.CoachType)
+	var i GetTatkalInventoryRow
+	err := row.Scan(&i.Total, &i.Available)
+	return i, err
+}
+
+const getTatkalJourneyStatus = `-- name: GetTatkalJourneyStatus :one
+
+SELECT tj.status
+FROM train_journey tj
+JOIN tatkal_config tc ON tc.train_id = tj.train_id
+WHERE tj.id = $1
+  AND tc.coach_type = $2
+`
+
+type GetTatkalJourneyStatusParams struct {
+	ID        int32     `json:"id"`
+	CoachType CoachType `json:"coach_type"`
+}
+
+// the status of a journey whose train has tatkal configured for the class, no
+// row when there is no such journey or class
+func (q *Queries) GetTatkalJourneyStatus(ctx context.Context, arg GetTatkalJourneyStatusParams) (NullJourneyStatus, error) {
+	row := q.db.QueryRow(ctx, getTatkalJourneyStatus, arg.ID, arg.CoachType)
+	var status NullJourneyStatus
+	err := row.Scan(&status)
+	return status, err
+}
+
+const getTatkalWaitingBookingsByJourney = `-- name: GetTatkalWaitingBookingsByJourney :many
+
+SELECT
+    b.id,
+    b.userId,
+    b.booking_type,
+    w.coach_type,
+    p.amount,
+    p.status AS payment_status,
+    p.gateway_payment_id
+FROM tatkal_waitlist w
+JOIN booking b ON b.id = w.booking_id
+LEFT JOIN LATERAL (
+    SELECT amount, status, gateway_payment_id
+    FROM payment
+    WHERE bookingId = b.id
+    ORDER BY id DESC
+    LIMIT 1
+) p ON true
+WHERE w.journey_id = $1
+  AND w.status = 'WAITING'
+  AND b.status = 'WAITLIST'
+ORDER BY w.id
+FOR UPDATE OF w, b
+`
+
+type GetTatkalWaitingBookingsByJourneyRow struct {
+	ID               int32             `json:"id"`
+	Userid           pgtype.UUID       `json:"userid"`
+	BookingType      BookingType       `json:"booking_type"`
+	CoachType        CoachType         `json:"coach_type"`
+	Amount           pgtype.Float8     `json:"amount"`
+	PaymentStatus    NullPaymentStatus `json:"payment_status"`
+	GatewayPaymentID pgtype.Text       `json:"gateway_payment_id"`
+}
+
+// bookings still on the tatkal waitlist, with the last payment made for each
+func (q *Queries) GetTatkalWaitingBookingsByJourney(ctx context.Context, journeyID pgtype.Int4) ([]GetTatkalWaitingBookingsByJourneyRow, error) {
+	rows, err := q.db.Query(ctx, getTatkalWaitingBookingsByJourney, journeyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []GetTatkalWaitingBookingsByJourneyRow{}
+	for rows.Next() {
+		var i GetTatkalWaitingBookingsByJourneyRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Userid,
+			&i.BookingType,
+			&i.CoachType,
+			&i.Amount,
+			&i.PaymentStatus,
+			&i.GatewayPaymentID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getTatkalWaitlistByBooking = `-- name: GetTatkalWaitlistByBooking :one
+
+SELECT
+    w.wl_position,
+    w.status,
+    w.coach_type,
+    ((
+        SELECT COUNT(*)
+        FROM tatkal_waitlist ahead
+        WHERE ahead.journey_id = w.journey_id
+          AND ahead.coach_type = w.coach_type
+          AND ahead.status = 'WAITING'
+          AND ahead.wl_position < w.wl_position
+    ) + 1)::int AS position
+FROM tatkal_waitlist w
+WHERE w.booking_id = $1
+`
+
+type GetTatkalWaitlistByBookingRow struct {
+	WlPosition int32             `json:"wl_position"`
+	Status     NullWaitingStatus `json:"status"`
+	CoachType  CoachType         `json:"coach_type"`
+	Position   int32             `json:"position"`
+}
+
+// position is counted among the places still waiting in the class
+func (q *Queries) GetTatkalWaitlistByBooking(ctx context.Context, bookingID pgtype.Int4) (GetTatkalWaitlistByBookingRow, error) {
+	row := q.db.QueryRow(ctx, getTatkalWaitlistByBooking, bookingID)
+	var i GetTatkalWaitlistByBookingRow
+	err := row.Scan(
+		&i.WlPosition,
+		&i.Status,
+		&i.CoachType,
+		&i.Position,
+	)
+	return i, err
+}
+
+const insertTatkalWaitlist = `-- name: InsertTatkalWaitlist :one
+
+INSERT INTO tatkal_waitlist (user_id, coach_type, journey_id, booking_id, wl_position, status)
+SELECT $1, $2, $3, $4, COALESCE(MAX(wl_position), 0) + 1, 'WAITING'
+FROM tatkal_waitlist
+WHERE journey_id = $3
+  AND coach_type = $2
+ON CONFLICT (user_id, journey_id) DO UPDATE
+SET coach_type = EXCLUDED.coach_type,
+    booking_id = EXCLUDED.booking_id,
+    wl_position = EXCLUDED.wl_position,
+    status = 'WAITING',
+    created_at = now(),
+    updated_at = now()
+WHERE tatkal_waitlist.status <> 'WAITING'
+RETURNING id, user_id, coach_type, journey_id, wl_position, status, created_at, booking_id, updated_at
+`
+
+type InsertTatkalWaitlistParams struct {
+	UserID    uuid.UUID   `json:"user_id"`
+	CoachType CoachType   `json:"coach_type"`
+	JourneyID pgtype.Int4 `json:"journey_id"`
+	BookingID pgtype.Int4 `json:"booking_id"`
+}
+
+// gives a booking the next position on the tatkal waitlist of its class. a
+// user keeps one place per journey: a place of theirs that was confirmed or
+// cancelled is taken over, one still waiting returns no row.
+func (q *Queries) InsertTatkalWaitlist(ctx context.Context, arg InsertTatkalWaitlistParams) (TatkalWaitlist, error) {
+	row := q.db.QueryRow(ctx, insertTatkalWaitlist,
+		arg.UserID,
+		arg.CoachType,
+		arg.JourneyID,
+		arg.BookingID,
+	)
+	var i TatkalWaitlist
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.CoachType,
+		&i.JourneyID,
+		&i.WlPosition,
+		&i.Status,
+		&i.CreatedAt,
+		&i.BookingID,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const listTatkalCounters = `-- name: ListTatkalCounters :many
+
+SELECT
+    si.journey_id,
+    si.coach_type,
+    tc.tatkal_end_time,
+    COUNT(*) FILTER (WHERE (si.held_mask | si.confirmed_mask) = 0) AS available
+FROM tatkal_config tc
+JOIN train_journey tj ON tj.train_id = tc.train_id
+JOIN seat_inventory si ON si.journey_id = tj.id AND si.coach_type = tc.coach_type
+WHERE tc.tatkal_start_time <= $1
+  AND tc.tatkal_end_time > $2
+  AND tj.status = 'OPEN'
+  AND tj.journey_date >= CURRENT_DATE
+  AND si.quota = 'TATKAL'
+GROUP BY si.journey_id, si.coach_type, tc.tatkal_end_time
+ORDER BY si.journey_id, si.coach_type
+`
+
+type ListTatkalCountersParams struct {
+	WarmUntil pgtype.Timestamp `json:"warm_until"`
+	Now       pgtype.Timestamp `json:"now"`
+}
+
+type ListTatkalCountersRow struct {
+	JourneyID     int32            `json:"journey_id"`
+	CoachType     CoachType        `json:"coach_type"`
+	TatkalEndTime pgtype.Timestamp `json:"tatkal_end_time"`
+	Available     int64            `json:"available"`
+}
+
+// free tatkal seats per class of the open journeys whose tatkal window opens
+// by warm_until and has not closed at now. a seat counts when it is free for
+// the whole journey.
+func (q *Queries) ListTatkalCounters(ctx context.Context, arg ListTatkalCountersParams) ([]ListTatkalCountersRow, error) {
+	rows, err := q.db.Query(ctx, listTatkalCounters, arg.WarmUntil, arg.Now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListTatkalCountersRow{}
+	for rows.Next() {
+		var i ListTatkalCountersRow
+		if err := rows.Scan(
+			&i.JourneyID,
+			&i.CoachType,
+			&i.TatkalEndTime,
+			&i.Available,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const lockTatkalWaitlist = `-- name: LockTatkalWaitlist :exec
+
+SELECT pg_advisory_xact_lock($1::int, hashtext($2::text))
+`
+
+type LockTatkalWaitlistParams struct {
+	JourneyID int32  `json:"journey_id"`
+	CoachType string `json:"coach_type"`
+}
+
+// serialises handing out positions on the tatkal waitlist of a journey and
+// class until the transaction ends
+func (q *Queries) LockTatkalWaitlist(ctx context.Context, arg LockTatkalWaitlistParams) error {
+	_, err := q.db.Exec(ctx, lockTatkalWaitlist, arg.JourneyID, arg.CoachType)
+	return err
+}
+
+const updateTatkalWaitlistStatus = `-- name: UpdateTatkalWaitlistStatus :exec
+UPDATE tatkal_waitlist
+SET status = $2,
+    updated_at = now()
+WHERE id = $1
+`
+
+type UpdateTatkalWaitlistStatusParams struct {
+	ID     int32             `json:"id"`
+	Status NullWaitingStatus `json:"status"`
+}
+
+func (q *Queries) UpdateTatkalWaitlistStatus(ctx context.Context, arg UpdateTatkalWaitlistStatusParams) error {
+	_, err := q.db.Exec(ctx, updateTatkalWaitlistStatus, arg.ID, arg.Status)
+	return err
+}
+
 const validateTatkalWindow = `-- name: ValidateTatkalWindow :one
 SELECT id, train_id, coach_type, tatkal_start_time, tatkal_end_time, created_at, updated_at from 
 tatkal_config
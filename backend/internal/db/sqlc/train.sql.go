@@ -13,13 +13,23 @@ import (
 )
 
 const confirmSeat = `-- name: ConfirmSeat :exec
-UPDATE seat_inventory
-SET status = 'CONFIRMED'
-WHERE booking_id = $1
-AND status = 'HELD'
+WITH confirmed AS (
+    UPDATE seat_segment
+    SET status = 'CONFIRMED'
+    WHERE booking_id = $1
+      AND status = 'HELD'
+    RETURNING journey_id, seat_id, leg_mask
+)
+UPDATE seat_inventory si
+SET held_mask = si.held_mask & ~c.leg_mask,
+    confirmed_mask = si.confirmed_mask | c.leg_mask,
+    status = 'CONFIRMED'
+FROM confirmed c
+WHERE si.journey_id = c.journey_id
+  AND si.seat_id = c.seat_id
 `
 
-func (q *Queries) ConfirmSeat(ctx context.Context, bookingID pgtype.Int4) error {
+func (q *Queries) ConfirmSeat(ctx context.Context, bookingID int32) error {
 	_, err := q.db.Exec(ctx, confirmSeat, bookingID)
 	return err
 }
@@ -69,9 +79,9 @@ func (q *Queries) CreateSeat(ctx context.Context, arg CreateSeatParams) (Seat, e
 }
 
 const createTrain = `-- name: CreateTrain :one
-INSERT into train(trainNumber,trainName,source,destination )
-VALUES ( $1 ,$2 ,$3,$4) 
-RETURNING id, trainnumber, trainname, source, destination
+INSERT into train(trainNumber,trainName,source,destination,distance_km,is_superfast )
+VALUES ( $1 ,$2 ,$3,$4,$5,$6) 
+RETURNING id, trainnumber, trainname, source, destination, distance_km, is_superfast
 `
 
 type CreateTrainParams struct {
@@ -79,6 +89,8 @@ type CreateTrainParams struct {
 	Trainname   string `json:"trainname"`
 	Source      string `json:"source"`
 	Destination string `json:"destination"`
+	DistanceKm  int32  `json:"distance_km"`
+	IsSuperfast bool   `json:"is_superfast"`
 }
 
 func (q *Queries) CreateTrain(ctx context.Context, arg CreateTrainParams) (Train, error) {
@@ -87,6 +99,8 @@ func (q *Queries) CreateTrain(ctx context.Context, arg CreateTrainParams) (Train
 		arg.Trainname,
 		arg.Source,
 		arg.Destination,
+		arg.DistanceKm,
+		arg.IsSuperfast,
 	)
 	var i Train
 	err := row.Scan(
@@ -95,6 +109,8 @@ func (q *Queries) CreateTrain(ctx context.Context, arg CreateTrainParams) (Train
 		&i.Trainname,
 		&i.Source,
 		&i.Destination,
+		&i.DistanceKm,
+		&i.IsSuperfast,
 	)
 	return i, err
 }
@@ -162,7 +178,7 @@ func (q *Queries) CreateTrainSchedule(ctx context.Context, arg CreateTrainSchedu
 }
 
 const getAllTrain = `-- name: GetAllTrain :many
-SELECT t.id, t.trainnumber, t.trainname, t.source, t.destination , ts.id, ts.trainid, ts.day, ts.arrivaltime, ts.departuretime
+SELECT t.id, t.trainnumber, t.trainname, t.source, t.destination, t.distance_km, t.is_superfast , ts.id, ts.trainid, ts.day, ts.arrivaltime, ts.departuretime
 FROM train t
 JOIN train_schedule ts ON t.id = ts.trainid
 `
@@ -173,6 +189,8 @@ type GetAllTrainRow struct {
 	Trainname     string      `json:"trainname"`
 	Source        string      `json:"source"`
 	Destination   string      `json:"destination"`
+	DistanceKm    int32       `json:"distance_km"`
+	IsSuperfast   bool        `json:"is_superfast"`
 	ID_2          int32       `json:"id_2"`
 	Trainid       pgtype.Int4 `json:"trainid"`
 	Day           DayOfWeek   `json:"day"`
@@ -195,6 +213,8 @@ func (q *Queries) GetAllTrain(ctx context.Context) ([]GetAllTrainRow, error) {
 			&i.Trainname,
 			&i.Source,
 			&i.Destination,
+			&i.DistanceKm,
+			&i.IsSuperfast,
 			&i.ID_2,
 			&i.Trainid,
 			&i.Day,
@@ -211,6 +231,61 @@ func (q *Queries) GetAllTrain(ctx context.Context) ([]GetAllTrainRow, error) {
 	return items, nil
 }
 
+const getAvailabilityByJourneys = `-- name: GetAvailabilityByJourneys :many
+SELECT
+    si.journey_id,
+    si.coach_type,
+    COUNT(*) FILTER (WHERE ((si.held_mask | si.confirmed_mask) & req.leg_mask) = 0) AS available_seats,
+    COUNT(*) AS total_seats
+FROM seat_inventory si
+JOIN (
+    SELECT
+        unnest($1::int[]) AS journey_id,
+        unnest($2::bigint[]) AS leg_mask
+) req ON req.journey_id = si.journey_id
+WHERE si.quota = $3
+GROUP BY si.journey_id, si.coach_type
+ORDER BY si.journey_id, si.coach_type
+`
+
+type GetAvailabilityByJourneysParams struct {
+	JourneyIds []int32   `json:"journey_ids"`
+	LegMasks   []int64   `json:"leg_masks"`
+	Quota      SeatQuota `json:"quota"`
+}
+
+type GetAvailabilityByJourneysRow struct {
+	JourneyID      int32     `json:"journey_id"`
+	CoachType      CoachType `json:"coach_type"`
+	AvailableSeats int64     `json:"available_seats"`
+	TotalSeats     int64     `json:"total_seats"`
+}
+
+func (q *Queries) GetAvailabilityByJourneys(ctx context.Context, arg GetAvailabilityByJourneysParams) ([]GetAvailabilityByJourneysRow, error) {
+	rows, err := q.db.Query(ctx, getAvailabilityByJourneys, arg.JourneyIds, arg.LegMasks, arg.Quota)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []GetAvailabilityByJourneysRow{}
+	for rows.Next() {
+		var i GetAvailabilityByJourneysRow
+		if err := rows.Scan(
+			&i.JourneyID,
+			&i.CoachType,
+			&i.AvailableSeats,
+			&i.TotalSeats,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getAvailableSeats = `-- name: GetAvailableSeats :many
 SELECT
     si.coach_type,
@@ -319,6 +394,78 @@ func (q *Queries) GetNextCoachNumber(ctx context.Context, trainid pgtype.Int4) (
 	return column_1, err
 }
 
+const getSeatSummaryByBooking = `-- name: GetSeatSummaryByBooking :many
+SELECT si.coach_type, COUNT(*) AS seats
+FROM seat_segment ss
+JOIN seat_inventory si ON si.journey_id = ss.journey_id AND si.seat_id = ss.seat_id
+WHERE ss.booking_id = $1
+GROUP BY si.coach_type
+`
+
+type GetSeatSummaryByBookingRow struct {
+	CoachType CoachType `json:"coach_type"`
+	Seats     int64     `json:"seats"`
+}
+
+func (q *Queries) GetSeatSummaryByBooking(ctx context.Context, bookingID int32) ([]GetSeatSummaryByBookingRow, error) {
+	rows, err := q.db.Query(ctx, getSeatSummaryByBooking, bookingID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []GetSeatSummaryByBookingRow{}
+	for rows.Next() {
+		var i GetSeatSummaryByBookingRow
+		if err := rows.Scan(&i.CoachType, &i.Seats); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getSeatSummaryBySeats = `-- name: GetSeatSummaryBySeats :many
+SELECT si.coach_type, COUNT(*) AS seats
+FROM seat_segment ss
+JOIN seat_inventory si ON si.journey_id = ss.journey_id AND si.seat_id = ss.seat_id
+WHERE ss.booking_id = $1
+  AND ss.seat_id = ANY($2::int[])
+GROUP BY si.coach_type
+`
+
+type GetSeatSummaryBySeatsParams struct {
+	BookingID int32   `json:"booking_id"`
+	SeatIds   []int32 `json:"seat_ids"`
+}
+
+type GetSeatSummaryBySeatsRow struct {
+	CoachType CoachType `json:"coach_type"`
+	Seats     int64     `json:"seats"`
+}
+
+func (q *Queries) GetSeatSummaryBySeats(ctx context.Context, arg GetSeatSummaryBySeatsParams) ([]GetSeatSummaryBySeatsRow, error) {
+	rows, err := q.db.Query(ctx, getSeatSummaryBySeats, arg.BookingID, arg.SeatIds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []GetSeatSummaryBySeatsRow{}
+	for rows.Next() {
+		var i GetSeatSummaryBySeatsRow
+		if err := rows.Scan(&i.CoachType, &i.Seats); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getSeatsByCoach = `-- name: GetSeatsByCoach :many
 SELECT id, coachid, seatno, berth FROM seat WHERE coachId = $1
 `
@@ -381,7 +528,7 @@ func (q *Queries) GetSeatsByTrain(ctx context.Context, trainid pgtype.Int4) ([]S
 }
 
 const getTrainById = `-- name: GetTrainById :one
-SELECT id, trainnumber, trainname, source, destination FROM train
+SELECT id, trainnumber, trainname, source, destination, distance_km, is_superfast FROM train
 WHERE id = $1
 `
 
@@ -394,6 +541,8 @@ func (q *Queries) GetTrainById(ctx context.Context, id int32) (Train, error) {
 		&i.Trainname,
 		&i.Source,
 		&i.Destination,
+		&i.DistanceKm,
+		&i.IsSuperfast,
 	)
 	return i, err
 }
@@ -443,75 +592,191 @@ func (q *Queries) GetTrainScheduleByDay(ctx context.Context, arg GetTrainSchedul
 	return i, err
 }
 
-const holdSeat = `-- name: HoldSeat :exec
+const holdSeat = `-- name: HoldSeat :execrows
 
-UPDATE seat_inventory
-SET status = 'HELD',
-    booking_id = $3
-WHERE journey_id = $1
-  AND seat_id = $2
-  AND status = 'AVAILABLE'
+WITH held AS (
+    UPDATE seat_inventory
+    SET held_mask = held_mask | $1::bigint,
+        status = CASE WHEN confirmed_mask = 0 THEN 'HELD' ELSE status END
+    WHERE journey_id = $2
+      AND seat_id = $3
+      AND ((held_mask | confirmed_mask) & $1::bigint) = 0
+    RETURNING journey_id, seat_id
+)
+INSERT INTO seat_segment (journey_id, seat_id, booking_id, leg_mask, status)
+SELECT journey_id, seat_id, $4::int, $1::bigint, 'HELD'
+FROM held
 `
 
 type HoldSeatParams struct {
-	JourneyID int32       `json:"journey_id"`
-	SeatID    int32       `json:"seat_id"`
-	BookingID pgtype.Int4 `json:"booking_id"`
+	LegMask   int64 `json:"leg_mask"`
+	JourneyID int32 `json:"journey_id"`
+	SeatID    int32 `json:"seat_id"`
+	BookingID int32 `json:"booking_id"`
 }
 
 // below are not applied till now
-func (q *Queries) HoldSeat(ctx context.Context, arg HoldSeatParams) error {
-	_, err := q.db.Exec(ctx, holdSeat, arg.JourneyID, arg.SeatID, arg.BookingID)
-	return err
+func (q *Queries) HoldSeat(ctx context.Context, arg HoldSeatParams) (int64, error) {
+	result, err := q.db.Exec(ctx, holdSeat,
+		arg.LegMask,
+		arg.JourneyID,
+		arg.SeatID,
+		arg.BookingID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
 }
 
 const initializeSeatInventory = `-- name: InitializeSeatInventory :exec
+
+WITH seats AS (
+    SELECT
+        s.id,
+        s.seatNo,
+        c.coachNumber,
+        c.coachtype,
+        s.berth = 'SIDE_DOWN' AND c.coachtype IN ('SL', '3A') AS rac,
+        EXISTS (
+            SELECT 1 FROM tatkal_config tc
+            WHERE tc.train_id = c.trainId AND tc.coach_type = c.coachtype
+        ) AS tatkal
+    FROM seat s
+    JOIN coach c ON s.coachId = c.id
+    WHERE c.trainId = $2
+),
+ranked AS (
+    SELECT
+        seats.*,
+        ROW_NUMBER() OVER (PARTITION BY coachtype, rac ORDER BY seatNo, coachNumber) AS n,
+        COUNT(*) OVER (PARTITION BY coachtype, rac) AS total
+    FROM seats
+)
 INSERT INTO seat_inventory (journey_id, seat_id, coach_type, quota, status)
-SELECT 
-    $1,                   
-    s.id,
-    c.coachtype,
-    'NORMAL',              
+SELECT
+    $1,
+    r.id,
+    r.coachtype,
+    CASE
+        WHEN r.rac THEN 'RAC'
+        WHEN r.tatkal AND r.n <= FLOOR(r.total * $3::float / 100) THEN 'TATKAL'
+        ELSE 'NORMAL'
+    END::seat_quota,
     'AVAILABLE'
-FROM seat s
-JOIN coach c ON s.coachId = c.id
-WHERE c.trainId = $2
+FROM ranked r
 `
 
 type InitializeSeatInventoryParams struct {
-	JourneyID int32       `json:"journey_id"`
-	Trainid   pgtype.Int4 `json:"trainid"`
+	JourneyID     int32       `json:"journey_id"`
+	Trainid       pgtype.Int4 `json:"trainid"`
+	TatkalPercent float64     `json:"tatkal_percent"`
 }
 
+// side lower berths of SL and 3A go to the RAC quota. of the other seats of
+// a class with tatkal configured, tatkal_percent (rounded down) go to the
+// TATKAL quota, a berth number at a time across the coaches so that every
+// coach has some.
 func (q *Queries) InitializeSeatInventory(ctx context.Context, arg InitializeSeatInventoryParams) error {
-	_, err := q.db.Exec(ctx, initializeSeatInventory, arg.JourneyID, arg.Trainid)
+	_, err := q.db.Exec(ctx, initializeSeatInventory, arg.JourneyID, arg.Trainid, arg.TatkalPercent)
 	return err
 }
 
+const listFreeSeats = `-- name: ListFreeSeats :many
+
+SELECT
+    si.seat_id,
+    c.coachNumber AS coach_number,
+    s.seatNo AS seat_no,
+    s.berth,
+    ((si.held_mask | si.confirmed_mask) = 0)::boolean AS untouched
+FROM seat_inventory si
+JOIN seat s ON s.id = si.seat_id
+JOIN coach c ON c.id = s.coachId
+WHERE si.journey_id = $1
+  AND si.coach_type = $2
+  AND si.quota = $3
+  AND ((si.held_mask | si.confirmed_mask) & $4::bigint) = 0
+ORDER BY c.coachNumber, s.seatNo
+`
+
+type ListFreeSeatsParams struct {
+	JourneyID int32     `json:"journey_id"`
+	CoachType CoachType `json:"coach_type"`
+	Quota     SeatQuota `json:"quota"`
+	LegMask   int64     `json:"leg_mask"`
+}
+
+type ListFreeSeatsRow struct {
+	SeatID      int32     `json:"seat_id"`
+	CoachNumber int32     `json:"coach_number"`
+	SeatNo      int32     `json:"seat_no"`
+	Berth       BerthType `json:"berth"`
+	Untouched   bool      `json:"untouched"`
+}
+
+// free seats of a class with where they are in the train, for the allocator to
+// choose from. nothing is locked here, LockFreeSeats locks the chosen ones.
+func (q *Queries) ListFreeSeats(ctx context.Context, arg ListFreeSeatsParams) ([]ListFreeSeatsRow, error) {
+	rows, err := q.db.Query(ctx, listFreeSeats,
+		arg.JourneyID,
+		arg.CoachType,
+		arg.Quota,
+		arg.LegMask,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListFreeSeatsRow{}
+	for rows.Next() {
+		var i ListFreeSeatsRow
+		if err := rows.Scan(
+			&i.SeatID,
+			&i.CoachNumber,
+			&i.SeatNo,
+			&i.Berth,
+			&i.Untouched,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const lockAvailableSeats = `-- name: LockAvailableSeats :many
+
 SELECT seat_id
 FROM seat_inventory
 WHERE journey_id = $1
   AND coach_type = $2
   AND quota = $3
-  AND status = 'AVAILABLE'
-ORDER BY seat_id
+  AND ((held_mask | confirmed_mask) & $4::bigint) = 0
+ORDER BY (held_mask | confirmed_mask) = 0, seat_id
 FOR UPDATE SKIP LOCKED
-LIMIT $4
+LIMIT $5
 `
 
 type LockAvailableSeatsParams struct {
 	JourneyID int32     `json:"journey_id"`
 	CoachType CoachType `json:"coach_type"`
 	Quota     SeatQuota `json:"quota"`
+	LegMask   int64     `json:"leg_mask"`
 	SeatLimit int32     `json:"seat_limit"`
 }
 
+// seats that are already sold for other legs come first, so untouched seats
+// stay free for passengers travelling the whole route.
 func (q *Queries) LockAvailableSeats(ctx context.Context, arg LockAvailableSeatsParams) ([]int32, error) {
 	rows, err := q.db.Query(ctx, lockAvailableSeats,
 		arg.JourneyID,
 		arg.CoachType,
 		arg.Quota,
+		arg.LegMask,
 		arg.SeatLimit,
 	)
 	if err != nil {
@@ -532,6 +797,51 @@ func (q *Queries) LockAvailableSeats(ctx context.Context, arg LockAvailableSeats
 	return items, nil
 }
 
+const lockFreeSeats = `-- name: LockFreeSeats :many
+
+SELECT seat_id
+FROM seat_inventory
+WHERE journey_id = $1
+  AND seat_id = ANY($2::int[])
+  AND quota = $3
+  AND ((held_mask | confirmed_mask) & $4::bigint) = 0
+FOR UPDATE SKIP LOCKED
+`
+
+type LockFreeSeatsParams struct {
+	JourneyID int32     `json:"journey_id"`
+	SeatIds   []int32   `json:"seat_ids"`
+	Quota     SeatQuota `json:"quota"`
+	LegMask   int64     `json:"leg_mask"`
+}
+
+// locks those of the given seats that are still free for the legs. a seat
+// another booking has locked or taken since it was listed is left out.
+func (q *Queries) LockFreeSeats(ctx context.Context, arg LockFreeSeatsParams) ([]int32, error) {
+	rows, err := q.db.Query(ctx, lockFreeSeats,
+		arg.JourneyID,
+		arg.SeatIds,
+		arg.Quota,
+		arg.LegMask,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []int32{}
+	for rows.Next() {
+		var seat_id int32
+		if err := rows.Scan(&seat_id); err != nil {
+			return nil, err
+		}
+		items = append(items, seat_id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const lockTrainForLayout = `-- name: LockTrainForLayout :one
 SELECT id
 FROM train
@@ -545,34 +855,63 @@ func (q *Queries) LockTrainForLayout(ctx context.Context, id int32) (int32, erro
 	return id, err
 }
 
-const releaseExpiredSeats = `-- name: ReleaseExpiredSeats :exec
-UPDATE seat_inventory
-SET status = 'AVAILABLE',
-    booking_id = NULL
-WHERE status = 'HELD'
-AND booking_id IN (
-    SELECT id FROM booking
-    WHERE status = 'PENDING'
-    AND createdAt < now() - interval '5 minutes'
+const releaseSeatsByBooking = `-- name: ReleaseSeatsByBooking :exec
+WITH released AS (
+    DELETE FROM seat_segment
+    WHERE booking_id = $1
+    RETURNING journey_id, seat_id, leg_mask
 )
+UPDATE seat_inventory si
+SET held_mask = si.held_mask & ~r.leg_mask,
+    confirmed_mask = si.confirmed_mask & ~r.leg_mask,
+    status = CASE
+        WHEN (si.confirmed_mask & ~r.leg_mask) <> 0 THEN 'CONFIRMED'
+        WHEN (si.held_mask & ~r.leg_mask) <> 0 THEN 'HELD'
+        ELSE 'AVAILABLE'
+    END
+FROM released r
+WHERE si.journey_id = r.journey_id
+  AND si.seat_id = r.seat_id
 `
 
-func (q *Queries) ReleaseExpiredSeats(ctx context.Context) error {
-	_, err := q.db.Exec(ctx, releaseExpiredSeats)
+func (q *Queries) ReleaseSeatsByBooking(ctx context.Context, bookingID int32) error {
+	_, err := q.db.Exec(ctx, releaseSeatsByBooking, bookingID)
 	return err
 }
 
-const releaseSeatsByBooking = `-- name: ReleaseSeatsByBooking :exec
-UPDATE seat_inventory
-SET status = 'AVAILABLE',
-    booking_id = NULL
-WHERE status = 'HELD'
-AND booking_id = $1
+const releaseSeatsBySeats = `-- name: ReleaseSeatsBySeats :execrows
+WITH released AS (
+    DELETE FROM seat_segment
+    WHERE booking_id = $1
+      AND seat_id = ANY($2::int[])
+    RETURNING journey_id, seat_id, leg_mask
+)
+UPDATE seat_inventory si
+SET held_mask = si.held_mask & ~r.leg_mask,
+    confirmed_mask = si.confirmed_mask & ~r.leg_mask,
+    status = CASE
+        WHEN (si.confirmed_mask & ~r.leg_mask) <> 0 THEN 'CONFIRMED'
+        WHEN (si.held_mask & ~r.leg_mask) <> 0 THEN 'HELD'
+        ELSE 'AVAILABLE'
+    END
+FROM released r
+WHERE si.journey_id = r.journey_id
+  AND si.seat_id = r.seat_id
 `
 
-func (q *Queries) ReleaseSeatsByBooking(ctx context.Context, bookingID pgtype.Int4) error {
-	_, err := q.db.Exec(ctx, releaseSeatsByBooking, bookingID)
-	return err
+type ReleaseSeatsBySeatsParams struct {
+	BookingID int32   `json:"booking_id"`
+	SeatIds   []int32 `json:"seat_ids"`
+}
+
+// frees some of the seats of a booking and leaves the others held or sold.
+// a seat that was already released is not counted.
+func (q *Queries) ReleaseSeatsBySeats(ctx context.Context, arg ReleaseSeatsBySeatsParams) (int64, error) {
+	result, err := q.db.Exec(ctx, releaseSeatsBySeats, arg.BookingID, arg.SeatIds)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
 }
 
 const validateSchedule = `-- name: ValidateSchedule :one
@@ -33,8 +33,45 @@ func (q *Queries) DeleteWaitlist(ctx context.Context, bookingid pgtype.Int4) err
 	return err
 }
 
+const getNextPaidWaitlistByCoach = `-- name: GetNextPaidWaitlistByCoach :one
+
+SELECT w.id, w.journey_id, w.bookingid, w.waitlist_number, w.status, w.priority_level, w.createdat, w.updatedat, w.coach_type
+FROM waitlist w
+WHERE w.journey_id = $1
+  AND w.coach_type = $2
+  AND w.status = 'WAITING'
+  AND EXISTS (SELECT 1 FROM payment p WHERE p.bookingId = w.bookingId AND p.status = 'SUCCESS')
+ORDER BY w.priority_level DESC, w.waitlist_number ASC
+LIMIT 1
+FOR UPDATE OF w SKIP LOCKED
+`
+
+type GetNextPaidWaitlistByCoachParams struct {
+	JourneyID pgtype.Int4   `json:"journey_id"`
+	CoachType NullCoachType `json:"coach_type"`
+}
+
+// the next waitlisted booking of a class that has been paid for, only those
+// are moved to RAC
+func (q *Queries) GetNextPaidWaitlistByCoach(ctx context.Context, arg GetNextPaidWaitlistByCoachParams) (Waitlist, error) {
+	row := q.db.QueryRow(ctx, getNextPaidWaitlistByCoach, arg.JourneyID, arg.CoachType)
+	var i Waitlist
+	err := row.Scan(
+		&i.ID,
+		&i.JourneyID,
+		&i.Bookingid,
+		&i.WaitlistNumber,
+		&i.Status,
+		&i.PriorityLevel,
+		&i.Createdat,
+		&i.Updatedat,
+		&i.CoachType,
+	)
+	return i, err
+}
+
 const getNextWaitlist = `-- name: GetNextWaitlist :one
-SELECT id, journey_id, bookingid, waitlist_number, status, priority_level, createdat, updatedat
+SELECT id, journey_id, bookingid, waitlist_number, status, priority_level, createdat, updatedat, coach_type
 FROM waitlist
 WHERE journey_id = $1
   AND status = 'WAITING'
@@ -55,6 +92,40 @@ func (q *Queries) GetNextWaitlist(ctx context.Context, journeyID pgtype.Int4) (W
 		&i.PriorityLevel,
 		&i.Createdat,
 		&i.Updatedat,
+		&i.CoachType,
+	)
+	return i, err
+}
+
+const getNextWaitlistByCoach = `-- name: GetNextWaitlistByCoach :one
+SELECT id, journey_id, bookingid, waitlist_number, status, priority_level, createdat, updatedat, coach_type
+FROM waitlist
+WHERE journey_id = $1
+  AND coach_type = $2
+  AND status = 'WAITING'
+ORDER BY priority_level DESC, waitlist_number ASC
+LIMIT 1
+FOR UPDATE SKIP LOCKED
+`
+
+type GetNextWaitlistByCoachParams struct {
+	JourneyID pgtype.Int4   `json:"journey_id"`
+	CoachType NullCoachType `json:"coach_type"`
+}
+
+func (q *Queries) GetNextWaitlistByCoach(ctx context.Context, arg GetNextWaitlistByCoachParams) (Waitlist, error) {
+	row := q.db.QueryRow(ctx, getNextWaitlistByCoach, arg.JourneyID, arg.CoachType)
+	var i Waitlist
+	err := row.Scan(
+		&i.ID,
+		&i.JourneyID,
+		&i.Bookingid,
+		&i.WaitlistNumber,
+		&i.Status,
+		&i.PriorityLevel,
+		&i.Createdat,
+		&i.Updatedat,
+		&i.CoachType,
 	)
 	return i, err
 }
@@ -78,7 +149,7 @@ func (q *Queries) GetNextWaitlistNumber(ctx context.Context, journeyID pgtype.In
 }
 
 const getWaitlistBatch = `-- name: GetWaitlistBatch :many
-SELECT id, journey_id, bookingid, waitlist_number, status, priority_level, createdat, updatedat
+SELECT id, journey_id, bookingid, waitlist_number, status, priority_level, createdat, updatedat, coach_type
 FROM waitlist
 WHERE journey_id = $1
   AND status = 'WAITING'
@@ -109,6 +180,7 @@ func (q *Queries) GetWaitlistBatch(ctx context.Context, arg GetWaitlistBatchPara
 			&i.PriorityLevel,
 			&i.Createdat,
 			&i.Updatedat,
+			&i.CoachType,
 		); err != nil {
 			return nil, err
 		}
@@ -120,24 +192,121 @@ func (q *Queries) GetWaitlistBatch(ctx context.Context, arg GetWaitlistBatchPara
 	return items, nil
 }
 
+const getWaitlistByBooking = `-- name: GetWaitlistByBooking :one
+
+SELECT
+    w.waitlist_number,
+    w.status,
+    w.coach_type,
+    ((
+        SELECT COUNT(*)
+        FROM waitlist ahead
+        WHERE ahead.journey_id = w.journey_id
+          AND ahead.coach_type IS NOT DISTINCT FROM w.coach_type
+          AND ahead.status = 'WAITING'
+          AND (ahead.priority_level > w.priority_level
+               OR (ahead.priority_level = w.priority_level AND ahead.waitlist_number < w.waitlist_number))
+    ) + 1)::int AS position,
+    (
+        SELECT COUNT(*)
+        FROM waitlist ahead
+        JOIN booking_passenger bp ON bp.booking_id = ahead.bookingId
+        WHERE ahead.journey_id = w.journey_id
+          AND ahead.coach_type IS NOT DISTINCT FROM w.coach_type
+          AND ahead.status = 'WAITING'
+          AND (ahead.priority_level > w.priority_level
+               OR (ahead.priority_level = w.priority_level AND ahead.waitlist_number < w.waitlist_number))
+    )::int AS seats_ahead
+FROM waitlist w
+WHERE w.bookingId = $1
+ORDER BY w.id DESC
+LIMIT 1
+`
+
+type GetWaitlistByBookingRow struct {
+	WaitlistNumber int32         `json:"waitlist_number"`
+	Status         WaitingStatus `json:"status"`
+	CoachType      NullCoachType `json:"coach_type"`
+	Position       int32         `json:"position"`
+	SeatsAhead     int32         `json:"seats_ahead"`
+}
+
+// position is counted within the class, which is waitlisted and promoted on
+// its own. seats_ahead are the passengers of the bookings ahead.
+func (q *Queries) GetWaitlistByBooking(ctx context.Context, bookingid pgtype.Int4) (GetWaitlistByBookingRow, error) {
+	row := q.db.QueryRow(ctx, getWaitlistByBooking, bookingid)
+	var i GetWaitlistByBookingRow
+	err := row.Scan(
+		&i.WaitlistNumber,
+		&i.Status,
+		&i.CoachType,
+		&i.Position,
+		&i.SeatsAhead,
+	)
+	return i, err
+}
+
+const getWaitlistSeatsByJourneys = `-- name: GetWaitlistSeatsByJourneys :many
+SELECT w.journey_id, w.coach_type, COUNT(bp.id) AS seats
+FROM waitlist w
+JOIN booking_passenger bp ON bp.booking_id = w.bookingId
+WHERE w.journey_id = ANY($1::int[])
+  AND w.status = 'WAITING'
+  AND w.coach_type IS NOT NULL
+GROUP BY w.journey_id, w.coach_type
+`
+
+type GetWaitlistSeatsByJourneysRow struct {
+	JourneyID pgtype.Int4   `json:"journey_id"`
+	CoachType NullCoachType `json:"coach_type"`
+	Seats     int64         `json:"seats"`
+}
+
+func (q *Queries) GetWaitlistSeatsByJourneys(ctx context.Context, journeyIds []int32) ([]GetWaitlistSeatsByJourneysRow, error) {
+	rows, err := q.db.Query(ctx, getWaitlistSeatsByJourneys, journeyIds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []GetWaitlistSeatsByJourneysRow{}
+	for rows.Next() {
+		var i GetWaitlistSeatsByJourneysRow
+		if err := rows.Scan(&i.JourneyID, &i.CoachType, &i.Seats); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const insertWaitlist = `-- name: InsertWaitlist :exec
 INSERT INTO waitlist (
   journey_id,
   bookingId,
   waitlist_number,
+  coach_type,
   status
 )
-VALUES ($1, $2, $3, 'WAITING')
+VALUES ($1, $2, $3, $4, 'WAITING')
 `
 
 type InsertWaitlistParams struct {
-	JourneyID      pgtype.Int4 `json:"journey_id"`
-	Bookingid      pgtype.Int4 `json:"bookingid"`
-	WaitlistNumber int32       `json:"waitlist_number"`
+	JourneyID      pgtype.Int4   `json:"journey_id"`
+	Bookingid      pgtype.Int4   `json:"bookingid"`
+	WaitlistNumber int32         `json:"waitlist_number"`
+	CoachType      NullCoachType `json:"coach_type"`
 }
 
 func (q *Queries) InsertWaitlist(ctx context.Context, arg InsertWaitlistParams) error {
-	_, err := q.db.Exec(ctx, insertWaitlist, arg.JourneyID, arg.Bookingid, arg.WaitlistNumber)
+	_, err := q.db.Exec(ctx, insertWaitlist,
+		arg.JourneyID,
+		arg.Bookingid,
+		arg.WaitlistNumber,
+		arg.CoachType,
+	)
 	return err
 }
 
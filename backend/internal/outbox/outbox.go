@@ -0,0 +1,127 @@
+package outbox
+
+import (
+	"better-uptime/common/kafka"
+	"better-uptime/common/logger"
+	db "better-uptime/internal/db/sqlc"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Enqueue stores an event in the outbox using the caller's transaction, so the
+// event is published if and only if the transaction commits. dedupKey names
+// the change being announced; queueing the same key again is a no-op.
+func Enqueue(ctx context.Context, q db.Querier, topic, key, dedupKey string, event any) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %w", topic, err)
+	}
+
+	err = q.CreateOutboxEvent(ctx, db.CreateOutboxEventParams{
+		Topic:      topic,
+		MessageKey: key,
+		Payload:    payload,
+		DedupKey:   dedupKey,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to queue %s event: %w", topic, err)
+	}
+	return nil
+}
+
+// Relay publishes committed outbox events to Kafka in the order they were
+// written. Delivery is at-least-once: an event whose publish succeeded but
+// whose row could not be marked is sent again, so consumers must tolerate
+// duplicates (the booking consumers check the booking state first).
+type Relay struct {
+	store     db.Store
+	producer  kafka.Producer
+	batchSize int
+}
+
+func NewRelay(store db.Store, producer kafka.Producer, batchSize int) *Relay {
+	return &Relay{
+		store:     store,
+		producer:  producer,
+		batchSize: batchSize,
+	}
+}
+
+// Run polls the outbox every interval until ctx is done and once an hour drops
+// events published more than retentionHours ago.
+func (r *Relay) Run(ctx context.Context, interval time.Duration, retentionHours int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	cleanup := time.NewTicker(time.Hour)
+	defer cleanup.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-cleanup.C:
+			if err := r.store.DeletePublishedOutbox(ctx, int32(retentionHours)); err != nil {
+				logger.Error("outbox cleanup failed: %v", err)
+			}
+		case <-ticker.C:
+			if _, err := r.PublishPending(ctx); err != nil {
+				logger.Error("outbox relay failed: %v", err)
+			}
+		}
+	}
+}
+
+// PublishPending drains the outbox batch by batch. It stops at the first event
+// Kafka refuses so nothing queued after it overtakes it, and returns how many
+// events were published.
+func (r *Relay) PublishPending(ctx context.Context) (int, error) {
+	total := 0
+
+	for {
+		var published, pending int
+		var publishErr error
+
+		err := r.store.ExecTx(ctx, func(q *db.Queries) error {
+			published, publishErr = 0, nil
+
+			events, err := q.GetPendingOutbox(ctx, int32(r.batchSize))
+			if err != nil {
+				return err
+			}
+			pending = len(events)
+
+			for _, event := range events {
+				publishErr = r.producer.Publish(ctx, event.Topic, event.MessageKey, event.Payload)
+				if publishErr != nil {
+					return q.MarkOutboxFailed(ctx, db.MarkOutboxFailedParams{
+						ID:        event.ID,
+						LastError: pgtype.Text{String: publishErr.Error(), Valid: true},
+					})
+				}
+
+				if err := q.MarkOutboxPublished(ctx, event.ID); err != nil {
+					return err
+				}
+				published++
+			}
+
+			return nil
+		})
+		if err != nil {
+			return total, err
+		}
+
+		total += published
+		if publishErr != nil {
+			return total, fmt.Errorf("failed to publish outbox event: %w", publishErr)
+		}
+		if pending < r.batchSize {
+			return total, nil
+		}
+	}
+}
@@ -0,0 +1,304 @@
+package worker
+
+import (
+	"better-uptime/common/firebase"
+	"better-uptime/common/kafka"
+	"better-uptime/common/middleware"
+	"better-uptime/common/stripe"
+	"better-uptime/common/waitingroom"
+	"better-uptime/config"
+	"better-uptime/internal/api/booking"
+	"better-uptime/internal/api/fare"
+	"better-uptime/internal/db/dbtest"
+	db "better-uptime/internal/db/sqlc"
+	"better-uptime/internal/outbox"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	flowBookingId = 11
+	flowJourneyId = 3
+)
+
+var flowUser = uuid.MustParse("5f0c6a52-8d1e-4c8e-9a53-2f1d7c6b9e01")
+
+func flowConfig() *config.Config {
+	return &config.Config{
+		HOLD_TTL_SECONDS:               600,
+		KAFKA_TATKAL_TOPIC:             "tatkal_booking",
+		KAFKA_TATKAL_GROUP:             "tatkal-booking-group",
+		KAFKA_SEAT_TOPIC:               "seat_upgradation",
+		KAFKA_SEAT_GROUP:               "seat-upgradation-group",
+		KAFKA_DLQ_TOPIC:                "booking_dlq",
+		KAFKA_DLQ_GROUP:                "booking-dlq-group",
+		CONSUMER_MAX_ATTEMPTS:          1,
+		CONSUMER_RETRY_BASE_MS:         1,
+		CONSUMER_RETRY_MAX_MS:          1,
+		WAITING_ROOM_SECRET:            "0123456789abcdef0123456789abcdef",
+		WAITING_ROOM_ADMIT_PER_SECOND:  1000,
+		WAITING_ROOM_TOKEN_TTL_MINUTES: 30,
+	}
+}
+
+func flowBooking(status db.BookingStatus) db.Booking {
+	return db.Booking{
+		ID:          flowBookingId,
+		Userid:      pgtype.UUID{Bytes: flowUser, Valid: true},
+		JourneyID:   pgtype.Int4{Int32: flowJourneyId, Valid: true},
+		BookingType: db.BookingTypeTATKAL,
+		Status:      status,
+		Holdtoken:   pgtype.Text{String: "hold", Valid: true},
+		Pnr:         pgtype.Text{String: "4217650932", Valid: true},
+		LegMask:     1,
+	}
+}
+
+// flowPayment is the payment written when the booking was waitlisted, with
+// the page opened for it if there is one.
+func flowPayment(sessionUrl string) db.Payment {
+	return db.Payment{
+		ID:         6,
+		Bookingid:  pgtype.Int4{Int32: flowBookingId, Valid: true},
+		Amount:     1065.75,
+		Status:     db.NullPaymentStatus{PaymentStatus: db.PaymentStatusPENDING, Valid: true},
+		SessionUrl: pgtype.Text{String: sessionUrl, Valid: sessionUrl != ""},
+	}
+}
+
+// openTatkalJourney answers the queries a tatkal booking of a 3A berth on an
+// open journey reads, from the request through to its fare.
+func openTatkalJourney(data *dbtest.DB) {
+	data.Return("GetTrainJourneyById", db.TrainJourney{
+		ID:      flowJourneyId,
+		TrainID: pgtype.Int4{Int32: 7, Valid: true},
+		Status:  db.NullJourneyStatus{JourneyStatus: db.JourneyStatusOPEN, Valid: true},
+	})
+	data.Return("ValidateTatkalWindow", db.TatkalConfig{
+		TatkalStartTime: pgtype.Timestamp{Time: time.Now().Add(-time.Hour), Valid: true},
+		TatkalEndTime:   pgtype.Timestamp{Time: time.Now().Add(time.Hour), Valid: true},
+	})
+	data.Return("GetTrainById", db.Train{ID: 7, DistanceKm: 500})
+	data.Return("GetFareRule", db.FareRule{
+		CoachType:            db.CoachType3A,
+		BaseFarePerKm:        1.5,
+		MinDistanceKm:        200,
+		ReservationCharge:    40,
+		TatkalPremiumPercent: 30,
+		TatkalMinCharge:      100,
+		TatkalMaxCharge:      400,
+		GstPercent:           5,
+	})
+	data.Return("PnrExists", false)
+}
+
+// progressOf receives the stages a booking is pushed through on its stream
+// until one matches, and fails the test if a consumer gave up on a message
+// first.
+func progressOf(t *testing.T, data *dbtest.DB, stream <-chan *redis.Message, match func(booking.BookingProgress) bool) booking.BookingProgress {
+	t.Helper()
+
+	deadline := time.After(5 * time.Second)
+	for {
+		select {
+		case msg := <-stream:
+			var progress booking.BookingProgress
+			if err := json.Unmarshal([]byte(msg.Payload), &progress); err != nil {
+				t.Fatal(err)
+			}
+			if match(progress) {
+				return progress
+			}
+		case <-time.After(10 * time.Millisecond):
+			if calls := data.Calls("CreateDeadLetter"); len(calls) > 0 {
+				t.Fatalf("message dead-lettered: %v", calls[0].Args)
+			}
+		case <-deadline:
+			t.Fatal("booking did not get there")
+		}
+	}
+}
+
+func TestTatkalBookingIsWaitlistedAndPromoted(t *testing.T) {
+	cfg := flowConfig()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	transport, err := kafka.NewTransport(kafka.DriverMemory, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	producer, err := transport.Producer()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := dbtest.New()
+	store := data.Store()
+	gateway := stripe.NewFakeGateway("http://localhost", "http://localhost/webhook", "whsec_test")
+	h := booking.NewHandler(cfg, store, *rdb, producer, gateway)
+
+	consumers, err := NewBookingConsumers(cfg, transport, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		Run(ctx, consumers)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	stream := rdb.Subscribe(ctx, "booking:progress:11")
+	defer stream.Close()
+	if _, err := stream.Receive(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// every tatkal seat of the class is taken
+	mr.Set(fare.TatkalCounterKey(flowJourneyId, db.CoachType3A), "0")
+
+	// the user queues in the waiting room and is admitted
+	status, err := h.WaitingRoom.Join(ctx, flowJourneyId, string(db.CoachType3A), flowUser.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	openTatkalJourney(data)
+	data.Return("CreateQueuedBooking", flowBooking(db.BookingStatusQUEUED))
+
+	body, err := json.Marshal(booking.BookingRequest{
+		JourneyId:   flowJourneyId,
+		BookingType: db.BookingTypeTATKAL,
+		SeatCount:   1,
+		CoachType:   db.CoachType3A,
+		Passengers:  []booking.PassengerRequest{{Name: "Asha", Age: 30, Gender: "F"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/create-booking", bytes.NewReader(body))
+	req.Header.Set(waitingroom.TokenHeader, status.Token)
+	req = req.WithContext(context.WithValue(req.Context(), middleware.TokenPayloadKey, firebase.FirebasePayload{UserId: flowUser}))
+	w := httptest.NewRecorder()
+	h.CreateBooking(w, req)
+
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("create booking returned %d: %s", w.Code, w.Body)
+	}
+
+	// the relay publishes the job the booking wrote to the outbox
+	queued := data.Calls("CreateOutboxEvent")
+	if len(queued) != 1 {
+		t.Fatalf("%d outbox events written", len(queued))
+	}
+	data.Return("GetPendingOutbox", db.Outbox{
+		ID:         1,
+		Topic:      queued[0].Args[0].(string),
+		MessageKey: queued[0].Args[1].(string),
+		Payload:    queued[0].Args[2].([]byte),
+		DedupKey:   queued[0].Args[3].(string),
+	})
+
+	// the worker finds no tatkal seat and puts the booking on the tatkal
+	// waitlist, paid for up front
+	data.Return("GetBookingById", flowBooking(db.BookingStatusQUEUED))
+	data.Return("GetBookingById", flowBooking(db.BookingStatusWAITLIST))
+	data.Return("WaitlistQueuedBooking", int64(1))
+	data.Return("InsertTatkalWaitlist", db.TatkalWaitlist{ID: 5, BookingID: pgtype.Int4{Int32: flowBookingId, Valid: true}})
+	data.Return("CreateBookingPassenger", db.BookingPassenger{ID: 8})
+	data.Return("CreatePayment", db.Payment{ID: 6})
+	// read for its progress and by the checkout, which then opens its page
+	data.Return("GetLatestPaymentByBooking", flowPayment(""))
+	data.Return("GetLatestPaymentByBooking", flowPayment(""))
+	data.Return("GetLatestPaymentByBooking", flowPayment("http://localhost/checkout/waitlisted"))
+
+	relay := outbox.NewRelay(store, producer, 10)
+	if published, err := relay.PublishPending(ctx); err != nil || published != 1 {
+		t.Fatalf("relay published %d: %v", published, err)
+	}
+
+	waitlisted := progressOf(t, data, stream.Channel(), func(p booking.BookingProgress) bool {
+		return p.Stage == booking.StageWaitlist && p.PaymentURL != ""
+	})
+	if waitlisted.BookingID != flowBookingId {
+		t.Fatalf("progress of booking %d", waitlisted.BookingID)
+	}
+	if calls := data.Calls("HoldSeat"); len(calls) != 0 {
+		t.Fatalf("seats held without a tatkal seat left: %v", calls)
+	}
+
+	// a tatkal seat is given back and the head of the tatkal waitlist is
+	// promoted into it, with a hold to pay in
+	data.Return("GetNextTatkalWaitlist", db.TatkalWaitlist{ID: 5, BookingID: pgtype.Int4{Int32: flowBookingId, Valid: true}})
+	data.Return("GetNextTatkalWaitlist")
+	data.Return("GetBookingById", flowBooking(db.BookingStatusPENDING))
+	data.Return("GetPassengersByBooking", db.GetPassengersByBookingRow{ID: 8, Name: "Asha", Age: 30, Gender: "F"})
+	data.Return("ListFreeSeats", db.ListFreeSeatsRow{SeatID: 50, CoachNumber: 1, SeatNo: 1, Berth: db.BerthTypeDOWN})
+	data.Return("LockFreeSeats", int32(50))
+	data.Return("CreateBookingItem", db.Bookingitem{ID: 1})
+	data.Return("GetLatestPaymentByBooking", flowPayment("http://localhost/checkout/promoted"))
+
+	released, err := json.Marshal(booking.SeatReleasedEvent{
+		JourneyId:     flowJourneyId,
+		CoachType:     string(db.CoachType3A),
+		Quota:         string(db.SeatQuotaTATKAL),
+		ReleasedSeats: 1,
+		Timestamp:     time.Now().Unix(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := producer.Publish(ctx, cfg.KAFKA_SEAT_TOPIC, "3:3A", released); err != nil {
+		t.Fatal(err)
+	}
+
+	promoted := progressOf(t, data, stream.Channel(), func(p booking.BookingProgress) bool {
+		return p.Stage == booking.StagePaymentReady
+	})
+	if promoted.ExpiresAt == nil {
+		t.Errorf("promoted booking has no hold expiry: %+v", promoted)
+	}
+
+	held := data.Calls("HoldSeat")
+	if len(held) != 1 || held[0].Args[2] != int32(50) || held[0].Args[3] != int32(flowBookingId) {
+		t.Fatalf("seats held %v", held)
+	}
+	if calls := data.Calls("UpdateTatkalWaitlistStatus"); len(calls) != 1 {
+		t.Errorf("tatkal waitlist place not closed: %v", calls)
+	}
+	if calls := data.Calls("HoldPromotedBooking"); len(calls) != 1 {
+		t.Errorf("promoted booking not put on hold: %v", calls)
+	}
+	// one page while waitlisted, one for the hold
+	if calls := data.Calls("UpdatePaymentSession"); len(calls) != 2 {
+		t.Errorf("%d payment pages opened", len(calls))
+	}
+	if calls := data.Calls("FailQueuedBooking"); len(calls) != 0 {
+		t.Errorf("booking failed: %v", calls)
+	}
+
+	// the queue token let one booking through and stays used
+	_, err = h.WaitingRoom.Verify(ctx, status.Token, flowUser.String(), flowJourneyId, string(db.CoachType3A))
+	if !errors.Is(err, waitingroom.ErrTokenUsed) {
+		t.Errorf("queue token after booking: %v", err)
+	}
+}
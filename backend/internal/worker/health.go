@@ -0,0 +1,35 @@
+package worker
+
+import (
+	"better-uptime/common/kafka"
+	"better-uptime/common/util"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// HealthRoutes reports every consumer; the worker is unhealthy as soon as one
+// of them is not consuming, so an orchestrator can restart it.
+func HealthRoutes(consumers []kafka.Consumer) *chi.Mux {
+	router := chi.NewRouter()
+
+	router.Get("/health", func(w http.ResponseWriter, r *http.Request) {
+		status := http.StatusOK
+		report := make([]kafka.ConsumerHealth, 0, len(consumers))
+
+		for _, c := range consumers {
+			health := c.Health()
+			if health.Status != kafka.StatusConsuming {
+				status = http.StatusServiceUnavailable
+			}
+			report = append(report, health)
+		}
+
+		util.WriteJson(w, status, map[string]interface{}{
+			"message": http.StatusText(status),
+			"data":    report,
+		})
+	})
+
+	return router
+}
@@ -0,0 +1,70 @@
+package worker
+
+import (
+	"better-uptime/common/kafka"
+	"better-uptime/common/logger"
+	"better-uptime/config"
+	"better-uptime/internal/api/booking"
+	"context"
+	"fmt"
+	"sync"
+)
+
+// NewBookingConsumers builds the consumers of the booking flow: tatkal jobs,
+// waitlist promotion on released seats, and storing dead letters.
+func NewBookingConsumers(cfg *config.Config, transport *kafka.Transport, h *booking.Handler) ([]kafka.Consumer, error) {
+	tatkalConsumer, err := transport.Consumer(
+		"tatkal-consumer",
+		cfg.KAFKA_TATKAL_GROUP,
+		cfg.KAFKA_TATKAL_TOPIC,
+		h.TatkalConsumer(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create tatkal consumer: %w", err)
+	}
+
+	seatConsumer, err := transport.Consumer(
+		"seat-consumer",
+		cfg.KAFKA_SEAT_GROUP,
+		cfg.KAFKA_SEAT_TOPIC,
+		h.SeatConsumer(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create seat consumer: %w", err)
+	}
+
+	deadLetterConsumer, err := transport.Consumer(
+		"dead-letter-consumer",
+		cfg.KAFKA_DLQ_GROUP,
+		cfg.KAFKA_DLQ_TOPIC,
+		h.DeadLetterConsumer(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create dead letter consumer: %w", err)
+	}
+
+	return []kafka.Consumer{tatkalConsumer, seatConsumer, deadLetterConsumer}, nil
+}
+
+// Run consumes until ctx is done, then closes every consumer and waits for
+// them to return. Close waits for the in-flight message of each claim, so a
+// booking is never cut off halfway through its transaction.
+func Run(ctx context.Context, consumers []kafka.Consumer) {
+	var wg sync.WaitGroup
+	for _, c := range consumers {
+		wg.Add(1)
+		go func(c kafka.Consumer) {
+			defer wg.Done()
+			c.Start(ctx)
+		}(c)
+	}
+
+	<-ctx.Done()
+
+	for _, c := range consumers {
+		if err := c.Close(); err != nil {
+			logger.Error("closing consumer: %v", err)
+		}
+	}
+	wg.Wait()
+}
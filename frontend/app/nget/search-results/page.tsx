@@ -6,17 +6,38 @@ import { apiFetch } from '@/lib/api'
 import Navbar from '@/app/_components/Navbar'
 import Footer from '@/app/_components/Footer'
 
+interface ClassAvailability {
+    coach_type: string
+    available_seats: number
+    total_seats: number
+    fare: number
+}
+
 interface Train {
-    id: number
-    trainnumber: number
-    trainname: string
-    source: string
-    destination: string
-    day: string
-    arrivaltime: string
-    departuretime: string
+    train_id: number
+    train_number: number
+    train_name: string
+    journey_id: number
+    from_code: string
+    to_code: string
+    departure_time: string
+    arrival_time: string
+    duration_minutes: number
+    classes: ClassAvailability[]
+}
+
+// "New Delhi (NDLS)" -> "NDLS"
+const stationCode = (value: string | null) => {
+    if (!value) return ''
+    const match = value.match(/\(([A-Za-z]+)\)/)
+    return (match ? match[1] : value).trim().toUpperCase()
 }
 
+const formatTime = (value: string) =>
+    new Date(value).toLocaleTimeString('en-IN', { hour: '2-digit', minute: '2-digit', timeZone: 'Asia/Kolkata' })
+
+const formatDuration = (minutes: number) => `${Math.floor(minutes / 60)}h ${minutes % 60}m`
+
 export default function SearchResultsPage() {
     const searchParams = useSearchParams()
     const from = searchParams.get('from')
@@ -29,8 +50,9 @@ export default function SearchResultsPage() {
 
     const handleBook = (train: Train, cls: string) => {
         const params = new URLSearchParams({
-            train_id: train.id.toString(),
-            train_name: train.trainname,
+            train_id: train.train_id.toString(),
+            journey_id: train.journey_id.toString(),
+            train_name: train.train_name,
             date: date || '',
             class: cls
         })
@@ -40,23 +62,13 @@ export default function SearchResultsPage() {
     useEffect(() => {
         const fetchTrains = async () => {
             try {
-                // Since backend GetAllTrain is Admin only, we might hit an issue.
-                // However, we'll try to fetch all and filter locally for now.
-                const res = await apiFetch('/train/all-train')
-                let filteredTrains = res.data
-
-                if (from) {
-                    filteredTrains = filteredTrains.filter((t: Train) =>
-                        t.source.toLowerCase().includes(from.split(' ')[0].toLowerCase())
-                    )
-                }
-                if (to) {
-                    filteredTrains = filteredTrains.filter((t: Train) =>
-                        t.destination.toLowerCase().includes(to.split(' ')[0].toLowerCase())
-                    )
-                }
-
-                setTrains(filteredTrains)
+                const params = new URLSearchParams({
+                    from: stationCode(from),
+                    to: stationCode(to),
+                    date: date || '',
+                })
+                const res = await apiFetch(`/train/search?${params.toString()}`)
+                setTrains(res.data)
             } catch (err: any) {
                 setError(err.message)
             } finally {
@@ -65,7 +77,7 @@ export default function SearchResultsPage() {
         }
 
         fetchTrains()
-    }, [from, to])
+    }, [from, to, date])
 
     return (
         <div className="min-h-screen bg-[#f7f7f5] flex flex-col">
@@ -114,7 +126,7 @@ export default function SearchResultsPage() {
                         <div className="text-center py-20 text-gray-400 font-bold animate-pulse">Searching for best routes...</div>
                     ) : error ? (
                         <div className="bg-red-50 border border-red-100 text-red-500 p-6 rounded-3xl text-center font-bold">
-                            {error === "Unauthorized" ? "Please sign in to search trains." : error}
+                            {error}
                         </div>
                     ) : trains.length === 0 ? (
                         <div className="bg-white border border-gray-100 p-12 rounded-[32px] text-center space-y-4">
@@ -127,44 +139,47 @@ export default function SearchResultsPage() {
                     ) : (
                         <div className="grid gap-4">
                             {trains.map((train) => (
-                                <div key={train.id} className="bg-white rounded-[32px] border border-gray-100 p-8 shadow-[0_8px_30px_rgba(0,0,0,0.02)] hover:shadow-[0_8px_40px_rgba(0,0,0,0.06)] hover:border-gray-200 transition-all group">
+                                <div key={train.journey_id} className="bg-white rounded-[32px] border border-gray-100 p-8 shadow-[0_8px_30px_rgba(0,0,0,0.02)] hover:shadow-[0_8px_40px_rgba(0,0,0,0.06)] hover:border-gray-200 transition-all group">
                                     <div className="flex flex-col md:flex-row md:items-center justify-between gap-8">
 
                                         {/* Train Info */}
                                         <div className="space-y-4">
                                             <div className="flex items-center gap-3">
                                                 <div className="bg-gray-900 text-white px-3 py-1 rounded-lg font-black text-[10px] tracking-wider uppercase">
-                                                    {train.trainnumber}
+                                                    {train.train_number}
                                                 </div>
-                                                <h4 className="text-xl font-black text-gray-900 group-hover:text-black transition-colors">{train.trainname}</h4>
+                                                <h4 className="text-xl font-black text-gray-900 group-hover:text-black transition-colors">{train.train_name}</h4>
                                             </div>
                                             <div className="flex items-center gap-8 text-gray-400">
                                                 <div className="flex items-center gap-2">
                                                     <FaClock size={12} />
-                                                    <span className="text-xs font-bold uppercase tracking-widest">{train.departuretime}</span>
+                                                    <span className="text-xs font-bold uppercase tracking-widest">{formatTime(train.departure_time)} - {formatTime(train.arrival_time)}</span>
                                                 </div>
                                                 <div className="w-px h-3 bg-gray-200 line-through" />
-                                                <span className="text-xs font-bold uppercase tracking-widest">Runs on: {train.day}</span>
+                                                <span className="text-xs font-bold uppercase tracking-widest">{formatDuration(train.duration_minutes)}</span>
                                             </div>
                                         </div>
 
                                         {/* Classes/Pricing */}
                                         <div className="flex flex-wrap gap-3">
-                                            {['SL', '3A', '2A', '1A'].map((cls) => (
+                                            {train.classes.map((cls) => (
                                                 <button
-                                                    key={cls}
+                                                    key={cls.coach_type}
+                                                    onClick={() => handleBook(train, cls.coach_type)}
                                                     className="px-6 py-4 rounded-2xl border border-gray-100 hover:border-gray-900 hover:bg-gray-900 hover:text-white transition-all text-left min-w-[120px] group/btn"
                                                 >
                                                     <div className="text-[10px] font-black uppercase tracking-widest mb-1 group-hover/btn:text-gray-400">Class</div>
-                                                    <div className="text-sm font-black">{cls}</div>
-                                                    <div className="text-xs font-bold text-green-500 mt-2">Available</div>
+                                                    <div className="text-sm font-black">{cls.coach_type} · ₹{cls.fare}</div>
+                                                    <div className={`text-xs font-bold mt-2 ${cls.available_seats > 0 ? 'text-green-500' : 'text-orange-500'}`}>
+                                                        {cls.available_seats > 0 ? `Available ${cls.available_seats}` : 'Waitlist'}
+                                                    </div>
                                                 </button>
                                             ))}
                                         </div>
 
                                         {/* Action */}
                                         <button
-                                            onClick={() => handleBook(train, 'SL')}
+                                            onClick={() => handleBook(train, train.classes[0]?.coach_type || 'SL')}
                                             className="bg-gray-900 text-white px-8 py-5 rounded-[20px] font-black text-sm hover:bg-gray-700 transition-all shadow-xl shadow-gray-200"
                                         >
                                             Book Now